@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// alertRules are the rules of an --alert-rules file.
+type alertRules struct {
+	Rules []alertRule `json:"rules"`
+}
+
+// alertRule opens an incident for a table once its drift crosses a level
+// for Rounds rounds in a row, and resolves it on the first round it doesn't.
+// A round crosses the level when any of the rule's conditions holds.
+type alertRule struct {
+	Name string `json:"name"`
+	// Tables are the patterns of the tables the rule applies to, like
+	// --include's, and all of them when empty.
+	Tables []string `json:"tables,omitempty"`
+	// MaxDiff and MaxDiffPct are the drift a table tolerates, like its
+	// threshold's.
+	MaxDiff    *int     `json:"max_diff,omitempty"`
+	MaxDiffPct *float64 `json:"max_diff_pct,omitempty"`
+	// MaxGrowth is how much the drift may grow from one round to the next.
+	MaxGrowth *int `json:"max_growth,omitempty"`
+	// Errors counts rounds the table couldn't be compared in. Otherwise
+	// those rounds neither count nor resolve the incident.
+	Errors bool `json:"errors,omitempty"`
+	// Rounds is how many rounds in a row the level has to be crossed in
+	// before the incident opens, 1 when unset.
+	Rounds int `json:"rounds,omitempty"`
+	// Severity is PagerDuty's: critical, the default, error, warning or
+	// info, mapped to Opsgenie's priorities P1, P2, P3 and P5.
+	Severity string `json:"severity,omitempty"`
+
+	tables dbdiff.TablePatterns
+}
+
+// alertSeverities maps PagerDuty's severities to Opsgenie's priorities.
+var alertSeverities = map[string]string{"critical": "P1", "error": "P2", "warning": "P3", "info": "P5"}
+
+func loadAlertRules(path string) ([]alertRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file alertRules
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(file.Rules) == 0 {
+		return nil, fmt.Errorf("%s has no rules", path)
+	}
+	names := map[string]bool{}
+	for i := range file.Rules {
+		rule := &file.Rules[i]
+		// the name identifies the rule's incidents
+		if rule.Name == "" {
+			return nil, fmt.Errorf("%s: rule %d has no name", path, i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("%s: there are several rules named %s", path, rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.MaxDiff == nil && rule.MaxDiffPct == nil && rule.MaxGrowth == nil && !rule.Errors {
+			return nil, fmt.Errorf("%s: rule %s sets none of max_diff, max_diff_pct, max_growth and errors", path, rule.Name)
+		}
+		if rule.Rounds < 0 {
+			return nil, fmt.Errorf("%s: rule %s: rounds must not be negative", path, rule.Name)
+		}
+		if rule.Rounds == 0 {
+			rule.Rounds = 1
+		}
+		if rule.Severity == "" {
+			rule.Severity = "critical"
+		}
+		if _, ok := alertSeverities[rule.Severity]; !ok {
+			return nil, fmt.Errorf("%s: rule %s: unknown severity %q (available: critical, error, warning, info)", path, rule.Name, rule.Severity)
+		}
+		for _, pattern := range rule.Tables {
+			if err := rule.tables.Set(pattern); err != nil {
+				return nil, fmt.Errorf("%s: rule %s: %w", path, rule.Name, err)
+			}
+		}
+	}
+	return file.Rules, nil
+}
+
+// crossed reports why the table's round crosses the rule's level, or
+// nothing. previous is the table's drift in the previous round, if any.
+func (r alertRule) crossed(table dbdiff.TableResult, mode string, previous *int) string {
+	if table.Err != nil {
+		return "couldn't be compared: " + table.Err.Error()
+	}
+	diff, total := table.Drift(mode)
+	switch {
+	case r.MaxDiff != nil && abs(diff) > *r.MaxDiff:
+		return fmt.Sprintf("drift of %d over %d", diff, *r.MaxDiff)
+	case r.MaxDiffPct != nil && dbdiff.DriftPct(diff, total) > *r.MaxDiffPct:
+		return fmt.Sprintf("drift of %.2f%% over %.2f%%", dbdiff.DriftPct(diff, total), *r.MaxDiffPct)
+	case r.MaxGrowth != nil && previous != nil && abs(diff)-abs(*previous) > *r.MaxGrowth:
+		return fmt.Sprintf("drift grew by %d, from %d to %d, over %d", abs(diff)-abs(*previous), *previous, diff, *r.MaxGrowth)
+	}
+	return ""
+}
+
+// incident is an alert about a table, opened and resolved by its key.
+type incident struct {
+	Key      string
+	Summary  string
+	Severity string
+	Details  map[string]interface{}
+}
+
+// incidentService opens and resolves incidents in an on-call service.
+type incidentService interface {
+	name() string
+	open(incident incident) error
+	resolve(incident incident) error
+}
+
+// alertState is a rule's state for a table: how many rounds in a row it
+// crossed the level in, and the services whose incident is open.
+type alertState struct {
+	streak int
+	open   map[string]bool
+}
+
+// alerter evaluates the alert rules after every round of a watch or a
+// schedule. Incidents are only tracked for the life of the process, so one
+// left open by a previous run is resolved by hand.
+type alerter struct {
+	rules    []alertRule
+	services []incidentService
+	states   map[string]*alertState
+	// previous is every table's drift in the last round it was compared in
+	previous map[resultKey]int
+}
+
+// newAlerter sets up the services whose credentials are in the
+// environment, which may be secret references:
+//
+//	PAGERDUTY_ROUTING_KEY=...  the integration key of a PagerDuty service
+//	OPSGENIE_API_KEY=...       an Opsgenie API integration's key
+//
+// OPSGENIE_URL points to Opsgenie's EU instance, https://api.eu.opsgenie.com,
+// and PAGERDUTY_URL to another Events API v2 endpoint.
+func newAlerter(rules []alertRule) (*alerter, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	a := &alerter{rules: rules, states: map[string]*alertState{}, previous: map[resultKey]int{}}
+	key, err := secretEnv("PAGERDUTY_ROUTING_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		a.services = append(a.services, &pagerDuty{envOr("PAGERDUTY_URL", "https://events.pagerduty.com/v2/enqueue"), key, client})
+	}
+	if key, err = secretEnv("OPSGENIE_API_KEY"); err != nil {
+		return nil, err
+	}
+	if key != "" {
+		a.services = append(a.services, &opsgenie{strings.TrimSuffix(envOr("OPSGENIE_URL", "https://api.opsgenie.com"), "/"), key, client})
+	}
+	if len(a.services) == 0 {
+		return nil, fmt.Errorf("alert rules need PAGERDUTY_ROUTING_KEY or OPSGENIE_API_KEY")
+	}
+	return a, nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// evaluate applies the rules to a round's results, opening and resolving
+// incidents. A service that fails is retried the next round.
+func (a *alerter) evaluate(tableDiffs []dbdiff.TableResult, mode string) {
+	for _, table := range tableDiffs {
+		var previous *int
+		if diff, ok := a.previous[keyOf(table)]; ok {
+			previous = &diff
+		}
+		for _, rule := range a.rules {
+			if len(rule.tables) > 0 && !rule.tables.Matches(table.Name) {
+				continue
+			}
+			if table.Err != nil && !rule.Errors {
+				continue
+			}
+			key := strings.Join([]string{"databasediff", rule.Name, table.Name, table.Source, table.Dest}, "/")
+			state := a.states[key]
+			if state == nil {
+				state = &alertState{open: map[string]bool{}}
+				a.states[key] = state
+			}
+			reason := rule.crossed(table, mode, previous)
+			diff, total := table.Drift(mode)
+			alert := incident{
+				Key:      key,
+				Summary:  fmt.Sprintf("databasediff: %s between %s and %s: %s", table.Name, table.Source, table.Dest, reason),
+				Severity: rule.Severity,
+				Details: map[string]interface{}{
+					"rule": rule.Name, "table": table.Name, "source": table.Source, "dest": table.Dest,
+					"mode": mode, "diff": diff, "total": total, "status": table.Status(),
+				},
+			}
+			if reason == "" {
+				state.streak = 0
+				for _, service := range a.services {
+					if !state.open[service.name()] {
+						continue
+					}
+					if err := service.resolve(alert); err != nil {
+						logger.Errorw("Couldn't resolve the incident", "service", service.name(), "rule", rule.Name, "table", table.Name, "error", err)
+						continue
+					}
+					delete(state.open, service.name())
+					logger.Infow("Resolved the incident", "service", service.name(), "rule", rule.Name, "table", table.Name)
+				}
+				continue
+			}
+			state.streak++
+			if state.streak < rule.Rounds {
+				continue
+			}
+			for _, service := range a.services {
+				if state.open[service.name()] {
+					continue
+				}
+				if err := service.open(alert); err != nil {
+					logger.Errorw("Couldn't open the incident", "service", service.name(), "rule", rule.Name, "table", table.Name, "error", err)
+					continue
+				}
+				state.open[service.name()] = true
+				logger.Warnw("Opened an incident", "service", service.name(), "rule", rule.Name, "table", table.Name, "reason", reason)
+			}
+		}
+		if table.Err == nil {
+			diff, _ := table.Drift(mode)
+			a.previous[keyOf(table)] = diff
+		}
+	}
+}
+
+// pagerDuty sends events to the Events API v2, deduplicated by the
+// incident's key.
+type pagerDuty struct {
+	url, routingKey string
+	client          *http.Client
+}
+
+func (p *pagerDuty) name() string { return "pagerduty" }
+
+func (p *pagerDuty) open(incident incident) error {
+	return p.send(map[string]interface{}{
+		"routing_key": p.routingKey, "event_action": "trigger", "dedup_key": incident.Key,
+		"payload": map[string]interface{}{
+			"summary": incident.Summary, "source": "databasediff", "severity": incident.Severity,
+			"custom_details": incident.Details,
+		},
+	})
+}
+
+func (p *pagerDuty) resolve(incident incident) error {
+	return p.send(map[string]interface{}{"routing_key": p.routingKey, "event_action": "resolve", "dedup_key": incident.Key})
+}
+
+func (p *pagerDuty) send(event map[string]interface{}) error {
+	return postJSON(p.client, p.url, nil, event)
+}
+
+// opsgenie creates alerts through the Alert API, aliased by the incident's
+// key, and closes them by it.
+type opsgenie struct {
+	url, apiKey string
+	client      *http.Client
+}
+
+func (o *opsgenie) name() string { return "opsgenie" }
+
+func (o *opsgenie) open(incident incident) error {
+	details := make(map[string]string, len(incident.Details))
+	for key, value := range incident.Details {
+		details[key] = fmt.Sprint(value)
+	}
+	// messages are limited to 130 characters
+	message := incident.Summary
+	if len(message) > 130 {
+		message = message[:127] + "..."
+	}
+	return postJSON(o.client, o.url+"/v2/alerts", o.header(), map[string]interface{}{
+		"message": message, "alias": incident.Key, "description": incident.Summary,
+		"priority": alertSeverities[incident.Severity], "details": details, "tags": []string{"databasediff"},
+	})
+}
+
+func (o *opsgenie) resolve(incident incident) error {
+	return postJSON(o.client, o.url+"/v2/alerts/"+url.PathEscape(incident.Key)+"/close?identifierType=alias", o.header(),
+		map[string]interface{}{"source": "databasediff"})
+}
+
+func (o *opsgenie) header() http.Header {
+	return http.Header{"Authorization": {"GenieKey " + o.apiKey}}
+}
+
+// postJSON posts the body, failing on a status other than 2xx. Errors only
+// name the host, as URLs may hold keys.
+func postJSON(client *http.Client, endpoint string, header http.Header, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	host := req.URL.Host
+	resp, err := client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// baseline is the drift accepted for each table, such as the rows a
+// destination keeping 90 days lacks, so only deviations from it count
+// against the thresholds.
+type baseline struct {
+	// Mode is the comparison mode the drift was measured in.
+	Mode   string          `json:"mode"`
+	Tables []baselineTable `json:"tables"`
+}
+
+// baselineTable is the drift accepted for a table, against one destination
+// when Dest is set and all of them otherwise.
+type baselineTable struct {
+	Table string `json:"table"`
+	Dest  string `json:"dest,omitempty"`
+	Diff  int    `json:"diff"`
+	// Ignore accepts any drift, for tables known to diverge.
+	Ignore bool `json:"ignore,omitempty"`
+}
+
+func loadBaseline(path, mode string) (*baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// drift in other modes is measured in other units
+	if b.Mode != "" && b.Mode != mode {
+		return nil, fmt.Errorf("%s: the baseline is of %s mode, not %s", path, b.Mode, mode)
+	}
+	for i, table := range b.Tables {
+		if table.Table == "" {
+			return nil, fmt.Errorf("%s: table %d has no name", path, i+1)
+		}
+	}
+	return &b, nil
+}
+
+// accepted returns the entry of the table, preferring one for its
+// destination, or nil.
+func (b *baseline) accepted(table dbdiff.TableResult) *baselineTable {
+	var found *baselineTable
+	for i, entry := range b.Tables {
+		if entry.Table != table.Name {
+			continue
+		}
+		if entry.Dest == table.Dest {
+			return &b.Tables[i]
+		}
+		if entry.Dest == "" {
+			found = &b.Tables[i]
+		}
+	}
+	return found
+}
+
+// deviation is how far the table's drift is from the accepted drift, and
+// whether it's ignored altogether.
+func (b *baseline) deviation(table dbdiff.TableResult, diff int) (int, bool) {
+	if b == nil {
+		return diff, false
+	}
+	entry := b.accepted(table)
+	if entry == nil {
+		return diff, false
+	}
+	if entry.Ignore {
+		return 0, true
+	}
+	if diff -= entry.Diff; diff < 0 {
+		diff = -diff
+	}
+	return diff, false
+}
+
+// writeBaseline records the drift of every compared table as accepted, for
+// --baseline of later runs. Tables that failed are left out.
+func writeBaseline(path, mode string, tableDiffs []dbdiff.TableResult, dests int) error {
+	b := baseline{Mode: mode, Tables: []baselineTable{}}
+	for _, table := range tableDiffs {
+		if table.Err != nil {
+			continue
+		}
+		diff, _ := table.Drift(mode)
+		entry := baselineTable{Table: table.Name, Diff: diff}
+		if dests > 1 {
+			entry.Dest = table.Dest
+		}
+		b.Tables = append(b.Tables, entry)
+	}
+	// in order, to diff against the previous baseline
+	sort.SliceStable(b.Tables, func(i, j int) bool {
+		if b.Tables[i].Table != b.Tables[j].Table {
+			return b.Tables[i].Table < b.Tables[j].Table
+		}
+		return b.Tables[i].Dest < b.Tables[j].Dest
+	})
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
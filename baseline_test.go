@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"databasediff/pkg/dbdiff"
+)
+
+func TestLoadBaseline(t *testing.T) {
+	for _, test := range []struct {
+		name, json string
+		err        string
+	}{
+		{"baseline", `{"mode": "count", "tables": [{"table": "orders", "diff": -3}, {"table": "audit", "ignore": true}]}`, ""},
+		{"without a mode", `{"tables": [{"table": "orders", "diff": 3}]}`, ""},
+		{"other mode", `{"mode": "rows", "tables": []}`, "the baseline is of rows mode, not count"},
+		{"table without a name", `{"tables": [{"table": "orders"}, {"diff": 3}]}`, "table 2 has no name"},
+		{"not json", `{"tables": `, "unexpected end of JSON input"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "baseline.json")
+			if err := os.WriteFile(path, []byte(test.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadBaseline(path, dbdiff.ModeCount)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestBaselineAccepted(t *testing.T) {
+	b := &baseline{Tables: []baselineTable{
+		{Table: "orders", Dest: "eu", Diff: 1},
+		{Table: "orders", Diff: 2},
+		{Table: "orders", Dest: "us", Diff: 3},
+	}}
+	for dest, want := range map[string]int{"eu": 1, "us": 3, "apac": 2} {
+		entry := b.accepted(dbdiff.TableResult{Name: "orders", Dest: dest})
+		if entry == nil || entry.Diff != want {
+			t.Errorf("accepted for %s is %+v, want a diff of %d", dest, entry, want)
+		}
+	}
+	if entry := b.accepted(dbdiff.TableResult{Name: "users"}); entry != nil {
+		t.Errorf("accepted %+v for a table not in the baseline", entry)
+	}
+}
+
+func TestBaselineDeviation(t *testing.T) {
+	b := &baseline{Tables: []baselineTable{{Table: "orders", Diff: 5}, {Table: "audit", Ignore: true}}}
+	for _, test := range []struct {
+		name    string
+		b       *baseline
+		table   string
+		diff    int
+		want    int
+		ignored bool
+	}{
+		{"no baseline", nil, "orders", -7, -7, false},
+		{"not in the baseline", b, "users", 7, 7, false},
+		{"as accepted", b, "orders", 5, 0, false},
+		{"more", b, "orders", 8, 3, false},
+		{"less", b, "orders", 2, 3, false},
+		{"the other way", b, "orders", -5, 10, false},
+		{"ignored", b, "audit", 100, 0, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ignored := test.b.deviation(dbdiff.TableResult{Name: test.table}, test.diff)
+			if got != test.want || ignored != test.ignored {
+				t.Errorf("got %d, %t, want %d, %t", got, ignored, test.want, test.ignored)
+			}
+		})
+	}
+}
+
+func TestWriteBaseline(t *testing.T) {
+	failed := counted("broken", 1, 0)
+	failed.Err = errors.New("timeout")
+	eu, us := counted("users", 10, 12), counted("users", 10, 10)
+	eu.Dest, us.Dest = "eu", "us"
+	tables := []dbdiff.TableResult{counted("orders", 100, 97), failed, us, eu}
+
+	for _, test := range []struct {
+		name  string
+		dests int
+		want  []baselineTable
+	}{
+		{"one destination", 1, []baselineTable{{Table: "orders", Diff: 3}, {Table: "users", Diff: 0}, {Table: "users", Diff: -2}}},
+		{"several destinations", 2, []baselineTable{{Table: "orders", Dest: "dest", Diff: 3}, {Table: "users", Dest: "eu", Diff: -2}, {Table: "users", Dest: "us", Diff: 0}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "baseline.json")
+			if err := writeBaseline(path, dbdiff.ModeCount, tables, test.dests); err != nil {
+				t.Fatal(err)
+			}
+			b, err := loadBaseline(path, dbdiff.ModeCount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.Mode != dbdiff.ModeCount || !reflect.DeepEqual(b.Tables, test.want) {
+				t.Errorf("wrote %+v, want %+v", b, test.want)
+			}
+		})
+	}
+}
+
+func TestWriteBaselineEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := writeBaseline(path, dbdiff.ModeRows, nil, 1); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"mode\": \"rows\",\n  \"tables\": []\n}\n"; string(data) != want {
+		t.Errorf("wrote %q, want %q", data, want)
+	}
+}
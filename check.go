@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// runCheck is the check subcommand, taking the same flags as a run: it
+// checks that the databases can be reached and the tables read on all of
+// them, and prints the plan of the run, before a long run finds out halfway
+// through. It exits with exitTableErrors when anything fails.
+func runCheck(ctx context.Context, comparer *dbdiff.MultiComparer, tables []dbdiff.TableConfig, options dbdiff.Options, workers int) int {
+	databases, checks := comparer.Preflight(ctx, tables, workers)
+	failed := printCheck(stdout, comparer, databases, checks, tables, options, workers)
+	if failed > 0 {
+		logger.Warnw("The run would fail", "problems", failed)
+		return exitTableErrors
+	}
+	logger.Info("Ready to run")
+	return 0
+}
+
+// printCheck prints the databases, the tables on each and the plan, and
+// returns how many problems it found.
+func printCheck(w io.Writer, comparer *dbdiff.MultiComparer, databases []dbdiff.DatabaseCheck, checks []dbdiff.TableCheck,
+	tables []dbdiff.TableConfig, options dbdiff.Options, workers int) int {
+	failed := 0
+	out := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	fmt.Fprintln(out, "Database\tEngine\tPing\tTLS\tStatus")
+	for _, db := range databases {
+		ping, tls, status := db.Latency.Round(time.Millisecond).String(), "n/a", "ok"
+		if db.Latency < time.Millisecond {
+			ping = "<1ms"
+		}
+		if db.Encrypted != nil {
+			tls = "no"
+			if *db.Encrypted {
+				tls = "yes"
+			}
+		}
+		if db.Err != nil {
+			ping, tls, status = "-", "-", db.Err.Error()
+			failed++
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", db.Name, db.Engine, ping, tls, status)
+	}
+	out.Flush()
+
+	names := comparer.Databases()
+	byTable := map[string]map[string]dbdiff.TableCheck{}
+	for _, check := range checks {
+		if byTable[check.Table] == nil {
+			byTable[check.Table] = map[string]dbdiff.TableCheck{}
+		}
+		byTable[check.Table][check.Database] = check
+	}
+	// the rows estimated on each database, -1 when none are
+	estimated := make([]int, len(names))
+	for i := range estimated {
+		estimated[i] = -1
+	}
+	fmt.Fprintln(w)
+	out = tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(out, "Table\t%s\tStatus\n", strings.Join(names, " rows\t")+" rows")
+	for _, table := range tables {
+		row := []string{table.Name}
+		var problems []string
+		for i, name := range names {
+			check, ok := byTable[table.Name][name]
+			switch {
+			case !ok:
+				row = append(row, "-")
+			case check.Err != nil:
+				row = append(row, "-")
+				problems = append(problems, check.Err.Error())
+			case check.EstimatedRows < 0:
+				row = append(row, "n/a")
+			default:
+				row = append(row, "~"+strconv.Itoa(check.EstimatedRows))
+				if estimated[i] < 0 {
+					estimated[i] = 0
+				}
+				estimated[i] += check.EstimatedRows
+			}
+		}
+		status := "ok"
+		if len(problems) > 0 {
+			status = strings.Join(problems, "; ")
+			failed += len(problems)
+		}
+		fmt.Fprintln(out, strings.Join(append(row, status), "\t"))
+	}
+	out.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Plan")
+	out = tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(out, "Mode\t%s\n", options.Mode)
+	var pairs []string
+	for _, pair := range comparer.Comparers() {
+		pairs = append(pairs, pair.Source().ServiceName+" → "+pair.Dest().ServiceName)
+	}
+	fmt.Fprintf(out, "Pairs\t%s\n", strings.Join(pairs, ", "))
+	fmt.Fprintf(out, "Tables\t%d\n", len(tables))
+	var rows []string
+	for i, name := range names {
+		if estimated[i] < 0 {
+			rows = append(rows, "n/a on "+name)
+			continue
+		}
+		rows = append(rows, fmt.Sprintf("~%d on %s", estimated[i], name))
+	}
+	fmt.Fprintf(out, "Estimated rows\t%s\n", strings.Join(rows, ", "))
+	fmt.Fprintf(out, "Workers\t%d\n", workers)
+	switch {
+	case options.Mode == dbdiff.ModeRows:
+		fmt.Fprintf(out, "Batches\t%d rows\n", options.BatchSize)
+	case options.ChunkSize > 0 && estimated[0] >= 0:
+		fmt.Fprintf(out, "Chunks\t%d rows, ~%d on %s\n", options.ChunkSize, (estimated[0]+options.ChunkSize-1)/options.ChunkSize, names[0])
+	case options.ChunkSize > 0:
+		fmt.Fprintf(out, "Chunks\t%d rows\n", options.ChunkSize)
+	}
+	timeout := "none"
+	if options.QueryTimeout > 0 {
+		timeout = options.QueryTimeout.String()
+	}
+	fmt.Fprintf(out, "Query timeout\t%s\n", timeout)
+	out.Flush()
+	return failed
+}
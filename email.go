@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// mailer sends finished reports over SMTP. The server and credentials come
+// from the environment, like the connection strings:
+//
+//	SMTP_ADDR=smtp.example.com:587
+//	SMTP_USER=databasediff
+//	SMTP_PASSWORD=secret
+//	SMTP_FROM=databasediff@example.com
+type mailer struct {
+	addr string
+	from string
+	to   []string
+	auth smtp.Auth
+}
+
+func newMailer(to []string) (*mailer, error) {
+	m := &mailer{addr: os.Getenv("SMTP_ADDR"), from: os.Getenv("SMTP_FROM"), to: to}
+	if m.addr == "" {
+		return nil, fmt.Errorf("email: SMTP_ADDR is not set")
+	}
+	host, _, err := net.SplitHostPort(m.addr)
+	if err != nil {
+		return nil, fmt.Errorf("email: SMTP_ADDR: %w", err)
+	}
+	if m.from == "" {
+		m.from = "databasediff@" + host
+	}
+	for _, address := range append([]string{m.from}, to...) {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return nil, fmt.Errorf("email: %q: %w", address, err)
+		}
+	}
+	// net/smtp only sends these credentials over TLS, or to localhost
+	if user := os.Getenv("SMTP_USER"); user != "" {
+		password, err := secretEnv("SMTP_PASSWORD")
+		if err != nil {
+			return nil, fmt.Errorf("email: %w", err)
+		}
+		m.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return m, nil
+}
+
+// send mails the report in the body, as HTML for the html format and as
+// plain text otherwise.
+func (m *mailer) send(subject, format string, report []byte) error {
+	contentType := "text/plain; charset=utf-8"
+	if format == "html" {
+		contentType = "text/html; charset=utf-8"
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", m.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(m.to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: %s\r\n", contentType)
+	fmt.Fprintf(&message, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	body := quotedprintable.NewWriter(&message)
+	if _, err := body.Write(report); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, m.to, message.Bytes()); err != nil {
+		return fmt.Errorf("email: %w", err)
+	}
+	logger.Infow("Emailed the report", "to", strings.Join(m.to, ", "))
+	return nil
+}
+
+// reportSubject sums up a run for the email's subject line.
+func reportSubject(mode, sourceDB, destDB string, tables, exceeded int) string {
+	subject := fmt.Sprintf("databasediff %s report for %s and %s: %d table(s)", mode, sourceDB, destDB, tables)
+	if exceeded > 0 {
+		subject += fmt.Sprintf(", %d over the drift threshold", exceeded)
+	}
+	return subject
+}
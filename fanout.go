@@ -0,0 +1,161 @@
+package main
+
+import (
+	"io"
+	"strconv"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// fanOutReportWriter renders the counts of more than two databases as a
+// matrix, with a row per table holding its count on every database and the
+// diff of every pair compared. It receives each pair's result separately and
+// writes the table's row once all of them have arrived.
+type fanOutReportWriter struct {
+	ReportWriter
+	pairs int
+	// results holds every table's results by pair, which the layout reads
+	// its columns from
+	results map[string][]dbdiff.TableResult
+}
+
+func newFanOutReportWriter(format string, w io.Writer, comparer *dbdiff.MultiComparer, options reportOptions) (ReportWriter, error) {
+	if err := checkReportFormat(format); err != nil {
+		return nil, err
+	}
+	fanOut := &fanOutReportWriter{pairs: len(comparer.Comparers()), results: map[string][]dbdiff.TableResult{}}
+	layout := fanOutLayout(comparer, func(t dbdiff.TableResult) []dbdiff.TableResult { return fanOut.results[t.Name] })
+	fanOut.ReportWriter = reportWriters[format](w, options.apply(layout))
+	return fanOut, nil
+}
+
+func (w *fanOutReportWriter) WriteTableResult(tableDiff dbdiff.TableResult) error {
+	results := append(w.results[tableDiff.Name], tableDiff)
+	w.results[tableDiff.Name] = results
+	if len(results) < w.pairs {
+		return nil
+	}
+	// the table is only left out of the summary when no pair could be
+	// compared, e.g. as the source failed
+	row := dbdiff.TableResult{Name: tableDiff.Name, Err: results[0].Err}
+	for _, result := range results {
+		if result.Err == nil {
+			row.Err = nil
+		}
+	}
+	return w.ReportWriter.WriteTableResult(row)
+}
+
+// fanOutLayout has a count column for every database, followed by a diff
+// column for every pair: named after the destination when each is compared
+// against the source, or after both databases when every pair is. Example
+// rows and errors are listed with the pair they were found on.
+func fanOutLayout(comparer *dbdiff.MultiComparer, results func(dbdiff.TableResult) []dbdiff.TableResult) reportLayout {
+	pairwise := false
+	for _, pair := range comparer.Comparers() {
+		if pair.Source().ServiceName != comparer.Databases()[0] {
+			pairwise = true
+		}
+	}
+	pairName := func(t dbdiff.TableResult) string {
+		if pairwise {
+			return t.Source + "/" + t.Dest
+		}
+		return t.Dest
+	}
+
+	columns := []reportColumn{{Header: "Table", Value: func(t dbdiff.TableResult) string { return t.Name }}}
+	for _, name := range comparer.Databases() {
+		name := name
+		columns = append(columns, reportColumn{Header: name, Numeric: true, Value: func(t dbdiff.TableResult) string {
+			// any pair the database was counted in will do
+			for _, result := range results(t) {
+				if result.Err != nil {
+					continue
+				}
+				if result.Source == name {
+					return formatCount(result, result.SourceRowCount)
+				}
+				if result.Dest == name {
+					return formatCount(result, result.DestRowCount)
+				}
+			}
+			return "error"
+		}})
+	}
+	for i, pair := range comparer.Comparers() {
+		i := i
+		header := pairName(dbdiff.TableResult{Source: pair.Source().ServiceName, Dest: pair.Dest().ServiceName})
+		columns = append(columns, reportColumn{Header: "Diff " + header, Numeric: true, Value: func(t dbdiff.TableResult) string {
+			if result := results(t)[i]; result.Err == nil {
+				return formatCount(result, result.SourceRowCount-result.DestRowCount)
+			}
+			return ""
+		}, Drift: func(t dbdiff.TableResult) (dbdiff.TableResult, bool) {
+			result := results(t)[i]
+			return result, result.Err == nil
+		}})
+	}
+
+	errorsHeader := "Destination"
+	if pairwise {
+		errorsHeader = "Pair"
+	}
+	return reportLayout{
+		Columns: columns,
+		// the most any pair drifts
+		Run: reportRun{Mode: dbdiff.ModeCount, Databases: comparer.Databases(), Drift: func(t dbdiff.TableResult) int {
+			drift := 0
+			for _, result := range results(t) {
+				if diff, _ := result.Drift(dbdiff.ModeCount); result.Err == nil && abs(diff) > abs(drift) {
+					drift = diff
+				}
+			}
+			return drift
+		}, Results: results},
+		Sections: []reportSection{{
+			Title:   "Differing partitions",
+			Headers: []string{"Table", errorsHeader, "Partition", "Source", "Dest", "Diff"},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				var rows [][]string
+				for _, result := range results(t) {
+					for _, partition := range result.Partitions {
+						if partition.SourceCount != partition.DestCount {
+							rows = append(rows, []string{result.Name, pairName(result), partition.Name,
+								strconv.Itoa(partition.SourceCount), strconv.Itoa(partition.DestCount), strconv.Itoa(partition.SourceCount - partition.DestCount)})
+						}
+					}
+				}
+				return rows
+			},
+		}, {
+			Title:   "Example rows",
+			Headers: []string{"Table", errorsHeader, "Key", "Only in", "Row"},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				var rows [][]string
+				for _, result := range results(t) {
+					for _, example := range result.Examples {
+						side := result.Source
+						if example.Kind == dbdiff.MissingInSource {
+							side = result.Dest
+						}
+						rows = append(rows, []string{result.Name, pairName(result), example.Key, side, example.Row})
+					}
+				}
+				return rows
+			},
+		}, {
+			Title:   "Errors",
+			Headers: []string{"Table", errorsHeader, "Status", "Error"},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				var rows [][]string
+				for _, result := range results(t) {
+					if result.Err != nil {
+						rows = append(rows, []string{result.Name, pairName(result), result.Status(), result.Err.Error()})
+					}
+				}
+				return rows
+			},
+		}},
+	}
+}
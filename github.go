@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// githubEscaper escapes the message of a GitHub Actions workflow command,
+// and githubPropertyEscaper its properties, such as the title.
+var (
+	githubEscaper         = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// writeGitHubAnnotations prints a workflow command for every table that
+// drifts or couldn't be compared, and every check that differs or failed,
+// which GitHub Actions shows as annotations on the run and its pull request:
+// errors for those past their threshold or failed, warnings for drift
+// within it.
+func writeGitHubAnnotations(w io.Writer, mode string, tableDiffs []dbdiff.TableResult, exceeded []dbdiff.TableResult, checks []dbdiff.CheckResult) error {
+	over := make(map[resultKey]bool, len(exceeded))
+	for _, table := range exceeded {
+		over[keyOf(table)] = true
+	}
+	annotate := func(level, title, message string) error {
+		_, err := fmt.Fprintf(w, "::%s title=%s::%s\n", level, githubPropertyEscaper.Replace(title), githubEscaper.Replace(message))
+		return err
+	}
+	for _, table := range tableDiffs {
+		var err error
+		diff, total := table.Drift(mode)
+		switch {
+		case table.Err != nil:
+			err = annotate("error", "Couldn't compare "+table.Name, fmt.Sprintf("%s (%s): %v", table.Name, table.Status(), table.Err))
+		case over[keyOf(table)]:
+			err = annotate("error", "Drift in "+table.Name, fmt.Sprintf("%s drifts by %d of %d (%.2f%%) between %s and %s, past its threshold",
+				table.Name, diff, total, dbdiff.DriftPct(diff, total), table.Source, table.Dest))
+		case diff != 0:
+			err = annotate("warning", "Drift in "+table.Name, fmt.Sprintf("%s drifts by %d of %d (%.2f%%) between %s and %s",
+				table.Name, diff, total, dbdiff.DriftPct(diff, total), table.Source, table.Dest))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, check := range checks {
+		var err error
+		switch {
+		case check.Err != nil:
+			err = annotate("error", "Couldn't run check "+check.Name, check.Err.Error())
+		case !check.Passed():
+			err = annotate("error", "Check "+check.Name+" differs", fmt.Sprintf("%d rows only on %s, %d only on %s",
+				len(check.OnlyInSource), check.Source, len(check.OnlyInDest), check.Dest))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGitHubSummary appends the Markdown report to the job summary in
+// GITHUB_STEP_SUMMARY, under a heading counting the tables past their
+// threshold. Outside GitHub Actions there's no summary to write.
+func writeGitHubSummary(newReport func(io.Writer) (ReportWriter, error), mode string, tableDiffs []dbdiff.TableResult, exceeded, failed int, checks []dbdiff.CheckResult) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	heading := fmt.Sprintf("## databasediff %s: %d tables", mode, len(tableDiffs))
+	if exceeded > 0 {
+		heading += fmt.Sprintf(", %d over the drift threshold", exceeded)
+	}
+	if failed > 0 {
+		heading += fmt.Sprintf(", %d failed", failed)
+	}
+	if _, err := fmt.Fprintf(f, "%s\n\n", heading); err != nil {
+		return err
+	}
+	report, err := newReport(f)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteHeader(); err != nil {
+		return err
+	}
+	for _, table := range tableDiffs {
+		if err := report.WriteTableResult(table); err != nil {
+			return err
+		}
+	}
+	if err := report.WriteCheckResults(checks); err != nil {
+		return err
+	}
+	if err := report.Close(); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f)
+	return err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"databasediff/pkg/api"
+)
+
+// grpcServer is the gRPC service of pkg/api, running comparisons through
+// the same server as the REST API, so runs started either way don't
+// overlap and are listed by both.
+type grpcServer struct {
+	api.UnimplementedDatabaseDiffServer
+	*server
+}
+
+// serveGRPC starts serving the gRPC service until the context is done. The
+// address is bound before returning so a port in use fails right away.
+func (s *server) serveGRPC(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("grpc: %w", err)
+	}
+	srv := s.newGRPCServer()
+	if s.token == "" && !loopback(listener.Addr()) {
+		logger.Warnw("Serving the gRPC service without SERVE_TOKEN on an address other machines can reach", "address", listener.Addr().String())
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+	go func() {
+		if err := srv.Serve(listener); err != nil {
+			// the REST API goes on without it
+			logger.Errorw("gRPC server failed", "error", err)
+		}
+	}()
+	logger.Infow("Serving the gRPC service", "address", listener.Addr().String())
+	return nil
+}
+
+// newGRPCServer registers the service on a server turning away calls
+// without the token in their authorization metadata.
+func (s *server) newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.StreamInterceptor(func(service interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		var header string
+		if md, ok := metadata.FromIncomingContext(stream.Context()); ok && len(md.Get("authorization")) > 0 {
+			header = md.Get("authorization")[0]
+		}
+		if !s.authorized(header) {
+			return status.Error(codes.Unauthenticated, "missing or wrong bearer token")
+		}
+		return handler(service, stream)
+	}))
+	api.RegisterDatabaseDiffServer(srv, &grpcServer{server: s})
+	return srv
+}
+
+// Compare starts a run and streams it. A client going away doesn't stop the
+// run, which the REST API still lists.
+func (g *grpcServer) Compare(request *api.CompareRequest, stream api.DatabaseDiff_CompareServer) error {
+	if err := g.checkTables(request.Tables); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	run, ok := g.start(request.Tables)
+	if !ok {
+		return status.Errorf(codes.Unavailable, "run %d is still running", run.ID)
+	}
+	ended, err := g.follow(stream.Context(), run, func(tables []notificationTable) error {
+		for _, table := range tables {
+			if err := stream.Send(&api.CompareEvent{Event: &api.CompareEvent_Table{Table: apiTable(table)}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return status.FromContextError(err).Err()
+	}
+	summary := &api.RunSummary{Id: int64(ended.ID), Mode: ended.Mode, Exceeded: int64(ended.Exceeded), Failed: int64(ended.Failed), Error: ended.Error}
+	for _, table := range ended.Tables {
+		summary.Tables = append(summary.Tables, apiTable(table))
+	}
+	for _, check := range ended.Checks {
+		summary.Checks = append(summary.Checks, &api.CheckResult{
+			Name: check.Name, Source: check.Source, Dest: check.Dest, Passed: check.Passed,
+			OnlyInSource: int64(check.OnlyInSource), OnlyInDest: int64(check.OnlyInDest), Error: check.Error,
+		})
+	}
+	return stream.Send(&api.CompareEvent{Event: &api.CompareEvent_Summary{Summary: summary}})
+}
+
+func apiTable(table notificationTable) *api.TableResult {
+	return &api.TableResult{
+		Name: table.Name, Source: table.Source, Dest: table.Dest,
+		SourceRows: int64(table.SourceRows), DestRows: int64(table.DestRows), Diff: int64(table.Diff), Total: int64(table.Total),
+		Approximate: table.Approximate, OverThreshold: table.OverThreshold, Status: table.Status, Error: table.Error,
+	}
+}
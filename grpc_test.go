@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"databasediff/pkg/api"
+)
+
+// dialGRPC serves the server's gRPC service in memory and connects to it.
+func dialGRPC(t *testing.T, s *server) api.DatabaseDiffClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	srv := s.newGRPCServer()
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return api.NewDatabaseDiffClient(conn)
+}
+
+// receive reads the stream to its end.
+func receive(stream api.DatabaseDiff_CompareClient) (tables []*api.TableResult, summary *api.RunSummary, err error) {
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			return tables, summary, nil
+		}
+		if err != nil {
+			return tables, summary, err
+		}
+		if table := event.GetTable(); table != nil {
+			tables = append(tables, table)
+		}
+		if event.GetSummary() != nil {
+			summary = event.GetSummary()
+		}
+	}
+}
+
+func TestGRPCCompare(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gated := newGatedComparison(nil)
+	s := newTestServer(ctx, gated.compare)
+	client := dialGRPC(t, s)
+
+	stream, err := client.Compare(ctx, &api.CompareRequest{Tables: []string{"orders"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first event arrives once the run has started
+	if event, err := stream.Recv(); err != nil || event.GetTable().GetName() != "orders" {
+		t.Fatalf("first event is %v, error %v", event, err)
+	}
+
+	// runs started either way don't overlap
+	second, err := client.Compare(ctx, &api.CompareRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := receive(second); status.Code(err) != codes.Unavailable {
+		t.Errorf("second run while the first is running failed with %v, want %s", err, codes.Unavailable)
+	}
+	if code, _ := request(t, s, http.MethodPost, "/runs"); code != http.StatusConflict {
+		t.Errorf("REST run while a gRPC one is running answered %d, want %d", code, http.StatusConflict)
+	}
+
+	close(gated.release)
+	tables, summary, err := receive(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 0 {
+		t.Errorf("%d more table events after the first", len(tables))
+	}
+	if summary == nil || summary.Id != 1 || summary.Exceeded != 1 || len(summary.Tables) != 1 || !summary.Tables[0].OverThreshold {
+		t.Errorf("summary is %v", summary)
+	}
+}
+
+func TestGRPCCompareUnknownTable(t *testing.T) {
+	s := newTestServer(context.Background(), nil)
+	stream, err := dialGRPC(t, s).Compare(context.Background(), &api.CompareRequest{Tables: []string{"audit"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := receive(stream); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("run of an unknown table failed with %v, want %s", err, codes.InvalidArgument)
+	}
+}
+
+func TestGRPCToken(t *testing.T) {
+	s := newTestServer(context.Background(), nil)
+	s.token = "s3cret"
+	client := dialGRPC(t, s)
+	for _, test := range []struct {
+		header string
+		want   codes.Code
+	}{
+		{"", codes.Unauthenticated},
+		{"Bearer wrong", codes.Unauthenticated},
+		// past the token, the unknown table is what fails the call
+		{"Bearer s3cret", codes.InvalidArgument},
+	} {
+		ctx := context.Background()
+		if test.header != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", test.header)
+		}
+		stream, err := client.Compare(ctx, &api.CompareRequest{Tables: []string{"audit"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := receive(stream); status.Code(err) != test.want {
+			t.Errorf("call with authorization %q failed with %v, want %s", test.header, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// defaultHistoryTable is the table runs are recorded in, created on first use.
+const defaultHistoryTable = "databasediff_history"
+
+// historyStore persists the per-table results of every run, so the history
+// subcommand can show whether a table's drift is growing across runs rather
+// than only across the rounds of one watch.
+type historyStore struct {
+	db    *sqlx.DB
+	table string
+}
+
+// openHistory connects to the history database, a SQLite file when the
+// connection string is a plain path, and creates the table if needed.
+func openHistory(conn, table string) (*historyStore, error) {
+	if !strings.Contains(conn, "://") {
+		conn = "sqlite://" + conn
+	}
+	dialect := dbdiff.DialectFor(conn)
+	dsn, err := dialect.DSN(conn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sqlx.Open(dialect.DriverName(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	ref := dbdiff.ParseTableRef(table)
+	quoted := dialect.QuoteIdentifier(ref.Name)
+	if ref.Schema != "" {
+		quoted = dialect.QuoteIdentifier(ref.Schema) + "." + quoted
+	}
+	store := &historyStore{db: db, table: quoted}
+	// types every engine understands, with times as sortable UTC text
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS ` + store.table + ` (
+		run_at VARCHAR(40) NOT NULL,
+		mode VARCHAR(20) NOT NULL,
+		source_db VARCHAR(200) NOT NULL,
+		dest_db VARCHAR(200) NOT NULL,
+		table_name VARCHAR(500) NOT NULL,
+		source_rows BIGINT NOT NULL,
+		dest_rows BIGINT NOT NULL,
+		diff BIGINT NOT NULL,
+		total BIGINT NOT NULL,
+		status VARCHAR(200) NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating %s: %w", table, err)
+	}
+	return store, nil
+}
+
+// record stores a run's results in one transaction.
+func (h *historyStore) record(tableDiffs []dbdiff.TableResult, mode string, at time.Time) error {
+	tx, err := h.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insert := tx.Rebind(`INSERT INTO ` + h.table + ` (run_at, mode, source_db, dest_db, table_name, source_rows, dest_rows, diff, total, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	runAt := at.UTC().Format(time.RFC3339)
+	for _, table := range tableDiffs {
+		diff, total := table.Drift(mode)
+		if table.Err != nil {
+			diff, total = 0, 0
+		}
+		if _, err := tx.Exec(insert, runAt, mode, table.Source, table.Dest, table.Name,
+			table.SourceRowCount, table.DestRowCount, diff, total, table.Status()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// historyEntry is a table's result in one recorded run.
+type historyEntry struct {
+	RunAt  string `db:"run_at"`
+	Mode   string `db:"mode"`
+	Source string `db:"source_db"`
+	Dest   string `db:"dest_db"`
+	Table  string `db:"table_name"`
+	Diff   int    `db:"diff"`
+	Status string `db:"status"`
+}
+
+// load returns the recorded results of the mode since the given time, in
+// order, optionally of one table only.
+func (h *historyStore) load(mode, table string, since time.Time) ([]historyEntry, error) {
+	query := `SELECT run_at, mode, source_db, dest_db, table_name, diff, status FROM ` + h.table + ` WHERE mode = ? AND run_at >= ?`
+	args := []interface{}{mode, since.UTC().Format(time.RFC3339)}
+	if table != "" {
+		query += " AND table_name = ?"
+		args = append(args, table)
+	}
+	var entries []historyEntry
+	err := h.db.Select(&entries, h.db.Rebind(query+" ORDER BY table_name, source_db, dest_db, run_at"), args...)
+	return entries, err
+}
+
+// runHistory is the history subcommand, printing how each table's drift
+// evolved over its recorded runs.
+func runHistory(args []string) int {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	historyConn := flags.String("history", "", "the history database the comparisons were recorded in, a SQLite file or a connection string")
+	historyTable := flags.String("history-table", defaultHistoryTable, "the table in the history database holding the results")
+	mode := flags.String("mode", dbdiff.ModeCount, "the comparison mode whose results to show")
+	table := flags.String("table", "", "only show this table")
+	since := flags.Duration("since", 30*24*time.Hour, "only show runs within this long")
+	runs := flags.Int("runs", 10, "the most recent runs shown for every table")
+	flags.Parse(args)
+	if *historyConn == "" {
+		log.Fatal("--history is required")
+	}
+	if *runs <= 0 {
+		log.Fatal("--runs must be positive")
+	}
+	store, err := openHistory(*historyConn, *historyTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.db.Close()
+	entries, err := store.load(*mode, *table, time.Now().Add(-*since))
+	if err != nil {
+		log.Fatal(err)
+	}
+	printHistory(os.Stdout, entries, *runs)
+	return 0
+}
+
+// printHistory lists every table with its drift in the most recent runs,
+// oldest first, and whether it's growing from the first of them to the
+// last. Failed runs show as errors and are left out of the trend.
+func printHistory(w *os.File, entries []historyEntry, runs int) {
+	out := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	fmt.Fprintln(out, "Table\tSource\tDest\tRuns\tLatest\tChange\tTrend\tDrift per run")
+	for start := 0; start < len(entries); {
+		end := start
+		for end < len(entries) && entries[end].Table == entries[start].Table &&
+			entries[end].Source == entries[start].Source && entries[end].Dest == entries[start].Dest {
+			end++
+		}
+		series := entries[start:end]
+		if len(series) > runs {
+			series = series[len(series)-runs:]
+		}
+		start = end
+
+		var diffs []string
+		first, last, compared := 0, 0, 0
+		for _, entry := range series {
+			if entry.Status != dbdiff.StatusOK {
+				diffs = append(diffs, "error")
+				continue
+			}
+			diffs = append(diffs, strconv.Itoa(entry.Diff))
+			if compared == 0 {
+				first = entry.Diff
+			}
+			last = entry.Diff
+			compared++
+		}
+		trend, latest, change := "n/a", "error", ""
+		if compared > 0 {
+			latest, change = strconv.Itoa(last), fmt.Sprintf("%+d", last-first)
+			trend = "stable"
+			switch {
+			case abs(last) > abs(first):
+				trend = "growing"
+			case abs(last) < abs(first):
+				trend = "shrinking"
+			}
+		}
+		entry := series[0]
+		fmt.Fprintf(out, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n", entry.Table, entry.Source, entry.Dest, len(series), latest, change, trend, strings.Join(diffs, " → "))
+	}
+	out.Flush()
+}
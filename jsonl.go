@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// jsonlReportWriter writes a JSON line for every destination's replication
+// status first, one for every table as soon as it's compared, and one for
+// every check and the run's summary at the end, so
+// that a long run can be tailed and processed as it goes rather than once
+// it's over.
+type jsonlReportWriter struct {
+	enc    *json.Encoder
+	layout reportLayout
+	// layouts are the layouts by pair of databases, whose names head their
+	// columns
+	layouts map[[2]string]reportLayout
+	totals  reportTotals
+}
+
+// jsonlTable is a table's line. Summary is its row of the other formats'
+// report, and Details its rows of their sections, both keyed by the
+// columns' headers.
+type jsonlTable struct {
+	Type        string                         `json:"type"`
+	Mode        string                         `json:"mode"`
+	Name        string                         `json:"name"`
+	Source      string                         `json:"source"`
+	Dest        string                         `json:"dest"`
+	SourceRows  int                            `json:"source_rows"`
+	DestRows    int                            `json:"dest_rows"`
+	Diff        int                            `json:"diff"`
+	Total       int                            `json:"total"`
+	Approximate bool                           `json:"approximate,omitempty"`
+	Status      string                         `json:"status"`
+	Error       string                         `json:"error,omitempty"`
+	DurationMS  int64                          `json:"duration_ms"`
+	Summary     map[string]string              `json:"summary,omitempty"`
+	Details     map[string][]map[string]string `json:"details,omitempty"`
+}
+
+// jsonlCheck is a check's line.
+type jsonlCheck struct {
+	Type         string     `json:"type"`
+	Name         string     `json:"name"`
+	Source       string     `json:"source"`
+	Dest         string     `json:"dest"`
+	Passed       bool       `json:"passed"`
+	SourceValue  string     `json:"source_value,omitempty"`
+	DestValue    string     `json:"dest_value,omitempty"`
+	OnlyInSource [][]string `json:"only_in_source,omitempty"`
+	OnlyInDest   [][]string `json:"only_in_dest,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// jsonlReplication is a destination's replication line. LagBytes and
+// ReplayDelayMS are left out when unknown.
+type jsonlReplication struct {
+	Type          string `json:"type"`
+	Source        string `json:"source"`
+	Dest          string `json:"dest"`
+	Replication   string `json:"replication,omitempty"`
+	Slot          string `json:"slot,omitempty"`
+	Connected     bool   `json:"connected"`
+	LagBytes      *int64 `json:"lag_bytes,omitempty"`
+	ReplayDelayMS *int64 `json:"replay_delay_ms,omitempty"`
+	Behind        bool   `json:"behind"`
+	Error         string `json:"error,omitempty"`
+}
+
+// jsonlSummary is the run's summary line, the last.
+type jsonlSummary struct {
+	Type       string         `json:"type"`
+	Mode       string         `json:"mode"`
+	Tables     int            `json:"tables"`
+	Matching   int            `json:"matching"`
+	Drifting   int            `json:"drifting"`
+	Errors     int            `json:"errors"`
+	Rows       map[string]int `json:"rows,omitempty"`
+	DurationMS int64          `json:"duration_ms"`
+	Slowest    []jsonlSlow    `json:"slowest,omitempty"`
+}
+
+type jsonlSlow struct {
+	Name       string `json:"name"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+func newJSONLReportWriter(w io.Writer, layout reportLayout) ReportWriter {
+	return &jsonlReportWriter{enc: json.NewEncoder(w), layout: layout, layouts: map[[2]string]reportLayout{}, totals: newReportTotals()}
+}
+
+func (r *jsonlReportWriter) WriteReplication(statuses []dbdiff.ReplicationStatus) error {
+	for _, status := range statuses {
+		line := jsonlReplication{
+			Type: "replication", Source: status.Source, Dest: status.Dest, Replication: status.Kind, Slot: status.Slot,
+			Connected: status.Active, Behind: status.Behind(),
+		}
+		if status.Err != nil {
+			line.Error = status.Err.Error()
+		}
+		if status.LagBytes >= 0 {
+			lag := status.LagBytes
+			line.LagBytes = &lag
+		}
+		if status.ReplayDelay >= 0 {
+			delay := status.ReplayDelay.Milliseconds()
+			line.ReplayDelayMS = &delay
+		}
+		if err := r.enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteHeader writes nothing, as every line stands on its own.
+func (r *jsonlReportWriter) WriteHeader() error {
+	return nil
+}
+
+func (r *jsonlReportWriter) WriteTableResult(tableDiff dbdiff.TableResult) error {
+	mode := r.layout.Run.Mode
+	layout, ok := r.layouts[[2]string{tableDiff.Source, tableDiff.Dest}]
+	if !ok {
+		layout = modeLayout(mode, tableDiff.Source, tableDiff.Dest)
+		r.layouts[[2]string{tableDiff.Source, tableDiff.Dest}] = layout
+	}
+	r.totals.add(layout, tableDiff)
+	if !r.layout.lists(tableDiff) {
+		return nil
+	}
+	diff, total := tableDiff.Drift(mode)
+	line := jsonlTable{
+		Type: "table", Mode: mode, Name: tableDiff.Name, Source: tableDiff.Source, Dest: tableDiff.Dest,
+		SourceRows: tableDiff.SourceRowCount, DestRows: tableDiff.DestRowCount, Diff: diff, Total: total,
+		Approximate: tableDiff.Approximate, Status: tableDiff.Status(), DurationMS: tableDiff.Duration.Milliseconds(),
+	}
+	if tableDiff.Err != nil {
+		line.Error = tableDiff.Err.Error()
+	} else {
+		line.Summary = keyedRow(layout.headers(), layout.values(tableDiff))
+	}
+	for _, section := range layout.Sections {
+		// the error is already the line's
+		if section.Title == errorsSection.Title {
+			continue
+		}
+		for _, row := range section.Rows(tableDiff) {
+			if line.Details == nil {
+				line.Details = map[string][]map[string]string{}
+			}
+			line.Details[section.Title] = append(line.Details[section.Title], keyedRow(section.Headers, row))
+		}
+	}
+	return r.enc.Encode(line)
+}
+
+func (r *jsonlReportWriter) WriteCheckResults(checks []dbdiff.CheckResult) error {
+	for _, check := range checks {
+		line := jsonlCheck{
+			Type: "check", Name: check.Name, Source: check.Source, Dest: check.Dest, Passed: check.Passed(),
+			OnlyInSource: check.OnlyInSource, OnlyInDest: check.OnlyInDest,
+		}
+		if check.Err != nil {
+			line.Error = check.Err.Error()
+		} else if source, dest, scalar := check.Scalar(); scalar {
+			line.SourceValue, line.DestValue = source, dest
+		}
+		if err := r.enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *jsonlReportWriter) Close() error {
+	summary := r.totals.summary()
+	line := jsonlSummary{
+		Type: "summary", Mode: r.layout.Run.Mode, Tables: summary.Tables, Matching: summary.Matching,
+		Drifting: summary.Drifting, Errors: summary.Failed, DurationMS: summary.Duration.Milliseconds(),
+	}
+	for i, database := range summary.Databases {
+		if line.Rows == nil {
+			line.Rows = map[string]int{}
+		}
+		line.Rows[database] = summary.Rows[i]
+	}
+	for _, table := range summary.Slowest {
+		line.Slowest = append(line.Slowest, jsonlSlow{table.Name, table.Duration.Milliseconds()})
+	}
+	return r.enc.Encode(line)
+}
+
+func keyedRow(headers, values []string) map[string]string {
+	row := make(map[string]string, len(headers))
+	for i, header := range headers {
+		if i < len(values) {
+			row[header] = values[i]
+		}
+	}
+	return row
+}
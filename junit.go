@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// junitSuites is a JUnit XML report, with a test suite for the tables and
+// checks of every pair of databases, so CI servers show each table's pass or
+// fail history.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Errors   int          `xml:"errors,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitSeconds formats a duration the way JUnit reports do.
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeJUnit writes the run as JUnit XML: a test case per table, failing
+// when its drift exceeds its threshold and erroring when it couldn't be
+// compared, and one per check.
+func writeJUnit(path, mode string, tableDiffs []dbdiff.TableResult, exceeded []dbdiff.TableResult, checks []dbdiff.CheckResult) error {
+	over := make(map[resultKey]bool, len(exceeded))
+	for _, table := range exceeded {
+		over[keyOf(table)] = true
+	}
+	timestamp := time.Now().UTC().Format("2006-01-02T15:04:05")
+	report := junitSuites{Name: "databasediff"}
+	suites := map[string]int{}
+	// the suite's index, as pointers don't survive appending another
+	suiteOf := func(source, dest string) int {
+		name := source + "/" + dest
+		i, ok := suites[name]
+		if !ok {
+			i = len(report.Suites)
+			suites[name] = i
+			report.Suites = append(report.Suites, junitSuite{Name: "databasediff " + mode + " " + name, Timestamp: timestamp,
+				Properties: []junitProperty{{"mode", mode}, {"source", source}, {"dest", dest}}})
+		}
+		return i
+	}
+	durations := map[int]time.Duration{}
+
+	for _, table := range tableDiffs {
+		i := suiteOf(table.Source, table.Dest)
+		suite := &report.Suites[i]
+		diff, total := table.Drift(mode)
+		testCase := junitCase{Name: table.Name, ClassName: "databasediff." + mode, Time: junitSeconds(table.Duration),
+			SystemOut: fmt.Sprintf("%s: %d rows, %s: %d rows, drift %d of %d", table.Source, table.SourceRowCount, table.Dest, table.DestRowCount, diff, total)}
+		switch {
+		case table.Err != nil:
+			testCase.SystemOut = ""
+			testCase.Error = &junitProblem{Message: table.Status(), Type: "error", Text: table.Err.Error()}
+			suite.Errors++
+		case over[keyOf(table)]:
+			testCase.Failure = &junitProblem{Message: fmt.Sprintf("drift of %d exceeds the threshold", diff), Type: "drift",
+				Text: fmt.Sprintf("%s drifts by %d of %d (%.2f%%) between %s and %s", table.Name, diff, total, dbdiff.DriftPct(diff, total), table.Source, table.Dest)}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+		durations[i] += table.Duration
+	}
+
+	for _, check := range checks {
+		i := suiteOf(check.Source, check.Dest)
+		suite := &report.Suites[i]
+		testCase := junitCase{Name: check.Name, ClassName: "databasediff.checks", Time: junitSeconds(check.Duration)}
+		switch {
+		case check.Err != nil:
+			testCase.Error = &junitProblem{Message: "check failed", Type: "error", Text: check.Err.Error()}
+			suite.Errors++
+		case !check.Passed():
+			var rows []string
+			for _, row := range check.OnlyInSource {
+				rows = append(rows, strings.Join(row, ", ")+" only on "+check.Source)
+			}
+			for _, row := range check.OnlyInDest {
+				rows = append(rows, strings.Join(row, ", ")+" only on "+check.Dest)
+			}
+			testCase.Failure = &junitProblem{Message: "the databases returned different rows", Type: "check", Text: strings.Join(rows, "\n")}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+		durations[i] += check.Duration
+	}
+
+	var elapsed time.Duration
+	for i := range report.Suites {
+		suite := &report.Suites[i]
+		suite.Time = junitSeconds(durations[i])
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		elapsed += durations[i]
+	}
+	report.Time = junitSeconds(elapsed)
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0o644)
+}
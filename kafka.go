@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// Event types published to Kafka.
+const (
+	kafkaTableEvent     = "table"
+	kafkaThresholdEvent = "threshold_exceeded"
+)
+
+// kafkaAttempts is how many times a write is tried, backing off in between,
+// before a run's events are given up on.
+const kafkaAttempts = 5
+
+// kafkaEvent is a message published for every table compared, and another
+// for every table over its threshold, keyed by the table and its databases
+// so a table's events stay in order on one partition.
+type kafkaEvent struct {
+	Type  string    `json:"type"`
+	RunAt time.Time `json:"run_at"`
+	Mode  string    `json:"mode"`
+	notificationTable
+}
+
+// kafkaPublisher produces the events to a topic, acknowledged by all
+// in-sync replicas. The connections to the brokers are kept from one run, or
+// round, to the next. SASL credentials come from the environment, like the
+// connection strings:
+//
+//	KAFKA_USER=databasediff
+//	KAFKA_PASSWORD=secret
+//	KAFKA_SASL_MECHANISM=SCRAM-SHA-512
+//
+// the mechanism being PLAIN unless set.
+type kafkaPublisher struct {
+	writer    *kafka.Writer
+	transport *kafka.Transport
+	// timeout bounds publishing a run's events, retries included
+	timeout time.Duration
+}
+
+func newKafkaPublisher(brokers []string, topic string, useTLS bool) (*kafkaPublisher, error) {
+	if len(brokers) == 0 || topic == "" {
+		return nil, errors.New("kafka: --kafka-brokers and --kafka-topic are both required")
+	}
+	mechanism, err := kafkaSASL()
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	transport := &kafka.Transport{
+		ClientID:    "databasediff",
+		DialTimeout: 10 * time.Second,
+		// brokers close connections idle for 10 minutes
+		IdleTimeout: 9 * time.Minute,
+		SASL:        mechanism,
+	}
+	if useTLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return &kafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			MaxAttempts:  kafkaAttempts,
+			// every event of a run is written at once, without waiting for
+			// more to fill the batches
+			BatchTimeout: 10 * time.Millisecond,
+			WriteTimeout: 10 * time.Second,
+			Transport:    transport,
+		},
+		transport: transport,
+		timeout:   time.Minute,
+	}, nil
+}
+
+// kafkaSASL is the mechanism KAFKA_USER authenticates with, or nil without
+// one.
+func kafkaSASL() (sasl.Mechanism, error) {
+	user := os.Getenv("KAFKA_USER")
+	if user == "" {
+		return nil, nil
+	}
+	password, err := secretEnv("KAFKA_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+	switch mechanism := strings.ToUpper(os.Getenv("KAFKA_SASL_MECHANISM")); mechanism {
+	case "", "PLAIN":
+		return plain.Mechanism{Username: user, Password: password}, nil
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, user, password)
+	case "SCRAM-SHA-512":
+		return scram.Mechanism(scram.SHA512, user, password)
+	default:
+		return nil, fmt.Errorf("KAFKA_SASL_MECHANISM %s isn't PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", mechanism)
+	}
+}
+
+// publish sends the run's events and waits for them to be acknowledged.
+func (p *kafkaPublisher) publish(tableDiffs []dbdiff.TableResult, mode string, exceeded []dbdiff.TableResult, at time.Time) error {
+	messages, err := kafkaMessages(tableDiffs, mode, exceeded, at)
+	if err != nil || len(messages) == 0 {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	if err := p.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	return nil
+}
+
+// close closes the connections to the brokers.
+func (p *kafkaPublisher) close() error {
+	err := p.writer.Close()
+	p.transport.CloseIdleConnections()
+	return err
+}
+
+// kafkaMessages are the run's events, a table event for every table and a
+// threshold event for every table over its threshold.
+func kafkaMessages(tableDiffs []dbdiff.TableResult, mode string, exceeded []dbdiff.TableResult, at time.Time) ([]kafka.Message, error) {
+	over := make(map[resultKey]bool, len(exceeded))
+	for _, table := range exceeded {
+		over[keyOf(table)] = true
+	}
+	var messages []kafka.Message
+	add := func(eventType string, table dbdiff.TableResult) error {
+		value, err := json.Marshal(kafkaEvent{Type: eventType, RunAt: at, Mode: mode, notificationTable: newNotificationTable(table, mode, over[keyOf(table)])})
+		if err != nil {
+			return err
+		}
+		messages = append(messages, kafka.Message{Key: []byte(table.Source + "/" + table.Dest + "/" + table.Name), Value: value, Time: at})
+		return nil
+	}
+	for _, table := range tableDiffs {
+		if err := add(kafkaTableEvent, table); err != nil {
+			return nil, err
+		}
+	}
+	for _, table := range exceeded {
+		if err := add(kafkaThresholdEvent, table); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go/sasl/plain"
+
+	"databasediff/pkg/dbdiff"
+)
+
+func TestKafkaMessages(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	orders := dbdiff.TableResult{Name: "orders", Source: "src", Dest: "dest", SourceRowCount: 10, DestRowCount: 9}
+	users := dbdiff.TableResult{Name: "users", Source: "src", Dest: "dest", SourceRowCount: 5, DestRowCount: 5}
+	messages, err := kafkaMessages([]dbdiff.TableResult{orders, users}, dbdiff.ModeCount, []dbdiff.TableResult{orders}, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		key, eventType string
+		overThreshold  bool
+	}{
+		{"src/dest/orders", kafkaTableEvent, true},
+		{"src/dest/users", kafkaTableEvent, false},
+		{"src/dest/orders", kafkaThresholdEvent, true},
+	}
+	if len(messages) != len(want) {
+		t.Fatalf("%d messages, want %d", len(messages), len(want))
+	}
+	for i, message := range messages {
+		var event kafkaEvent
+		if err := json.Unmarshal(message.Value, &event); err != nil {
+			t.Fatal(err)
+		}
+		if string(message.Key) != want[i].key || event.Type != want[i].eventType || event.OverThreshold != want[i].overThreshold {
+			t.Errorf("message %d is %s of %+v, want %s of a %s event", i, message.Key, event, want[i].key, want[i].eventType)
+		}
+		if !message.Time.Equal(at) || !event.RunAt.Equal(at) || event.Mode != dbdiff.ModeCount {
+			t.Errorf("message %d is at %s of a %s run at %s, want %s", i, message.Time, event.Mode, event.RunAt, at)
+		}
+	}
+}
+
+func TestKafkaMessagesNone(t *testing.T) {
+	if messages, err := kafkaMessages(nil, dbdiff.ModeCount, nil, time.Now()); err != nil || len(messages) != 0 {
+		t.Errorf("messages of no tables are %v, error %v", messages, err)
+	}
+}
+
+func TestKafkaSASL(t *testing.T) {
+	for _, test := range []struct {
+		name, user, mechanism string
+		want                  string
+		err                   string
+	}{
+		{"none", "", "", "", ""},
+		{"plain by default", "databasediff", "", "PLAIN", ""},
+		{"scram", "databasediff", "scram-sha-512", "SCRAM-SHA-512", ""},
+		{"unknown", "databasediff", "GSSAPI", "", "KAFKA_SASL_MECHANISM GSSAPI isn't"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("KAFKA_USER", test.user)
+			t.Setenv("KAFKA_PASSWORD", "secret")
+			t.Setenv("KAFKA_SASL_MECHANISM", test.mechanism)
+			mechanism, err := kafkaSASL()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mechanism == nil {
+				if test.want != "" {
+					t.Fatalf("no mechanism, want %s", test.want)
+				}
+				return
+			}
+			if mechanism.Name() != test.want {
+				t.Errorf("mechanism is %s, want %s", mechanism.Name(), test.want)
+			}
+			if p, ok := mechanism.(plain.Mechanism); ok && (p.Username != "databasediff" || p.Password != "secret") {
+				t.Errorf("credentials are %s and %s", p.Username, p.Password)
+			}
+		})
+	}
+}
+
+func TestNewKafkaPublisher(t *testing.T) {
+	if _, err := newKafkaPublisher(nil, "drift", false); err == nil {
+		t.Error("publisher without brokers")
+	}
+	p, err := newKafkaPublisher([]string{"kafka1:9092", "kafka2:9092"}, "drift", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+	if p.writer.Addr.String() != "kafka1:9092,kafka2:9092" || p.writer.Topic != "drift" || p.writer.MaxAttempts != kafkaAttempts {
+		t.Errorf("writer of %s to %s tries %d times", p.writer.Addr, p.writer.Topic, p.writer.MaxAttempts)
+	}
+	if p.transport.TLS == nil || p.writer.Transport != p.transport {
+		t.Error("writer doesn't share the TLS transport")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logger is where progress and problems are logged. It writes to stderr,
+// leaving stdout to the report.
+var logger = zap.NewNop().Sugar()
+
+// newLogger builds the logger for --log-level and --log-format: JSON lines
+// for log pipelines, or aligned text for people.
+func newLogger(level, format string, out zapcore.WriteSyncer) (*zap.Logger, error) {
+	var minLevel zapcore.Level
+	if err := minLevel.Set(level); err != nil {
+		return nil, fmt.Errorf("--log-level: %w", err)
+	}
+	config := zap.NewProductionEncoderConfig()
+	config.TimeKey = "time"
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+	var encoder zapcore.Encoder
+	switch format {
+	case "json":
+		encoder = zapcore.NewJSONEncoder(config)
+	case "text":
+		config.EncodeLevel = zapcore.CapitalLevelEncoder
+		config.EncodeDuration = zapcore.StringDurationEncoder
+		encoder = zapcore.NewConsoleEncoder(config)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return zap.New(zapcore.NewCore(encoder, out, minLevel)), nil
+}
@@ -1,180 +1,1325 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"math"
 	"os"
-	"text/tabwriter"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap/zapcore"
 
-	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"databasediff/pkg/dbdiff"
 )
 
-var (
-	maxOpenConnection = 5
-	// list tables that need to be compared
-	tables = []string{
-		"imx_table_A",
-		"imx_table_B",
-		"imx_table_C",
-	}
-)
-
-type DB struct {
-	DB          *sqlx.DB
-	ServiceName string
+// list tables that need to be compared
+var tables = []string{
+	"imx_table_A",
+	"imx_table_B",
+	"imx_table_C",
 }
 
-type Databases struct {
-	source DB
-	dest   DB
+func main() {
+	os.Exit(run())
 }
 
-type TableDiff struct {
-	Name                         string
-	SourceRowCount, DestRowCount int
-}
+func run() (status int) {
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		return runHistory(os.Args[2:])
+	}
+	// serve takes the same flags as a run, and runs it on request, as does
+	// check, only checking that it can run
+	serving := len(os.Args) > 1 && os.Args[1] == "serve"
+	checking := len(os.Args) > 1 && os.Args[1] == "check"
+	profile := flag.String("profile", "", "compare the source and destination of this profile in --config")
+	sourceProfile := flag.String("source-profile", "", "take the source from this profile in --config, overriding --profile's")
+	destProfile := flag.String("dest-profile", "", "take the destination from this profile in --config, overriding --profile's")
+	tablesFile := flag.String("tables-file", "", "compare the tables listed in this file, one per line and optionally schema-qualified, instead of --config's or the built-in list; - reads them from stdin, as does piping them in")
+	configPath := flag.String("config", "", "JSON file listing the tables to compare and their settings, replacing the built-in table list")
+	format := flag.String("format", "text", "report format: "+strings.Join(reportFormats(), ", "))
+	sortBy := flag.String("sort", "", "order the report's tables by "+strings.Join(reportSorts, ", ")+": the most drifted first after those that failed, by name, or the slowest first; empty lists them as they're compared")
+	onlyDiff := flag.Bool("only-diff", false, "leave the tables that match out of the report, listing only those that drifted or failed")
+	output := flag.String("output", "", "write the report to this file instead of stdout (html defaults to "+defaultHTMLReport+")")
+	mode := flag.String("mode", dbdiff.ModeCount, "comparison mode: count (row counts), rows (row-level diff by primary key), checksum (md5 of rows per key range), schema (columns, indexes and constraints), sequences (last values of owned sequences), sample (rows behind randomly sampled keys, scaled up to an estimate), freshness (skew between the latest --freshness-column values), aggregates (sum, min, max and avg of columns), groups (row counts per value of --group-by), keys (gaps and duplicate keys on each side), grants (table and column privileges and owners), membership (Bloom filters of the keys per key range, estimating the keys missing on each side) or distinct (distinct values of the key, or of the columns set as \"distinct\" in --config), or the mode of a strategy registered by a --plugin")
+	batchSize := flag.Int("batch-size", 1000, "rows fetched per batch in rows mode and client-side checksums")
+	memoryLimit := flag.String("memory-limit", "", "bytes each rows comparison may hold, such as 256MB: batches shrink below --batch-size for wide rows, and the differences past half of it are only counted; empty leaves it unbounded")
+	chunkSize := flag.Int("chunk-size", 0, "rows per checksummed key range in checksum mode or filtered key range in membership mode, or keys per counted range in count mode with --table-parallelism; 0 checksums each table as a whole")
+	tableParallelism := flag.Int("table-parallelism", 0, "key ranges of each table counted or checksummed at once, splitting a single integer key between its lowest and highest keys when there's no --chunk-size; 0 compares one at a time")
+	checksum := flag.String("checksum", dbdiff.ChecksumServer, "where checksums are computed: server (md5 aggregate in the database) or client (rows are streamed and hashed locally), and likewise where membership mode hashes the keys")
+	functions := flag.Bool("functions", false, "in schema mode, also compare the stored functions and procedures of the compared tables' schemas (PostgreSQL, MySQL and SQL Server)")
+	settings := flag.Bool("settings", false, "in schema mode, also compare the installed extensions and the settings of the databases, such as encoding, collation and time zone")
+	allSequences := flag.Bool("all-sequences", false, "in sequences mode, also compare sequences in the schema not owned by a compared table")
+	checkSchema := flag.Bool("check-schema", true, "compare table schemas and print any drift before comparing data")
+	estimate := flag.Bool("estimate", false, "in count mode, read approximate row counts from the catalog (pg_class.reltuples, information_schema.tables, ...) instead of counting, except for tables with a where filter, their own count or \"exact\": true in --config; in distinct mode, estimate the distinct values with the engine's HyperLogLog aggregate where it has one")
+	views := flag.Bool("views", false, "with --schemas, also compare the views and materialized views of the schemas, and in count mode show when materialized views were last refreshed (Snowflake and BigQuery)")
+	partitions := flag.Bool("partitions", false, "in count mode, count declaratively partitioned tables one partition at a time and list the partitions whose counts differ (PostgreSQL 12 or later and MySQL)")
+	snapshot := flag.Bool("snapshot", false, "in count and sample modes, count every table of a database in one repeatable read transaction taken at the start of the run, so the counts are consistent with each other (PostgreSQL, MySQL and SQLite)")
+	freshnessColumn := flag.String("freshness-column", dbdiff.DefaultFreshnessColumn, "in freshness mode, the timestamp column whose latest value is compared, unless a table sets \"freshness_column\" in --config")
+	groupBy := flag.String("group-by", "", "in groups mode, the SQL expression rows are counted by, such as tenant_id or date_trunc('day', created_at), unless a table sets \"group_by\" in --config")
+	sampleSize := flag.Int("sample-size", 1000, "in sample mode, keys sampled on each database per table")
+	localize := flag.Bool("localize", false, "in checksum mode, bisect mismatched key ranges until the differing keys are found")
+	sourceTimeZone := flag.String("source-time-zone", "", "in rows and checksum modes, the time zone (e.g. Europe/Berlin) the source's timestamps without a time zone are in, so they match the same instants stored with one on the destination")
+	destTimeZone := flag.String("dest-time-zone", "", "like --source-time-zone, for the destination's timestamps without a time zone")
+	floatEpsilon := flag.Float64("float-epsilon", 0, "in rows and checksum modes, match numbers differing by at most this much")
+	trimTrailingSpace := flag.Bool("trim-trailing-space", false, "in rows and checksum modes, ignore whitespace at the end of text values")
+	ignoreCase := flag.Bool("ignore-case", false, "in rows and checksum modes, compare text values case-insensitively")
+	unicodeForm := flag.String("unicode-form", "", "in rows and checksum modes, compare text values in this Unicode normalization form: NFC, NFD, NFKC or NFKD")
+	collation := flag.String("collation", "", "in rows and checksum modes, compare text values under the collation of this BCP 47 language tag, such as de or en-u-ks-level2, matching those it sorts as equal")
+	sortJSONKeys := flag.Bool("sort-json-keys", false, "in rows and checksum modes, compare JSON text regardless of the order and spacing of its keys")
+	examples := flag.Int("examples", 0, "in count and checksum modes, show up to this many rows found on one side only for tables whose exact counts or checksums differ, by merging the tables' primary keys")
+	hashBinaryOver := flag.String("hash-binary-over", "", "in rows mode and client-side checksums, compare binary values (bytea, BLOB, VARBINARY, ...) larger than this size, such as 64KB, by an MD5 computed on the database instead of reading them; empty reads them whole")
+	mask := flag.String("mask", "", "mask the values of columns wherever rows are shown, in reports, logs, notifications and --sync-sql, as column=rule pairs such as email=hash,ssn=partial, with hash, redact or partial, adding to the tables' \"mask\" in --config")
+	fdw := flag.Bool("fdw", false, "in rows mode, when both databases are PostgreSQL, count the missing and mismatched rows of each table with one query on the source, reaching the destination through postgres_fdw, instead of transferring the rows; the rows themselves aren't listed")
+	fdwServer := flag.String("fdw-server", "", "with --fdw, the foreign server on the source that reaches the destination, instead of creating one from DEST_CONN")
+	syncSQL := flag.String("sync-sql", "", "in rows mode, or checksum mode with --localize, write the INSERT, UPDATE and DELETE statements that would bring the destination in line with the source to this file")
+	apply := flag.Bool("apply", false, "in rows mode, or checksum mode with --localize, run the statements that bring the destination in line with the source on it after comparing")
+	applyBatchSize := flag.Int("apply-batch-size", 100, "with --apply, statements run per transaction")
+	applyMaxRows := flag.Int("apply-max-rows", 1000, "with --apply, repair nothing when more rows than this differ across the tables")
+	dryRun := flag.Bool("dry-run", false, "with --apply, log the statements instead of running them")
+	leafSize := flag.Int("leaf-size", 100, "with --localize, stop bisecting once a key range has at most this many rows and compare them directly")
+	maxDiff := flag.Int("max-diff", -1, "exit with status 3 when a table's drift exceeds this many rows (or schema differences, or drifting sequences); -1 disables")
+	maxDiffPct := flag.Float64("max-diff-pct", -1, "exit with status 3 when a table's drift exceeds this percentage of its rows; -1 disables")
+	watch := flag.Duration("watch", 0, "repeat the comparison at this interval (e.g. 5m) until interrupted, printing whether each table's diff is growing, shrinking or stable")
+	scheduleExpr := flag.String("schedule", "", "repeat the comparison on this cron schedule in local time (e.g. \"0 */6 * * *\" or @daily) until interrupted, like --watch")
+	metricsAddr := flag.String("metrics-addr", "", "with --watch or --schedule, serve Prometheus metrics at /metrics on this address (e.g. :9187)")
+	notifyURL := flag.String("notify", "", "post a summary of each run to this Slack incoming webhook or HTTP endpoint")
+	notifyTemplate := flag.String("notify-template", "", "text/template file for the notification message")
+	notifyDriftOnly := flag.Bool("notify-drift-only", false, "only notify about tables over their drift threshold, and not at all when there are none")
+	alertRulesPath := flag.String("alert-rules", "", "with --watch or --schedule, open and resolve PagerDuty or Opsgenie incidents by the rules in this JSON file, with the keys from PAGERDUTY_ROUTING_KEY or OPSGENIE_API_KEY")
+	retries := flag.Int("retries", 2, "retry count and checksum queries this many times after transient failures such as dropped connections")
+	retryBackoff := flag.Duration("retry-backoff", time.Second, "delay before the first retry, doubled for each one after it")
+	retryJitter := flag.Float64("retry-jitter", 0.2, "randomize each retry delay by up to this fraction of it")
+	asOf := flag.String("as-of", "", "compare the destination against the source as it was at this time, such as a restored backup or a delayed replica: an RFC 3339 timestamp (e.g. 2024-05-01T12:00:00Z), or a duration before each run (e.g. 1h); tables are read through their \"history\" in --config, or without one the engine's temporal query on SQL Server, MariaDB, Oracle, Snowflake and BigQuery")
+	waitForReplica := flag.Duration("wait-for-replica", 0, "before comparing, wait up to this long (e.g. 5m) for the destination, a PostgreSQL streaming replica of the source, to replay the source's current WAL position, so replication lag doesn't show up as drift; 0 disables")
+	queryTimeout := flag.Duration("query-timeout", 0, "give up on a table whose comparison takes longer than this (e.g. 10m), unless --config sets the table's own timeout, also setting statement_timeout on Postgres; 0 disables")
+	tableTimeouts := flag.Bool("table-timeouts", true, "give up on the tables --config sets a timeout for once it's up; false leaves them to --query-timeout, as when re-running the tables that timed out")
+	writeTimedOut := flag.String("write-timed-out", "", "write the tables whose comparison timed out to this file, one per line, to compare just those again with --tables-file")
+	logLevel := flag.String("log-level", "info", "log messages at this level and above: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "log format: text or json")
+	tui := flag.Bool("tui", false, "browse the results in a full screen view as the tables are compared, sorting and filtering them and diffing a table's rows on demand; the report is only written with --output")
+	noProgress := flag.Bool("no-progress", false, "don't show the progress line on stderr, which is only shown when it's a terminal")
+	quiet := flag.Bool("quiet", false, "only log warnings and errors, without the progress line, so that stdout holds nothing but the report and can be piped")
+	sourceConcurrency := flag.Int("source-concurrency", 5, "run at most this many queries on the source at once")
+	pairwise := flag.Bool("pairwise", false, "with several destinations in DESTS, compare every pair of the databases, the source included, instead of each destination against the source")
+	destConcurrency := flag.Int("dest-concurrency", 5, "run at most this many queries on the destination at once, lower for a weaker replica; DEST_<NAME>_CONCURRENCY overrides it for each of several DESTS")
+	baselinePath := flag.String("baseline", "", "JSON file of the drift accepted for each table, or tables whose drift is ignored, so only deviations from it count against --max-diff and --max-diff-pct, or fail the run when neither is set")
+	writeBaselinePath := flag.String("write-baseline", "", "write the drift of every compared table to this file, to accept it with --baseline in later runs")
+	junitPath := flag.String("junit", "", "also write the results to this file as JUnit XML, a test case per table and check that fails when the table drifts past its threshold, for CI servers to show")
+	github := flag.Bool("github", false, "when run in GitHub Actions, print an annotation for every drifting or failed table and check, and append the report in Markdown to the job summary")
+	listen := flag.String("listen", "127.0.0.1:8080", "with the serve subcommand, the address the API listens on, only this machine by default; set SERVE_TOKEN before serving other machines")
+	grpcListen := flag.String("grpc-listen", "", "with the serve subcommand, also serve the gRPC service defined in pkg/api/databasediff.proto on this address (e.g. 127.0.0.1:9090)")
+	historyConn := flag.String("history", "", "record every run's results in this history database, a SQLite file or a connection string such as postgres://..., for the history subcommand to show their trends")
+	historyTable := flag.String("history-table", defaultHistoryTable, "with --history, the table the results are recorded in, created if missing")
+	kafkaTopic := flag.String("kafka-topic", "", "publish every table's result, and every threshold exceeded, as JSON events to this Kafka topic on --kafka-brokers")
+	kafkaTLS := flag.Bool("kafka-tls", false, "connect to the Kafka brokers over TLS")
+	uploadTo := flag.String("upload", "", "upload every run's report to this s3://bucket/key or gs://bucket/key, a text/template with {{.Date}}, {{.Time}}, {{.Mode}}, {{.Ext}} and {{env \"NAME\"}} (e.g. s3://audit/{{env \"ENVIRONMENT\"}}/{{.Date}}/report-{{.Time}}.{{.Ext}})")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "export OpenTelemetry traces of every run, its tables and their queries over OTLP/HTTP to this collector (e.g. http://localhost:4318)")
+	statsdAddr := flag.String("statsd", "", "push every run's per-table gauges and durations to this StatsD or DogStatsD server (e.g. localhost:8125)")
+	statsdPrefix := flag.String("statsd-prefix", "databasediff.", "with --statsd, the prefix of the metric names")
+	statePath := flag.String("state", "", "save the run's progress to this file as it goes, the tables compared and how far rows comparisons got, for --resume to continue it after a crash or interrupt; it's removed once every table is compared")
+	skipUnchanged := flag.String("skip-unchanged", "", "keep every table's last result in this file, and skip the tables written to on neither database since, reporting their last result, on Postgres and MySQL, which keep track of writes")
+	resume := flag.Bool("resume", false, "continue the run saved in --state where it left off, only comparing the tables it hasn't")
+	var schemas, emailTo, kafkaBrokers, statsdTags, plugins listFlag
+	flag.Var(&plugins, "plugin", "load this Go plugin, built with -buildmode=plugin against the same databasediff, whose init registers comparison strategies as modes; may be repeated or comma separated")
+	flag.Var(&statsdTags, "statsd-tags", "with --statsd, comma separated tags added to every metric, such as env:prod,team:data")
+	flag.Var(&kafkaBrokers, "kafka-brokers", "comma separated host:port addresses of the Kafka brokers to publish to --kafka-topic on, authenticating as KAFKA_USER if set")
+	flag.Var(&emailTo, "email-to", "email the report to these comma separated addresses after each run, over the SMTP server in SMTP_ADDR")
+	flag.Var(&schemas, "schemas", "compare every table in these schemas of the source, grouping the report by schema; may be repeated or comma separated")
+	var include, exclude dbdiff.TablePatterns
+	flag.Var(&include, "include", "only compare tables matching this glob, or regular expression between slashes (/^imx_/); may be repeated or comma separated")
+	flag.Var(&exclude, "exclude", "skip tables matching this glob or /regular expression/; may be repeated or comma separated")
+	if serving || checking {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
+
+	// quiet runs only log what needs looking at, on stderr as ever
+	if *quiet {
+		*noProgress = true
+		if level, err := zapcore.ParseLevel(*logLevel); err == nil && level < zapcore.WarnLevel {
+			*logLevel = "warn"
+		}
+	}
+	// a progress line needs the terminal to itself, around the logs and report
+	var term *terminal
+	var logOut zapcore.WriteSyncer = zapcore.Lock(os.Stderr)
+	// as does the browser, holding back the logs until it's quit
+	var logs *heldWriter
+	if *tui {
+		logs = &heldWriter{w: os.Stderr}
+		logOut = logs
+		stdout = io.Discard
+	} else if !*noProgress && isTerminal(os.Stderr) {
+		term = &terminal{}
+		logOut = term
+		if isTerminal(os.Stdout) {
+			stdout = term.around(os.Stdout)
+		}
+	}
+	zapLogger, err := newLogger(*logLevel, *logFormat, logOut)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer zapLogger.Sync()
+	logger = zapLogger.Sugar()
+
+	if err := loadPlugins(plugins); err != nil {
+		logger.Fatal(err)
+	}
+	if *mode != dbdiff.ModeCount && *mode != dbdiff.ModeRows && *mode != dbdiff.ModeChecksum && *mode != dbdiff.ModeSchema && *mode != dbdiff.ModeSequences && *mode != dbdiff.ModeSample && *mode != dbdiff.ModeFreshness &&
+		*mode != dbdiff.ModeAggregates && *mode != dbdiff.ModeGroups && *mode != dbdiff.ModeKeys && *mode != dbdiff.ModeGrants && *mode != dbdiff.ModeMembership &&
+		*mode != dbdiff.ModeDistinct && !dbdiff.IsStrategy(*mode) {
+		logger.Fatalf("unknown mode %q", *mode)
+	}
+	if *batchSize <= 0 {
+		logger.Fatal("--batch-size must be positive")
+	}
+	if *chunkSize < 0 {
+		logger.Fatal("--chunk-size must not be negative")
+	}
+	var memory int64
+	var hashOver int64
+	if *hashBinaryOver != "" {
+		var err error
+		if hashOver, err = dbdiff.ParseByteSize(*hashBinaryOver); err != nil || hashOver <= 0 {
+			logger.Fatalf("--hash-binary-over must be a size such as 64KB, not %q", *hashBinaryOver)
+		}
+	}
+	if *memoryLimit != "" {
+		var err error
+		if memory, err = dbdiff.ParseByteSize(*memoryLimit); err != nil || memory <= 0 {
+			logger.Fatalf("--memory-limit must be a size such as 256MB, not %q", *memoryLimit)
+		}
+	}
+	if *tableParallelism < 0 {
+		logger.Fatal("--table-parallelism must not be negative")
+	}
+	if *checksum != dbdiff.ChecksumServer && *checksum != dbdiff.ChecksumClient {
+		logger.Fatalf("unknown checksum location %q", *checksum)
+	}
+	if *leafSize <= 0 {
+		logger.Fatal("--leaf-size must be positive")
+	}
+	if *sourceConcurrency <= 0 || *destConcurrency <= 0 {
+		logger.Fatal("--source-concurrency and --dest-concurrency must be positive")
+	}
+	if *retries < 0 {
+		logger.Fatal("--retries must not be negative")
+	}
+	if *retryJitter < 0 || *retryJitter > 1 {
+		logger.Fatal("--retry-jitter must be between 0 and 1")
+	}
+	if *queryTimeout < 0 {
+		logger.Fatal("--query-timeout must not be negative")
+	}
+	if *fdw && *mode != dbdiff.ModeRows {
+		logger.Fatal("--fdw requires --mode=rows")
+	}
+	if *fdwServer != "" && !*fdw {
+		logger.Fatal("--fdw-server requires --fdw")
+	}
+	if *fdw && (*syncSQL != "" || *apply) {
+		logger.Fatal("--fdw can't be combined with --sync-sql or --apply, as the differing rows aren't read")
+	}
+	if *partitions && *mode != dbdiff.ModeCount {
+		logger.Fatal("--partitions requires --mode=count")
+	}
+	if *estimate && *mode != dbdiff.ModeCount && *mode != dbdiff.ModeSample {
+		logger.Fatal("--estimate requires --mode=count or --mode=sample")
+	}
+	if *snapshot && *mode != dbdiff.ModeCount && *mode != dbdiff.ModeSample {
+		logger.Fatal("--snapshot requires --mode=count or --mode=sample")
+	}
+	if *syncSQL != "" && *mode != dbdiff.ModeRows && !(*mode == dbdiff.ModeChecksum && *localize) {
+		logger.Fatal("--sync-sql requires --mode=rows, or --mode=checksum with --localize")
+	}
+	if *apply && *mode != dbdiff.ModeRows && !(*mode == dbdiff.ModeChecksum && *localize) {
+		logger.Fatal("--apply requires --mode=rows, or --mode=checksum with --localize")
+	}
+	if *watch < 0 {
+		logger.Fatal("--watch must not be negative")
+	}
+	var cron *schedule
+	if *scheduleExpr != "" {
+		if *watch > 0 {
+			logger.Fatal("--schedule can't be combined with --watch")
+		}
+		var err error
+		if cron, err = parseSchedule(*scheduleExpr); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	// with either, the comparison runs in rounds until interrupted
+	repeat := *watch > 0 || cron != nil
+	if *apply && repeat {
+		logger.Fatal("--apply can't be combined with --watch or --schedule")
+	}
+	if *apply && (*applyBatchSize <= 0 || *applyMaxRows <= 0) {
+		logger.Fatal("--apply-batch-size and --apply-max-rows must be positive")
+	}
+	if *dryRun && !*apply {
+		logger.Fatal("--dry-run requires --apply")
+	}
+	if *floatEpsilon < 0 {
+		logger.Fatal("--float-epsilon must not be negative")
+	}
+	normalize := dbdiff.Normalization{
+		FloatEpsilon:      *floatEpsilon,
+		TrimTrailingSpace: *trimTrailingSpace,
+		IgnoreCase:        *ignoreCase,
+		SortJSONKeys:      *sortJSONKeys,
+		UnicodeForm:       strings.ToUpper(*unicodeForm),
+		Collation:         *collation,
+	}
+	if err := normalize.Validate(); err != nil {
+		logger.Fatal(err)
+	}
+	for _, zone := range []struct {
+		name     string
+		location **time.Location
+	}{{*sourceTimeZone, &normalize.SourceTimeZone}, {*destTimeZone, &normalize.DestTimeZone}} {
+		if zone.name == "" {
+			continue
+		}
+		location, err := time.LoadLocation(zone.name)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		*zone.location = location
+	}
+	masking, err := dbdiff.ParseMasking(*mask)
+	if err != nil {
+		logger.Fatalf("--mask: %v", err)
+	}
+	if *examples < 0 {
+		logger.Fatal("--examples must not be negative")
+	}
+	if *sampleSize <= 0 {
+		logger.Fatal("--sample-size must be positive")
+	}
+	if *waitForReplica < 0 {
+		logger.Fatal("--wait-for-replica must not be negative")
+	}
+	asOfTime, asOfAgo, err := parseAsOf(*asOf)
+	if err != nil {
+		logger.Fatalf("--as-of: %v", err)
+	}
+	if serving && (repeat || *apply) {
+		logger.Fatal("serve can't be combined with --watch, --schedule or --apply")
+	}
+	if *tui && (serving || repeat) {
+		logger.Fatal("--tui can't be combined with serve, --watch or --schedule")
+	}
+	if *tui && *quiet {
+		logger.Fatal("--tui can't be combined with --quiet")
+	}
+	if *tui && (!isTerminal(os.Stdin) || !isTerminal(os.Stdout)) {
+		logger.Fatal("--tui requires a terminal")
+	}
+	if *resume && *statePath == "" {
+		logger.Fatal("--resume requires --state")
+	}
+	if *statePath != "" && (serving || repeat) {
+		logger.Fatal("--state keeps the progress of a single run, not of serve, --watch or --schedule")
+	}
+	if *skipUnchanged != "" && serving {
+		logger.Fatal("--skip-unchanged can't be combined with serve")
+	}
+	if *metricsAddr != "" && !repeat {
+		logger.Fatal("--metrics-addr requires --watch or --schedule")
+	}
+	if *alertRulesPath != "" && !repeat {
+		logger.Fatal("--alert-rules requires --watch or --schedule, whose later rounds resolve the incidents")
+	}
+	if err := checkReportFormat(*format); err != nil {
+		logger.Fatal(err)
+	}
+	if *sortBy != "" {
+		known := false
+		for _, name := range reportSorts {
+			known = known || name == *sortBy
+		}
+		if !known {
+			logger.Fatalf("unknown sort %q (available: %s)", *sortBy, strings.Join(reportSorts, ", "))
+		}
+	}
+	var notifications *notifier
+	if *notifyURL != "" {
+		var err error
+		if notifications, err = newNotifier(*notifyURL, *notifyTemplate, *notifyDriftOnly); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	var alerts *alerter
+	if *alertRulesPath != "" {
+		rules, err := loadAlertRules(*alertRulesPath)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if alerts, err = newAlerter(rules); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	var uploads *uploader
+	if *uploadTo != "" {
+		var err error
+		if uploads, err = newUploader(*uploadTo); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	var pushed *statsd
+	if *statsdAddr != "" {
+		var err error
+		if pushed, err = newStatsD(*statsdAddr, *statsdPrefix, statsdTags); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	var events *kafkaPublisher
+	if len(kafkaBrokers) > 0 || *kafkaTopic != "" {
+		var err error
+		if events, err = newKafkaPublisher(kafkaBrokers, *kafkaTopic, *kafkaTLS); err != nil {
+			logger.Fatal(err)
+		}
+		defer events.close()
+	}
+	config := dbdiff.Config{}
+	if *configPath != "" {
+		var err error
+		if config, err = dbdiff.LoadConfig(*configPath); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	if *apply && (len(masking) > 0 || config.Masks()) {
+		logger.Fatal("--apply can't be combined with masked columns, as the statements hold the masked values")
+	}
+	var listed []string
+	if *tablesFile != "" || (!serving && isPipe(os.Stdin)) {
+		var err error
+		if listed, err = readTableList(*tablesFile); err != nil {
+			logger.Fatal(err)
+		}
+		if listed != nil && len(schemas) > 0 {
+			logger.Fatal("a table list can't be combined with --schemas")
+		}
+	}
+	var accepted *baseline
+	if *baselinePath != "" {
+		var err error
+		if accepted, err = loadBaseline(*baselinePath, *mode); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	// runs are traced only with an endpoint to export them to
+	var tracing *otlpTracer
+	var tracerProvider trace.TracerProvider = trace.NewNoopTracerProvider()
+	if *otlpEndpoint != "" {
+		var err error
+		if tracing, err = newOTLPTracer(*otlpEndpoint); err != nil {
+			logger.Fatal(err)
+		}
+		tracerProvider = tracing
+	}
+	tracer := tracerProvider.Tracer("databasediff")
+	options := dbdiff.Options{
+		Mode:            *mode,
+		BatchSize:       *batchSize,
+		ChunkSize:       *chunkSize,
+		Parallelism:     *tableParallelism,
+		MemoryLimit:     memory,
+		Checksum:        *checksum,
+		Estimate:        *estimate,
+		Partitions:      *partitions,
+		Views:           *views,
+		Localize:        *localize,
+		LeafSize:        *leafSize,
+		Examples:        *examples,
+		Normalize:       normalize,
+		HashBinaryOver:  hashOver,
+		Mask:            masking,
+		SyncSQL:         *syncSQL != "" || *apply,
+		FDW:             *fdw,
+		FDWServer:       *fdwServer,
+		SampleSize:      *sampleSize,
+		FreshnessColumn: *freshnessColumn,
+		GroupBy:         *groupBy,
+		Retry:           dbdiff.Retry{Retries: *retries, Backoff: *retryBackoff, Jitter: *retryJitter},
+		QueryTimeout:    *queryTimeout,
+		AsOf:            asOfTime,
+		Logger:          zapLogger,
+		TracerProvider:  tracerProvider,
+	}
 
-func main() {
 	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+		logger.Fatal("Error loading .env file")
+	}
+	if *profile != "" || *sourceProfile != "" || *destProfile != "" {
+		if *configPath == "" {
+			logger.Fatal("--profile, --source-profile and --dest-profile require --config")
+		}
+		if err := applyProfiles(config.Profiles, *profile, *sourceProfile, *destProfile); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	// hashes of masked values match across runs only under a key of one's own
+	if key := mustSecretEnv("MASK_KEY"); key != "" {
+		options.MaskKey = []byte(key)
+	}
+	var reportMailer *mailer
+	if len(emailTo) > 0 {
+		var err error
+		if reportMailer, err = newMailer(emailTo); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	var results *historyStore
+	if *historyConn != "" {
+		var err error
+		if results, err = openHistory(*historyConn, *historyTable); err != nil {
+			logger.Fatal(err)
+		}
+		defer results.db.Close()
 	}
 
 	// human-legible name of source DB (i.e. public-api)
-	sourceDB := os.Getenv("SRC_DB")
-	sourceConn := os.Getenv("SRC_CONN")
-	// i.e. orderbook DB
-	destDB := os.Getenv("DEST_DB")
-	destConn := os.Getenv("DEST_CONN")
-	databases, err := initializeDatabases(sourceDB, sourceConn, destDB, destConn)
+	source := connectionEndpoint(os.Getenv("SRC_DB"), "SRC", *sourceConcurrency)
+	dests := destEndpoints(*destConcurrency)
+	if len(dests) > 1 && options.Mode != dbdiff.ModeCount {
+		logger.Fatal("several destinations in DESTS can only be compared with --mode=count")
+	}
+	if *pairwise && len(dests) < 2 {
+		logger.Fatal("--pairwise requires several destinations in DESTS")
+	}
+	if *pairwise && *waitForReplica > 0 {
+		logger.Fatal("--wait-for-replica compares destinations against the source, not --pairwise")
+	}
+	if *pairwise && *asOf != "" {
+		logger.Fatal("--as-of compares destinations against the source, not --pairwise")
+	}
+	sourceDB := source.Name
+	destNames := make([]string, len(dests))
+	for i, dest := range dests {
+		destNames[i] = dest.Name
+	}
+	destDB := strings.Join(destNames, ", ")
+	var state *runState
+	if *statePath != "" {
+		var err error
+		if state, err = openState(*statePath, *resume, options.Mode, append([]string{sourceDB}, destNames...)); err != nil {
+			logger.Fatal(err)
+		}
+		options.Checkpoints = state
+	}
+	var last *lastResults
+	if *skipUnchanged != "" {
+		var err error
+		if last, err = openLastResults(*skipUnchanged, options.Mode); err != nil {
+			logger.Fatal(err)
+		}
+		options.Unchanged = last
+	}
+
+	var comparer *dbdiff.MultiComparer
+	if *pairwise {
+		comparer, err = dbdiff.OpenPairwise(append([]dbdiff.Endpoint{source}, dests...), options)
+	} else {
+		comparer, err = dbdiff.OpenMulti(source, dests, options)
+	}
 	if err != nil {
-		panic(err)
+		if checking {
+			logger.Errorw("Couldn't open the databases", "error", err)
+			return exitTableErrors
+		}
+		logger.Fatalw("Couldn't open the databases", "error", err)
+	}
+	logger.Info("Databases initialized")
+
+	defer func(comparer *dbdiff.MultiComparer) {
+		if err := comparer.Close(); err != nil {
+			logger.Errorw("Couldn't close the database connections", "error", err)
+			if status == 0 {
+				status = 1
+			}
+		}
+		logger.Debug("Database connections closed")
+	}(comparer)
+
+	ctx := context.Background()
+	candidates := config.TablesOr(tables)
+	if listed != nil {
+		candidates = config.TablesNamed(listed)
+	}
+	if len(schemas) > 0 {
+		if candidates, err = comparer.Comparers()[0].DiscoverTables(ctx, schemas, config); err != nil {
+			logger.Fatalw("Couldn't discover the tables", "schemas", schemas, "error", err)
+		}
+	}
+	names := dbdiff.SelectTables(candidates, include, exclude)
+	if len(names) == 0 {
+		logger.Fatal("no tables left to compare after --include and --exclude")
+	}
+	if !*tableTimeouts {
+		for i := range names {
+			names[i].Timeout = 0
+		}
 	}
-	fmt.Println("Databases initialized")
 
-	defer func(databases *Databases) {
-		err := databases.source.DB.Close()
+	// keep all databases busy: a table's comparison runs a query on each at
+	// once, and waits for a connection on the busier one
+	workers := source.Conns
+	for _, dest := range dests {
+		if dest.Conns > workers {
+			workers = dest.Conns
+		}
+	}
+	if checking {
+		return runCheck(ctx, comparer, names, options, workers)
+	}
+
+	for _, pair := range comparer.Comparers() {
+		if *checkSchema && options.Mode != dbdiff.ModeSchema && options.Mode != dbdiff.ModeSequences {
+			pair.CheckSchemas(ctx, names)
+		}
+		pair.Options.Tables = names
+	}
+	if options.Mode == dbdiff.ModeSequences && *allSequences {
+		names = append(names, dbdiff.TableConfig{Name: dbdiff.UnownedSequences})
+	}
+	if options.Mode == dbdiff.ModeSchema && *functions {
+		names = append(names, dbdiff.TableConfig{Name: dbdiff.Functions})
+	}
+	if options.Mode == dbdiff.ModeSchema && *settings {
+		names = append(names, dbdiff.TableConfig{Name: dbdiff.Settings})
+	}
+
+	// in watch mode, stop waiting for the next round on interrupt
+	stop, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	defer cancel()
+	// rounds come at the watch interval, or when the schedule next matches
+	nextRound := func() time.Time {
+		if cron != nil {
+			return cron.next(time.Now())
+		}
+		return time.Now().Add(*watch)
+	}
+	history := watchHistory{}
+	var gauges *metrics
+	if *metricsAddr != "" {
+		if gauges, err = serveMetrics(*metricsAddr); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	// the diffs are colored on a terminal, unless NO_COLOR is set, but not
+	// in the copies emailed or uploaded
+	colored := (*output == "" || *output == "-") && isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "" &&
+		!*tui && reportMailer == nil && uploads == nil
+	newReport := func(format string, w io.Writer) (ReportWriter, error) {
+		style := reportOptions{bySchema: len(schemas) > 0, onlyDrift: *onlyDiff}
+		if colored && format == "text" {
+			style.severity = func(t dbdiff.TableResult) severity {
+				diff, _ := t.Drift(options.Mode)
+				switch {
+				case exceedsThreshold(t, options.Mode, threshold{*maxDiff, *maxDiffPct}, config, accepted):
+					return severityExceeded
+				case diff != 0:
+					return severityDrift
+				}
+				return severityMatch
+			}
+		}
+		// JSONL lines are written per pair of databases, rather than once
+		// every destination's result for the table is in
+		if len(dests) > 1 && format != "jsonl" {
+			return newFanOutReportWriter(format, w, comparer, style)
+		}
+		return newReportWriter(format, w, options.Mode, sourceDB, destDB, style)
+	}
+	// wait for the replica and take a new snapshot before every watch round
+	// or served run
+	prepare := func() error {
+		if asOfAgo > 0 {
+			at := time.Now().Add(-asOfAgo)
+			for _, pair := range comparer.Comparers() {
+				pair.Options.AsOf = at
+			}
+		}
+		if *asOf != "" {
+			logger.Infow("Comparing against the source as of", "at", comparer.Comparers()[0].Options.AsOf.UTC().Format(time.RFC3339))
+		}
+		if *waitForReplica > 0 {
+			waitCtx, cancelWait := context.WithTimeout(ctx, *waitForReplica)
+			err := comparer.WaitForReplicas(waitCtx)
+			cancelWait()
+			// the lag is worth reporting too
+			if errors.Is(err, context.DeadlineExceeded) {
+				logger.Warnw("The replica didn't catch up in time, comparing anyway", "error", err)
+			} else if err != nil {
+				return fmt.Errorf("waiting for the replica: %w", err)
+			}
+		}
+		if *snapshot {
+			if err := comparer.TakeSnapshots(ctx); err != nil {
+				return fmt.Errorf("taking the snapshots: %w", err)
+			}
+		}
+		return nil
+	}
+	if serving {
+		compare := func(ctx context.Context, only []string, progress func(dbdiff.TableResult)) ([]dbdiff.TableResult, []dbdiff.CheckResult, []dbdiff.TableResult, error) {
+			// the snapshots would otherwise stay open until the next run
+			defer comparer.ReleaseSnapshots()
+			if err := prepare(); err != nil {
+				return nil, nil, nil, err
+			}
+			selected := names
+			if len(only) > 0 {
+				selected = nil
+				for _, table := range names {
+					for _, name := range only {
+						if table.Name == name {
+							selected = append(selected, table)
+							break
+						}
+					}
+				}
+			}
+			started := time.Now()
+			runCtx, span := startRun(ctx, tracer, options.Mode, len(selected))
+			var tableDiffs []dbdiff.TableResult
+			for result := range comparer.CompareTables(runCtx, selected, workers) {
+				for _, tableDiff := range result.Results {
+					progress(tableDiff)
+					tableDiffs = append(tableDiffs, tableDiff)
+				}
+			}
+			checkResults := comparer.RunChecks(runCtx, config.Checks)
+			endRun(span, tableDiffs, tracing)
+			countFailed(tableDiffs)
+			countChecks(checkResults)
+			exceeded := checkThresholds(tableDiffs, options.Mode, threshold{*maxDiff, *maxDiffPct}, config, accepted)
+			if pushed != nil {
+				if err := pushed.record(tableDiffs, options.Mode, exceeded, time.Since(started)); err != nil {
+					logger.Errorw("Couldn't push the metrics to StatsD", "error", err)
+				}
+			}
+			if results != nil {
+				if err := results.record(tableDiffs, options.Mode, time.Now()); err != nil {
+					logger.Errorw("Couldn't record the results in the history", "error", err)
+				}
+			}
+			if notifications != nil {
+				if err := notifications.notify(tableDiffs, options.Mode, sourceDB, destNames, *pairwise, exceeded); err != nil {
+					logger.Errorw("Couldn't send the notification", "error", err)
+				}
+			}
+			if events != nil {
+				if err := events.publish(tableDiffs, options.Mode, exceeded, time.Now()); err != nil {
+					logger.Errorw("Couldn't publish the results to Kafka", "error", err)
+				}
+			}
+			return tableDiffs, checkResults, exceeded, nil
+		}
+		if err := serve(stop, *listen, *grpcListen, mustSecretEnv("SERVE_TOKEN"), options.Mode, names, compare); err != nil {
+			logger.Fatal(err)
+		}
+		return 0
+	}
+	// a schedule's first round waits for it too, like cron's
+	if cron != nil && !wait(stop, nextRound()) {
+		return 0
+	}
+	// rounds that couldn't be prepared are skipped, failing the run when it's
+	// the last
+	failedRounds := 0
+	for {
+		if err := prepare(); err != nil {
+			comparer.ReleaseSnapshots()
+			failedRounds++
+			logger.Errorw("Couldn't prepare the comparison", "error", err, "failed_rounds", failedRounds)
+			if !repeat || !wait(stop, nextRound()) {
+				return exitTableErrors
+			}
+			continue
+		}
+		out, err := openReportOutput(*format, *output)
 		if err != nil {
-			panic(err)
+			logger.Fatal(err)
 		}
-		err = databases.dest.DB.Close()
+		// keep a copy of the report to email or upload
+		var reportCopy bytes.Buffer
+		var w io.Writer = out
+		if reportMailer != nil || uploads != nil {
+			w = io.MultiWriter(out, &reportCopy)
+		}
+		report, err := newReport(*format, w)
 		if err != nil {
-			panic(err)
+			logger.Fatal(err)
+		}
+		var browse *browser
+		if *tui {
+			browse = newBrowser(ctx, options.Mode, len(names)*len(comparer.Comparers()), pairRowDiff(comparer, names))
+			report = browserReportWriter{report, browse}
+			logs.hold()
+			if err := browse.start(); err != nil {
+				logs.release()
+				logger.Fatal(err)
+			}
+			defer func() {
+				browse.close()
+				logs.release()
+			}()
+		}
+		// how far behind the replicas are as the run starts tells the drift
+		// their lag explains from lost data
+		if err := report.WriteReplication(comparer.Replication(ctx)); err != nil {
+			logger.Fatalw("Couldn't write the report", "error", err)
+		}
+		started := time.Now()
+		// an interrupt stops a run whose progress is saved, rather than
+		// waiting for it to finish
+		runCtx := ctx
+		if state != nil {
+			runCtx = stop
+		}
+		runCtx, span := startRun(runCtx, tracer, options.Mode, len(names))
+		// JSONL is written as the tables finish rather than sorted by schema
+		order := reportOrder{mode: options.Mode, bySchema: len(schemas) > 0 && *format != "jsonl", sort: *sortBy}
+		tableDiffs, checkResults := compareAll(runCtx, comparer, names, config.Checks, workers, report, order, term, state)
+		// a watch or schedule waits for its next round without holding them
+		comparer.ReleaseSnapshots()
+		took := time.Since(started)
+		endRun(span, tableDiffs, tracing)
+		if err := out.Close(); err != nil {
+			logger.Fatalw("Couldn't write the report", "output", *output, "error", err)
+		}
+		if browse != nil {
+			browse.done()
+			browse.wait()
+			browse.close()
+			logs.release()
+		}
+		if state != nil {
+			if err := state.finish(tableDiffs); err != nil {
+				logger.Errorw("Couldn't save the state", "state", *statePath, "error", err)
+			}
+			if stop.Err() != nil {
+				logger.Warnw("Interrupted, continue the run with --resume", "state", *statePath)
+				return exitTableErrors
+			}
+		}
+		logger.Infow("Comparison finished", "tables", len(tableDiffs), "checks", len(config.Checks))
+		applyFailed := false
+		if *syncSQL != "" {
+			if err := writeSyncSQL(*syncSQL, tableDiffs); err != nil {
+				logger.Errorw("Couldn't write the sync SQL", "error", err)
+			}
+		}
+		if *apply {
+			applyOptions := dbdiff.ApplyOptions{BatchSize: *applyBatchSize, MaxRows: *applyMaxRows, DryRun: *dryRun}
+			applied, err := comparer.Comparers()[0].ApplySync(ctx, tableDiffs, applyOptions)
+			if err != nil {
+				logger.Errorw("Couldn't apply the repairs, those applied before stay committed", "applied", applied, "error", err)
+				applyFailed = true
+				// the table fails, in the summaries and notifications
+				var failure *dbdiff.ApplyError
+				if errors.As(err, &failure) {
+					for i := range tableDiffs {
+						if tableDiffs[i].Name == failure.Table && tableDiffs[i].Err == nil {
+							tableDiffs[i].Err = fmt.Errorf("applying the repairs: %w", failure.Err)
+						}
+					}
+				}
+			} else if !*dryRun {
+				logger.Infow("Repairs applied", "applied", applied)
+			}
 		}
-		fmt.Println("Database connections closed")
-	}(databases)
 
-	ctx := context.Background()
-	maxConn := int(math.Min(float64(len(tables)), float64(maxOpenConnection)))
-	limiter := make(chan bool, maxConn)
-	tableDiffStream := make(chan TableDiff, len(tables))
-	defer close(tableDiffStream)
+		if *writeTimedOut != "" {
+			if err := writeTimedOutTables(*writeTimedOut, tableDiffs); err != nil {
+				logger.Errorw("Couldn't write the tables that timed out", "error", err)
+			}
+		}
+		if *writeBaselinePath != "" {
+			if err := writeBaseline(*writeBaselinePath, options.Mode, tableDiffs, len(dests)); err != nil {
+				logger.Errorw("Couldn't write the baseline", "error", err)
+			}
+		}
+		if last != nil {
+			if err := last.record(tableDiffs, names); err != nil {
+				logger.Errorw("Couldn't keep the last results", "error", err)
+			}
+		}
+		history.record(tableDiffs, options.Mode)
+		if results != nil {
+			if err := results.record(tableDiffs, options.Mode, time.Now()); err != nil {
+				logger.Errorw("Couldn't record the results in the history", "error", err)
+			}
+		}
+		if gauges != nil {
+			gauges.record(tableDiffs, options.Mode, time.Now())
+		}
+		exceeded := checkThresholds(tableDiffs, options.Mode, threshold{*maxDiff, *maxDiffPct}, config, accepted)
+		if pushed != nil {
+			if err := pushed.record(tableDiffs, options.Mode, exceeded, took); err != nil {
+				logger.Errorw("Couldn't push the metrics to StatsD", "error", err)
+			}
+		}
+		failed := countFailed(tableDiffs)
+		failedChecks, differingChecks := countChecks(checkResults)
+		if *github {
+			if err := writeGitHubAnnotations(stdout, options.Mode, tableDiffs, exceeded, checkResults); err != nil {
+				logger.Errorw("Couldn't write the GitHub annotations", "error", err)
+			}
+			markdown := func(w io.Writer) (ReportWriter, error) { return newReport("markdown", w) }
+			if err := writeGitHubSummary(markdown, options.Mode, tableDiffs, len(exceeded), failed, checkResults); err != nil {
+				logger.Errorw("Couldn't write the GitHub job summary", "error", err)
+			}
+		}
+		if *junitPath != "" {
+			if err := writeJUnit(*junitPath, options.Mode, tableDiffs, exceeded, checkResults); err != nil {
+				logger.Errorw("Couldn't write the JUnit report", "error", err)
+			}
+		}
+		if uploads != nil {
+			location, err := uploads.upload(ctx, reportCopy.Bytes(), *format, options.Mode, sourceDB, destDB, started)
+			if err != nil {
+				logger.Errorw("Couldn't upload the report", "error", err)
+			} else {
+				logger.Infow("Report uploaded", "url", location)
+			}
+		}
+		if reportMailer != nil {
+			subject := reportSubject(options.Mode, sourceDB, destDB, len(tableDiffs), len(exceeded))
+			if err := reportMailer.send(subject, *format, reportCopy.Bytes()); err != nil {
+				logger.Errorw("Couldn't email the report", "error", err)
+			}
+		}
+		if notifications != nil {
+			// a failed notification shouldn't end a watch
+			if err := notifications.notify(tableDiffs, options.Mode, sourceDB, destNames, *pairwise, exceeded); err != nil {
+				logger.Errorw("Couldn't send the notification", "error", err)
+			}
+		}
+		if events != nil {
+			if err := events.publish(tableDiffs, options.Mode, exceeded, time.Now()); err != nil {
+				logger.Errorw("Couldn't publish the results to Kafka", "error", err)
+			}
+		}
+		if alerts != nil {
+			alerts.evaluate(tableDiffs, options.Mode)
+		}
+		if !repeat || !wait(stop, nextRound()) {
+			if failed > 0 || failedChecks > 0 || applyFailed {
+				return exitTableErrors
+			}
+			if len(exceeded) > 0 || differingChecks > 0 {
+				return exitDrift
+			}
+			return 0
+		}
+	}
+}
+
+// resultKey identifies a table's result among those of several pairs of
+// databases.
+type resultKey struct {
+	Table, Source, Dest string
+}
 
-	for _, tableName := range tables {
-		go compareTables(ctx, limiter, tableDiffStream, tableName, databases)
+func keyOf(table dbdiff.TableResult) resultKey {
+	return resultKey{table.Name, table.Source, table.Dest}
+}
+
+// countFailed prints how many tables couldn't be compared and returns it.
+func countFailed(tableDiffs []dbdiff.TableResult) int {
+	failed := 0
+	for _, table := range tableDiffs {
+		if table.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		logger.Warnw("Some tables couldn't be compared", "failed", failed, "tables", len(tableDiffs))
 	}
+	return failed
+}
 
-	printTableDiffStream(tableDiffStream, sourceDB, destDB)
-	fmt.Println("Done")
+// countChecks prints how many checks couldn't be run or differ, and returns
+// both.
+func countChecks(checks []dbdiff.CheckResult) (failed, differing int) {
+	for _, check := range checks {
+		switch {
+		case check.Err != nil:
+			failed++
+		case !check.Passed():
+			differing++
+		}
+	}
+	if failed > 0 || differing > 0 {
+		logger.Warnw("Some checks didn't pass", "failed", failed, "differing", differing, "checks", len(checks))
+	}
+	return failed, differing
 }
 
-func initializeDatabases(sourceDB, sourceConn, destDB, destConn string) (*Databases, error) {
-	srcdb, err := sqlx.Open("postgres", sourceConn)
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
+// wait sleeps until the next round and reports whether to run it, which it
+// doesn't once interrupted.
+func wait(stop context.Context, at time.Time) bool {
+	in := time.Until(at)
+	logger.Infow("Waiting for the next comparison", "in", in.Round(time.Second), "at", at.Format(time.RFC3339))
+	select {
+	case <-stop.Done():
+		logger.Info("Interrupted, stopping")
+		return false
+	case <-time.After(in):
+		return true
 	}
-	srcdb.SetMaxOpenConns(maxOpenConnection)
+}
 
-	destdb, err := sqlx.Open("postgres", destConn)
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
+// compareAll compares every table, then runs the checks, and writes them to
+// the report, with a result per destination.
+// With a state, the tables it holds the results of aren't compared again.
+func compareAll(ctx context.Context, comparer *dbdiff.MultiComparer, names []dbdiff.TableConfig, checks []dbdiff.Check, workers int, report ReportWriter, order reportOrder, term *terminal, state *runState) ([]dbdiff.TableResult, []dbdiff.CheckResult) {
+	bar := term.startProgress(comparer, len(names))
+	var stream <-chan dbdiff.MultiResult
+	if state != nil {
+		remaining, restored := state.resumed(names, comparer)
+		if len(restored) > 0 {
+			logger.Infow("Resuming the run", "compared", len(restored), "remaining", len(remaining))
+		}
+		stream = state.track(restored, comparer.CompareTables(ctx, remaining, workers))
+	} else {
+		stream = comparer.CompareTables(ctx, names, workers)
 	}
-	destdb.SetMaxOpenConns(maxOpenConnection)
+	tableDiffs := printTableDiffStream(stream, report, len(names), order, bar)
+	bar.finish()
+	checkResults := comparer.RunChecks(ctx, checks)
+	if err := report.WriteCheckResults(checkResults); err != nil {
+		logger.Fatalw("Couldn't write the report", "error", err)
+	}
+	if err := report.Close(); err != nil {
+		logger.Fatalw("Couldn't write the report", "error", err)
+	}
+	return tableDiffs, checkResults
+}
+
+const defaultHTMLReport = "databasediff-report.html"
 
-	return &Databases{
-		DB{srcdb, sourceDB},
-		DB{destdb, destDB},
-	}, nil
+// openReportOutput returns where the report should be written: the given
+// file, or stdout when none is set. HTML reports are standalone documents, so
+// they go to a file by default.
+func openReportOutput(format, output string) (io.WriteCloser, error) {
+	if output == "" && format == "html" {
+		output = defaultHTMLReport
+	}
+	if output == "" || output == "-" {
+		return nopWriteCloser{stdout}, nil
+	}
+	return os.Create(output)
 }
 
-func printTableDiffStream(tableDiffStream chan TableDiff, sourceDB, destDB string) {
-	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
-	if _, err := fmt.Fprintf(w, "\nTable\t%s\t%s\tDiff\n", sourceDB, destDB); err != nil {
-		panic(err)
+// readTableList reads the tables to compare from the file, or from stdin
+// when it's - or empty, one per line. Blank lines and those starting with #
+// are skipped, as are tables listed twice. Only a list asked for by name must
+// hold a table, so that an empty pipe leaves the configured list in place.
+func readTableList(path string) ([]string, error) {
+	in, name := os.Stdin, "stdin"
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		in, name = file, path
 	}
+	var names []string
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+		seen[line] = true
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(names) == 0 && path != "" {
+		return nil, fmt.Errorf("%s lists no tables", name)
+	}
+	return names, nil
+}
 
-	for range tables {
-		select {
-		case tableDiff := <-tableDiffStream:
-			printTableDiff(w, tableDiff)
+// writeTimedOutTables writes the tables whose comparison timed out, on any
+// destination, in the format readTableList reads. The file is left empty
+// when none did.
+func writeTimedOutTables(path string, tableDiffs []dbdiff.TableResult) error {
+	var list bytes.Buffer
+	seen := map[string]bool{}
+	for _, table := range tableDiffs {
+		if table.TimedOut() && !seen[table.Name] {
+			seen[table.Name] = true
+			fmt.Fprintln(&list, table.Name)
 		}
 	}
-	if err := w.Flush(); err != nil {
-		panic(err)
+	return os.WriteFile(path, list.Bytes(), 0o644)
+}
+
+// connectionEndpoint reads a database's connection settings from the
+// environment variables with the prefix, e.g. SRC_CONN and SRC_SSLMODE for
+// the source.
+func connectionEndpoint(name, prefix string, conns int) dbdiff.Endpoint {
+	return dbdiff.Endpoint{
+		Name:     name,
+		Conn:     mustSecretEnv(prefix + "_CONN"),
+		TLS:      connectionTLS(prefix),
+		SSH:      connectionSSH(prefix),
+		IAMAuth:  connectionIAMAuth(prefix),
+		Conns:    conns,
+		Pool:     connectionPool(prefix),
+		Throttle: connectionThrottle(prefix),
 	}
 }
 
-func printTableDiff(w *tabwriter.Writer, tableDiff TableDiff) {
-	_, err := fmt.Fprintf(w, "%s\t%d\t%d\t\t%d\n", tableDiff.Name, tableDiff.SourceRowCount, tableDiff.DestRowCount, tableDiff.SourceRowCount-tableDiff.DestRowCount)
-	if err != nil {
-		panic(err)
+// destEndpoints reads the destinations: DEST_DB and DEST_CONN, or each of
+// the comma separated names in DESTS, whose variables are prefixed with
+// DEST_ and the upper-cased name, as in DEST_EU_WEST_CONN for eu-west. Their
+// DEST_<NAME>_CONCURRENCY overrides --dest-concurrency.
+func destEndpoints(concurrency int) []dbdiff.Endpoint {
+	if os.Getenv("DESTS") == "" {
+		// i.e. orderbook DB
+		return []dbdiff.Endpoint{connectionEndpoint(os.Getenv("DEST_DB"), "DEST", concurrency)}
 	}
+	var dests []dbdiff.Endpoint
+	seen := map[string]bool{}
+	for _, name := range strings.Split(os.Getenv("DESTS"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if seen[name] {
+			logger.Fatalf("DESTS lists %s twice", name)
+		}
+		seen[name] = true
+		prefix := "DEST_" + strings.ToUpper(envName.ReplaceAllString(name, "_"))
+		conns := concurrency
+		if value := os.Getenv(prefix + "_CONCURRENCY"); value != "" {
+			var err error
+			if conns, err = strconv.Atoi(value); err != nil || conns <= 0 {
+				logger.Fatalf("%s_CONCURRENCY must be a positive number", prefix)
+			}
+		}
+		dests = append(dests, connectionEndpoint(name, prefix, conns))
+	}
+	if len(dests) == 0 {
+		logger.Fatal("DESTS names no destinations")
+	}
+	return dests
 }
 
-func compareTables(ctx context.Context, limiter chan bool, tableDiffStream chan TableDiff, tableName string, databases *Databases) {
-	limiter <- true
+// envName matches the characters of a destination's name that can't be in
+// an environment variable's.
+var envName = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// connectionTLS reads a connection's TLS options from the environment, e.g.
+// SRC_SSLMODE and SRC_SSLROOTCERT for the source.
+func connectionTLS(prefix string) dbdiff.TLS {
+	return dbdiff.TLS{
+		Mode:     os.Getenv(prefix + "_SSLMODE"),
+		RootCert: os.Getenv(prefix + "_SSLROOTCERT"),
+		Cert:     os.Getenv(prefix + "_SSLCERT"),
+		Key:      os.Getenv(prefix + "_SSLKEY"),
+	}
+}
 
-	table := TableDiff{Name: tableName}
-	start := time.Now()
-	c1 := make(chan int)
-	c2 := make(chan int)
+// connectionSSH reads the SSH jump host to reach a database through from the
+// environment, e.g. DEST_SSH_HOST for the destination.
+func connectionSSH(prefix string) dbdiff.SSHTunnel {
+	return dbdiff.SSHTunnel{
+		Host:       os.Getenv(prefix + "_SSH_HOST"),
+		User:       os.Getenv(prefix + "_SSH_USER"),
+		KeyFile:    os.Getenv(prefix + "_SSH_KEY"),
+		Passphrase: mustSecretEnv(prefix + "_SSH_PASSPHRASE"),
+		KnownHosts: os.Getenv(prefix + "_SSH_KNOWN_HOSTS"),
+	}
+}
 
-	go getRowCount(&databases.source, ctx, table, c1)
-	go getRowCount(&databases.dest, ctx, table, c2)
+// connectionIAMAuth reads whether to authenticate to a database with RDS IAM
+// tokens from the environment, e.g. SRC_RDS_IAM=true for the source.
+func connectionIAMAuth(prefix string) bool {
+	value := os.Getenv(prefix + "_RDS_IAM")
+	if value == "" {
+		return false
+	}
+	iamAuth, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Fatalf("%s_RDS_IAM: %v", prefix, err)
+	}
+	return iamAuth
+}
 
-	for i := 0; i < 2; i++ {
-		select {
-		case msg1 := <-c1:
-			table.SourceRowCount = msg1
-		case msg2 := <-c2:
-			table.DestRowCount = msg2
+// connectionPool reads how a connection's pool is tuned from the
+// environment, e.g. DEST_MAX_IDLE_CONNS and DEST_KEEPALIVE for the
+// destination.
+func connectionPool(prefix string) dbdiff.Pool {
+	var pool dbdiff.Pool
+	if value := os.Getenv(prefix + "_MAX_IDLE_CONNS"); value != "" {
+		var err error
+		if pool.MaxIdleConns, err = strconv.Atoi(value); err != nil || pool.MaxIdleConns <= 0 {
+			logger.Fatalf("%s_MAX_IDLE_CONNS must be a positive number", prefix)
+		}
+	}
+	for name, duration := range map[string]*time.Duration{
+		"_CONN_MAX_LIFETIME":  &pool.ConnMaxLifetime,
+		"_CONN_MAX_IDLE_TIME": &pool.ConnMaxIdleTime,
+		"_KEEPALIVE":          &pool.Keepalive,
+	} {
+		value := os.Getenv(prefix + name)
+		if value == "" {
+			continue
+		}
+		var err error
+		if *duration, err = time.ParseDuration(value); err != nil || *duration <= 0 {
+			logger.Fatalf("%s%s must be a positive duration such as 5m, not %q", prefix, name, value)
 		}
 	}
+	return pool
+}
 
-	fmt.Printf("Retrieved row counts from %s in %s\n", tableName, time.Since(start))
-	close(c1)
-	close(c2)
-	tableDiffStream <- table
-	<-limiter
+// connectionThrottle reads the limits of the load put on a database from the
+// environment, e.g. SRC_QPS and SRC_MAX_LAG for the source.
+func connectionThrottle(prefix string) dbdiff.Throttle {
+	var limits dbdiff.Throttle
+	if value := os.Getenv(prefix + "_QPS"); value != "" {
+		var err error
+		if limits.QueriesPerSecond, err = strconv.ParseFloat(value, 64); err != nil || limits.QueriesPerSecond <= 0 {
+			logger.Fatalf("%s_QPS must be a positive number", prefix)
+		}
+	}
+	for name, count := range map[string]*int{
+		"_HEAVY_QUERIES": &limits.HeavyQueries,
+		"_MAX_ACTIVE":    &limits.MaxActive,
+	} {
+		value := os.Getenv(prefix + name)
+		if value == "" {
+			continue
+		}
+		var err error
+		if *count, err = strconv.Atoi(value); err != nil || *count <= 0 {
+			logger.Fatalf("%s%s must be a positive number", prefix, name)
+		}
+	}
+	for name, duration := range map[string]*time.Duration{
+		"_MAX_LAG":        &limits.MaxLag,
+		"_THROTTLE_CHECK": &limits.CheckEvery,
+	} {
+		value := os.Getenv(prefix + name)
+		if value == "" {
+			continue
+		}
+		var err error
+		if *duration, err = time.ParseDuration(value); err != nil || *duration <= 0 {
+			logger.Fatalf("%s%s must be a positive duration such as 30s, not %q", prefix, name, value)
+		}
+	}
+	if value := os.Getenv(prefix + "_WINDOW"); value != "" {
+		var err error
+		if limits.Window, err = dbdiff.ParseWindow(value); err != nil {
+			logger.Fatalf("%s_WINDOW: %v", prefix, err)
+		}
+	}
+	return limits
 }
 
-func getRowCount(db *DB, ctx context.Context, table TableDiff, countStream chan int) {
-	conn, err := db.DB.Conn(ctx)
+// parseAsOf parses --as-of, returning either the time it gives or how long
+// before each run it is, or neither when it's empty.
+func parseAsOf(value string) (time.Time, time.Duration, error) {
+	if value == "" {
+		return time.Time{}, 0, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		if ago <= 0 {
+			return time.Time{}, 0, fmt.Errorf("%s isn't a positive duration", value)
+		}
+		return time.Now().Add(-ago), ago, nil
+	}
+	at, err := time.Parse(time.RFC3339Nano, value)
 	if err != nil {
-		println(err.Error())
-		panic(err)
+		return time.Time{}, 0, fmt.Errorf("%s is neither an RFC 3339 timestamp such as 2024-05-01T12:00:00Z nor a duration such as 1h", value)
+	}
+	if at.After(time.Now()) {
+		return time.Time{}, 0, fmt.Errorf("%s is in the future", value)
 	}
+	return at, 0, nil
+}
+
+// stdout is where reports go without --output, which is behind the progress
+// line when both are on the terminal.
+var stdout io.Writer = os.Stdout
+
+type nopWriteCloser struct {
+	io.Writer
+}
 
-	defer func(conn *sql.Conn) {
-		if err := conn.Close(); err != nil {
-			println(err.Error())
-			panic(err)
+func (nopWriteCloser) Close() error { return nil }
+
+// printTableDiffStream writes the table diffs to the report as they arrive,
+// or once all of them have, in the order's, when it sorts them or groups
+// them by schema. The report is left open for the checks.
+func printTableDiffStream(tableDiffStream <-chan dbdiff.MultiResult, report ReportWriter, count int, order reportOrder, bar *progress) []dbdiff.TableResult {
+	if err := report.WriteHeader(); err != nil {
+		logger.Fatalw("Couldn't write the report", "error", err)
+	}
+
+	write := func(result dbdiff.MultiResult) {
+		for _, tableDiff := range result.Results {
+			if err := report.WriteTableResult(tableDiff); err != nil {
+				logger.Fatalw("Couldn't write the report", "table", tableDiff.Name, "error", err)
+			}
+		}
+	}
+	tableDiffs := make([]dbdiff.TableResult, 0, count)
+	var results []dbdiff.MultiResult
+	for result := range tableDiffStream {
+		bar.tableDone()
+		if order.streams() {
+			write(result)
+		} else {
+			results = append(results, result)
 		}
-	}(conn)
+		tableDiffs = append(tableDiffs, result.Results...)
+	}
+	order.sortResults(results)
+	for _, result := range results {
+		write(result)
+	}
+	return tableDiffs
+}
 
-	count := -1
-	// don't concatenate table name in production code...
-	if err = conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table.Name).Scan(&count); err != nil {
-		println(err.Error())
-		panic(err)
+// listFlag is a flag.Value collecting values, such as schema names, from
+// repeated or comma separated flags.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
 	}
-	countStream <- count
+	return nil
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// tableMetrics is the latest comparison of a table exposed to Prometheus.
+type tableMetrics struct {
+	SourceRows, DestRows, Diff int
+	Duration                   time.Duration
+	Timestamp                  time.Time
+}
+
+// metrics holds the gauges served at /metrics, updated after every watch
+// round.
+type metrics struct {
+	mu     sync.Mutex
+	tables map[resultKey]tableMetrics
+}
+
+// serveMetrics starts serving the metrics in the Prometheus text format. The
+// address is bound before returning so a port in use fails right away. A
+// server that fails later is logged, and the comparisons go on without it.
+func serveMetrics(addr string) (*metrics, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("metrics: %w", err)
+	}
+	m := &metrics{tables: map[resultKey]tableMetrics{}}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logger.Errorw("Metrics server failed", "error", err)
+		}
+	}()
+	logger.Infow("Serving metrics", "url", fmt.Sprintf("http://%s/metrics", listener.Addr()))
+	return m, nil
+}
+
+func (m *metrics) record(tableDiffs []dbdiff.TableResult, mode string, finished time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, table := range tableDiffs {
+		// keep the last successful comparison, which the timestamp dates
+		if table.Err != nil {
+			continue
+		}
+		diff, _ := table.Drift(mode)
+		m.tables[keyOf(table)] = tableMetrics{
+			SourceRows: table.SourceRowCount,
+			DestRows:   table.DestRowCount,
+			Diff:       diff,
+			Duration:   table.Duration,
+			Timestamp:  finished,
+		}
+	}
+}
+
+var metricGauges = []struct {
+	name, help string
+	value      func(tableMetrics) float64
+}{
+	{"databasediff_source_rows", "Rows in the table on the source database.", func(t tableMetrics) float64 { return float64(t.SourceRows) }},
+	{"databasediff_dest_rows", "Rows in the table on the destination database.", func(t tableMetrics) float64 { return float64(t.DestRows) }},
+	{"databasediff_diff", "Drift of the table as counted by the comparison mode.", func(t tableMetrics) float64 { return float64(t.Diff) }},
+	{"databasediff_last_compare_duration_seconds", "How long the table's last comparison took.", func(t tableMetrics) float64 { return t.Duration.Seconds() }},
+	{"databasediff_last_compare_timestamp", "Unix time the table was last compared at.", func(t tableMetrics) float64 { return float64(t.Timestamp.UnixNano()) / 1e9 }},
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]resultKey, 0, len(m.tables))
+	for key := range m.tables {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Table != keys[j].Table {
+			return keys[i].Table < keys[j].Table
+		}
+		if keys[i].Source != keys[j].Source {
+			return keys[i].Source < keys[j].Source
+		}
+		return keys[i].Dest < keys[j].Dest
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, gauge := range metricGauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", gauge.name, gauge.help, gauge.name)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s{table=\"%s\",source=\"%s\",dest=\"%s\"} %g\n", gauge.name,
+				labelValue.Replace(key.Table), labelValue.Replace(key.Source), labelValue.Replace(key.Dest), gauge.value(m.tables[key]))
+		}
+	}
+}
+
+// labelValue escapes a label value for the Prometheus text format.
+var labelValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
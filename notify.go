@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// defaultNotifyTemplate summarizes a run in a few lines of plain text, which
+// Slack renders as is.
+const defaultNotifyTemplate = `databasediff {{.Mode}} comparison of {{.Source}} and {{.Dest}}: {{len .Tables}} table(s){{if .Exceeded}}, {{.Exceeded}} over the drift threshold{{end}}
+{{range .Tables}}• {{.Name}}{{if $.Pairwise}} between {{.Source}} and {{.Dest}}{{else if gt (len $.Dests) 1}} on {{.Dest}}{{end}}: {{if .Error}}{{.Status}}: {{.Error}}{{else}}{{if .Approximate}}~{{end}}{{.Diff}} of {{.Total}}{{if .OverThreshold}} (over threshold){{end}}{{end}}
+{{end}}`
+
+// notification is what message templates are executed with, and what
+// generic webhooks receive alongside the rendered text.
+type notification struct {
+	Text     string              `json:"text"`
+	Mode     string              `json:"mode"`
+	Source   string              `json:"source"`
+	Dest     string              `json:"dest"`
+	Dests    []string            `json:"dests"`
+	Pairwise bool                `json:"pairwise,omitempty"`
+	Exceeded int                 `json:"exceeded"`
+	Tables   []notificationTable `json:"tables"`
+}
+
+type notificationTable struct {
+	Name          string `json:"name"`
+	Source        string `json:"source"`
+	Dest          string `json:"dest"`
+	SourceRows    int    `json:"source_rows"`
+	DestRows      int    `json:"dest_rows"`
+	Diff          int    `json:"diff"`
+	Total         int    `json:"total"`
+	OverThreshold bool   `json:"over_threshold"`
+	Approximate   bool   `json:"approximate,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+}
+
+func newNotificationTable(table dbdiff.TableResult, mode string, overThreshold bool) notificationTable {
+	diff, total := table.Drift(mode)
+	entry := notificationTable{
+		Name: table.Name, Source: table.Source, Dest: table.Dest, SourceRows: table.SourceRowCount, DestRows: table.DestRowCount,
+		Diff: diff, Total: total, OverThreshold: overThreshold, Status: table.Status(),
+		Approximate: table.Approximate,
+	}
+	if table.Err != nil {
+		entry.Error = table.Err.Error()
+	}
+	return entry
+}
+
+// notifier posts a summary of each run to a Slack incoming webhook or any
+// other HTTP endpoint.
+type notifier struct {
+	url       string
+	template  *template.Template
+	driftOnly bool
+	client    *http.Client
+}
+
+// newNotifier parses the message template, the default one when the path is
+// empty.
+func newNotifier(webhook, templatePath string, driftOnly bool) (*notifier, error) {
+	if _, err := url.ParseRequestURI(webhook); err != nil {
+		return nil, fmt.Errorf("notify: %w", err)
+	}
+	text := defaultNotifyTemplate
+	if templatePath != "" {
+		data, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("notify: %w", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("notification").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("notify: %w", err)
+	}
+	return &notifier{webhook, tmpl, driftOnly, &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// notify posts the run's results. With driftOnly, only tables over their
+// threshold are included, and nothing is posted when there are none.
+func (n *notifier) notify(tableDiffs []dbdiff.TableResult, mode, sourceDB string, dests []string, pairwise bool, exceeded []dbdiff.TableResult) error {
+	over := make(map[resultKey]bool, len(exceeded))
+	for _, table := range exceeded {
+		over[keyOf(table)] = true
+	}
+	message := notification{Mode: mode, Source: sourceDB, Dest: strings.Join(dests, ", "), Dests: dests, Pairwise: pairwise, Exceeded: len(exceeded)}
+	for _, table := range tableDiffs {
+		if n.driftOnly && !over[keyOf(table)] && table.Err == nil {
+			continue
+		}
+		message.Tables = append(message.Tables, newNotificationTable(table, mode, over[keyOf(table)]))
+	}
+	if n.driftOnly && len(message.Tables) == 0 {
+		return nil
+	}
+
+	var text strings.Builder
+	if err := n.template.Execute(&text, message); err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	message.Text = text.String()
+
+	// Slack webhooks only take the text; other endpoints get the numbers too
+	var payload interface{} = message
+	u, _ := url.Parse(n.url)
+	if u.Host == "hooks.slack.com" {
+		payload = struct {
+			Text string `json:"text"`
+		}{message.Text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		// the URL's path is often a secret token, so only name the host
+		return fmt.Errorf("notify: %s returned %s", u.Host, resp.Status)
+	}
+	logger.Infow("Sent notification", "tables", len(message.Tables))
+	return nil
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// maxBufferedSpans is how many ended spans are kept before exporting them
+// without waiting for the run to end.
+const maxBufferedSpans = 512
+
+// otlpTracer records spans and exports them over OTLP/HTTP in its JSON
+// encoding, which collectors and most tracing backends accept, without
+// pulling in the OpenTelemetry SDK. It's the trace.TracerProvider given to
+// pkg/dbdiff, whose spans of tables and queries are children of the run's.
+type otlpTracer struct {
+	url     string
+	service string
+	// headers are sent with every export, such as an API key, from
+	// OTEL_EXPORTER_OTLP_HEADERS
+	headers map[string]string
+	client  *http.Client
+
+	mu    sync.Mutex
+	ended map[string][]*otlpSpan
+}
+
+// newOTLPTracer exports to the collector's base URL, such as
+// http://localhost:4318, posting to its /v1/traces.
+func newOTLPTracer(endpoint string) (*otlpTracer, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("otlp: endpoint %q isn't an http:// or https:// URL", endpoint)
+	}
+	t := &otlpTracer{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service: "databasediff",
+		headers: map[string]string{},
+		client:  &http.Client{Timeout: 10 * time.Second},
+		ended:   map[string][]*otlpSpan{},
+	}
+	if service := os.Getenv("OTEL_SERVICE_NAME"); service != "" {
+		t.service = service
+	}
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if i := strings.Index(header, "="); i > 0 {
+			t.headers[strings.TrimSpace(header[:i])] = strings.TrimSpace(header[i+1:])
+		}
+	}
+	return t, nil
+}
+
+func (t *otlpTracer) Tracer(name string, _ ...trace.TracerOption) trace.Tracer {
+	return otlpScope{t, name}
+}
+
+// otlpScope is a tracer of the provider, named after the instrumented code.
+type otlpScope struct {
+	provider *otlpTracer
+	name     string
+}
+
+func (s otlpScope) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(options...)
+	parent := trace.SpanContextFromContext(ctx)
+	if config.NewRoot() {
+		parent = trace.SpanContext{}
+	}
+	traceID := parent.TraceID()
+	if !parent.IsValid() {
+		rand.Read(traceID[:])
+	}
+	var spanID trace.SpanID
+	rand.Read(spanID[:])
+	span := &otlpSpan{
+		scope: s,
+		context: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+		}),
+		name:  name,
+		kind:  config.SpanKind(),
+		start: config.Timestamp(),
+		attrs: config.Attributes(),
+	}
+	if parent.IsValid() {
+		span.parent = parent.SpanID()
+	}
+	if span.start.IsZero() {
+		span.start = time.Now()
+	}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+// otlpSpan is a span being recorded, exported once ended.
+type otlpSpan struct {
+	scope   otlpScope
+	context trace.SpanContext
+	parent  trace.SpanID
+	kind    trace.SpanKind
+
+	mu          sync.Mutex
+	name        string
+	start, end  time.Time
+	attrs       []attribute.KeyValue
+	events      []otlpEvent
+	status      codes.Code
+	description string
+}
+
+type otlpEvent struct {
+	name  string
+	at    time.Time
+	attrs []attribute.KeyValue
+}
+
+func (s *otlpSpan) End(options ...trace.SpanEndOption) {
+	config := trace.NewSpanEndConfig(options...)
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = config.Timestamp()
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+	s.mu.Unlock()
+	s.scope.provider.record(s)
+}
+
+func (s *otlpSpan) AddEvent(name string, options ...trace.EventOption) {
+	config := trace.NewEventConfig(options...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, otlpEvent{name, config.Timestamp(), config.Attributes()})
+}
+
+func (s *otlpSpan) IsRecording() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.end.IsZero()
+}
+
+// RecordError adds the error as an exception event, as the SDK does.
+func (s *otlpSpan) RecordError(err error, options ...trace.EventOption) {
+	if err == nil {
+		return
+	}
+	options = append(options, trace.WithAttributes(
+		attribute.String("exception.type", fmt.Sprintf("%T", err)),
+		attribute.String("exception.message", err.Error()),
+	))
+	s.AddEvent("exception", options...)
+}
+
+func (s *otlpSpan) SpanContext() trace.SpanContext { return s.context }
+
+func (s *otlpSpan) SetStatus(code codes.Code, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.description = code, description
+}
+
+func (s *otlpSpan) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+func (s *otlpSpan) SetAttributes(attrs ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+func (s *otlpSpan) TracerProvider() trace.TracerProvider { return s.scope.provider }
+
+// record keeps the ended span for the next export, starting one in the
+// background once enough are kept.
+func (t *otlpTracer) record(span *otlpSpan) {
+	t.mu.Lock()
+	t.ended[span.scope.name] = append(t.ended[span.scope.name], span)
+	n := 0
+	for _, spans := range t.ended {
+		n += len(spans)
+	}
+	t.mu.Unlock()
+	if n >= maxBufferedSpans {
+		go func() {
+			if err := t.flush(context.Background()); err != nil {
+				logger.Errorw("Couldn't export the traces", "error", err)
+			}
+		}()
+	}
+}
+
+// flush exports the spans ended since the last export.
+func (t *otlpTracer) flush(ctx context.Context) error {
+	t.mu.Lock()
+	ended := t.ended
+	t.ended = map[string][]*otlpSpan{}
+	t.mu.Unlock()
+	if len(ended) == 0 {
+		return nil
+	}
+
+	resource := otlpResourceSpans{Resource: otlpResource{Attributes: otlpAttributes([]attribute.KeyValue{attribute.String("service.name", t.service)})}}
+	for scope, spans := range ended {
+		encoded := otlpScopeSpans{Scope: otlpScopeName{Name: scope}}
+		for _, span := range spans {
+			encoded.Spans = append(encoded.Spans, span.encode())
+		}
+		resource.ScopeSpans = append(resource.ScopeSpans, encoded)
+	}
+	body, err := json.Marshal(otlpExport{ResourceSpans: []otlpResourceSpans{resource}})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		request.Header.Set(name, value)
+	}
+	response, err := t.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("otlp: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp: %s answered %s", t.url, response.Status)
+	}
+	return nil
+}
+
+// The OTLP/HTTP JSON encoding of an export request, with IDs in hex and
+// 64-bit integers as strings.
+type otlpExport struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScopeName     `json:"scope"`
+	Spans []otlpEncodedSpan `json:"spans"`
+}
+
+type otlpScopeName struct {
+	Name string `json:"name"`
+}
+
+type otlpEncodedSpan struct {
+	TraceID      string             `json:"traceId"`
+	SpanID       string             `json:"spanId"`
+	ParentSpanID string             `json:"parentSpanId,omitempty"`
+	Name         string             `json:"name"`
+	Kind         int                `json:"kind"`
+	Start        string             `json:"startTimeUnixNano"`
+	End          string             `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute    `json:"attributes,omitempty"`
+	Events       []otlpEncodedEvent `json:"events,omitempty"`
+	Status       otlpStatus         `json:"status"`
+}
+
+type otlpEncodedEvent struct {
+	Time       string          `json:"timeUnixNano"`
+	Name       string          `json:"name"`
+	Attributes []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	String *string    `json:"stringValue,omitempty"`
+	Bool   *bool      `json:"boolValue,omitempty"`
+	Int    *string    `json:"intValue,omitempty"`
+	Double *float64   `json:"doubleValue,omitempty"`
+	Array  *otlpArray `json:"arrayValue,omitempty"`
+}
+
+type otlpArray struct {
+	Values []otlpValue `json:"values"`
+}
+
+func (s *otlpSpan) encode() otlpEncodedSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	encoded := otlpEncodedSpan{
+		TraceID:    s.context.TraceID().String(),
+		SpanID:     s.context.SpanID().String(),
+		Name:       s.name,
+		Kind:       otlpKind(s.kind),
+		Start:      strconv.FormatInt(s.start.UnixNano(), 10),
+		End:        strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes: otlpAttributes(s.attrs),
+		// OTLP's codes are unset, ok and error where the API's are unset,
+		// error and ok
+		Status: otlpStatus{Code: map[codes.Code]int{codes.Unset: 0, codes.Ok: 1, codes.Error: 2}[s.status], Message: s.description},
+	}
+	if s.parent.IsValid() {
+		encoded.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, event := range s.events {
+		encoded.Events = append(encoded.Events, otlpEncodedEvent{
+			Time: strconv.FormatInt(event.at.UnixNano(), 10), Name: event.name, Attributes: otlpAttributes(event.attrs),
+		})
+	}
+	return encoded
+}
+
+// otlpKind maps the API's span kinds, whose unspecified is internal, to
+// OTLP's.
+func otlpKind(kind trace.SpanKind) int {
+	switch kind {
+	case trace.SpanKindServer:
+		return 2
+	case trace.SpanKindClient:
+		return 3
+	case trace.SpanKindProducer:
+		return 4
+	case trace.SpanKindConsumer:
+		return 5
+	default:
+		return 1
+	}
+}
+
+func otlpAttributes(attrs []attribute.KeyValue) []otlpAttribute {
+	encoded := make([]otlpAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		encoded = append(encoded, otlpAttribute{Key: string(attr.Key), Value: otlpValueOf(attr.Value)})
+	}
+	return encoded
+}
+
+func otlpValueOf(value attribute.Value) otlpValue {
+	switch value.Type() {
+	case attribute.BOOL:
+		v := value.AsBool()
+		return otlpValue{Bool: &v}
+	case attribute.INT64:
+		v := strconv.FormatInt(value.AsInt64(), 10)
+		return otlpValue{Int: &v}
+	case attribute.FLOAT64:
+		v := value.AsFloat64()
+		return otlpValue{Double: &v}
+	case attribute.BOOLSLICE, attribute.INT64SLICE, attribute.FLOAT64SLICE, attribute.STRINGSLICE:
+		array := &otlpArray{Values: []otlpValue{}}
+		switch value.Type() {
+		case attribute.BOOLSLICE:
+			for _, v := range value.AsBoolSlice() {
+				array.Values = append(array.Values, otlpValueOf(attribute.BoolValue(v)))
+			}
+		case attribute.INT64SLICE:
+			for _, v := range value.AsInt64Slice() {
+				array.Values = append(array.Values, otlpValueOf(attribute.Int64Value(v)))
+			}
+		case attribute.FLOAT64SLICE:
+			for _, v := range value.AsFloat64Slice() {
+				array.Values = append(array.Values, otlpValueOf(attribute.Float64Value(v)))
+			}
+		default:
+			for _, v := range value.AsStringSlice() {
+				array.Values = append(array.Values, otlpValueOf(attribute.StringValue(v)))
+			}
+		}
+		return otlpValue{Array: array}
+	default:
+		v := value.Emit()
+		return otlpValue{String: &v}
+	}
+}
+
+// startRun starts the span of a run, which every table's span is a child of.
+func startRun(ctx context.Context, tracer trace.Tracer, mode string, tables int) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "run", trace.WithAttributes(attribute.String("databasediff.mode", mode), attribute.Int("databasediff.tables", tables)))
+}
+
+// endRun ends the run's span and exports it with the rest of the run's, if
+// traced.
+func endRun(span trace.Span, tableDiffs []dbdiff.TableResult, tracing *otlpTracer) {
+	failed := 0
+	for _, table := range tableDiffs {
+		if table.Err != nil {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Int("databasediff.failed", failed))
+	if failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d tables couldn't be compared", failed))
+	}
+	span.End()
+	if tracing == nil {
+		return
+	}
+	if err := tracing.flush(context.Background()); err != nil {
+		logger.Errorw("Couldn't export the traces", "error", err)
+	}
+}
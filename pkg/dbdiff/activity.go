@@ -0,0 +1,83 @@
+package dbdiff
+
+import (
+	"context"
+	"time"
+)
+
+// activityDialect is implemented by dialects whose catalogs keep track of
+// writes to tables, read with Options.Unchanged to skip the tables nothing
+// was written to since their last comparison. The activity is opaque, only
+// compared with the last one, and empty when the engine lost track, e.g.
+// after a restart.
+type activityDialect interface {
+	tableActivity(ctx context.Context, db *DB, tableName string) (string, error)
+}
+
+// LastResults keep the tables' last results, along with their activity
+// then, for Options.Unchanged.
+type LastResults interface {
+	// LastResult returns the table's last result between the databases,
+	// compared as configured now, or nil.
+	LastResult(source, dest string, config TableConfig) *TableResult
+}
+
+// canSkip reports whether the table's comparison may be skipped when it's
+// unchanged: its data is compared, not its definition, read from the table
+// alone rather than through a query of the tables it joins, and as it is
+// now rather than as of Options.AsOf.
+func (c *Comparer) canSkip(config TableConfig) bool {
+	switch c.Options.Mode {
+	case ModeSchema, ModeSequences, ModeGrants:
+		return false
+	}
+	return c.Options.Unchanged != nil && config.CountQuery == "" && config.DestCountQuery == "" && c.Options.AsOf.IsZero()
+}
+
+// readActivity records the table's activity on both databases, which is
+// empty on either when the engine doesn't keep track or it couldn't be read.
+func (c *Comparer) readActivity(ctx context.Context, table *TableResult, config TableConfig) {
+	source, dest := &c.databases.source, &c.databases.dest
+	bothSides(func() error {
+		table.SourceActivity = c.tableActivity(ctx, source, config.Name)
+		return nil
+	}, func() error {
+		table.DestActivity = c.tableActivity(ctx, dest, config.onDest().Name)
+		return nil
+	})
+}
+
+// tableActivity reads the table's activity on the database. Failing to
+// read it only means the table is compared.
+func (c *Comparer) tableActivity(ctx context.Context, db *DB, tableName string) string {
+	dialect, ok := db.Dialect.(activityDialect)
+	if !ok {
+		return ""
+	}
+	activity, err := dialect.tableActivity(ctx, db, tableName)
+	if err != nil {
+		c.log.Warnw("Couldn't tell whether the table changed, comparing it", "table", tableName, "database", db.ServiceName, "error", err)
+		return ""
+	}
+	return activity
+}
+
+// unchanged returns the table's last result when nothing was written to it
+// on either database since, as far as both engines can tell, or nil to
+// compare it. The activity is read before comparing, so writes made while
+// the table is compared count against the next run.
+func (c *Comparer) unchanged(table TableResult, config TableConfig, start time.Time) *TableResult {
+	if table.SourceActivity == "" || table.DestActivity == "" {
+		return nil
+	}
+	last := c.Options.Unchanged.LastResult(table.Source, table.Dest, config)
+	if last == nil || last.Err != nil || last.SourceActivity != table.SourceActivity || last.DestActivity != table.DestActivity {
+		return nil
+	}
+	skipped := *last
+	skipped.Unchanged = true
+	skipped.Duration = time.Since(start)
+	c.log.Infow("Skipped unchanged table", "table", table.Name, "source", table.Source, "dest", table.Dest,
+		"source_rows", skipped.SourceRowCount, "dest_rows", skipped.DestRowCount)
+	return &skipped
+}
@@ -0,0 +1,235 @@
+package dbdiff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// aggregateFunctions are the functions an Aggregate may apply.
+var aggregateFunctions = map[string]bool{"sum": true, "min": true, "max": true, "avg": true}
+
+// Aggregate is a column statistic compared in ModeAggregates, written as
+// function(column) in the configuration, as in "sum(amount)".
+type Aggregate struct {
+	// Function is sum, min, max or avg.
+	Function string
+	Column   string
+}
+
+func (a Aggregate) String() string {
+	return a.Function + "(" + a.Column + ")"
+}
+
+// ParseAggregate reads an aggregate written as function(column).
+func ParseAggregate(s string) (Aggregate, error) {
+	open := strings.Index(s, "(")
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return Aggregate{}, fmt.Errorf("aggregate %q isn't written as function(column)", s)
+	}
+	a := Aggregate{Function: strings.ToLower(strings.TrimSpace(s[:open])), Column: strings.TrimSpace(s[open+1 : len(s)-1])}
+	if !aggregateFunctions[a.Function] {
+		return Aggregate{}, fmt.Errorf("aggregate %q: unknown function %s, expected sum, min, max or avg", s, a.Function)
+	}
+	if a.Column == "" {
+		return Aggregate{}, fmt.Errorf("aggregate %q names no column", s)
+	}
+	return a, nil
+}
+
+func (a *Aggregate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseAggregate(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func (a Aggregate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// AggregateValue is an aggregate's value on both databases.
+type AggregateValue struct {
+	Aggregate    Aggregate
+	Source, Dest string
+	Equal        bool
+}
+
+// compareAggregates computes the table's aggregates on both databases in a
+// single query each. Tables configuring none get the sum, min and max of
+// every numeric column and the min and max of every date and time column.
+func (c *Comparer) compareAggregates(ctx context.Context, table *TableResult, config TableConfig) error {
+	source, dest := &c.databases.source, &c.databases.dest
+	aggregates := config.Aggregates
+	if len(aggregates) == 0 {
+		columns, err := getColumns(ctx, source, config.Name)
+		if err != nil {
+			return err
+		}
+		aggregates = defaultAggregates(columns)
+		if len(aggregates) == 0 {
+			return source.wrap(fmt.Errorf("table %s has no numeric or date columns to aggregate", config.Name))
+		}
+	}
+
+	var sourceValues, destValues []aggregateResult
+	err := bothSides(func() error {
+		return c.Options.Retry.do(ctx, source, func() (err error) {
+			sourceValues, err = queryAggregates(ctx, source, config, aggregates)
+			return err
+		})
+	}, func() error {
+		return c.Options.Retry.do(ctx, dest, func() (err error) {
+			destValues, err = queryAggregates(ctx, dest, config.onDest(), aggregates)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for i, aggregate := range aggregates {
+		table.Aggregates = append(table.Aggregates, AggregateValue{
+			Aggregate: aggregate,
+			Source:    sourceValues[i].String(),
+			Dest:      destValues[i].String(),
+			Equal:     sourceValues[i].equal(destValues[i]),
+		})
+	}
+	return nil
+}
+
+func defaultAggregates(columns []tableColumn) []Aggregate {
+	var aggregates []Aggregate
+	for _, column := range columns {
+		dataType := strings.ToLower(column.DataType)
+		// e.g. numeric(10,2)
+		if i := strings.Index(dataType, "("); i >= 0 {
+			dataType = dataType[:i]
+		}
+		switch {
+		case keyKindOf(dataType) == keyNumeric:
+			for _, function := range []string{"sum", "min", "max"} {
+				aggregates = append(aggregates, Aggregate{function, column.Name})
+			}
+		case strings.Contains(dataType, "date") || strings.Contains(dataType, "time"):
+			for _, function := range []string{"min", "max"} {
+				aggregates = append(aggregates, Aggregate{function, column.Name})
+			}
+		}
+	}
+	return aggregates
+}
+
+// queryAggregates computes the aggregates on the database. Averages are
+// computed from the sum and count, since engines round AVG differently.
+func queryAggregates(ctx context.Context, db *DB, table TableConfig, aggregates []Aggregate) ([]aggregateResult, error) {
+	var selects []string
+	for _, aggregate := range aggregates {
+		column := db.Dialect.QuoteIdentifier(aggregate.Column)
+		if aggregate.Function == "avg" {
+			selects = append(selects, "SUM("+column+")", "COUNT("+column+")")
+			continue
+		}
+		selects = append(selects, strings.ToUpper(aggregate.Function)+"("+column+")")
+	}
+	query := "SELECT " + strings.Join(selects, ", ") + " FROM " + table.from(db.Dialect) + whereClause(table.Where)
+	raw := make([]interface{}, len(selects))
+	pointers := make([]interface{}, len(selects))
+	for i := range raw {
+		pointers[i] = &raw[i]
+	}
+	if err := db.scanRow(ctx, query, pointers...); err != nil {
+		return nil, db.wrap(err)
+	}
+
+	results := make([]aggregateResult, 0, len(aggregates))
+	for _, aggregate := range aggregates {
+		if aggregate.Function != "avg" {
+			results = append(results, newAggregateResult(raw[0]))
+			raw = raw[1:]
+			continue
+		}
+		sum, count := newAggregateResult(raw[0]), newAggregateResult(raw[1])
+		raw = raw[2:]
+		avg := aggregateResult{}
+		if sum.number != nil && count.number != nil && count.number.Sign() != 0 {
+			avg.number, avg.exact = new(big.Rat).Quo(sum.number, count.number), sum.exact
+		}
+		results = append(results, avg)
+	}
+	return results, nil
+}
+
+// aggregateResult is a scanned aggregate, parsed when it's a number.
+type aggregateResult struct {
+	// raw is the scanned value, nil for NULL and computed averages
+	raw    interface{}
+	number *big.Rat
+	// exact is false for numbers the driver returned as floats
+	exact bool
+}
+
+func newAggregateResult(value interface{}) aggregateResult {
+	result := aggregateResult{raw: value}
+	switch v := value.(type) {
+	case nil:
+	case int64:
+		result.number, result.exact = new(big.Rat).SetInt64(v), true
+	case float64:
+		if !math.IsInf(v, 0) && !math.IsNaN(v) {
+			result.number = new(big.Rat).SetFloat64(v)
+		}
+	default:
+		if formatted := formatValue(value); formatted != "NULL" {
+			result.number, result.exact = new(big.Rat).SetString(formatted)
+		} else {
+			result.raw = nil
+		}
+	}
+	return result
+}
+
+func (r aggregateResult) String() string {
+	switch {
+	case r.raw != nil:
+		return formatValue(r.raw)
+	case r.number != nil:
+		return strings.TrimRight(strings.TrimRight(r.number.FloatString(6), "0"), ".")
+	}
+	return "NULL"
+}
+
+// equal compares exact numbers exactly, floats to within their precision,
+// and timestamps as times whatever their format.
+func (r aggregateResult) equal(other aggregateResult) bool {
+	if r.isNull() || other.isNull() {
+		return r.isNull() == other.isNull()
+	}
+	if r.number != nil && other.number != nil {
+		if r.exact && other.exact {
+			return r.number.Cmp(other.number) == 0
+		}
+		x, _ := r.number.Float64()
+		y, _ := other.number.Float64()
+		return math.Abs(x-y) <= 1e-9*math.Max(math.Abs(x), math.Abs(y))
+	}
+	x, xErr := parseTimestamp(r.raw)
+	y, yErr := parseTimestamp(other.raw)
+	if xErr == nil && yErr == nil {
+		return x.Equal(y)
+	}
+	return r.String() == other.String()
+}
+
+func (r aggregateResult) isNull() bool {
+	return r.raw == nil && r.number == nil
+}
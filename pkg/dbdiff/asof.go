@@ -0,0 +1,117 @@
+package dbdiff
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// History is how the source keeps the past states of a table, for reading
+// it as it was at Options.AsOf: by columns telling when each row, or each
+// version of a row kept in an audit table, was current.
+type History struct {
+	// Table is the audit table read in place of the table, holding every
+	// version of its rows along with the current ones, with its columns
+	// and more. ValidFrom and ValidTo are left out of the comparison, and
+	// the table's Key has to be set, since the audit table's primary key
+	// tells versions apart. Empty reads the table itself.
+	Table string `json:"table,omitempty"`
+	// ValidFrom is the column holding when each row or version became
+	// current, and ValidTo when it stopped being, NULL while it still is.
+	// Without ValidTo, rows are current from ValidFrom on, as with a
+	// created_at column. Both are compared with the time in UTC.
+	ValidFrom string `json:"valid_from"`
+	ValidTo   string `json:"valid_to,omitempty"`
+	// Where further restricts the versions read, only on the source, such
+	// as to leave out those recording a row's deletion.
+	Where string `json:"where,omitempty"`
+}
+
+// temporalDialect is implemented by dialects of engines that keep the past
+// states of tables for themselves, read as of a time for the tables without
+// a History: SQL Server's and MariaDB's system-versioned tables, Oracle's
+// flashback queries and Snowflake's and BigQuery's time travel.
+type temporalDialect interface {
+	// asOf is the quoted table read as it was at the time.
+	asOf(table string, at time.Time) string
+}
+
+// readAsOf returns the table's settings for reading it on the source as it
+// was at Options.AsOf, through its History or the engine's temporal query,
+// while the destination is read as it is now. Schema, sequences and grants
+// comparisons compare the databases as they are now, and get config as it
+// is.
+func (c *Comparer) readAsOf(config TableConfig) (TableConfig, error) {
+	switch c.Options.Mode {
+	case ModeSchema, ModeSequences, ModeGrants:
+		return config, nil
+	}
+	if c.Options.AsOf.IsZero() {
+		return config, nil
+	}
+	return config.atTime(c.databases.source.Dialect, c.Options.AsOf)
+}
+
+// atTime returns the table's settings reading it as of the time on a
+// database of the dialect, keeping those of onDest as they were.
+func (t TableConfig) atTime(d Dialect, at time.Time) (TableConfig, error) {
+	if t.CountQuery != "" {
+		return t, fmt.Errorf("table %s: its count_query can't be read as of a time", t.Name)
+	}
+	t.Dest = t.onDest().Name
+	t.asOf, t.destWhere = at, t.Where
+	h := t.History
+	if h == nil {
+		if _, ok := d.(temporalDialect); !ok {
+			return t, fmt.Errorf("table %s: %s has no temporal queries, so reading it as of a time needs its history", t.Name, d.Name())
+		}
+		return t, nil
+	}
+
+	literal := sqlLiteral(d, at)
+	var conditions []string
+	if t.Where != "" {
+		conditions = append(conditions, "("+t.Where+")")
+	}
+	conditions = append(conditions, d.QuoteIdentifier(h.ValidFrom)+" <= "+literal)
+	if h.ValidTo != "" {
+		validTo := d.QuoteIdentifier(h.ValidTo)
+		conditions = append(conditions, "("+validTo+" IS NULL OR "+validTo+" > "+literal+")")
+	}
+	if h.Where != "" {
+		conditions = append(conditions, "("+h.Where+")")
+	}
+	t.Where = strings.Join(conditions, " AND ")
+	if h.Table != "" {
+		t.Name = h.Table
+		t.ExcludeColumns = append(append([]string(nil), t.ExcludeColumns...), h.ValidFrom)
+		if h.ValidTo != "" {
+			t.ExcludeColumns = append(t.ExcludeColumns, h.ValidTo)
+		}
+	}
+	return t, nil
+}
+
+// temporalAt is when the table is read as of through the engine's temporal
+// query, zero when it's read now or through its History.
+func (t TableConfig) temporalAt() time.Time {
+	if t.History != nil {
+		return time.Time{}
+	}
+	return t.asOf
+}
+
+// from is the table to select from.
+func (t TableConfig) from(d Dialect) string {
+	return tableAt(d, t.Name, t.temporalAt())
+}
+
+// tableAt is the quoted table, read as it was at the time through the
+// engine's temporal query unless the time is zero.
+func tableAt(d Dialect, name string, at time.Time) string {
+	table := quoteTable(d, name)
+	if dialect, ok := d.(temporalDialect); ok && !at.IsZero() {
+		return dialect.asOf(table, at)
+	}
+	return table
+}
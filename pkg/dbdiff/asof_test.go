@@ -0,0 +1,72 @@
+package dbdiff
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTableConfigAtTime(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name    string
+		config  TableConfig
+		dialect Dialect
+		want    TableConfig
+		err     string
+	}{
+		{"valid from", TableConfig{Name: "users", Where: "active", History: &History{ValidFrom: "created_at"}}, sqliteDialect{},
+			TableConfig{Name: "users", Dest: "users", Where: `(active) AND "created_at" <= '2024-03-01 12:00:00'`}, ""},
+		{"audit table", TableConfig{Name: "users", History: &History{Table: "users_audit", ValidFrom: "valid_from", ValidTo: "valid_to", Where: "op <> 'D'"}}, postgresDialect{},
+			TableConfig{Name: "users_audit", Dest: "users", ExcludeColumns: []string{"valid_from", "valid_to"},
+				Where: `"valid_from" <= '2024-03-01 12:00:00' AND ("valid_to" IS NULL OR "valid_to" > '2024-03-01 12:00:00') AND (op <> 'D')`}, ""},
+		{"temporal query", TableConfig{Name: "users", Dest: "accounts"}, sqlserverDialect{}, TableConfig{Name: "users", Dest: "accounts"}, ""},
+		{"no temporal query", TableConfig{Name: "users"}, sqliteDialect{}, TableConfig{}, "SQLite has no temporal queries"},
+		{"count query", TableConfig{Name: "users", CountQuery: "SELECT 1"}, sqlserverDialect{}, TableConfig{}, "count_query can't be read as of a time"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.config.atTime(test.dialect, at)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != test.want.Name || got.Dest != test.want.Dest || got.Where != test.want.Where ||
+				strings.Join(got.ExcludeColumns, ",") != strings.Join(test.want.ExcludeColumns, ",") {
+				t.Errorf("read as of a time as %+v, want %+v", got, test.want)
+			}
+			// the destination is read now, as configured
+			if dest := got.onDest(); dest.Where != test.config.Where || !dest.asOf.IsZero() {
+				t.Errorf("destination is read as %+v", dest)
+			}
+		})
+	}
+}
+
+func TestCompareCountsAsOf(t *testing.T) {
+	history := &History{ValidFrom: "synced_at"}
+	for _, test := range []struct {
+		name         string
+		asOf         time.Time
+		source, dest int
+	}{
+		{"after every row", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), 10, 9},
+		{"before every row", time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), 0, 9},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			comparer := openFixtures(t, Options{Mode: ModeCount, AsOf: test.asOf})
+			result, err := comparer.CompareTable(context.Background(), TableConfig{Name: "orders", History: history})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.SourceRowCount != test.source || result.DestRowCount != test.dest {
+				t.Errorf("counted %d and %d rows, want %d and %d", result.SourceRowCount, result.DestRowCount, test.source, test.dest)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// bigqueryDriverName is a minimal database/sql driver over the BigQuery
+// client, which has none of its own. It only runs queries, with ?
+// parameters bound positionally.
+const bigqueryDriverName = "bigquery_databasediff"
+
+func init() {
+	sql.Register(bigqueryDriverName, bigqueryDriver{})
+}
+
+type bigqueryDriver struct{}
+
+// bigqueryConfig is parsed from bigquery://project/dataset URLs.
+type bigqueryConfig struct {
+	Project, Dataset string
+	Location         string
+	CredentialsFile  string
+	// MaxBytes caps the bytes each query may process, checked with a dry
+	// run before the query runs and enforced by BigQuery as the maximum
+	// bytes billed. Zero means no limit.
+	MaxBytes int64
+}
+
+func parseBigQueryConfig(dsn string) (bigqueryConfig, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return bigqueryConfig{}, err
+	}
+	config := bigqueryConfig{
+		Project:         u.Host,
+		Dataset:         strings.Trim(u.Path, "/"),
+		Location:        u.Query().Get("location"),
+		CredentialsFile: u.Query().Get("credentials_file"),
+	}
+	if config.Project == "" {
+		return bigqueryConfig{}, fmt.Errorf("%s: no project", dsn)
+	}
+	if maxBytes := u.Query().Get("max_bytes"); maxBytes != "" {
+		if config.MaxBytes, err = ParseByteSize(maxBytes); err != nil {
+			return bigqueryConfig{}, fmt.Errorf("max_bytes: %w", err)
+		}
+	}
+	return config, nil
+}
+
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// ParseByteSize reads sizes such as 500MB or 10GB, or a plain byte count.
+func ParseByteSize(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(upper, unit.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix)), 64)
+			if err != nil {
+				return 0, err
+			}
+			return int64(n * float64(unit.size)), nil
+		}
+	}
+	return strconv.ParseInt(upper, 10, 64)
+}
+
+func formatByteSize(n int64) string {
+	for _, unit := range byteUnits {
+		if n >= unit.size && unit.size > 1 {
+			return fmt.Sprintf("%.1f%s", float64(n)/float64(unit.size), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// Open authenticates with the credentials file when one is given, and with
+// Application Default Credentials otherwise.
+func (bigqueryDriver) Open(dsn string) (driver.Conn, error) {
+	config, err := parseBigQueryConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	var options []option.ClientOption
+	if config.CredentialsFile != "" {
+		options = append(options, option.WithCredentialsFile(config.CredentialsFile))
+	}
+	client, err := bigquery.NewClient(context.Background(), config.Project, options...)
+	if err != nil {
+		return nil, err
+	}
+	client.Location = config.Location
+	return &bigqueryConn{client: client, config: config}, nil
+}
+
+type bigqueryConn struct {
+	client *bigquery.Client
+	config bigqueryConfig
+}
+
+func (c *bigqueryConn) Prepare(query string) (driver.Stmt, error) {
+	return &bigqueryStmt{conn: c, query: query}, nil
+}
+
+func (c *bigqueryConn) Close() error {
+	return c.client.Close()
+}
+
+func (c *bigqueryConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("bigquery: transactions are not supported")
+}
+
+func (c *bigqueryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q := c.client.Query(query)
+	q.DefaultProjectID = c.config.Project
+	q.DefaultDatasetID = c.config.Dataset
+	q.MaxBytesBilled = c.config.MaxBytes
+	for _, arg := range args {
+		value := arg.Value
+		// Text keys read from other engines arrive as bytes.
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		q.Parameters = append(q.Parameters, bigquery.QueryParameter{Value: value})
+	}
+
+	if c.config.MaxBytes > 0 {
+		q.DryRun = true
+		job, err := q.Run(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if processed := job.LastStatus().Statistics.TotalBytesProcessed; processed > c.config.MaxBytes {
+			return nil, fmt.Errorf("bigquery: query would process %s, more than max_bytes of %s",
+				formatByteSize(processed), formatByteSize(c.config.MaxBytes))
+		}
+		q.DryRun = false
+	}
+
+	it, err := q.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows := &bigqueryRows{it: it}
+	// The schema is only known once the first page has been read.
+	rows.err = it.Next(&rows.next)
+	if rows.err != nil && rows.err != iterator.Done {
+		return nil, rows.err
+	}
+	return rows, nil
+}
+
+type bigqueryStmt struct {
+	conn  *bigqueryConn
+	query string
+}
+
+func (s *bigqueryStmt) Close() error {
+	return nil
+}
+
+func (s *bigqueryStmt) NumInput() int {
+	return -1
+}
+
+func (s *bigqueryStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("bigquery: only queries are supported")
+}
+
+func (s *bigqueryStmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return s.conn.QueryContext(context.Background(), s.query, named)
+}
+
+func (s *bigqueryStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+type bigqueryRows struct {
+	it   *bigquery.RowIterator
+	next []bigquery.Value
+	err  error
+}
+
+func (r *bigqueryRows) Columns() []string {
+	columns := make([]string, len(r.it.Schema))
+	for i, field := range r.it.Schema {
+		columns[i] = field.Name
+	}
+	return columns
+}
+
+func (r *bigqueryRows) Close() error {
+	return nil
+}
+
+func (r *bigqueryRows) Next(dest []driver.Value) error {
+	if r.err == iterator.Done {
+		return io.EOF
+	}
+	if r.err != nil {
+		return r.err
+	}
+	for i, value := range r.next {
+		dest[i] = bigqueryValue(value)
+	}
+	r.next = nil
+	r.err = r.it.Next(&r.next)
+	return nil
+}
+
+// bigqueryValue converts the client's values to the types other drivers
+// return, so they format alike: dates and datetimes become times in UTC
+// and NUMERICs their decimal text.
+func bigqueryValue(value bigquery.Value) driver.Value {
+	switch v := value.(type) {
+	case civil.Date:
+		return v.In(time.UTC)
+	case civil.DateTime:
+		return v.In(time.UTC)
+	case civil.Time:
+		return v.String()
+	case *big.Rat:
+		return strings.TrimSuffix(strings.TrimRight(bigquery.BigNumericString(v), "0"), ".")
+	case nil, bool, int64, float64, string, []byte, time.Time:
+		return v
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,94 @@
+package dbdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// binaryHashDialect is implemented by dialects that can hash binary values
+// on the server, so rows comparisons read the MD5 of a large value in place
+// of its bytes. Every dialect writes the hash alike, as the bytes of
+// md5:<hex>, so the values compare across engines.
+type binaryHashDialect interface {
+	// hashBinary renders a binary expression as its hash when it's longer
+	// than over bytes, or always when over is negative, and as it is
+	// otherwise. NULLs stay NULL.
+	hashBinary(expression string, over int64) string
+}
+
+// binaryTypes are the binary column types of every engine, as described by
+// the source's schema, leaving out the deprecated ones the engines can't
+// hash, such as SQL Server's image.
+var binaryTypes = map[string]bool{
+	"bytea": true, "blob": true, "tinyblob": true, "mediumblob": true, "longblob": true,
+	"binary": true, "varbinary": true, "bytes": true,
+}
+
+func isBinaryType(dataType string) bool {
+	dataType = strings.ToLower(dataType)
+	// e.g. varbinary(255)
+	if i := strings.Index(dataType, "("); i >= 0 {
+		dataType = dataType[:i]
+	}
+	return binaryTypes[strings.TrimSpace(dataType)]
+}
+
+// canHashBinary reports whether the database hashes binary values.
+func canHashBinary(db *DB) bool {
+	_, ok := db.Dialect.(binaryHashDialect)
+	return ok
+}
+
+// markLargeObjects flags the columns holding large objects, matched
+// case-insensitively.
+func markLargeObjects(db *DB, columns []tableColumn, largeObjects []string) error {
+	if len(largeObjects) == 0 {
+		return nil
+	}
+	if !canHashBinary(db) {
+		return fmt.Errorf("%s can't hash large objects", db.Dialect.Name())
+	}
+	for _, name := range largeObjects {
+		found := false
+		for i := range columns {
+			if strings.EqualFold(columns[i].Name, name) {
+				columns[i].LargeObject, found = true, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no column %s holding large objects", name)
+		}
+	}
+	return nil
+}
+
+// columnExpression selects a column, hashed on the server when it holds
+// large objects, or binary values and HashBinaryOver is set.
+func (t tableSpec) columnExpression(d Dialect, column tableColumn) string {
+	expression := d.QuoteIdentifier(column.Name)
+	hashing, ok := d.(binaryHashDialect)
+	switch {
+	case !ok:
+		return expression
+	case column.LargeObject:
+		if _, postgres := d.(postgresDialect); postgres {
+			// the column holds the object's oid, which differs between
+			// databases
+			expression = "lo_get(" + expression + ")"
+		}
+		return hashing.hashBinary(expression, -1)
+	case t.HashBinaryOver > 0 && isBinaryType(column.DataType):
+		return hashing.hashBinary(expression, t.HashBinaryOver)
+	}
+	return expression
+}
+
+// hasLargeObjects reports whether any column holds large objects.
+func (t tableSpec) hasLargeObjects() bool {
+	for _, column := range t.Columns {
+		if column.LargeObject {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package dbdiff
+
+// Checkpoints keep the progress of rows comparisons, so that a table
+// interrupted part way is compared from its last batch on rather than from
+// its first row.
+type Checkpoints interface {
+	// Checkpoint returns the table's saved progress between the databases,
+	// or nil to compare it from the start.
+	Checkpoint(source, dest, table string) *RowsCheckpoint
+	// SaveCheckpoint records the table's progress after every batch.
+	SaveCheckpoint(source, dest, table string, checkpoint RowsCheckpoint)
+}
+
+// RowsCheckpoint is how far a rows comparison of a table got: every key
+// before Next is compared, with the rows scanned on each database and the
+// differences found among them.
+type RowsCheckpoint struct {
+	Next                                 []interface{}
+	SourceRows, DestRows                 int
+	OnlyInSource, OnlyInDest, Mismatched int
+	DroppedDifferences                   int
+	Differences                          []RowDifference
+	SyncStatements                       []string
+}
+
+// restore picks a table's comparison up from the checkpoint.
+func (t *TableResult) restore(checkpoint RowsCheckpoint) {
+	t.SourceRowCount, t.DestRowCount = checkpoint.SourceRows, checkpoint.DestRows
+	t.OnlyInSource, t.OnlyInDest, t.Mismatched = checkpoint.OnlyInSource, checkpoint.OnlyInDest, checkpoint.Mismatched
+	t.DroppedDifferences = checkpoint.DroppedDifferences
+	t.Differences = append([]RowDifference(nil), checkpoint.Differences...)
+	t.SyncStatements = append([]string(nil), checkpoint.SyncStatements...)
+	for _, difference := range t.Differences {
+		t.kept += difference.size()
+	}
+	for _, statement := range t.SyncStatements {
+		t.kept += int64(len(statement))
+	}
+}
+
+// checkpoint is the table's progress once every key before next is
+// compared.
+func (t *TableResult) checkpoint(next []interface{}, sourceRows, destRows int) RowsCheckpoint {
+	return RowsCheckpoint{
+		Next: next, SourceRows: sourceRows, DestRows: destRows,
+		OnlyInSource: t.OnlyInSource, OnlyInDest: t.OnlyInDest, Mismatched: t.Mismatched, DroppedDifferences: t.DroppedDifferences,
+		Differences: t.Differences, SyncStatements: t.SyncStatements,
+	}
+}
@@ -0,0 +1,77 @@
+package dbdiff
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// savedCheckpoints keeps every checkpoint saved, and hands out resume to
+// continue from.
+type savedCheckpoints struct {
+	resume *RowsCheckpoint
+	saved  []RowsCheckpoint
+}
+
+func (c *savedCheckpoints) Checkpoint(source, dest, table string) *RowsCheckpoint {
+	return c.resume
+}
+
+func (c *savedCheckpoints) SaveCheckpoint(source, dest, table string, checkpoint RowsCheckpoint) {
+	checkpoint.Differences = append([]RowDifference(nil), checkpoint.Differences...)
+	c.saved = append(c.saved, checkpoint)
+}
+
+func TestCompareRowsCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	want, err := openFixtures(t, Options{Mode: ModeRows}).CompareTable(ctx, TableConfig{Name: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints := &savedCheckpoints{}
+	result, err := openFixtures(t, Options{Mode: ModeRows, Checkpoints: checkpoints}).CompareTable(ctx, TableConfig{Name: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameRows(result, want) {
+		t.Errorf("with checkpoints the result is %+v, want %+v", result, want)
+	}
+	if len(checkpoints.saved) < 2 {
+		t.Fatalf("saved %d checkpoints of 19 rows in batches of 3", len(checkpoints.saved))
+	}
+
+	// resuming from any of them ends the same as comparing the whole table
+	for _, checkpoint := range checkpoints.saved {
+		checkpoint := checkpoint
+		if len(checkpoint.Next) != 1 {
+			t.Fatalf("checkpoint %+v isn't of the id", checkpoint)
+		}
+		result, err := openFixtures(t, Options{Mode: ModeRows, Checkpoints: &savedCheckpoints{resume: &checkpoint}}).CompareTable(ctx, TableConfig{Name: "orders"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameRows(result, want) {
+			t.Errorf("resumed from id %v, the result is %+v, want %+v", checkpoint.Next[0], result, want)
+		}
+	}
+}
+
+func TestCompareRowsCheckpointOfAnotherKey(t *testing.T) {
+	// checkpointed when the table was keyed by two columns
+	checkpoint := &RowsCheckpoint{Next: []interface{}{int64(5), "c5"}, SourceRows: 4, DestRows: 2, OnlyInSource: 2}
+	result, err := openFixtures(t, Options{Mode: ModeRows, Checkpoints: &savedCheckpoints{resume: checkpoint}}).
+		CompareTable(context.Background(), TableConfig{Name: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SourceRowCount != 10 || result.DestRowCount != 9 || result.OnlyInSource != 2 {
+		t.Errorf("compared %+v, want the whole table", result)
+	}
+}
+
+func sameRows(got, want TableResult) bool {
+	return got.SourceRowCount == want.SourceRowCount && got.DestRowCount == want.DestRowCount &&
+		got.OnlyInSource == want.OnlyInSource && got.OnlyInDest == want.OnlyInDest && got.Mismatched == want.Mismatched &&
+		reflect.DeepEqual(differingKeys(got), differingKeys(want))
+}
@@ -0,0 +1,172 @@
+package dbdiff
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Check is a query run on both databases whose results are compared, for
+// invariants the table comparisons can't express, such as the sum of order
+// totals per status.
+type Check struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// DestQuery replaces Query on the destination, for SQL that has to
+	// differ between the engines.
+	DestQuery string `json:"dest_query,omitempty"`
+}
+
+// CheckResult is a check's outcome on a pair of databases. The rows each
+// returned are compared as a set, in any order, with their values rendered
+// as text.
+type CheckResult struct {
+	Name         string
+	Source, Dest string
+	// SourceRows and DestRows are the rows each database returned.
+	SourceRows, DestRows [][]string
+	// OnlyInSource and OnlyInDest are the rows the other database didn't
+	// return, in order.
+	OnlyInSource, OnlyInDest [][]string
+	Duration                 time.Duration
+	// Err is why the check couldn't be run.
+	Err error
+}
+
+// Passed reports whether the check ran and both databases returned the same
+// rows.
+func (r CheckResult) Passed() bool {
+	return r.Err == nil && len(r.OnlyInSource) == 0 && len(r.OnlyInDest) == 0
+}
+
+// Scalar returns the single value each database returned, and false unless
+// both returned exactly one row of one column.
+func (r CheckResult) Scalar() (source, dest string, ok bool) {
+	if len(r.SourceRows) != 1 || len(r.DestRows) != 1 || len(r.SourceRows[0]) != 1 || len(r.DestRows[0]) != 1 {
+		return "", "", false
+	}
+	return r.SourceRows[0][0], r.DestRows[0][0], true
+}
+
+// RunCheck runs the check on both databases and compares what they return.
+// When it fails, the error is kept in the result's Err.
+func (c *Comparer) RunCheck(ctx context.Context, check Check) CheckResult {
+	result := CheckResult{Name: check.Name, Source: c.databases.source.ServiceName, Dest: c.databases.dest.ServiceName}
+	start := time.Now()
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	destQuery := check.DestQuery
+	if destQuery == "" {
+		destQuery = check.Query
+	}
+	source, dest := &c.databases.source, &c.databases.dest
+	err := bothSides(func() error {
+		return c.Options.Retry.do(ctx, source, func() (err error) {
+			result.SourceRows, err = queryCheck(ctx, source, check.Query)
+			return err
+		})
+	}, func() error {
+		return c.Options.Retry.do(ctx, dest, func() (err error) {
+			result.DestRows, err = queryCheck(ctx, dest, destQuery)
+			return err
+		})
+	})
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Err = err
+		c.log.Errorw("Check failed", "check", check.Name, "source", result.Source, "dest", result.Dest, "duration", result.Duration, "error", err)
+		return result
+	}
+	result.OnlyInSource, result.OnlyInDest = diffRowSets(result.SourceRows, result.DestRows)
+	if result.Passed() {
+		c.log.Infow("Check passed", "check", check.Name, "source", result.Source, "dest", result.Dest, "duration", result.Duration)
+	} else {
+		c.log.Warnw("Check differs", "check", check.Name, "source", result.Source, "dest", result.Dest, "duration", result.Duration,
+			"only_in_source", len(result.OnlyInSource), "only_in_dest", len(result.OnlyInDest))
+	}
+	return result
+}
+
+// RunChecks runs the checks on every pair, one check at a time, returning
+// each pair's result in the order of Comparers.
+func (m *MultiComparer) RunChecks(ctx context.Context, checks []Check) []CheckResult {
+	var results []CheckResult
+	for _, check := range checks {
+		pairResults := make([]CheckResult, len(m.comparers))
+		var wg sync.WaitGroup
+		for i, comparer := range m.comparers {
+			wg.Add(1)
+			go func(i int, comparer *Comparer) {
+				defer wg.Done()
+				pairResults[i] = comparer.RunCheck(ctx, check)
+			}(i, comparer)
+		}
+		wg.Wait()
+		results = append(results, pairResults...)
+	}
+	return results
+}
+
+func queryCheck(ctx context.Context, db *DB, query string) ([][]string, error) {
+	rows, err := db.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	var result [][]string
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, db.wrap(err)
+		}
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = formatValue(value)
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, db.wrap(err)
+	}
+	db.addScanned(len(result))
+	return result, nil
+}
+
+// diffRowSets returns the rows of each set missing from the other, counting
+// duplicates.
+func diffRowSets(source, dest [][]string) (onlyInSource, onlyInDest [][]string) {
+	// the rows' values joined by a byte values won't contain
+	key := func(row []string) string { return strings.Join(row, "\x00") }
+	remaining := map[string]int{}
+	for _, row := range dest {
+		remaining[key(row)]++
+	}
+	for _, row := range source {
+		if remaining[key(row)] > 0 {
+			remaining[key(row)]--
+			continue
+		}
+		onlyInSource = append(onlyInSource, row)
+	}
+	for _, row := range dest {
+		if remaining[key(row)] > 0 {
+			remaining[key(row)]--
+			onlyInDest = append(onlyInDest, row)
+		}
+	}
+	for _, rows := range [][][]string{onlyInSource, onlyInDest} {
+		sort.Slice(rows, func(i, j int) bool { return key(rows[i]) < key(rows[j]) })
+	}
+	return onlyInSource, onlyInDest
+}
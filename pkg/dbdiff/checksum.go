@@ -0,0 +1,208 @@
+package dbdiff
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	ChecksumServer = "server"
+	ChecksumClient = "client"
+)
+
+// ChunkChecksum is the checksum of one key range on both databases.
+type ChunkChecksum struct {
+	Range                KeyRange
+	SourceRows, DestRows int
+	SourceHash, DestHash string
+	// Bounds is the Range as shown, with masked key columns masked.
+	Bounds string
+}
+
+func (c ChunkChecksum) matches() bool {
+	return c.SourceRows == c.DestRows && c.SourceHash == c.DestHash
+}
+
+// compareChecksums splits the table into key ranges of roughly chunkSize rows
+// (or a single range when chunkSize is 0), checksums each range on both sides,
+// Options.Parallelism ranges at a time, and records the ranges whose checksums
+// differ.
+func compareChecksums(ctx context.Context, databases *Databases, table *TableResult, config TableConfig, options Options) error {
+	spec, err := loadTableSpec(ctx, &databases.source, config, options)
+	if err != nil {
+		return err
+	}
+
+	ranges := []KeyRange{{}}
+	if size := chunkSize(config, options); size > 0 {
+		err := options.Retry.do(ctx, &databases.source, func() (err error) {
+			ranges, err = chunkRanges(ctx, &databases.source, spec, size)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	} else if workers := parallelism(config, options); workers > 1 {
+		var split []KeyRange
+		err := options.Retry.do(ctx, &databases.source, func() (err error) {
+			split, err = integerRanges(ctx, &databases.source, spec, workers, 0)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if split != nil {
+			ranges = split
+		}
+	}
+
+	// the ranges are checksummed concurrently, and then looked into in order
+	chunks := make([]ChunkChecksum, len(ranges))
+	err = forEachRange(ctx, len(ranges), parallelism(config, options), func(ctx context.Context, i int) (err error) {
+		chunks[i], err = checksumChunk(ctx, databases, spec, ranges[i], options)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		table.SourceRowCount += chunk.SourceRows
+		table.DestRowCount += chunk.DestRows
+		table.Chunks++
+		if chunk.matches() {
+			continue
+		}
+		table.MismatchedChunks = append(table.MismatchedChunks, chunk)
+		if options.Localize {
+			if err := localizeChunk(ctx, databases, spec, chunk, options, table); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checksumChunk(ctx context.Context, databases *Databases, spec tableSpec, keyRange KeyRange, options Options) (ChunkChecksum, error) {
+	chunk := ChunkChecksum{Range: keyRange, Bounds: spec.displayRange(keyRange)}
+	checksum := checksumRangeOnServer
+	if options.Checksum == ChecksumClient {
+		checksum = func(ctx context.Context, db *DB, spec tableSpec, keyRange KeyRange) (int, string, error) {
+			return checksumRangeOnClient(ctx, db, spec, keyRange, options.BatchSize)
+		}
+	}
+
+	err := bothSides(func() error {
+		return options.Retry.do(ctx, &databases.source, func() (err error) {
+			chunk.SourceRows, chunk.SourceHash, err = checksum(ctx, &databases.source, spec, keyRange)
+			return err
+		})
+	}, func() error {
+		return options.Retry.do(ctx, &databases.dest, func() (err error) {
+			chunk.DestRows, chunk.DestHash, err = checksum(ctx, &databases.dest, spec.onDest(), keyRange)
+			return err
+		})
+	})
+	return chunk, err
+}
+
+// bothSides runs the source and destination halves of a comparison
+// concurrently and returns the first error either of them hit.
+func bothSides(source, dest func() error) error {
+	errs := make(chan error, 2)
+	go func() { errs <- source() }()
+	go func() { errs <- dest() }()
+	err := <-errs
+	if destErr := <-errs; err == nil {
+		err = destErr
+	}
+	return err
+}
+
+// moduloDialect is implemented by dialects without the % operator.
+type moduloDialect interface {
+	modulo(dividend string, divisor int) string
+}
+
+// chunkRanges picks every chunkSize-th key on the source as a range boundary.
+// The first and last ranges are left open so rows outside the source's key
+// span on the destination are still covered.
+func chunkRanges(ctx context.Context, db *DB, spec tableSpec, chunkSize int) ([]KeyRange, error) {
+	predicate, args := spec.rangePredicate(db.Dialect, KeyRange{})
+	if predicate != "" {
+		predicate = " WHERE " + predicate
+	}
+	boundary := fmt.Sprintf("(rn - 1) %% %d", chunkSize)
+	if dialect, ok := db.Dialect.(moduloDialect); ok {
+		boundary = dialect.modulo("rn - 1", chunkSize)
+	}
+	rows, err := db.DB.QueryContext(ctx, db.rebind(fmt.Sprintf(`
+		SELECT %[1]s FROM (
+			SELECT %[1]s, row_number() OVER (ORDER BY %[2]s) AS rn FROM %[3]s%[5]s
+		) numbered
+		WHERE rn > 1 AND %[4]s = 0
+		ORDER BY rn`, spec.keyList(db.Dialect), spec.keyTuple(db.Dialect), spec.from(db.Dialect), boundary, predicate)), args...)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	defer rows.Close()
+
+	ranges := []KeyRange{{}}
+	for rows.Next() {
+		boundary := make([]interface{}, len(spec.Key))
+		pointers := make([]interface{}, len(boundary))
+		for i := range boundary {
+			pointers[i] = &boundary[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		ranges[len(ranges)-1].Upper = boundary
+		ranges = append(ranges, KeyRange{Lower: boundary})
+	}
+	return ranges, rows.Err()
+}
+
+// checksumRangeOnServer has the database aggregate a checksum of the range
+// without transferring the rows. Checksums computed this way are only
+// comparable between databases of the same dialect.
+func checksumRangeOnServer(ctx context.Context, db *DB, spec tableSpec, keyRange KeyRange) (int, string, error) {
+	predicate, args := spec.rangePredicate(db.Dialect, keyRange)
+	query := db.Dialect.ChecksumQuery(spec, predicate)
+
+	var count int
+	var hash string
+	if err := db.DB.QueryRowContext(ctx, db.rebind(query), args...).Scan(&count, &hash); err != nil {
+		return 0, "", db.wrap(err)
+	}
+	db.addScanned(count)
+	return count, hash, nil
+}
+
+// checksumRangeOnClient streams the rows and hashes their normalized values
+// locally, which is slower but independent of how each server renders text.
+func checksumRangeOnClient(ctx context.Context, db *DB, spec tableSpec, keyRange KeyRange, batchSize int) (int, string, error) {
+	cursor := newRowCursor(db, spec, keyRange, batchSize)
+	// the checksum's retries wait for the throttle
+	cursor.throttled = false
+	hash := md5.New()
+	for {
+		row, err := cursor.Next(ctx)
+		if err != nil {
+			return 0, "", err
+		}
+		if row == nil {
+			break
+		}
+		for i, value := range row {
+			hash.Write([]byte(spec.hashValue(i, value)))
+			hash.Write([]byte{0})
+		}
+		hash.Write([]byte{'\n'})
+	}
+	if cursor.scanned == 0 {
+		return 0, "", nil
+	}
+	return cursor.scanned, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,755 @@
+// Package dbdiff compares tables between two databases, possibly on different
+// engines: their row counts, rows, checksums, schemas and sequences.
+//
+//	comparer, err := dbdiff.Open("source", sourceConn, "dest", destConn, dbdiff.Options{Mode: dbdiff.ModeCount})
+//	if err != nil {
+//		return err
+//	}
+//	defer comparer.Close()
+//	result, err := comparer.CompareTable(ctx, dbdiff.TableConfig{Name: "orders"})
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	_ "github.com/lib/pq"
+	_ "github.com/microsoft/go-mssqldb"
+	_ "github.com/sijms/go-ora/v2"
+	_ "github.com/snowflakedb/gosnowflake"
+)
+
+type DB struct {
+	DB          *sqlx.DB
+	ServiceName string
+	Dialect     Dialect
+	log         *zap.SugaredLogger
+	tracer      trace.Tracer
+	// scanned counts the rows read, shared by both databases
+	scanned *int64
+	// snapshot is what counts are read in, if taken
+	snapshot *snapshot
+	// keepalive pings the idle connections, if the pool asks for it
+	keepalive *keepalive
+	// throttle limits the queries, if the endpoint asks for it
+	throttle *throttle
+	// conn is the connection string the database was opened with, if
+	// known
+	conn string
+}
+
+// close stops pinging the database and closes it.
+func (db *DB) close() error {
+	db.keepalive.close()
+	return db.DB.Close()
+}
+
+// addScanned counts rows read from the database, or checksummed by it.
+func (db *DB) addScanned(rows int) {
+	if db.scanned != nil {
+		atomic.AddInt64(db.scanned, int64(rows))
+	}
+}
+
+type Databases struct {
+	source DB
+	dest   DB
+}
+
+// TableResult is the outcome of comparing one table. Which fields are set
+// depends on the comparison mode.
+type TableResult struct {
+	Name                         string
+	SourceRowCount, DestRowCount int
+	Duration                     time.Duration
+
+	// Source and Dest name the databases compared, telling apart the
+	// results of a table against several destinations.
+	Source, Dest string
+
+	// Approximate is set when either count is an estimate.
+	Approximate bool
+	// Partitions are the counts of each partition of a table partitioned
+	// on both databases, with Options.Partitions, in order. The table's
+	// counts are their sums.
+	Partitions []PartitionCount
+
+	// Examples are rows found on one database only, with Options.Examples,
+	// when the counts or checksums differ.
+	Examples []RowExample
+
+	// SourceRefreshed and DestRefreshed are when a materialized view was
+	// last refreshed, with Options.Views in ModeCount, on engines that keep
+	// track. They're zero otherwise.
+	SourceRefreshed, DestRefreshed time.Time
+
+	// populated by the row-level comparison
+	OnlyInSource, OnlyInDest, Mismatched int
+	Differences                          []RowDifference
+	// SyncStatements repair each of the Differences on the destination,
+	// with Options.SyncSQL.
+	SyncStatements []string
+	// DroppedDifferences are the differences found past Options.MemoryLimit,
+	// counted in OnlyInSource, OnlyInDest and Mismatched but neither kept in
+	// Differences nor repaired by SyncStatements.
+	DroppedDifferences int
+	// kept is roughly the bytes Differences and SyncStatements take
+	kept int64
+
+	// populated by the sampled comparison, along with the row-level fields
+	// for the sampled rows
+	SampledSource, SampledDest int
+
+	// populated by the freshness comparison: the latest value of the
+	// freshness column, zero when no row has one
+	SourceLatest, DestLatest time.Time
+
+	// populated by the aggregates comparison
+	Aggregates []AggregateValue
+
+	// populated by the distinct comparison, along with the counts
+	DistinctCounts []DistinctCount
+
+	// populated by the groups comparison: the number of groups on either
+	// database, and those whose counts differ, in order
+	Buckets          int
+	DifferingBuckets []BucketCount
+
+	// populated by the keys comparison, for each database independently
+	SourceKeys, DestKeys KeyScan
+
+	// populated by the membership comparison, along with Chunks and the
+	// counts
+	DifferingFilters []MembershipChunk
+
+	// populated by the checksum comparison
+	Chunks           int
+	MismatchedChunks []ChunkChecksum
+	DifferingRanges  []ChunkChecksum
+
+	// populated by the schema comparison, and by the grants comparison
+	// along with the number of grantees, or grantees and columns, holding
+	// privileges
+	SourceColumns, DestColumns int
+	SchemaDifferences          []SchemaDifference
+	SourceGrants, DestGrants   int
+
+	// populated by the sequence comparison
+	Sequences []SequenceDiff
+
+	// SourceActivity and DestActivity are the writes to the table the
+	// catalogs kept track of when it was compared, with Options.Unchanged.
+	// Unchanged is set when the result is the last comparison's, the table
+	// having been written to on neither database since.
+	SourceActivity, DestActivity string
+	Unchanged                    bool
+
+	// Err is why the comparison failed, leaving the rest of the result
+	// incomplete.
+	Err error
+}
+
+const (
+	ModeCount      = "count"
+	ModeRows       = "rows"
+	ModeChecksum   = "checksum"
+	ModeSchema     = "schema"
+	ModeSequences  = "sequences"
+	ModeSample     = "sample"
+	ModeFreshness  = "freshness"
+	ModeAggregates = "aggregates"
+	ModeGroups     = "groups"
+	ModeKeys       = "keys"
+	ModeGrants     = "grants"
+	ModeMembership = "membership"
+	ModeDistinct   = "distinct"
+)
+
+// Options control how tables are compared.
+type Options struct {
+	// Mode is one of ModeCount, ModeRows, ModeChecksum, ModeSchema,
+	// ModeSequences, ModeSample, ModeFreshness, ModeAggregates, ModeGroups,
+	// ModeKeys, ModeGrants, ModeMembership or ModeDistinct, or the mode of a
+	// registered Strategy.
+	Mode string
+	// BatchSize is the number of rows fetched per batch when rows are
+	// streamed to the client.
+	BatchSize int
+	// ChunkSize is the number of rows per checksummed key range, or per
+	// key range filtered in ModeMembership. Zero checksums each table as a
+	// whole. With Parallelism, it's also the number of keys per counted
+	// range.
+	ChunkSize int
+	// Parallelism is how many key ranges of a table ModeCount and
+	// ModeChecksum compare at once, for tables a single query takes too long
+	// on. Counts split a single integer key's span between its lowest and
+	// highest keys into Parallelism ranges, or ranges of ChunkSize keys, and
+	// add them up; tables with other keys are counted as a whole. Checksums
+	// compare their ChunkSize chunks that many at a time, or without
+	// ChunkSize split a single integer key like counts. Zero or one compares
+	// a range at a time.
+	Parallelism int
+	// Checksum is ChecksumServer or ChecksumClient, also telling where
+	// ModeMembership hashes the keys.
+	Checksum string
+	// Localize bisects mismatched key ranges until the differing keys are
+	// found, stopping once a range has at most LeafSize rows.
+	Localize bool
+	LeafSize int
+	// Examples is the number of rows present on one database only that
+	// ModeCount and ModeChecksum fetch for tables whose exact counts or
+	// checksums differ. Zero fetches none.
+	Examples int
+	// Normalize are the rules column values are normalized by in row
+	// comparisons and client-side checksums. Server-side checksums can't
+	// apply them, so they're computed on the client when any is set.
+	Normalize Normalization
+	// Mask are the rules the values of columns of every table are shown
+	// by, in the differences, examples and sync statements. A table's own
+	// take precedence.
+	Mask Masking
+	// MaskKey is the HMAC key MaskHash hashes values under. New picks a
+	// random one when it's empty, so hashes only match within a comparer;
+	// set it to match them across runs.
+	MaskKey []byte
+	// SyncSQL has ModeRows, and ModeChecksum with Localize, generate the
+	// INSERT, UPDATE and DELETE statements that would bring the destination
+	// in line with the source.
+	SyncSQL bool
+	// SampleSize is the number of keys sampled on each database in
+	// ModeSample.
+	SampleSize int
+	// FreshnessColumn is the timestamp column whose latest value ModeFreshness
+	// compares, for tables that don't set their own. Empty compares
+	// DefaultFreshnessColumn.
+	FreshnessColumn string
+	// GroupBy is the SQL expression ModeGroups counts rows by, such as
+	// tenant_id, for tables that don't set their own.
+	GroupBy string
+	// Tables are all the tables being compared, so sequences owned by none
+	// of them can be told apart, and Functions knows which schemas to read.
+	Tables []TableConfig
+	// Estimate reads row counts from the catalog where the engine keeps
+	// them, instead of counting, for tables without a filter or Exact set.
+	// In ModeDistinct, it estimates the distinct values instead, where the
+	// engine has an aggregate for it, for tables without Exact set.
+	Estimate bool
+	// Views has DiscoverTables list views and materialized views along
+	// with tables, and ModeCount read when materialized views were last
+	// refreshed.
+	Views bool
+	// Partitions has ModeCount count partitioned tables one partition at a
+	// time, keeping each partition's counts along with the table's.
+	Partitions bool
+	// Retry is how count and checksum queries are retried after transient
+	// failures.
+	Retry Retry
+	// HashBinaryOver has rows comparisons and client-side checksums read
+	// the binary values longer than this many bytes, such as those of bytea
+	// and BLOB columns, as an MD5 the database computes instead of their
+	// bytes. Zero reads them whole. It needs both databases to hash them,
+	// and SyncSQL the values themselves, so it's ignored otherwise.
+	HashBinaryOver int64
+	// QueryTimeout bounds each table's comparison, unless the table sets
+	// its own Timeout. Postgres connections made by Open also get it as their
+	// statement_timeout, so the server stops working on a query the
+	// comparison gave up on, which cuts short a table's longer Timeout.
+	// Zero disables it.
+	QueryTimeout time.Duration
+	// Logger receives progress, retries and schema drift found ahead of
+	// data comparisons. Nil discards them.
+	Logger *zap.Logger
+	// TracerProvider receives a span for every table's comparison, with the
+	// queries it runs on each database as children. Nil disables tracing.
+	TracerProvider trace.TracerProvider
+	// Unchanged, unless nil, keeps the tables' last results, and the tables
+	// written to on neither database since are skipped, their last result
+	// standing, on engines that keep track of writes: Postgres's
+	// pg_stat_user_tables and MySQL's information_schema.tables. Schema,
+	// sequences and grants comparisons are never skipped.
+	Unchanged LastResults
+	// AsOf, unless zero, has the source read as it was then, to compare a
+	// restored backup or a delayed replica against: each table through its
+	// History, or the engine's temporal query without one. The
+	// destination is read as it is now. Schema, sequences and grants
+	// comparisons compare the databases as they are now, and tables aren't
+	// skipped by Unchanged.
+	AsOf time.Time
+	// MemoryLimit bounds the bytes each rows comparison holds, in ModeRows
+	// and ModeChecksum with Localize: a quarter of it for the batch of each
+	// database, fetching fewer than BatchSize rows when the rows are wide,
+	// and half for the differences, those found past it being only counted
+	// in DroppedDifferences. The sizes are estimates of the values scanned,
+	// not of the process. Zero leaves it unbounded.
+	MemoryLimit int64
+	// FDW has ModeRows compare each PostgreSQL table with a single query on
+	// the source, full joining it with the destination's through
+	// postgres_fdw, so no rows are transferred and only their counts are
+	// known: those on one side only and those mismatched, not which. The
+	// foreign server is created from the destination's connection string,
+	// which needs the privilege to, unless FDWServer names one already set
+	// up on the source. Tables are compared row by row instead when either
+	// database isn't PostgreSQL, or with Normalize or SyncSQL. Checkpoints
+	// aren't kept, the query being a single one.
+	FDW       bool
+	FDWServer string
+	// Checkpoints, unless nil, keep the progress of ModeRows comparisons
+	// after every batch and continue those that have a checkpoint from it.
+	Checkpoints Checkpoints
+	// SourceConns and DestConns limit the connections Open makes to each
+	// database, and so how many queries run on it at once, since queries
+	// wait for a free connection. Zero leaves them unlimited.
+	SourceConns, DestConns int
+	// SourcePool and DestPool tune the connections Open keeps to each
+	// database.
+	SourcePool, DestPool Pool
+	// SourceThrottle and DestThrottle limit the load Open's databases are
+	// put under.
+	SourceThrottle, DestThrottle Throttle
+	// SourceTLS and DestTLS configure how Open encrypts the connections to
+	// each database.
+	SourceTLS, DestTLS TLS
+	// SourceSSH and DestSSH have Open connect to each database through an
+	// SSH jump host.
+	SourceSSH, DestSSH SSHTunnel
+	// SourceIAMAuth and DestIAMAuth have Open authenticate to Amazon RDS
+	// PostgreSQL databases with IAM auth tokens, generated from the AWS
+	// credentials for every new connection, instead of a password.
+	SourceIAMAuth, DestIAMAuth bool
+}
+
+// Comparer compares tables between a source and a destination database.
+type Comparer struct {
+	Options   Options
+	databases *Databases
+	log       *zap.SugaredLogger
+	scanned   *int64
+	// tunnels opened by Open, closed with the databases
+	tunnels []*sshTunnel
+	// fdw reaches the destination from the source, with Options.FDW
+	fdw *fdwLink
+}
+
+// Open connects to the source and destination databases. The names label
+// them in results and errors.
+func Open(sourceName, sourceConn, destName, destConn string, options Options) (*Comparer, error) {
+	srcdb, srcTunnel, err := openEndpoint(Endpoint{
+		Name: sourceName, Conn: sourceConn, TLS: options.SourceTLS, SSH: options.SourceSSH,
+		IAMAuth: options.SourceIAMAuth, Conns: options.SourceConns, Pool: options.SourcePool, Throttle: options.SourceThrottle,
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	destdb, destTunnel, err := openEndpoint(Endpoint{
+		Name: destName, Conn: destConn, TLS: options.DestTLS, SSH: options.DestSSH,
+		IAMAuth: options.DestIAMAuth, Conns: options.DestConns, Pool: options.DestPool, Throttle: options.DestThrottle,
+	}, options)
+	if err != nil {
+		srcdb.close()
+		if srcTunnel != nil {
+			srcTunnel.Close()
+		}
+		return nil, err
+	}
+
+	comparer := New(srcdb, destdb, options)
+	for _, tunnel := range []*sshTunnel{srcTunnel, destTunnel} {
+		if tunnel != nil {
+			comparer.tunnels = append(comparer.tunnels, tunnel)
+		}
+	}
+	return comparer, nil
+}
+
+// Endpoint is a database to connect to and how.
+type Endpoint struct {
+	// Name labels the database in results and errors.
+	Name, Conn string
+	TLS        TLS
+	// SSH is the jump host to connect through, if any.
+	SSH SSHTunnel
+	// IAMAuth authenticates to Amazon RDS PostgreSQL with IAM auth tokens.
+	IAMAuth bool
+	// Conns limits the connections made to the database, zero leaving them
+	// unlimited.
+	Conns int
+	// Pool tunes the connections kept open to the database.
+	Pool Pool
+	// Throttle limits the load the database is put under.
+	Throttle Throttle
+}
+
+// openEndpoint connects to one of the databases, through its SSH tunnel if
+// it has one, which is returned to be closed along with it.
+func openEndpoint(endpoint Endpoint, options Options) (DB, *sshTunnel, error) {
+	conn := endpoint.Conn
+	var iam *rdsIAM
+	if endpoint.IAMAuth {
+		var err error
+		// tokens are signed for the database's own endpoint, not the tunnel
+		if iam, err = newRDSIAM(conn); err != nil {
+			return DB{}, nil, err
+		}
+	}
+	var tunnel *sshTunnel
+	if endpoint.SSH.Host != "" {
+		var err error
+		if conn, tunnel, err = openTunnel(conn, endpoint.SSH, options.sugar().With("database", endpoint.Name)); err != nil {
+			return DB{}, nil, err
+		}
+	}
+	db, dialect, err := openDatabase(conn, options.QueryTimeout, endpoint.TLS, iam)
+	if err != nil {
+		if tunnel != nil {
+			tunnel.Close()
+		}
+		return DB{}, nil, err
+	}
+	db.SetMaxOpenConns(endpoint.Conns)
+	endpoint.Pool.apply(db)
+	opened := DB{DB: db, ServiceName: endpoint.Name, Dialect: dialect, conn: endpoint.Conn, throttle: newThrottle(endpoint.Throttle)}
+	if endpoint.Pool.Keepalive > 0 {
+		opened.keepalive = startKeepalive(db, endpoint.Pool.Keepalive, options.sugar().With("database", endpoint.Name))
+	}
+	return opened, tunnel, nil
+}
+
+// New returns a Comparer over already open databases.
+func New(source, dest DB, options Options) *Comparer {
+	options = options.withMaskKey()
+	log := options.sugar()
+	source.log, dest.log = log.With("database", source.ServiceName), log.With("database", dest.ServiceName)
+	source.tracer, dest.tracer = options.tracer(), options.tracer()
+	scanned := new(int64)
+	source.scanned, dest.scanned = scanned, scanned
+	for _, db := range []*DB{&source, &dest} {
+		if db.snapshot == nil {
+			db.snapshot = &snapshot{}
+		}
+		if t := db.throttle; t != nil && (t.limits.MaxLag > 0 || t.limits.MaxActive > 0) {
+			if _, ok := db.Dialect.(loadDialect); !ok {
+				db.log.Warnw("Replication lag and active queries are only checked on PostgreSQL and MySQL, not pausing for them", "engine", db.Dialect.Name())
+			}
+		}
+	}
+
+	if options.Mode == ModeChecksum && options.Checksum == ChecksumServer &&
+		source.Dialect.Name() != dest.Dialect.Name() {
+		log.Warnw("Checksums aren't comparable across engines, hashing rows on the client instead",
+			"source_engine", source.Dialect.Name(), "dest_engine", dest.Dialect.Name())
+		options.Checksum = ChecksumClient
+	}
+	if options.Mode == ModeChecksum && options.Checksum == ChecksumServer && options.Normalize.set() {
+		log.Warnw("Checksums can't be normalized on the server, hashing rows on the client instead")
+		options.Checksum = ChecksumClient
+	}
+	if options.FDW && options.Mode == ModeRows {
+		switch {
+		case source.Dialect.Name() != "PostgreSQL" || dest.Dialect.Name() != "PostgreSQL":
+			log.Warnw("postgres_fdw needs PostgreSQL on both databases, walking the rows instead",
+				"source_engine", source.Dialect.Name(), "dest_engine", dest.Dialect.Name())
+			options.FDW = false
+		case options.Normalize.set() || options.SyncSQL:
+			log.Warnw("Rows compared through postgres_fdw can't be normalized or repaired, walking the rows instead")
+			options.FDW = false
+		}
+	}
+	if options.HashBinaryOver > 0 {
+		switch {
+		case !canHashBinary(&source) || !canHashBinary(&dest):
+			log.Warnw("Binary values can only be hashed on PostgreSQL, MySQL, SQL Server and BigQuery, reading them whole instead",
+				"source_engine", source.Dialect.Name(), "dest_engine", dest.Dialect.Name())
+			options.HashBinaryOver = 0
+		case options.SyncSQL:
+			log.Warnw("Sync statements need the binary values themselves, reading them whole instead")
+			options.HashBinaryOver = 0
+		}
+	}
+	comparer := &Comparer{options, &Databases{source, dest}, log, scanned, nil, nil}
+	if options.FDW && options.Mode == ModeRows {
+		comparer.fdw = newFDWLink(options.FDWServer)
+	}
+	return comparer
+}
+
+func (o Options) sugar() *zap.SugaredLogger {
+	if o.Logger == nil {
+		return zap.NewNop().Sugar()
+	}
+	return o.Logger.Sugar()
+}
+
+// RowsScanned is how many rows have been read from both databases so far,
+// or checksummed by them, for progress reporting.
+func (c *Comparer) RowsScanned() int64 {
+	return atomic.LoadInt64(c.scanned)
+}
+
+// Source returns the source database.
+func (c *Comparer) Source() *DB {
+	return &c.databases.source
+}
+
+// Dest returns the destination database.
+func (c *Comparer) Dest() *DB {
+	return &c.databases.dest
+}
+
+// Close closes both databases, and the snapshots and SSH tunnels on them.
+func (c *Comparer) Close() error {
+	c.ReleaseSnapshots()
+	err := c.closeFDW()
+	if sourceErr := c.databases.source.close(); err == nil {
+		err = sourceErr
+	}
+	if destErr := c.databases.dest.close(); err == nil {
+		err = destErr
+	}
+	for _, tunnel := range c.tunnels {
+		if tunnelErr := tunnel.Close(); err == nil {
+			err = tunnelErr
+		}
+	}
+	return err
+}
+
+// closeFDW drops what the comparer set up for postgres_fdw on the source.
+func (c *Comparer) closeFDW() error {
+	if c.fdw == nil {
+		return nil
+	}
+	return c.fdw.close(&c.databases.source)
+}
+
+// CompareTable compares one table in the comparer's mode. When it fails, the
+// error is also kept in the result's Err.
+func (c *Comparer) CompareTable(ctx context.Context, config TableConfig) (TableResult, error) {
+	table := c.newResult(config)
+	start := time.Now()
+	ctx, span := c.startTable(ctx, config, attribute.String("databasediff.source", table.Source), attribute.String("databasediff.dest", table.Dest))
+	defer endTable(span, &table)
+	ctx, cancel := c.withTableTimeout(ctx, config)
+	defer cancel()
+
+	config, err := c.readAsOf(config)
+	if err == nil {
+		err = c.databases.source.checkSystemTable(config.Name)
+	}
+	if err == nil {
+		err = c.databases.dest.checkSystemTable(config.onDest().Name)
+	}
+	if err != nil {
+		return table, c.finish(&table, start, err)
+	}
+
+	if c.canSkip(config) {
+		c.readActivity(ctx, &table, config)
+		if last := c.unchanged(table, config, start); last != nil {
+			table = *last
+			return table, nil
+		}
+	}
+
+	switch c.Options.Mode {
+	case ModeCount:
+		err = c.compareCounts(ctx, &table, config)
+	case ModeRows:
+		if c.fdw != nil {
+			err = compareRowsOverFDW(ctx, c.databases, c.fdw, &table, config, c.Options)
+			break
+		}
+		err = compareRows(ctx, c.databases, &table, config, c.Options)
+	case ModeChecksum:
+		err = compareChecksums(ctx, c.databases, &table, config, c.Options)
+	case ModeSchema:
+		if config.Name == Functions {
+			err = compareFunctions(ctx, c.databases, &table, c.Options.Tables)
+			break
+		}
+		if config.Name == Settings {
+			err = compareSettings(ctx, c.databases, &table)
+			break
+		}
+		err = compareSchema(ctx, c.databases, &table, config)
+	case ModeSequences:
+		err = compareSequences(ctx, c.databases, &table, config, c.Options.Tables)
+	case ModeSample:
+		err = c.compareSample(ctx, &table, config)
+	case ModeFreshness:
+		err = c.compareFreshness(ctx, &table, config)
+	case ModeAggregates:
+		err = c.compareAggregates(ctx, &table, config)
+	case ModeGroups:
+		err = c.compareGroups(ctx, &table, config)
+	case ModeKeys:
+		err = c.compareKeySpace(ctx, &table, config)
+	case ModeGrants:
+		err = compareGrants(ctx, c.databases, &table, config)
+	case ModeMembership:
+		err = compareMembership(ctx, c.databases, &table, config, c.Options)
+	case ModeDistinct:
+		err = c.compareDistinct(ctx, &table, config)
+	default:
+		strategy := strategyFor(c.Options.Mode)
+		if strategy == nil {
+			err = fmt.Errorf("unknown mode %q", c.Options.Mode)
+			break
+		}
+		err = strategy.Compare(ctx, &c.databases.source, &c.databases.dest, &table, config)
+	}
+	if err == nil {
+		c.findExamples(ctx, &table, config)
+	}
+	return table, c.finish(&table, start, err)
+}
+
+func (c *Comparer) newResult(config TableConfig) TableResult {
+	return TableResult{Name: config.Name, Source: c.databases.source.ServiceName, Dest: c.databases.dest.ServiceName}
+}
+
+// finish records how the comparison that started at start ended.
+func (c *Comparer) finish(table *TableResult, start time.Time, err error) error {
+	table.Duration = time.Since(start)
+	if err != nil {
+		table.Err = err
+		c.log.Errorw("Comparison failed", "table", table.Name, "source", table.Source, "dest", table.Dest, "status", table.Status(), "duration", table.Duration, "error", err)
+		return err
+	}
+	if table.DroppedDifferences > 0 {
+		c.log.Warnw("Dropped the differences past the memory limit, keeping their counts", "table", table.Name, "source", table.Source, "dest", table.Dest,
+			"kept", len(table.Differences), "dropped", table.DroppedDifferences)
+	}
+	c.log.Infow("Compared table", "table", table.Name, "source", table.Source, "dest", table.Dest, "mode", c.Options.Mode, "duration", table.Duration,
+		"source_rows", table.SourceRowCount, "dest_rows", table.DestRowCount)
+	return nil
+}
+
+// CompareTables compares the tables on a pool of workers, each comparing one
+// table at a time, and sends the results as they finish. The channel is
+// closed once every table is done.
+func (c *Comparer) CompareTables(ctx context.Context, tables []TableConfig, workers int) <-chan TableResult {
+	results := make(chan TableResult, len(tables))
+	go func() {
+		forEachTable(tables, workers, func(config TableConfig) {
+			// failures are kept in the result
+			result, _ := c.CompareTable(ctx, config)
+			results <- result
+		})
+		close(results)
+	}()
+	return results
+}
+
+// forEachTable calls compare for every table on a pool of workers, returning
+// once all of them are done.
+func forEachTable(tables []TableConfig, workers int, compare func(TableConfig)) {
+	if workers > len(tables) {
+		workers = len(tables)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan TableConfig)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for config := range jobs {
+				compare(config)
+			}
+		}()
+	}
+	for _, config := range tables {
+		jobs <- config
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// withTimeout applies the query timeout, if any, to a table's comparison.
+func (c *Comparer) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.Options.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.Options.QueryTimeout)
+}
+
+// withTableTimeout applies the table's own timeout in place of the query
+// timeout when it sets one.
+func (c *Comparer) withTableTimeout(ctx context.Context, config TableConfig) (context.Context, context.CancelFunc) {
+	if config.Timeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(config.Timeout))
+	}
+	return c.withTimeout(ctx)
+}
+
+// compareCounts counts the table's rows on both databases, or estimates them
+// with Options.Estimate, partition by partition with Options.Partitions.
+func (c *Comparer) compareCounts(ctx context.Context, table *TableResult, config TableConfig) error {
+	source, dest := &c.databases.source, &c.databases.dest
+	table.Approximate = c.canEstimate(source, config) || c.canEstimate(dest, config)
+	var sourcePartitions, destPartitions map[string]int
+	err := bothSides(func() error {
+		return c.Options.Retry.do(ctx, source, func() (err error) {
+			table.SourceRowCount, sourcePartitions, err = c.countRows(ctx, source, config)
+			return err
+		})
+	}, func() error {
+		return c.Options.Retry.do(ctx, dest, func() (err error) {
+			table.DestRowCount, destPartitions, err = c.countRows(ctx, dest, config.onDest())
+			return err
+		})
+	})
+	table.Partitions = partitionCounts(sourcePartitions, destPartitions)
+	if err != nil {
+		return err
+	}
+	return c.readRefreshes(ctx, table, config)
+}
+
+func (c *Comparer) getRowCount(ctx context.Context, db *DB, table TableConfig) (int, error) {
+	if c.canEstimate(db, table) {
+		count, err := db.Dialect.(estimatingDialect).estimateCount(ctx, db, table.Name)
+		if err != nil {
+			return count, db.wrap(err)
+		}
+		return count, nil
+	}
+	if c.canCountInRanges(db, table) {
+		return c.countInRanges(ctx, db, table)
+	}
+	query := countQuery(db.Dialect, table)
+	switch {
+	case table.CountQuery != "":
+		query = table.CountQuery
+	case table.Count != "":
+		query = "SELECT " + table.Count + " FROM " + table.from(db.Dialect) + whereClause(table.Where)
+	}
+	count := -1
+	if err := db.scanRow(ctx, query, &count); err != nil {
+		return count, db.wrap(err)
+	}
+	return count, nil
+}
+
+// countQuery is the dialect's query counting the table's rows, or a plain
+// COUNT(*) of the table read through the engine's temporal query, which the
+// dialect's query doesn't know of.
+func countQuery(d Dialect, table TableConfig) string {
+	if table.temporalAt().IsZero() {
+		return d.CountQuery(table.Name, table.Where)
+	}
+	return "SELECT COUNT(*) FROM " + table.from(d) + whereClause(table.Where)
+}
@@ -0,0 +1,264 @@
+package dbdiff
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// The source holds orders 1 to 10. The destination lacks 3 and 4, has an
+// extra 11, a different total for 5 and a later synced_at for 7. events has
+// no primary key, only a unique code, and differs in the payload of b.
+var (
+	sourceFixture = []string{
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT NOT NULL, total INTEGER NOT NULL, synced_at TEXT)`,
+		`WITH RECURSIVE n(id) AS (SELECT 1 UNION ALL SELECT id + 1 FROM n WHERE id < 10)
+			INSERT INTO orders SELECT id, 'c' || id, id * 10, '2024-01-01' FROM n`,
+		`CREATE TABLE events (code TEXT NOT NULL UNIQUE, payload TEXT)`,
+		`INSERT INTO events VALUES ('a', 'x'), ('b', 'y'), ('c', 'z')`,
+	}
+	destFixture = []string{
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer TEXT NOT NULL, total INTEGER NOT NULL, synced_at TEXT)`,
+		`WITH RECURSIVE n(id) AS (SELECT 1 UNION ALL SELECT id + 1 FROM n WHERE id < 11)
+			INSERT INTO orders SELECT id, 'c' || id, id * 10, '2024-01-01' FROM n WHERE id NOT IN (3, 4)`,
+		`UPDATE orders SET total = 999 WHERE id = 5`,
+		`UPDATE orders SET synced_at = '2024-02-01' WHERE id = 7`,
+		`CREATE TABLE events (code TEXT NOT NULL UNIQUE, payload TEXT)`,
+		`INSERT INTO events VALUES ('a', 'x'), ('b', 'changed'), ('c', 'z')`,
+	}
+)
+
+// openFixtures creates the fixture databases as SQLite files and opens a
+// comparer over them.
+func openFixtures(t *testing.T, options Options) *Comparer {
+	t.Helper()
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "source.db"), filepath.Join(dir, "dest.db")}
+	for i, statements := range [][]string{sourceFixture, destFixture} {
+		db, err := sqlx.Open(sqliteDriverName, paths[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, statement := range statements {
+			if _, err := db.Exec(statement); err != nil {
+				db.Close()
+				t.Fatalf("%s: %v", statement, err)
+			}
+		}
+		db.Close()
+	}
+	if options.BatchSize == 0 {
+		// small enough for the tables to take several batches
+		options.BatchSize = 3
+	}
+	comparer, err := Open("source", "sqlite://"+paths[0], "dest", "sqlite://"+paths[1], options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { comparer.Close() })
+	return comparer
+}
+
+// differingKeys lists the keys of the result's differences by kind, in order.
+func differingKeys(result TableResult) map[string]string {
+	keys := map[string][]string{}
+	for _, difference := range result.Differences {
+		keys[difference.Kind] = append(keys[difference.Kind], difference.Key)
+	}
+	joined := map[string]string{}
+	for kind, list := range keys {
+		sort.Strings(list)
+		joined[kind] = strings.Join(list, ",")
+	}
+	return joined
+}
+
+func TestCompareCounts(t *testing.T) {
+	for _, test := range []struct {
+		name                string
+		table               TableConfig
+		source, dest, drift int
+	}{
+		{"missing and extra rows", TableConfig{Name: "orders"}, 10, 9, 1},
+		{"where", TableConfig{Name: "orders", Where: "id > 8"}, 2, 3, -1},
+		{"no primary key", TableConfig{Name: "events"}, 3, 3, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			comparer := openFixtures(t, Options{Mode: ModeCount})
+			result, err := comparer.CompareTable(context.Background(), test.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.SourceRowCount != test.source || result.DestRowCount != test.dest {
+				t.Errorf("counted %d and %d rows, want %d and %d", result.SourceRowCount, result.DestRowCount, test.source, test.dest)
+			}
+			if diff, _ := result.Drift(ModeCount); diff != test.drift {
+				t.Errorf("drift is %d, want %d", diff, test.drift)
+			}
+		})
+	}
+}
+
+func TestCompareRows(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		table TableConfig
+		want  map[string]string
+	}{
+		{"missing, extra and changed rows", TableConfig{Name: "orders"},
+			map[string]string{MissingInDest: "id=3,id=4", MissingInSource: "id=11", ValuesDiffer: "id=5,id=7"}},
+		{"exclude columns", TableConfig{Name: "orders", ExcludeColumns: []string{"synced_at"}},
+			map[string]string{MissingInDest: "id=3,id=4", MissingInSource: "id=11", ValuesDiffer: "id=5"}},
+		{"where", TableConfig{Name: "orders", Where: "id >= 5"},
+			map[string]string{MissingInSource: "id=11", ValuesDiffer: "id=5,id=7"}},
+		{"key", TableConfig{Name: "events", Key: []string{"code"}},
+			map[string]string{ValuesDiffer: "code=b"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			comparer := openFixtures(t, Options{Mode: ModeRows})
+			result, err := comparer.CompareTable(context.Background(), test.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := differingKeys(result); !equalKeys(got, test.want) {
+				t.Errorf("differences are %v, want %v", got, test.want)
+			}
+			want := 0
+			for _, keys := range test.want {
+				want += len(strings.Split(keys, ","))
+			}
+			if diff, _ := result.Drift(ModeRows); diff != want {
+				t.Errorf("drift is %d, want %d", diff, want)
+			}
+		})
+	}
+}
+
+func TestCompareRowsWithoutKey(t *testing.T) {
+	comparer := openFixtures(t, Options{Mode: ModeRows})
+	result, err := comparer.CompareTable(context.Background(), TableConfig{Name: "events"})
+	if err == nil || !strings.Contains(err.Error(), "no primary key") {
+		t.Fatalf("compared a table without a key, error %v", err)
+	}
+	if result.Err != err {
+		t.Errorf("result's Err is %v, want %v", result.Err, err)
+	}
+}
+
+func TestCompareChecksums(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		options    Options
+		table      TableConfig
+		chunks     int
+		mismatched int
+	}{
+		{"whole table", Options{Checksum: ChecksumServer}, TableConfig{Name: "orders"}, 1, 1},
+		{"on the client", Options{Checksum: ChecksumClient}, TableConfig{Name: "orders"}, 1, 1},
+		{"chunks", Options{Checksum: ChecksumServer, ChunkSize: 4}, TableConfig{Name: "orders"}, 3, 3},
+		{"where", Options{Checksum: ChecksumServer, ChunkSize: 4}, TableConfig{Name: "orders", Where: "id <= 2"}, 1, 0},
+		{"exclude columns", Options{Checksum: ChecksumServer, ChunkSize: 4},
+			TableConfig{Name: "orders", Where: "id > 5 AND id < 11", ExcludeColumns: []string{"synced_at"}}, 2, 0},
+		{"changed excluded column", Options{Checksum: ChecksumServer, ChunkSize: 4},
+			TableConfig{Name: "orders", Where: "id > 5 AND id < 11"}, 2, 1},
+		{"key", Options{Checksum: ChecksumServer, ChunkSize: 2}, TableConfig{Name: "events", Key: []string{"code"}}, 2, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.options.Mode = ModeChecksum
+			comparer := openFixtures(t, test.options)
+			result, err := comparer.CompareTable(context.Background(), test.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Chunks != test.chunks || len(result.MismatchedChunks) != test.mismatched {
+				t.Errorf("%d of %d chunks differ, want %d of %d", len(result.MismatchedChunks), result.Chunks, test.mismatched, test.chunks)
+			}
+		})
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		options  Options
+		table    TableConfig
+		want     map[string]string
+		checksum string
+	}{
+		{"leaves of one row", Options{ChunkSize: 4, LeafSize: 1}, TableConfig{Name: "orders"},
+			map[string]string{MissingInDest: "id=3,id=4", MissingInSource: "id=11", ValuesDiffer: "id=5,id=7"}, ChecksumServer},
+		{"leaves of the whole chunk", Options{ChunkSize: 4, LeafSize: 4}, TableConfig{Name: "orders"},
+			map[string]string{MissingInDest: "id=3,id=4", MissingInSource: "id=11", ValuesDiffer: "id=5,id=7"}, ChecksumServer},
+		{"on the client", Options{LeafSize: 2}, TableConfig{Name: "orders"},
+			map[string]string{MissingInDest: "id=3,id=4", MissingInSource: "id=11", ValuesDiffer: "id=5,id=7"}, ChecksumClient},
+		{"exclude columns", Options{ChunkSize: 4, LeafSize: 1}, TableConfig{Name: "orders", ExcludeColumns: []string{"synced_at"}},
+			map[string]string{MissingInDest: "id=3,id=4", MissingInSource: "id=11", ValuesDiffer: "id=5"}, ChecksumServer},
+		{"where", Options{ChunkSize: 4, LeafSize: 1}, TableConfig{Name: "orders", Where: "id < 6"},
+			map[string]string{MissingInDest: "id=3,id=4", ValuesDiffer: "id=5"}, ChecksumServer},
+		{"key", Options{ChunkSize: 2, LeafSize: 1}, TableConfig{Name: "events", Key: []string{"code"}},
+			map[string]string{ValuesDiffer: "code=b"}, ChecksumServer},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.options.Mode, test.options.Localize, test.options.Checksum = ModeChecksum, true, test.checksum
+			comparer := openFixtures(t, test.options)
+			result, err := comparer.CompareTable(context.Background(), test.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := differingKeys(result); !equalKeys(got, test.want) {
+				t.Errorf("differences are %v, want %v", got, test.want)
+			}
+			if len(result.DifferingRanges) == 0 {
+				t.Error("no differing ranges")
+			}
+			for _, keyRange := range result.DifferingRanges {
+				if keyRange.SourceRows > test.options.LeafSize || keyRange.DestRows > test.options.LeafSize {
+					t.Errorf("range %s holds %d and %d rows, more than leaves of %d", keyRange.Range, keyRange.SourceRows, keyRange.DestRows, test.options.LeafSize)
+				}
+			}
+			diff, _ := result.Drift(ModeChecksum)
+			if rows := result.OnlyInSource + result.OnlyInDest + result.Mismatched; diff != rows || diff != len(result.Differences) {
+				t.Errorf("drift is %d, want the %d differences", diff, len(result.Differences))
+			}
+		})
+	}
+}
+
+func TestDrift(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		table       TableResult
+		mode        string
+		diff, total int
+	}{
+		{"missing rows", TableResult{SourceRowCount: 100, DestRowCount: 98}, ModeCount, 2, 100},
+		{"extra rows", TableResult{SourceRowCount: 98, DestRowCount: 100}, ModeCount, -2, 100},
+		{"rows", TableResult{SourceRowCount: 10, DestRowCount: 9, OnlyInSource: 2, OnlyInDest: 1, Mismatched: 2}, ModeRows, 5, 10},
+		{"checksum chunks", TableResult{SourceRowCount: 10, DestRowCount: 9, MismatchedChunks: []ChunkChecksum{{SourceRows: 4, DestRows: 2}, {SourceRows: 1, DestRows: 3}}},
+			ModeChecksum, 7, 10},
+		{"localized checksum", TableResult{SourceRowCount: 10, DestRowCount: 9, Mismatched: 1, DifferingRanges: []ChunkChecksum{{SourceRows: 1, DestRows: 1}}},
+			ModeChecksum, 1, 10},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if diff, total := test.table.Drift(test.mode); diff != test.diff || total != test.total {
+				t.Errorf("drift is %d of %d, want %d of %d", diff, total, test.diff, test.total)
+			}
+		})
+	}
+}
+
+func equalKeys(got, want map[string]string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for kind, keys := range want {
+		if got[kind] != keys {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,245 @@
+package dbdiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config is the optional JSON file listing the tables to compare, along with
+// settings for each.
+type Config struct {
+	Tables []TableConfig `json:"tables"`
+	// Schemas maps source schemas to the destination schemas holding the
+	// same tables, for schema-qualified table names without a dest.
+	Schemas map[string]string `json:"schemas,omitempty"`
+	// Checks are queries compared alongside the tables.
+	Checks []Check `json:"checks,omitempty"`
+	// Profiles are named environments to compare, each with the connection
+	// settings of its source and destination.
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+}
+
+// Profile holds the connection settings of an environment's source and
+// destination, keyed like the command's environment variables without their
+// SRC_ or DEST_ prefix, such as conn, db or sslmode. Values may be secret
+// references like the variables'.
+type Profile struct {
+	Source map[string]string `json:"source,omitempty"`
+	Dest   map[string]string `json:"dest,omitempty"`
+}
+
+// TableConfig holds the settings of one table. Unset fields fall back to
+// the defaults. In the file a table can also be given as just its name.
+type TableConfig struct {
+	Name string `json:"name"`
+	// Dest is the table's name on the destination, if it differs.
+	Dest       string   `json:"dest,omitempty"`
+	MaxDiff    *int     `json:"max_diff,omitempty"`
+	MaxDiffPct *float64 `json:"max_diff_pct,omitempty"`
+	// Where restricts the comparison to the rows matching an SQL condition,
+	// which has to be valid on both databases.
+	Where string `json:"where,omitempty"`
+	// Key are the columns rows are ordered and matched by in place of the
+	// primary key, such as those of a unique index. Together they have to
+	// be unique and not null on both databases.
+	Key []string `json:"key,omitempty"`
+	// ExcludeColumns are left out of row comparisons and checksums, for
+	// columns that legitimately differ, such as synced_at. Their rows
+	// can't be repaired by sync statements, which would insert them
+	// without those columns.
+	ExcludeColumns []string `json:"exclude_columns,omitempty"`
+	// LargeObjects are the columns holding PostgreSQL large objects by their
+	// oid, which rows comparisons compare by an MD5 of the objects the
+	// database computes. On the other engines, they're binary columns whose
+	// values are always hashed alike.
+	LargeObjects []string `json:"large_objects,omitempty"`
+	// Exact counts the table even when estimating the others.
+	Exact bool `json:"exact,omitempty"`
+	// Count replaces COUNT(*) in the table's count query with another
+	// expression, such as COUNT(*) FILTER (WHERE deleted_at IS NULL).
+	Count string `json:"count,omitempty"`
+	// CountQuery replaces the table's count query altogether, for counts
+	// that need a join. It returns a single number. DestCountQuery replaces
+	// it on the destination.
+	CountQuery     string `json:"count_query,omitempty"`
+	DestCountQuery string `json:"dest_count_query,omitempty"`
+	// FreshnessColumn is the timestamp column compared in freshness mode.
+	FreshnessColumn string `json:"freshness_column,omitempty"`
+	// Aggregates are the column statistics compared in aggregates mode.
+	Aggregates []Aggregate `json:"aggregates,omitempty"`
+	// Distinct are the columns distinct mode counts the distinct values of,
+	// each on its own, or several together when written comma separated as
+	// in "tenant_id, order_no". Tables listing none count their key's.
+	Distinct []string `json:"distinct,omitempty"`
+	// GroupBy is the SQL expression groups mode counts rows by, such as
+	// date_trunc('day', created_at). Like Where, it must be valid on both
+	// databases.
+	GroupBy string `json:"group_by,omitempty"`
+	// Parallelism and ChunkSize override Options.Parallelism and
+	// Options.ChunkSize for the table, such as for the one table too large
+	// to count with a single query.
+	Parallelism int `json:"parallelism,omitempty"`
+	ChunkSize   int `json:"chunk_size,omitempty"`
+	// Mask are the rules the table's columns are shown by, on top of
+	// Options.Mask.
+	Mask Masking `json:"mask,omitempty"`
+	// Timeout overrides Options.QueryTimeout for the table, such as a
+	// shorter one for a bloated audit table that shouldn't hold up the
+	// rest of the run.
+	Timeout Duration `json:"timeout,omitempty"`
+	// History is how the source keeps the table's past states, read with
+	// Options.AsOf in place of the engine's temporal query.
+	History *History `json:"history,omitempty"`
+
+	// asOf is when the source is read as of, set by Comparer.readAsOf,
+	// and destWhere the Where the destination is still read with
+	asOf      time.Time
+	destWhere string
+}
+
+// Duration is a time.Duration written in the file as a string such as "90s"
+// or "1h30m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration %s isn't a string such as \"90s\"", data)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	if parsed < 0 {
+		return fmt.Errorf("duration %s is negative", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (t *TableConfig) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &t.Name); err == nil {
+		return nil
+	}
+	type plain TableConfig
+	return json.Unmarshal(data, (*plain)(t))
+}
+
+// LoadConfig reads a configuration file.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, table := range config.Tables {
+		if table.Name == "" {
+			return config, fmt.Errorf("%s: table %d has no name", path, i+1)
+		}
+		if err := table.Mask.Validate(); err != nil {
+			return config, fmt.Errorf("%s: table %s: %w", path, table.Name, err)
+		}
+		if table.History != nil && table.History.ValidFrom == "" {
+			return config, fmt.Errorf("%s: table %s: history has no valid_from", path, table.Name)
+		}
+	}
+	for name, profile := range config.Profiles {
+		if profile.Source == nil && profile.Dest == nil {
+			return config, fmt.Errorf("%s: profile %s has neither a source nor a dest", path, name)
+		}
+	}
+	for i, check := range config.Checks {
+		if check.Name == "" {
+			return config, fmt.Errorf("%s: check %d has no name", path, i+1)
+		}
+		if check.Query == "" {
+			return config, fmt.Errorf("%s: check %s has no query", path, check.Name)
+		}
+	}
+	return config, nil
+}
+
+// TablesOr returns the configured tables, or the given defaults when the
+// configuration has none, with their destination names resolved.
+func (c Config) TablesOr(defaults []string) []TableConfig {
+	configs := append([]TableConfig(nil), c.Tables...)
+	if len(configs) == 0 {
+		for _, name := range defaults {
+			configs = append(configs, TableConfig{Name: name})
+		}
+	}
+	for i := range configs {
+		configs[i].Dest = c.destName(configs[i])
+	}
+	return configs
+}
+
+// TablesNamed returns the settings of the named tables, in place of the
+// configured list, with their destination names resolved. Tables the
+// configuration doesn't list get the defaults.
+func (c Config) TablesNamed(names []string) []TableConfig {
+	configs := make([]TableConfig, len(names))
+	for i, name := range names {
+		configs[i] = c.Table(name)
+		configs[i].Dest = c.destName(configs[i])
+	}
+	return configs
+}
+
+// destName returns the table's name on the destination: its dest, or its
+// name with the schema mapped.
+func (c Config) destName(table TableConfig) string {
+	if table.Dest != "" {
+		return table.Dest
+	}
+	ref := ParseTableRef(table.Name)
+	if schema, ok := c.Schemas[ref.Schema]; ok && ref.Schema != "" {
+		return schema + "." + ref.Name
+	}
+	return table.Name
+}
+
+// onDest returns the table as named, counted and filtered on the
+// destination.
+func (t TableConfig) onDest() TableConfig {
+	if !t.asOf.IsZero() {
+		t.Where, t.asOf = t.destWhere, time.Time{}
+	}
+	if t.Dest != "" {
+		t.Name = t.Dest
+	}
+	if t.DestCountQuery != "" {
+		t.CountQuery = t.DestCountQuery
+	}
+	return t
+}
+
+// Masks reports whether any table masks its columns.
+func (c Config) Masks() bool {
+	for _, table := range c.Tables {
+		if len(table.Mask) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Table returns the settings of a table, which are empty when the
+// configuration doesn't list it.
+func (c Config) Table(name string) TableConfig {
+	for _, table := range c.Tables {
+		if table.Name == name {
+			return table
+		}
+	}
+	return TableConfig{Name: name}
+}
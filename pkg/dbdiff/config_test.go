@@ -0,0 +1,121 @@
+package dbdiff
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	for _, test := range []struct {
+		json string
+		want time.Duration
+		err  string
+	}{
+		{`"90s"`, 90 * time.Second, ""},
+		{`"1h30m"`, 90 * time.Minute, ""},
+		{`"0s"`, 0, ""},
+		{`90`, 0, `isn't a string`},
+		{`"ninety"`, 0, `invalid duration`},
+		{`"-5s"`, 0, `is negative`},
+	} {
+		t.Run(test.json, func(t *testing.T) {
+			var d Duration
+			err := json.Unmarshal([]byte(test.json), &d)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if time.Duration(d) != test.want {
+				t.Errorf("got %s, want %s", time.Duration(d), test.want)
+			}
+		})
+	}
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	data, err := json.Marshal(Duration(90 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d Duration
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(d) != 90*time.Minute {
+		t.Errorf("%s read back as %s", data, time.Duration(d))
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	for _, test := range []struct {
+		name, json string
+		err        string
+	}{
+		{"names and objects", `{"tables": ["orders", {"name": "users", "key": ["email"], "timeout": "30s"}]}`, ""},
+		{"checks", `{"checks": [{"name": "open orders", "query": "SELECT count(*) FROM orders"}]}`, ""},
+		{"not json", `{"tables": [`, "unexpected end of JSON input"},
+		{"table without a name", `{"tables": [{"where": "id > 0"}]}`, "table 1 has no name"},
+		{"check without a name", `{"checks": [{"query": "SELECT 1"}]}`, "check 1 has no name"},
+		{"check without a query", `{"checks": [{"name": "open orders"}]}`, "check open orders has no query"},
+		{"masking", `{"tables": [{"name": "users", "mask": {"email": "hash", "ssn": "partial"}}]}`, ""},
+		{"profiles", `{"profiles": {"staging": {"source": {"conn": "postgres://primary"}, "dest": {"conn": "postgres://replica"}}}}`, ""},
+		{"history without valid_from", `{"tables": [{"name": "users", "history": {"table": "users_audit"}}]}`, "table users: history has no valid_from"},
+		{"bad timeout", `{"tables": [{"name": "users", "timeout": "-1m"}]}`, "is negative"},
+		{"empty profile", `{"profiles": {"staging": {}}}`, "profile staging has neither a source nor a dest"},
+		{"unknown masking rule", `{"tables": [{"name": "users", "mask": {"email": "scramble"}}]}`, `table users: unknown masking rule "scramble"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "databasediff.json")
+			if err := os.WriteFile(path, []byte(test.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadConfig(path)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error %v, want one containing %q", err, test.err)
+			}
+			if !strings.HasPrefix(err.Error(), path+": ") {
+				t.Errorf("error %q doesn't name the file", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "databasediff.json")
+	data := `{"tables": ["orders", {"name": "users", "dest": "accounts", "max_diff": 5, "timeout": "30s"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Tables) != 2 || config.Tables[0].Name != "orders" {
+		t.Fatalf("tables are %+v", config.Tables)
+	}
+	users := config.Table("users")
+	if users.Dest != "accounts" || users.MaxDiff == nil || *users.MaxDiff != 5 || time.Duration(users.Timeout) != 30*time.Second {
+		t.Errorf("users is %+v", users)
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("error %v, want the file not existing", err)
+	}
+}
@@ -0,0 +1,83 @@
+package dbdiff
+
+import (
+	"context"
+)
+
+// schemaObject is an index, constraint or trigger of a table, or a stored
+// function of a schema, keyed by name.
+type schemaObject struct {
+	Name       string `db:"name"`
+	Kind       string `db:"kind"`
+	Definition string `db:"definition"`
+}
+
+func getSchemaObjects(ctx context.Context, db *DB, tableName string) ([]schemaObject, error) {
+	objects, err := db.Dialect.SchemaObjects(ctx, db, tableName)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	return objects, nil
+}
+
+// compareSchemaObjects diffs the indexes, constraints and triggers of a
+// table. Objects are matched by name first; objects left unmatched on both
+// sides with the same definition are reported as renamed rather than missing
+// twice.
+func compareSchemaObjects(ctx context.Context, databases *Databases, table *TableResult, config TableConfig) error {
+	var source, dest []schemaObject
+	err := bothSides(func() (err error) {
+		source, err = getSchemaObjects(ctx, &databases.source, config.Name)
+		return err
+	}, func() (err error) {
+		dest, err = getSchemaObjects(ctx, &databases.dest, config.onDest().Name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	diffSchemaObjects(table, source, dest)
+	return nil
+}
+
+// diffSchemaObjects records the objects of each database missing on the
+// other, renamed or defined differently.
+func diffSchemaObjects(table *TableResult, source, dest []schemaObject) {
+	// dest objects not yet matched, keyed by kind and name
+	unmatched := make(map[string]schemaObject, len(dest))
+	for _, object := range dest {
+		unmatched[object.Kind+" "+object.Name] = object
+	}
+	var sourceOnly []schemaObject
+	for _, s := range source {
+		d, ok := unmatched[s.Kind+" "+s.Name]
+		if !ok {
+			sourceOnly = append(sourceOnly, s)
+			continue
+		}
+		delete(unmatched, s.Kind+" "+s.Name)
+		if s.Definition != d.Definition {
+			table.addSchemaDifference(s.Name, s.Kind, s.Definition, d.Definition)
+		}
+	}
+
+	byDefinition := make(map[string]schemaObject, len(unmatched))
+	for _, d := range unmatched {
+		byDefinition[d.Kind+" "+d.Definition] = d
+	}
+	for _, s := range sourceOnly {
+		d, ok := byDefinition[s.Kind+" "+s.Definition]
+		if !ok {
+			table.addSchemaDifference(s.Name, s.Kind, s.Definition, absent)
+			continue
+		}
+		delete(byDefinition, s.Kind+" "+s.Definition)
+		delete(unmatched, d.Kind+" "+d.Name)
+		table.addSchemaDifference(s.Name, s.Kind+" name", s.Name, d.Name)
+	}
+	for _, d := range dest {
+		if _, ok := unmatched[d.Kind+" "+d.Name]; ok {
+			table.addSchemaDifference(d.Name, d.Kind, absent, d.Definition)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect captures what differs between database engines: how to connect,
+// quote identifiers and order keys, and the catalog queries behind the
+// checksum, schema and sequence comparisons.
+type Dialect interface {
+	// Name is the engine's human-readable name.
+	Name() string
+	// DriverName is the database/sql driver the dialect connects with.
+	DriverName() string
+	// DSN converts a connection string into the driver's format.
+	DSN(conn string) (string, error)
+	QuoteIdentifier(name string) string
+	// CurrentSchema is an SQL expression for the schema that unqualified
+	// table names resolve to.
+	CurrentSchema() string
+	// OrderKey renders a key column so that it orders byte-wise, matching
+	// the client-side merge in compareKeys.
+	OrderKey(column string, kind keyKind) string
+	// KeyPredicate compares ordered key columns with the given values using
+	// one of >, >= or <, returning the predicate with ? placeholders and the
+	// arguments for them.
+	KeyPredicate(columns []string, op string, values []interface{}) (string, []interface{})
+	// Paginate returns the clause appended after ORDER BY to skip offset
+	// rows and return at most limit.
+	Paginate(limit, offset int) string
+	// RandomOrder is an expression to ORDER BY for the rows in random order.
+	RandomOrder() string
+	// CountQuery returns the query behind the count comparison, restricted
+	// to the rows matching the filter unless it's empty.
+	CountQuery(tableName, filter string) string
+	// ChecksumQuery returns the row count and an aggregate checksum of the
+	// rows matching the predicate, which may be empty.
+	ChecksumQuery(spec tableSpec, predicate string) string
+	// Columns describes the table's columns in ordinal order, returning
+	// none when the table doesn't exist.
+	Columns(ctx context.Context, db *DB, tableName string) ([]ColumnDefinition, error)
+	// PrimaryKey returns the table's primary key columns in key order.
+	PrimaryKey(ctx context.Context, db *DB, tableName string) ([]string, error)
+	// Tables lists the base tables of a schema, or of the current schema
+	// when it's empty, by their unqualified names.
+	Tables(ctx context.Context, db *DB, schema string) ([]string, error)
+	SchemaObjects(ctx context.Context, db *DB, tableName string) ([]schemaObject, error)
+	// Sequences returns the sequences (or the engine's equivalent) in the
+	// current schema. An empty owner returns every sequence.
+	Sequences(ctx context.Context, db *DB, owner string) ([]sequenceValue, error)
+}
+
+// dialects maps connection string schemes to the dialect handling them.
+var dialects = map[string]Dialect{
+	"postgres":   postgresDialect{},
+	"postgresql": postgresDialect{},
+	"mysql":      mysqlDialect{},
+	"mariadb":    mysqlDialect{},
+	"sqlserver":  sqlserverDialect{},
+	"mssql":      sqlserverDialect{},
+	"sqlite":     sqliteDialect{},
+	"sqlite3":    sqliteDialect{},
+	"clickhouse": clickhouseDialect{},
+	"snowflake":  snowflakeDialect{},
+	"oracle":     oracleDialect{},
+	"bigquery":   bigqueryDialect{},
+	"csv":        fileDialect{format: "CSV"},
+	"parquet":    fileDialect{format: "Parquet"},
+}
+
+// DialectFor picks the dialect from the connection string's scheme. Strings
+// without a known scheme, such as lib/pq's key=value format, are treated as
+// Postgres.
+func DialectFor(conn string) Dialect {
+	if u, err := url.Parse(conn); err == nil {
+		if dialect, ok := dialects[strings.ToLower(u.Scheme)]; ok {
+			return dialect
+		}
+	}
+	return postgresDialect{}
+}
+
+// configurableDialect is implemented by dialects that take options of their
+// own from the connection string's query parameters.
+type configurableDialect interface {
+	configure(options url.Values) (Dialect, error)
+}
+
+// statementTimeoutDialect is implemented by dialects that can have the server
+// cancel statements running longer than the timeout, set in the DSN.
+type statementTimeoutDialect interface {
+	statementTimeout(dsn string, timeout time.Duration) (string, error)
+}
+
+// openDatabase connects with the connection string, authenticating with RDS
+// IAM tokens when iam isn't nil.
+func openDatabase(conn string, statementTimeout time.Duration, tls TLS, iam *rdsIAM) (*sqlx.DB, Dialect, error) {
+	dialect := DialectFor(conn)
+	if file, ok := dialect.(fileDialect); ok {
+		db, err := openFile(conn, file)
+		return db, dialect, err
+	}
+	if configurable, ok := dialect.(configurableDialect); ok {
+		u, err := url.Parse(conn)
+		if err != nil {
+			return nil, nil, err
+		}
+		if dialect, err = configurable.configure(u.Query()); err != nil {
+			return nil, nil, err
+		}
+	}
+	dsn, err := dialect.DSN(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if timeouts, ok := dialect.(statementTimeoutDialect); ok && statementTimeout > 0 {
+		if dsn, err = timeouts.statementTimeout(dsn, statementTimeout); err != nil {
+			return nil, nil, err
+		}
+	}
+	if dsn, err = applyTLS(dialect, dsn, tls); err != nil {
+		return nil, nil, err
+	}
+	if iam != nil {
+		return sqlx.NewDb(sql.OpenDB(iamConnector{dsn, iam, dialect.DriverName() == "pgx"}), dialect.DriverName()), dialect, nil
+	}
+	db, err := sqlx.Open(dialect.DriverName(), dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", dialect.Name(), err)
+	}
+	return db, dialect, nil
+}
+
+// rebind converts a query written with ? placeholders to the database's.
+func (db *DB) rebind(query string) string {
+	return db.DB.Rebind(query)
+}
+
+// TableRef is a table name, optionally qualified with its schema as in
+// dbo.orders. Parts containing dots are written in double quotes, as in
+// "my.schema".orders.
+type TableRef struct {
+	Schema, Name string
+}
+
+func ParseTableRef(name string) TableRef {
+	schema, table := splitTableName(name)
+	return TableRef{Schema: unquoteTablePart(schema), Name: unquoteTablePart(table)}
+}
+
+// splitTableName splits a table name at the dot outside double quotes,
+// leaving the parts as they were written.
+func splitTableName(name string) (schema, table string) {
+	quoted := false
+	for i, r := range name {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '.' && !quoted:
+			return name[:i], name[i+1:]
+		}
+	}
+	return "", name
+}
+
+func isQuotedTablePart(part string) bool {
+	return len(part) >= 2 && strings.HasPrefix(part, `"`) && strings.HasSuffix(part, `"`)
+}
+
+func unquoteTablePart(part string) string {
+	if isQuotedTablePart(part) {
+		return strings.ReplaceAll(part[1:len(part)-1], `""`, `"`)
+	}
+	return part
+}
+
+// nameFoldingDialect is implemented by dialects of engines that fold the
+// case of unquoted identifiers, as PostgreSQL folds them to lower case.
+type nameFoldingDialect interface {
+	foldName(name string) string
+}
+
+// resolveTableRef parses a table name like ParseTableRef, folding the parts
+// not written in double quotes as the engine folds unquoted names, so the
+// table is the one the name would resolve to in a query: imx_table_A is
+// imx_table_a on PostgreSQL, while "imx_table_A" keeps its case.
+func resolveTableRef(d Dialect, name string) TableRef {
+	folding, ok := d.(nameFoldingDialect)
+	if !ok {
+		return ParseTableRef(name)
+	}
+	fold := func(part string) string {
+		if isQuotedTablePart(part) {
+			return unquoteTablePart(part)
+		}
+		return folding.foldName(part)
+	}
+	schema, table := splitTableName(name)
+	return TableRef{Schema: fold(schema), Name: fold(table)}
+}
+
+// qualifyTable joins a schema and table name, as the catalog of a database
+// of the dialect spells them, into the form resolveTableRef reads back.
+func qualifyTable(d Dialect, schema, name string) string {
+	folding, folds := d.(nameFoldingDialect)
+	quote := func(part string) string {
+		if strings.ContainsAny(part, `."`) || folds && folding.foldName(part) != part {
+			return `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+		}
+		return part
+	}
+	if schema == "" {
+		return quote(name)
+	}
+	return quote(schema) + "." + quote(name)
+}
+
+// quoteTable quotes each part of a possibly schema-qualified table name,
+// folded as the engine folds unquoted names.
+func quoteTable(d Dialect, name string) string {
+	ref := resolveTableRef(d, name)
+	if ref.Schema == "" {
+		return d.QuoteIdentifier(ref.Name)
+	}
+	return d.QuoteIdentifier(ref.Schema) + "." + d.QuoteIdentifier(ref.Name)
+}
+
+// systemSchemas are the schemas each engine keeps its catalogs, TOAST data
+// and temporary tables in, by the prefix of their names when they're
+// numbered per session, as pg_temp_3 is.
+var systemSchemas = map[string][]string{
+	postgresDialect{}.Name():   {"pg_catalog", "information_schema", "pg_toast", "pg_temp", "pg_toast_temp_*", "pg_temp_*"},
+	mysqlDialect{}.Name():      {"mysql", "information_schema", "performance_schema", "sys"},
+	sqlserverDialect{}.Name():  {"sys", "information_schema"},
+	sqliteDialect{}.Name():     {"temp"},
+	clickhouseDialect{}.Name(): {"system", "information_schema"},
+	snowflakeDialect{}.Name():  {"information_schema"},
+	bigqueryDialect{}.Name():   {"information_schema"},
+	oracleDialect{}.Name(): {"sys", "system", "audsys", "ctxsys", "dbsnmp", "dvsys", "gsmadmin_internal", "lbacsys", "mdsys",
+		"ojvmsys", "olapsys", "ordsys", "outln", "wmsys", "xdb", "appqossys"},
+}
+
+// isSystemSchema reports whether the schema is one of the engine's own, which
+// neither discovery nor a configured table reaches into.
+func isSystemSchema(d Dialect, schema string) bool {
+	for _, system := range systemSchemas[d.Name()] {
+		if prefix := strings.TrimSuffix(system, "*"); prefix != system {
+			if len(schema) > len(prefix) && strings.EqualFold(schema[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(schema, system) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSystemTable refuses a table in one of the engine's own schemas, so a
+// configuration can't have a comparison read its catalogs, such as the
+// password hashes in pg_catalog.pg_authid, into the report.
+func (db *DB) checkSystemTable(tableName string) error {
+	if schema := ParseTableRef(tableName).Schema; isSystemSchema(db.Dialect, schema) {
+		return db.wrap(fmt.Errorf("table %s is in the system schema %s, which isn't compared", tableName, schema))
+	}
+	return nil
+}
+
+// tablePredicate matches catalog columns against a table, resolving
+// unqualified names in the connection's current schema.
+func (db *DB) tablePredicate(schemaColumn, nameColumn, tableName string) (string, []interface{}) {
+	ref := resolveTableRef(db.Dialect, tableName)
+	if ref.Schema == "" {
+		return fmt.Sprintf("%s = %s AND %s = ?", schemaColumn, db.Dialect.CurrentSchema(), nameColumn), []interface{}{ref.Name}
+	}
+	return fmt.Sprintf("%s = ? AND %s = ?", schemaColumn, nameColumn), []interface{}{ref.Schema, ref.Name}
+}
+
+// informationSchemaColumns reads column definitions from the standard
+// information_schema views. Columns are aliased explicitly since MySQL 8
+// returns them in upper case.
+func informationSchemaColumns(ctx context.Context, db *DB, tableName string) ([]ColumnDefinition, error) {
+	predicate, args := db.tablePredicate("table_schema", "table_name", tableName)
+	var columns []ColumnDefinition
+	err := db.DB.SelectContext(ctx, &columns, db.rebind(`
+		SELECT column_name AS column_name, ordinal_position AS ordinal_position, data_type AS data_type,
+			character_maximum_length AS character_maximum_length, numeric_precision AS numeric_precision,
+			numeric_scale AS numeric_scale, is_nullable AS is_nullable, column_default AS column_default
+		FROM information_schema.columns
+		WHERE `+predicate+`
+		ORDER BY ordinal_position`), args...)
+	return columns, err
+}
+
+func informationSchemaPrimaryKey(ctx context.Context, db *DB, tableName string) ([]string, error) {
+	predicate, args := db.tablePredicate("tc.table_schema", "tc.table_name", tableName)
+	var names []string
+	err := db.DB.SelectContext(ctx, &names, db.rebind(`
+		SELECT kcu.column_name
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name
+			AND kcu.table_name = tc.table_name
+		WHERE tc.constraint_type = 'PRIMARY KEY' AND `+predicate+`
+		ORDER BY kcu.ordinal_position`), args...)
+	return names, err
+}
+
+// informationSchemaTables lists base tables from information_schema.tables.
+func informationSchemaTables(ctx context.Context, db *DB, schema string) ([]string, error) {
+	return informationSchemaTablesOfType(ctx, db, schema, "BASE TABLE")
+}
+
+// informationSchemaViews lists the views of a schema, which the standard
+// information_schema.tables has as VIEW.
+func informationSchemaViews(ctx context.Context, db *DB, schema string) ([]string, error) {
+	return informationSchemaTablesOfType(ctx, db, schema, "VIEW")
+}
+
+func informationSchemaTablesOfType(ctx context.Context, db *DB, schema, tableType string) ([]string, error) {
+	schemaValue, args := db.Dialect.CurrentSchema(), []interface{}(nil)
+	if schema != "" {
+		schemaValue, args = "?", []interface{}{schema}
+	}
+	var names []string
+	err := db.DB.SelectContext(ctx, &names, db.rebind(`
+		SELECT table_name AS table_name
+		FROM information_schema.tables
+		WHERE table_type = '`+tableType+`' AND table_schema = `+schemaValue+`
+		ORDER BY table_name`), args...)
+	return names, err
+}
+
+// rowConstructorPredicate compares the key as a row constructor, which
+// Postgres and MySQL order lexicographically.
+func rowConstructorPredicate(columns []string, op string, values []interface{}) (string, []interface{}) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), op, placeholders), values
+}
+
+// expandedKeyPredicate spells out the lexicographic comparison for engines
+// without row constructors: (a, b) > (x, y) becomes a > x OR (a = x AND b > y).
+func expandedKeyPredicate(columns []string, op string, values []interface{}) (string, []interface{}) {
+	strict := strings.TrimSuffix(op, "=")
+	var terms []string
+	var args []interface{}
+	for i := range columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[j]+" = ?")
+			args = append(args, values[j])
+		}
+		last := strict
+		if i == len(columns)-1 {
+			last = op
+		}
+		parts = append(parts, columns[i]+" "+last+" ?")
+		args = append(args, values[i])
+		terms = append(terms, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(terms, " OR ") + ")", args
+}
+
+// countAllQuery is the plain COUNT(*) most engines count with.
+func countAllQuery(d Dialect, tableName, filter string) string {
+	return "SELECT COUNT(*) FROM " + quoteTable(d, tableName) + whereClause(filter)
+}
+
+func whereClause(filter string) string {
+	if filter == "" {
+		return ""
+	}
+	return " WHERE " + filter
+}
+
+// limitOffset is the LIMIT/OFFSET pagination shared by most engines.
+func limitOffset(limit, offset int) string {
+	if offset == 0 {
+		return fmt.Sprintf("LIMIT %d", limit)
+	}
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
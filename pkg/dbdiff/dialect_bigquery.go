@@ -0,0 +1,226 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// bigqueryDialect handles BigQuery through bigqueryDriverName. Unqualified
+// table names resolve in the dataset of the connection string, and
+// dataset.table names in other datasets of the project.
+type bigqueryDialect struct{}
+
+func (bigqueryDialect) Name() string {
+	return "BigQuery"
+}
+
+func (bigqueryDialect) DriverName() string {
+	return bigqueryDriverName
+}
+
+// DSN passes bigquery://project/dataset URLs to the driver, which reads the
+// location, credentials_file and max_bytes parameters.
+func (bigqueryDialect) DSN(conn string) (string, error) {
+	_, err := parseBigQueryConfig(conn)
+	return conn, err
+}
+
+func (bigqueryDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "\\`") + "`"
+}
+
+// CurrentSchema isn't needed for catalog lookups, which go to the dataset's
+// own INFORMATION_SCHEMA.
+func (bigqueryDialect) CurrentSchema() string {
+	return "@@dataset_id"
+}
+
+// OrderKey leaves keys as they are, since BigQuery compares strings by code
+// point.
+func (bigqueryDialect) OrderKey(column string, kind keyKind) string {
+	return column
+}
+
+// KeyPredicate expands the comparison, as BigQuery can't order structs.
+func (bigqueryDialect) KeyPredicate(columns []string, op string, values []interface{}) (string, []interface{}) {
+	return expandedKeyPredicate(columns, op, values)
+}
+
+func (bigqueryDialect) Paginate(limit, offset int) string {
+	return limitOffset(limit, offset)
+}
+
+func (bigqueryDialect) RandomOrder() string {
+	return "RAND()"
+}
+
+// literal escapes quotes in strings with backslashes, as BigQuery doesn't
+// read doubled ones.
+func (bigqueryDialect) literal(value interface{}) (string, bool) {
+	return backslashLiteral(value)
+}
+
+// binaryLiteral decodes hex, as BigQuery has no X'...' literals.
+func (bigqueryDialect) binaryLiteral(b []byte) string {
+	return "FROM_HEX('" + hex.EncodeToString(b) + "')"
+}
+
+// CountQuery quotes the table. An unfiltered COUNT(*) is answered from
+// table metadata and processes no bytes.
+func (d bigqueryDialect) CountQuery(tableName, filter string) string {
+	return "SELECT COUNT(*) FROM " + quoteTable(d, tableName) + whereClause(filter)
+}
+
+// asOf uses time travel, as far back as the dataset's time travel window,
+// seven days by default.
+func (bigqueryDialect) asOf(table string, at time.Time) string {
+	return table + " FOR SYSTEM_TIME AS OF TIMESTAMP '" + at.UTC().Format("2006-01-02 15:04:05.999999") + "+00'"
+}
+
+func (bigqueryDialect) hashBinary(expression string, over int64) string {
+	return fmt.Sprintf("CASE WHEN LENGTH(%[1]s) > %[2]d THEN CAST(CONCAT('md5:', TO_HEX(MD5(%[1]s))) AS BYTES) ELSE %[1]s END", expression, over)
+}
+
+// approxCountDistinct uses APPROX_COUNT_DISTINCT, which takes a single
+// column.
+func (bigqueryDialect) approxCountDistinct(columns []string) (string, bool) {
+	if len(columns) != 1 {
+		return "", false
+	}
+	return "APPROX_COUNT_DISTINCT(" + columns[0] + ")", true
+}
+
+// ChecksumQuery sums a fingerprint of every row's JSON form as a BIGNUMERIC,
+// which doesn't depend on row order and can't overflow.
+func (d bigqueryDialect) ChecksumQuery(spec tableSpec, predicate string) string {
+	columns := make([]string, len(spec.Columns))
+	for i, column := range spec.Columns {
+		columns[i] = d.QuoteIdentifier(column.Name)
+	}
+	query := fmt.Sprintf("SELECT COUNT(*), IFNULL(CAST(SUM(CAST(FARM_FINGERPRINT(TO_JSON_STRING(STRUCT(%s))) AS BIGNUMERIC)) AS STRING), '') FROM %s",
+		strings.Join(columns, ", "), spec.from(d))
+	if predicate != "" {
+		query += " WHERE " + predicate
+	}
+	return query
+}
+
+// catalog returns the INFORMATION_SCHEMA of the table's dataset and
+// its unqualified name.
+func (d bigqueryDialect) catalog(tableName string) (string, string) {
+	ref := ParseTableRef(tableName)
+	if ref.Schema == "" {
+		return "INFORMATION_SCHEMA", ref.Name
+	}
+	return d.QuoteIdentifier(ref.Schema) + ".INFORMATION_SCHEMA", ref.Name
+}
+
+// estimateCount reads the dataset's __TABLES__ metadata, which is free to
+// query unlike COUNT(*) on a table.
+func (d bigqueryDialect) estimateCount(ctx context.Context, db *DB, tableName string) (int, error) {
+	ref := ParseTableRef(tableName)
+	tables := "__TABLES__"
+	if ref.Schema != "" {
+		tables = d.QuoteIdentifier(ref.Schema) + ".__TABLES__"
+	}
+	return scanEstimate(db.DB.QueryRowContext(ctx, db.rebind(`
+		SELECT row_count FROM `+tables+` WHERE table_id = ?`), ref.Name))
+}
+
+// Columns reads INFORMATION_SCHEMA.COLUMNS, whose data types carry their
+// parameters, e.g. NUMERIC(10, 2).
+func (d bigqueryDialect) Columns(ctx context.Context, db *DB, tableName string) ([]ColumnDefinition, error) {
+	catalog, name := d.catalog(tableName)
+	var columns []ColumnDefinition
+	err := db.DB.SelectContext(ctx, &columns, db.rebind(`
+		SELECT column_name, ordinal_position, LOWER(data_type) AS data_type, is_nullable,
+			NULLIF(column_default, 'NULL') AS column_default
+		FROM `+catalog+`.COLUMNS
+		WHERE table_name = ?
+		ORDER BY ordinal_position`), name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range columns {
+		columns[i].splitDeclaredType()
+	}
+	return columns, nil
+}
+
+// PrimaryKey reads the table's unenforced primary key.
+func (d bigqueryDialect) PrimaryKey(ctx context.Context, db *DB, tableName string) ([]string, error) {
+	catalog, name := d.catalog(tableName)
+	var names []string
+	err := db.DB.SelectContext(ctx, &names, db.rebind(`
+		SELECT kcu.column_name
+		FROM `+catalog+`.TABLE_CONSTRAINTS tc
+		JOIN `+catalog+`.KEY_COLUMN_USAGE kcu
+			ON kcu.constraint_name = tc.constraint_name AND kcu.table_name = tc.table_name
+		WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_name = ?
+		ORDER BY kcu.ordinal_position`), name)
+	return names, err
+}
+
+// SchemaObjects reports the declared constraints along with the partitioning
+// and clustering columns, which decide what queries cost.
+func (d bigqueryDialect) SchemaObjects(ctx context.Context, db *DB, tableName string) ([]schemaObject, error) {
+	catalog, name := d.catalog(tableName)
+	var objects []schemaObject
+	err := db.DB.SelectContext(ctx, &objects, db.rebind(`
+		SELECT constraint_name AS name, LOWER(constraint_type) AS kind, constraint_type AS definition
+		FROM `+catalog+`.TABLE_CONSTRAINTS
+		WHERE table_name = ?
+
+		UNION ALL
+
+		SELECT 'partitioning', 'partitioning', CONCAT('PARTITION BY ', STRING_AGG(column_name, ', '))
+		FROM `+catalog+`.COLUMNS
+		WHERE table_name = ? AND is_partitioning_column = 'YES'
+		HAVING COUNT(*) > 0
+
+		UNION ALL
+
+		SELECT 'clustering', 'clustering', CONCAT('CLUSTER BY ', STRING_AGG(column_name, ', ' ORDER BY clustering_ordinal_position))
+		FROM `+catalog+`.COLUMNS
+		WHERE table_name = ? AND clustering_ordinal_position IS NOT NULL
+		HAVING COUNT(*) > 0`), name, name, name)
+	return objects, err
+}
+
+// Sequences returns nothing, as BigQuery has no sequences.
+func (bigqueryDialect) Sequences(ctx context.Context, db *DB, owner string) ([]sequenceValue, error) {
+	return nil, nil
+}
+
+// lastRefresh reads INFORMATION_SCHEMA.MATERIALIZED_VIEWS, which has no row
+// for tables.
+func (d bigqueryDialect) lastRefresh(ctx context.Context, db *DB, tableName string) (time.Time, error) {
+	catalog, name := d.catalog(tableName)
+	var refreshed sql.NullTime
+	err := db.DB.QueryRowContext(ctx, db.rebind(`
+		SELECT last_refresh_time FROM `+catalog+`.MATERIALIZED_VIEWS WHERE table_name = ?`), name).Scan(&refreshed)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+	return refreshed.Time, nil
+}
+
+// Tables lists the tables of a dataset. Views and external tables aren't
+// included.
+func (d bigqueryDialect) Tables(ctx context.Context, db *DB, schema string) ([]string, error) {
+	catalog := "INFORMATION_SCHEMA"
+	if schema != "" {
+		catalog = d.QuoteIdentifier(schema) + ".INFORMATION_SCHEMA"
+	}
+	var names []string
+	err := db.DB.SelectContext(ctx, &names, `
+		SELECT table_name FROM `+catalog+`.TABLES
+		WHERE table_type = 'BASE TABLE'
+		ORDER BY table_name`)
+	return names, err
+}
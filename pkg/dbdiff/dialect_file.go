@@ -0,0 +1,320 @@
+package dbdiff
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fileDialect compares a CSV or Parquet file, or a directory of them, such
+// as an exported snapshot or a vendor's dump. Each file is loaded into an
+// in-memory SQLite database as a table named after it, so every mode
+// compares it like any other database.
+type fileDialect struct {
+	sqliteDialect
+	format string
+}
+
+func (d fileDialect) Name() string {
+	return d.format
+}
+
+// fileDatabases numbers the in-memory databases, each being shared by the
+// connections of one file endpoint only.
+var fileDatabases int64
+
+// fileTable is a file's columns, with the SQLite types they're declared
+// with, and its rows.
+type fileTable struct {
+	columns []fileColumn
+	rows    [][]interface{}
+	// stream, when set, reads the rows in place of rows, passing each to
+	// insert in turn so that the file isn't held in memory
+	stream func(insert func(row []interface{}) error) error
+}
+
+type fileColumn struct {
+	name, kind string
+}
+
+// openFile loads the file at csv:///path/orders.csv or
+// parquet:///path/orders.parquet, the path being relative without the
+// third slash. The parameters are
+//
+//	key        the key columns, comma-separated, which must be unique and
+//	           not null, in place of configuring the table's key
+//	table      the table's name, in place of the file's name without its
+//	           extension
+//	delimiter  the CSV field delimiter, a comma by default, or tab
+//	null       the CSV field read as NULL, empty by default
+//
+// A directory loads every file in it with the format's extension.
+func openFile(conn string, dialect fileDialect) (*sqlx.DB, error) {
+	u, err := url.Parse(conn)
+	if err != nil {
+		return nil, err
+	}
+	path := u.Opaque
+	if path == "" {
+		path = u.Host + u.Path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("%s: no file", conn)
+	}
+	options := u.Query()
+	var key []string
+	for _, column := range strings.Split(options.Get("key"), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			key = append(key, column)
+		}
+	}
+
+	paths := []string{path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dialect.Name(), err)
+	}
+	if info.IsDir() {
+		if options.Get("table") != "" {
+			return nil, fmt.Errorf("%s: table only names the table of a single file, not of %s", dialect.Name(), path)
+		}
+		extension := "." + strings.ToLower(dialect.format)
+		if paths, err = filepath.Glob(filepath.Join(path, "*"+extension)); err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("%s: no %s files in %s", dialect.Name(), extension, path)
+		}
+	}
+
+	// the database lasts as long as a connection to it is open, which the
+	// pool keeps idle between queries
+	dsn := fmt.Sprintf("file:databasediff_file_%d?mode=memory&cache=shared", atomic.AddInt64(&fileDatabases, 1))
+	db, err := sqlx.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		name := options.Get("table")
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		if dialect.format == "CSV" {
+			var table *fileTable
+			if table, err = readCSV(path, options); err == nil {
+				err = table.load(db, name, key)
+			}
+		} else {
+			err = loadParquet(db, path, name, key)
+		}
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %s: %w", dialect.Name(), path, err)
+		}
+	}
+	return db, nil
+}
+
+// load creates the table and inserts the rows, the key columns becoming its
+// primary key.
+func (t *fileTable) load(db *sqlx.DB, name string, key []string) error {
+	d := sqliteDialect{}
+	definitions := make([]string, len(t.columns))
+	placeholders := make([]string, len(t.columns))
+	for i, column := range t.columns {
+		definitions[i] = d.QuoteIdentifier(column.name) + " " + column.kind
+		placeholders[i] = "?"
+	}
+	keyColumns := make([]string, len(key))
+	for i, name := range key {
+		found := false
+		for j, column := range t.columns {
+			if strings.EqualFold(column.name, name) {
+				// SQLite's keys otherwise allow nulls, and an integer key
+				// would number them itself
+				definitions[j] += " NOT NULL"
+				keyColumns[i] = d.QuoteIdentifier(column.name)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("no key column %s", name)
+		}
+	}
+	if len(keyColumns) > 0 {
+		definitions = append(definitions, "PRIMARY KEY ("+strings.Join(keyColumns, ", ")+")")
+	}
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", d.QuoteIdentifier(name), strings.Join(definitions, ", "))); err != nil {
+		return err
+	}
+	insert, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)", d.QuoteIdentifier(name), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	n := 0
+	insertRow := func(row []interface{}) error {
+		n++
+		if _, err := insert.ExecContext(ctx, row...); err != nil {
+			return fmt.Errorf("row %d: %w", n, err)
+		}
+		return nil
+	}
+	if t.stream != nil {
+		if err := t.stream(insertRow); err != nil {
+			return err
+		}
+	}
+	for _, row := range t.rows {
+		if err := insertRow(row); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// readCSV reads a CSV file with a header row naming its columns. Each column
+// gets the narrowest type all its values parse as, so that numbers, booleans
+// and times compare as the other database's do rather than as text.
+func readCSV(path string, options url.Values) (*fileTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := csv.NewReader(file)
+	switch delimiter := options.Get("delimiter"); {
+	case delimiter == "tab":
+		r.Comma = '\t'
+	case delimiter != "":
+		comma, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) {
+			return nil, fmt.Errorf("delimiter %q isn't one character", delimiter)
+		}
+		r.Comma = comma
+	}
+	null := options.Get("null")
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	table := &fileTable{rows: make([][]interface{}, len(records))}
+	for i := range table.rows {
+		table.rows[i] = make([]interface{}, len(header))
+	}
+	for i, name := range header {
+		kind := csvKinds[len(csvKinds)-1]
+		for _, candidate := range csvKinds {
+			parsesAll := true
+			for _, record := range records {
+				if record[i] == null {
+					continue
+				}
+				if _, ok := candidate.parse(record[i]); !ok {
+					parsesAll = false
+					break
+				}
+			}
+			if parsesAll {
+				kind = candidate
+				break
+			}
+		}
+		table.columns = append(table.columns, fileColumn{name: name, kind: kind.name})
+		for row, record := range records {
+			if record[i] != null {
+				table.rows[row][i], _ = kind.parse(record[i])
+			}
+		}
+	}
+	return table, nil
+}
+
+// csvKinds are the types a CSV column may be read as, from the narrowest.
+// Numbers with leading zeros, such as postal codes, are kept as text.
+var csvKinds = []struct {
+	name  string
+	parse func(string) (interface{}, bool)
+}{
+	{"INTEGER", func(value string) (interface{}, bool) {
+		digits := strings.TrimLeft(value, "+-")
+		if len(digits) > 1 && digits[0] == '0' {
+			return nil, false
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		return n, err == nil
+	}},
+	{"REAL", func(value string) (interface{}, bool) {
+		digits := strings.TrimLeft(value, "+-")
+		if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' ||
+			strings.Trim(value, "0123456789+-.eE") != "" {
+			return nil, false
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		return f, err == nil
+	}},
+	{"BOOLEAN", func(value string) (interface{}, bool) {
+		switch strings.ToLower(value) {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+		return nil, false
+	}},
+	{"DATE", func(value string) (interface{}, bool) {
+		t, err := time.Parse("2006-01-02", value)
+		return t, err == nil
+	}},
+	{"TIMESTAMP", func(value string) (interface{}, bool) {
+		// as Postgres, MySQL and ISO 8601 write them, fractional seconds
+		// being accepted after the seconds by all of them
+		for _, layout := range []string{
+			"2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05",
+			"2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05Z07", "2006-01-02 15:04:05",
+		} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t.UTC(), true
+			}
+		}
+		return nil, false
+	}},
+	{"TEXT", func(value string) (interface{}, bool) {
+		return value, true
+	}},
+}
@@ -0,0 +1,596 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// postgresDialect connects with lib/pq, or with pgx when the connection URL
+// asks for it with driver=pgx. pgx speaks the binary protocol and cancels a
+// query on the server as soon as its context is done, where lib/pq leaves it
+// running until the statement timeout.
+type postgresDialect struct {
+	pgx bool
+}
+
+func (postgresDialect) Name() string {
+	return "PostgreSQL"
+}
+
+func (d postgresDialect) DriverName() string {
+	if d.pgx {
+		return "pgx"
+	}
+	return "postgres"
+}
+
+// configure reads the driver option, which neither driver would take.
+func (d postgresDialect) configure(options url.Values) (Dialect, error) {
+	switch driver := options.Get("driver"); driver {
+	case "", "pq":
+		d.pgx = false
+	case "pgx":
+		d.pgx = true
+	default:
+		return nil, fmt.Errorf("unknown PostgreSQL driver %q, expected pq or pgx", driver)
+	}
+	return d, nil
+}
+
+func (postgresDialect) defaultPort() string {
+	return "5432"
+}
+
+// DSN passes the connection string on as it is, but for the driver option
+// of postgres:// URLs.
+func (postgresDialect) DSN(conn string) (string, error) {
+	if !strings.HasPrefix(conn, "postgres://") && !strings.HasPrefix(conn, "postgresql://") {
+		return conn, nil
+	}
+	u, err := url.Parse(conn)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	if _, ok := query["driver"]; !ok {
+		return conn, nil
+	}
+	query.Del("driver")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// estimateCount reads the planner's estimate in pg_class.reltuples, or the
+// live rows counted in pg_stat_user_tables for tables never analyzed, whose
+// reltuples is -1.
+func (d postgresDialect) estimateCount(ctx context.Context, db *DB, tableName string) (int, error) {
+	return scanEstimate(db.DB.QueryRowContext(ctx, db.rebind(`
+		SELECT CASE WHEN c.reltuples < 0 THEN COALESCE(s.n_live_tup, 0) ELSE c.reltuples END::bigint
+		FROM pg_class c
+		LEFT JOIN pg_stat_user_tables s ON s.relid = c.oid
+		WHERE c.oid = to_regclass(?)`), quoteTable(d, tableName)))
+}
+
+// tableActivity reads the rows inserted, updated and deleted, and those live,
+// that pg_stat_user_tables counted since its statistics were last reset, the
+// live rows catching a TRUNCATE. Partitioned tables, views and foreign tables
+// have none.
+func (d postgresDialect) tableActivity(ctx context.Context, db *DB, tableName string) (string, error) {
+	var ins, upd, del, live sql.NullInt64
+	err := db.DB.QueryRowContext(ctx, db.rebind(`
+		SELECT n_tup_ins, n_tup_upd, n_tup_del, n_live_tup
+		FROM pg_stat_user_tables
+		WHERE relid = to_regclass(?)`), quoteTable(d, tableName)).Scan(&ins, &upd, &del, &live)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ins=%d upd=%d del=%d live=%d", ins.Int64, upd.Int64, del.Int64, live.Int64), nil
+}
+
+// partitions reads the leaf partitions of a declaratively partitioned
+// table, which are tables of their own, from pg_partition_tree.
+func (d postgresDialect) partitions(ctx context.Context, db *DB, tableName string) ([]partition, error) {
+	rows, err := db.DB.QueryContext(ctx, db.rebind(`
+		SELECT n.nspname, c.relname
+		FROM pg_partition_tree(to_regclass(?)) t
+		JOIN pg_class c ON c.oid = t.relid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE t.isleaf AND t.level > 0
+		ORDER BY c.relname`), quoteTable(d, tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var partitions []partition
+	for rows.Next() {
+		var schema, name string
+		if err := rows.Scan(&schema, &name); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition{name, d.QuoteIdentifier(schema) + "." + d.QuoteIdentifier(name)})
+	}
+	return partitions, rows.Err()
+}
+
+// views lists views and materialized views, which information_schema
+// leaves out, from pg_class.
+func (postgresDialect) views(ctx context.Context, db *DB, schema string) ([]string, error) {
+	schemaValue, args := "current_schema()", []interface{}(nil)
+	if schema != "" {
+		schemaValue, args = "?", []interface{}{schema}
+	}
+	var names []string
+	err := db.DB.SelectContext(ctx, &names, db.rebind(`
+		SELECT c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('v', 'm') AND n.nspname = `+schemaValue+`
+		ORDER BY c.relname`), args...)
+	return names, err
+}
+
+// viewDefinition reads the query pg_get_viewdef reconstructs from the
+// view's parse tree, so formatting it was created with doesn't matter.
+func (d postgresDialect) viewDefinition(ctx context.Context, db *DB, tableName string) (string, string, error) {
+	return scanViewDefinition(db.DB.QueryRowContext(ctx, db.rebind(`
+		SELECT CASE c.relkind WHEN 'm' THEN 'materialized view' ELSE 'view' END, pg_get_viewdef(c.oid)
+		FROM pg_class c
+		WHERE c.oid = to_regclass(?) AND c.relkind IN ('v', 'm')`), quoteTable(d, tableName)))
+}
+
+// beginSnapshot starts a repeatable read transaction, whose snapshot is
+// taken by its first statement.
+func (postgresDialect) beginSnapshot(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+		return err
+	}
+	_, err := conn.ExecContext(ctx, "SELECT 1")
+	return err
+}
+
+func (postgresDialect) exportSnapshot(ctx context.Context, conn *sql.Conn) (string, error) {
+	var id string
+	err := conn.QueryRowContext(ctx, "SELECT pg_export_snapshot()").Scan(&id)
+	return id, err
+}
+
+func (postgresDialect) importSnapshot(ctx context.Context, tx *sql.Tx, id string) error {
+	_, err := tx.ExecContext(ctx, "SET TRANSACTION SNAPSHOT "+pq.QuoteLiteral(id))
+	return err
+}
+
+// logPosition is the WAL position written so far, or replayed so far when
+// the database is itself a standby, such as of a cascading replica.
+func (postgresDialect) logPosition(ctx context.Context, db *DB) (string, error) {
+	var lsn string
+	err := db.DB.QueryRowContext(ctx, `
+		SELECT (CASE WHEN pg_is_in_recovery() THEN pg_last_wal_replay_lsn() ELSE pg_current_wal_lsn() END)::text`).Scan(&lsn)
+	return lsn, err
+}
+
+// replayedPast compares pg_last_wal_replay_lsn, which is NULL on a primary.
+func (postgresDialect) replayedPast(ctx context.Context, db *DB, lsn string) (bool, error) {
+	var replayed sql.NullBool
+	if err := db.DB.QueryRowContext(ctx, db.rebind("SELECT pg_last_wal_replay_lsn() >= ?::pg_lsn"), lsn).Scan(&replayed); err != nil {
+		return false, err
+	}
+	if !replayed.Valid {
+		return false, ErrNotReplica
+	}
+	return replayed.Bool, nil
+}
+
+// replicationLag is how long ago a replica replayed its last transaction,
+// which grows while the primary is idle too, or the replay_lag of a
+// primary's slowest replica.
+func (postgresDialect) replicationLag(ctx context.Context, db *DB) (time.Duration, error) {
+	var seconds float64
+	err := db.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(CASE WHEN pg_is_in_recovery()
+			THEN EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+			ELSE (SELECT EXTRACT(EPOCH FROM max(replay_lag)) FROM pg_stat_replication) END, 0)`).Scan(&seconds)
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+// upstreams reads the standby's WAL receiver, or the subscriptions to
+// other databases of a primary. A subscription's delay is left to its slot's
+// replay_lag, as its apply worker only reports when it last heard from it.
+func (postgresDialect) upstreams(ctx context.Context, db *DB) ([]upstream, error) {
+	var standby bool
+	if err := db.DB.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&standby); err != nil {
+		return nil, err
+	}
+	if standby {
+		link := upstream{kind: ReplicationStreaming, delay: -1}
+		var delay sql.NullFloat64
+		err := db.DB.QueryRowContext(ctx, `
+			SELECT COALESCE(current_setting('primary_slot_name', true), ''), COALESCE(pg_last_wal_replay_lsn()::text, ''),
+				EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()),
+				EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming')`).Scan(&link.slot, &link.position, &delay, &link.active)
+		if delay.Valid {
+			link.delay = time.Duration(delay.Float64 * float64(time.Second))
+		}
+		return []upstream{link}, err
+	}
+	rows, err := db.DB.QueryContext(ctx, `
+		SELECT s.subslotname, s.subenabled AND EXISTS (SELECT 1 FROM pg_stat_subscription w WHERE w.subid = s.oid AND w.pid IS NOT NULL)
+		FROM pg_subscription s
+		WHERE s.subdbid = (SELECT oid FROM pg_database WHERE datname = current_database()) AND s.subslotname IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []upstream
+	for rows.Next() {
+		link := upstream{kind: ReplicationLogical, delay: -1}
+		if err := rows.Scan(&link.slot, &link.active); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// slot reads pg_replication_slots, with the replay_lag of the WAL sender
+// reading from the slot. A slot's lag is the WAL written since the position
+// its consumer confirmed, or the oldest one kept for a physical slot.
+func (postgresDialect) slot(ctx context.Context, db *DB, name string) (*replicationSlot, error) {
+	slot := replicationSlot{delay: -1}
+	var lag, delay sql.NullFloat64
+	err := db.DB.QueryRowContext(ctx, db.rebind(`
+		SELECT s.active,
+			pg_wal_lsn_diff(CASE WHEN pg_is_in_recovery() THEN pg_last_wal_replay_lsn() ELSE pg_current_wal_lsn() END,
+				COALESCE(r.replay_lsn, s.confirmed_flush_lsn, s.restart_lsn)),
+			EXTRACT(EPOCH FROM r.replay_lag)
+		FROM pg_replication_slots s LEFT JOIN pg_stat_replication r ON r.pid = s.active_pid
+		WHERE s.slot_name = ?`), name).Scan(&slot.active, &lag, &delay)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	slot.lag = -1
+	if lag.Valid {
+		slot.lag = int64(lag.Float64)
+	}
+	if delay.Valid {
+		slot.delay = time.Duration(delay.Float64 * float64(time.Second))
+	}
+	return &slot, nil
+}
+
+// logBehind measures with pg_wal_lsn_diff from the position written so far,
+// or replayed so far on a standby.
+func (postgresDialect) logBehind(ctx context.Context, db *DB, lsn string) (int64, error) {
+	var behind float64
+	err := db.DB.QueryRowContext(ctx, db.rebind(`
+		SELECT pg_wal_lsn_diff(CASE WHEN pg_is_in_recovery() THEN pg_last_wal_replay_lsn() ELSE pg_current_wal_lsn() END, ?::pg_lsn)`), lsn).Scan(&behind)
+	return int64(behind), err
+}
+
+// encrypted reads the connection's row in pg_stat_ssl.
+func (postgresDialect) encrypted(ctx context.Context, db *DB) (bool, error) {
+	var ssl bool
+	err := db.DB.QueryRowContext(ctx, "SELECT ssl FROM pg_stat_ssl WHERE pid = pg_backend_pid()").Scan(&ssl)
+	return ssl, err
+}
+
+// activeQueries counts the other backends running a query.
+func (postgresDialect) activeQueries(ctx context.Context, db *DB) (int, error) {
+	var active int
+	err := db.DB.QueryRowContext(ctx, "SELECT count(*) FROM pg_stat_activity WHERE state = 'active' AND pid <> pg_backend_pid()").Scan(&active)
+	return active, err
+}
+
+// statementTimeout sets statement_timeout, which both drivers send as a
+// run-time parameter, on every connection.
+func (postgresDialect) statementTimeout(dsn string, timeout time.Duration) (string, error) {
+	return setPostgresParams(dsn, map[string]string{"statement_timeout": strconv.FormatInt(timeout.Milliseconds(), 10)})
+}
+
+// withTLS passes the TLS options on as sslmode, sslrootcert, sslcert and
+// sslkey, which match them and which pgx reads as lib/pq does.
+func (postgresDialect) withTLS(dsn string, options TLS) (string, error) {
+	params := map[string]string{"sslmode": options.Mode}
+	if options.RootCert != "" {
+		params["sslrootcert"] = options.RootCert
+	}
+	if options.Cert != "" {
+		params["sslcert"], params["sslkey"] = options.Cert, options.Key
+	}
+	return setPostgresParams(dsn, params)
+}
+
+// setPostgresParams sets connection parameters in a postgres:// URL or a
+// lib/pq key=value string, where later values of a key win.
+func setPostgresParams(dsn string, params map[string]string) (string, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(params[name])
+			dsn += " " + name + "='" + value + "'"
+		}
+		return dsn, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for name, value := range params {
+		query.Set(name, value)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (postgresDialect) QuoteIdentifier(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+func (postgresDialect) CurrentSchema() string {
+	return "current_schema()"
+}
+
+func (postgresDialect) OrderKey(column string, kind keyKind) string {
+	if kind == keyText {
+		return column + ` COLLATE "C"`
+	}
+	return column
+}
+
+func (postgresDialect) KeyPredicate(columns []string, op string, values []interface{}) (string, []interface{}) {
+	return rowConstructorPredicate(columns, op, values)
+}
+
+func (postgresDialect) Paginate(limit, offset int) string {
+	return limitOffset(limit, offset)
+}
+
+// foldName folds an unquoted name to lower case, as PostgreSQL does.
+func (postgresDialect) foldName(name string) string {
+	return strings.ToLower(name)
+}
+
+func (postgresDialect) RandomOrder() string {
+	return "random()"
+}
+
+// literal writes binary values in bytea's hex format.
+func (d postgresDialect) literal(value interface{}) (string, bool) {
+	if b, ok := value.([]byte); ok && !utf8.Valid(b) {
+		return d.binaryLiteral(b), true
+	}
+	return "", false
+}
+
+func (postgresDialect) binaryLiteral(b []byte) string {
+	return `'\x` + hex.EncodeToString(b) + "'::bytea"
+}
+
+func (d postgresDialect) CountQuery(tableName, filter string) string {
+	return countAllQuery(d, tableName, filter)
+}
+
+func (postgresDialect) hashBinary(expression string, over int64) string {
+	return fmt.Sprintf("CASE WHEN octet_length(%[1]s) > %[2]d THEN convert_to('md5:' || md5(%[1]s), 'UTF8') ELSE %[1]s END", expression, over)
+}
+
+// ChecksumQuery aggregates an md5 of every row in key order. Timestamps with
+// time zone are rendered in UTC so the sessions' TimeZone settings don't
+// affect the result.
+func (d postgresDialect) ChecksumQuery(spec tableSpec, predicate string) string {
+	columns := make([]string, len(spec.Columns))
+	for i, column := range spec.Columns {
+		columns[i] = d.QuoteIdentifier(column.Name)
+		if column.DataType == "timestamp with time zone" {
+			columns[i] = fmt.Sprintf("(%s AT TIME ZONE 'UTC')", columns[i])
+		}
+	}
+	query := fmt.Sprintf("SELECT count(*), coalesce(md5(string_agg(md5(ROW(%s)::text), '' ORDER BY %s)), '') FROM %s",
+		strings.Join(columns, ", "), spec.keyTuple(d), spec.from(d))
+	if predicate != "" {
+		query += " WHERE " + predicate
+	}
+	return query
+}
+
+// keyHashes read the first and the second 32 bits of the md5 of the key's
+// row text.
+func (d postgresDialect) keyHashes(spec tableSpec) (string, string) {
+	hash := func(from int) string {
+		return fmt.Sprintf("('x' || lpad(substr(md5(ROW(%s)::text), %d, 8), 16, '0'))::bit(64)::bigint", spec.keyList(d), from)
+	}
+	return hash(1), hash(9)
+}
+
+var postgresConstraintKinds = map[string]string{
+	"p": "primary key",
+	"u": "unique",
+	"f": "foreign key",
+	"c": "check",
+	"x": "exclusion",
+}
+
+// postgresIndexName matches the name and qualified table of an index
+// definition, so definitions of identically built indexes compare equal
+// whatever they are called.
+var postgresIndexName = regexp.MustCompile(`INDEX \S+ ON \S+`)
+
+// postgresTriggerTable matches the qualified table of a trigger definition,
+// so triggers of a renamed table compare equal.
+var postgresTriggerTable = regexp.MustCompile(` ON \S+ `)
+
+func (postgresDialect) SchemaObjects(ctx context.Context, db *DB, tableName string) ([]schemaObject, error) {
+	predicate, args := db.tablePredicate("schemaname", "tablename", tableName)
+	var indexes []schemaObject
+	err := db.DB.SelectContext(ctx, &indexes, db.rebind(`
+		SELECT indexname AS name, 'index' AS kind, indexdef AS definition
+		FROM pg_indexes
+		WHERE `+predicate), args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range indexes {
+		indexes[i].Definition = postgresIndexName.ReplaceAllString(indexes[i].Definition, "INDEX ON "+ParseTableRef(tableName).Name)
+	}
+
+	predicate, args = db.tablePredicate("nsp.nspname", "rel.relname", tableName)
+	var constraints []schemaObject
+	err = db.DB.SelectContext(ctx, &constraints, db.rebind(`
+		SELECT con.conname AS name, con.contype AS kind, pg_get_constraintdef(con.oid) AS definition
+		FROM pg_constraint con
+		JOIN pg_class rel ON rel.oid = con.conrelid
+		JOIN pg_namespace nsp ON nsp.oid = rel.relnamespace
+		WHERE `+predicate), args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range constraints {
+		constraints[i].Kind = postgresConstraintKinds[constraints[i].Kind]
+	}
+
+	var triggers []schemaObject
+	err = db.DB.SelectContext(ctx, &triggers, db.rebind(`
+		SELECT tgname AS name, 'trigger' AS kind, pg_get_triggerdef(oid) AS definition
+		FROM pg_trigger
+		WHERE tgrelid = to_regclass(?) AND NOT tgisinternal`), quoteTable(postgresDialect{}, tableName))
+	if err != nil {
+		return nil, err
+	}
+	for i := range triggers {
+		triggers[i].Definition = postgresTriggerTable.ReplaceAllString(triggers[i].Definition, " ON "+ParseTableRef(tableName).Name+" ")
+	}
+	return append(append(indexes, constraints...), triggers...), nil
+}
+
+// functions reads the definitions pg_get_functiondef reconstructs, leaving
+// out those installed by extensions. Aggregates have none and are compared
+// by signature only.
+func (postgresDialect) functions(ctx context.Context, db *DB, schema string) ([]schemaObject, error) {
+	schemaValue, args := "current_schema()", []interface{}(nil)
+	if schema != "" {
+		schemaValue, args = "?", []interface{}{schema}
+	}
+	var functions []schemaObject
+	err := db.DB.SelectContext(ctx, &functions, db.rebind(`
+		SELECT p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')' AS name,
+			CASE p.prokind WHEN 'p' THEN 'procedure' WHEN 'a' THEN 'aggregate' ELSE 'function' END AS kind,
+			CASE WHEN p.prokind = 'a' THEN '' ELSE pg_get_functiondef(p.oid) END AS definition
+		FROM pg_proc p
+		JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE n.nspname = `+schemaValue+`
+			AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = p.oid AND d.deptype = 'e')
+		ORDER BY 1`), args...)
+	return functions, err
+}
+
+// settings lists the installed extensions, the database's encoding and
+// collation, and the server settings that change how values are rendered or
+// compared.
+func (postgresDialect) settings(ctx context.Context, db *DB) ([]schemaObject, error) {
+	var settings []schemaObject
+	err := db.DB.SelectContext(ctx, &settings, `
+		SELECT extname AS name, 'extension' AS kind, extversion AS definition FROM pg_extension
+
+		UNION ALL
+
+		SELECT setting.name, 'setting', setting.value
+		FROM pg_database d
+		CROSS JOIN LATERAL (VALUES
+			('encoding', pg_encoding_to_char(d.encoding)), ('collation', d.datcollate), ('ctype', d.datctype)
+		) AS setting(name, value)
+		WHERE d.datname = current_database()
+
+		UNION ALL
+
+		SELECT name, 'setting', setting FROM pg_settings
+		WHERE name IN ('TimeZone', 'search_path', 'DateStyle', 'IntervalStyle', 'extra_float_digits',
+			'standard_conforming_strings', 'default_transaction_isolation', 'bytea_output')
+		ORDER BY 2, 1`)
+	return settings, err
+}
+
+// grants reads the table's ACLs from pg_class and pg_attribute rather than
+// information_schema, which only shows privileges involving the current
+// user's roles.
+func (d postgresDialect) grants(ctx context.Context, db *DB, tableName string) (string, []tableGrant, error) {
+	var owner string
+	err := db.DB.GetContext(ctx, &owner, db.rebind(`
+		SELECT pg_get_userbyid(relowner) FROM pg_class WHERE oid = to_regclass(?)`), quoteTable(d, tableName))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, ErrTableNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	var grants []tableGrant
+	err = db.DB.SelectContext(ctx, &grants, db.rebind(`
+		SELECT COALESCE(r.rolname, 'PUBLIC') AS grantee, '' AS column_name,
+			a.privilege_type || CASE WHEN a.is_grantable THEN ' WITH GRANT OPTION' ELSE '' END AS privilege
+		FROM pg_class c
+		CROSS JOIN LATERAL aclexplode(c.relacl) a
+		LEFT JOIN pg_roles r ON r.oid = a.grantee
+		WHERE c.oid = to_regclass(?)
+
+		UNION ALL
+
+		SELECT COALESCE(r.rolname, 'PUBLIC'), att.attname,
+			a.privilege_type || CASE WHEN a.is_grantable THEN ' WITH GRANT OPTION' ELSE '' END
+		FROM pg_attribute att
+		CROSS JOIN LATERAL aclexplode(att.attacl) a
+		LEFT JOIN pg_roles r ON r.oid = a.grantee
+		WHERE att.attrelid = to_regclass(?) AND NOT att.attisdropped`), quoteTable(d, tableName), quoteTable(d, tableName))
+	return owner, grants, err
+}
+
+func (postgresDialect) Sequences(ctx context.Context, db *DB, owner string) ([]sequenceValue, error) {
+	predicate, args := "s.schemaname = current_schema()", []interface{}(nil)
+	if owner != "" {
+		predicate, args = db.tablePredicate("s.schemaname", "t.relname", owner)
+	}
+	var sequences []sequenceValue
+	err := db.DB.SelectContext(ctx, &sequences, db.rebind(`
+		SELECT s.sequencename AS name, coalesce(t.relname, '') AS owner, coalesce(a.attname, '') AS column, s.last_value
+		FROM pg_sequences s
+		JOIN pg_class c ON c.relname = s.sequencename AND c.relnamespace = s.schemaname::regnamespace
+		LEFT JOIN pg_depend d ON d.objid = c.oid AND d.classid = 'pg_class'::regclass
+			AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+		LEFT JOIN pg_class t ON t.oid = d.refobjid
+		LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+		WHERE `+predicate+`
+		ORDER BY s.sequencename`), args...)
+	return sequences, err
+}
+
+func (postgresDialect) Columns(ctx context.Context, db *DB, tableName string) ([]ColumnDefinition, error) {
+	return informationSchemaColumns(ctx, db, tableName)
+}
+
+func (postgresDialect) PrimaryKey(ctx context.Context, db *DB, tableName string) ([]string, error) {
+	return informationSchemaPrimaryKey(ctx, db, tableName)
+}
+
+func (postgresDialect) Tables(ctx context.Context, db *DB, schema string) ([]string, error) {
+	return informationSchemaTables(ctx, db, schema)
+}
@@ -0,0 +1,339 @@
+package dbdiff
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriverName is go-sqlite3 registered with the checksum aggregate,
+// since SQLite has no hash functions of its own.
+const sqliteDriverName = "sqlite3_databasediff"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterAggregator("databasediff_checksum", newSQLiteChecksum, true)
+		},
+	})
+	sqlx.BindDriver(sqliteDriverName, sqlx.QUESTION)
+}
+
+// sqliteChecksum sums the leading 8 bytes of every row's MD5, wrapping
+// around, so the result doesn't depend on row order.
+type sqliteChecksum struct {
+	rows int
+	sum  uint64
+}
+
+func newSQLiteChecksum() *sqliteChecksum {
+	return &sqliteChecksum{}
+}
+
+func (c *sqliteChecksum) Step(values ...interface{}) {
+	hash := md5.New()
+	for _, value := range values {
+		hash.Write([]byte(formatValue(value)))
+		hash.Write([]byte{0})
+	}
+	c.rows++
+	c.sum += binary.BigEndian.Uint64(hash.Sum(nil))
+}
+
+func (c *sqliteChecksum) Done() string {
+	if c.rows == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%016x", c.sum)
+}
+
+// sqliteDialect reads SQLite database files, e.g. local fixtures or
+// embedded exports. Schema-qualified names refer to attached databases.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "SQLite"
+}
+
+func (sqliteDialect) DriverName() string {
+	return sqliteDriverName
+}
+
+// DSN accepts sqlite:///absolute/path.db, sqlite://relative/path.db or
+// sqlite:path.db. Query parameters such as mode=ro are passed to the driver.
+// beginSnapshot starts a deferred transaction and reads from it, since
+// SQLite only takes its snapshot at the first read.
+func (sqliteDialect) beginSnapshot(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return err
+	}
+	_, err := conn.ExecContext(ctx, "SELECT count(*) FROM sqlite_master")
+	return err
+}
+
+func (sqliteDialect) DSN(conn string) (string, error) {
+	u, err := url.Parse(conn)
+	if err != nil {
+		return "", err
+	}
+	path := u.Opaque
+	if path == "" {
+		path = u.Host + u.Path
+	}
+	if path == "" {
+		return "", fmt.Errorf("%s: no database file", conn)
+	}
+	dsn := "file:" + path
+	if u.RawQuery != "" {
+		dsn += "?" + u.RawQuery
+	}
+	return dsn, nil
+}
+
+func (sqliteDialect) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (sqliteDialect) CurrentSchema() string {
+	return "'main'"
+}
+
+func (sqliteDialect) OrderKey(column string, kind keyKind) string {
+	if kind == keyText {
+		return column + " COLLATE BINARY"
+	}
+	return column
+}
+
+func (sqliteDialect) KeyPredicate(columns []string, op string, values []interface{}) (string, []interface{}) {
+	return rowConstructorPredicate(columns, op, values)
+}
+
+func (sqliteDialect) Paginate(limit, offset int) string {
+	return limitOffset(limit, offset)
+}
+
+func (sqliteDialect) RandomOrder() string {
+	return "random()"
+}
+
+func (d sqliteDialect) CountQuery(tableName, filter string) string {
+	return countAllQuery(d, tableName, filter)
+}
+
+func (d sqliteDialect) ChecksumQuery(spec tableSpec, predicate string) string {
+	columns := make([]string, len(spec.Columns))
+	for i, column := range spec.Columns {
+		columns[i] = d.QuoteIdentifier(column.Name)
+	}
+	query := fmt.Sprintf("SELECT count(*), coalesce(databasediff_checksum(%s), '') FROM %s",
+		strings.Join(columns, ", "), spec.from(d))
+	if predicate != "" {
+		query += " WHERE " + predicate
+	}
+	return query
+}
+
+// sqliteSchema returns the attached database holding the table and its
+// unqualified name, for the pragma table-valued functions.
+func sqliteSchema(tableName string) (string, string) {
+	ref := ParseTableRef(tableName)
+	if ref.Schema == "" {
+		return "main", ref.Name
+	}
+	return ref.Schema, ref.Name
+}
+
+func (sqliteDialect) Columns(ctx context.Context, db *DB, tableName string) ([]ColumnDefinition, error) {
+	schema, name := sqliteSchema(tableName)
+	var columns []ColumnDefinition
+	err := db.DB.SelectContext(ctx, &columns, db.rebind(`
+		SELECT name AS column_name, cid + 1 AS ordinal_position, lower(type) AS data_type,
+			CASE "notnull" WHEN 0 THEN 'YES' ELSE 'NO' END AS is_nullable, dflt_value AS column_default
+		FROM pragma_table_info(?, ?)
+		ORDER BY cid`), name, schema)
+	if err != nil {
+		return nil, err
+	}
+	for i := range columns {
+		columns[i].splitDeclaredType()
+	}
+	return columns, nil
+}
+
+func (sqliteDialect) PrimaryKey(ctx context.Context, db *DB, tableName string) ([]string, error) {
+	schema, name := sqliteSchema(tableName)
+	var names []string
+	err := db.DB.SelectContext(ctx, &names, db.rebind(`
+		SELECT name FROM pragma_table_info(?, ?) WHERE pk > 0 ORDER BY pk`), name, schema)
+	return names, err
+}
+
+// SchemaObjects reads indexes and foreign keys through the pragma functions,
+// and triggers from sqlite_master.
+// SQLite doesn't name primary keys or foreign keys, so they're given the
+// names Postgres would generate by default. CHECK constraints aren't exposed
+// and are not compared.
+func (d sqliteDialect) SchemaObjects(ctx context.Context, db *DB, tableName string) ([]schemaObject, error) {
+	schema, name := sqliteSchema(tableName)
+	var objects []schemaObject
+
+	key, err := d.PrimaryKey(ctx, db, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) > 0 {
+		objects = append(objects, schemaObject{
+			Name:       name + "_pkey",
+			Kind:       "primary key",
+			Definition: "PRIMARY KEY (" + strings.Join(key, ", ") + ")",
+		})
+	}
+
+	var indexColumns []struct {
+		Index  string `db:"index_name"`
+		Origin string `db:"origin"`
+		Unique bool   `db:"is_unique"`
+		Column string `db:"column_name"`
+	}
+	err = db.DB.SelectContext(ctx, &indexColumns, db.rebind(`
+		SELECT il.name AS index_name, il.origin AS origin, il."unique" AS is_unique, coalesce(ii.name, '') AS column_name
+		FROM pragma_index_list(?, ?) il
+		JOIN pragma_index_info(il.name, ?) ii
+		WHERE il.origin != 'pk'
+		ORDER BY il.seq, ii.seqno`), name, schema, schema)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []schemaObject
+	var columns [][]string
+	for i, row := range indexColumns {
+		if i == 0 || row.Index != indexColumns[i-1].Index {
+			index := schemaObject{Name: row.Index, Kind: "index", Definition: "INDEX"}
+			switch {
+			case row.Origin == "u":
+				index.Kind, index.Definition = "unique", "UNIQUE"
+			case row.Unique:
+				index.Definition = "UNIQUE INDEX"
+			}
+			indexes = append(indexes, index)
+			columns = append(columns, nil)
+		}
+		columns[len(columns)-1] = append(columns[len(columns)-1], row.Column)
+	}
+	for i := range indexes {
+		indexes[i].Definition += " (" + strings.Join(columns[i], ", ") + ")"
+	}
+	objects = append(objects, indexes...)
+
+	var foreignKeys []struct {
+		ID    int            `db:"id"`
+		Table string         `db:"table"`
+		From  string         `db:"from"`
+		To    sql.NullString `db:"to"`
+	}
+	err = db.DB.SelectContext(ctx, &foreignKeys, db.rebind(`
+		SELECT id, "table", "from", "to" FROM pragma_foreign_key_list(?, ?) ORDER BY id, seq`), name, schema)
+	if err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(foreignKeys); {
+		end := start
+		var from, to []string
+		for ; end < len(foreignKeys) && foreignKeys[end].ID == foreignKeys[start].ID; end++ {
+			from = append(from, foreignKeys[end].From)
+			if foreignKeys[end].To.Valid {
+				to = append(to, foreignKeys[end].To.String)
+			}
+		}
+		definition := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s", strings.Join(from, ", "), foreignKeys[start].Table)
+		if len(to) > 0 {
+			definition += "(" + strings.Join(to, ", ") + ")"
+		}
+		objects = append(objects, schemaObject{
+			Name:       name + "_" + strings.Join(from, "_") + "_fkey",
+			Kind:       "foreign key",
+			Definition: definition,
+		})
+		start = end
+	}
+
+	var triggers []schemaObject
+	err = db.DB.SelectContext(ctx, &triggers, db.rebind(fmt.Sprintf(`
+		SELECT name, 'trigger' AS kind, sql AS definition
+		FROM %s.sqlite_master
+		WHERE type = 'trigger' AND tbl_name = ?`, d.QuoteIdentifier(schema))), name)
+	if err != nil {
+		return nil, err
+	}
+	for _, trigger := range triggers {
+		trigger.Definition = normalizeDefinition(trigger.Definition)
+		objects = append(objects, trigger)
+	}
+	return objects, nil
+}
+
+// settings lists the database's text encoding, the only setting stored in
+// the file that changes how values read back.
+func (sqliteDialect) settings(ctx context.Context, db *DB) ([]schemaObject, error) {
+	var settings []schemaObject
+	err := db.DB.SelectContext(ctx, &settings, `SELECT 'encoding' AS name, 'setting' AS kind, encoding AS definition FROM pragma_encoding`)
+	return settings, err
+}
+
+// Sequences reports AUTOINCREMENT counters from sqlite_sequence, which only
+// exists once a table declares one.
+func (sqliteDialect) Sequences(ctx context.Context, db *DB, owner string) ([]sequenceValue, error) {
+	schema, name := sqliteSchema(owner)
+	var exists bool
+	err := db.DB.GetContext(ctx, &exists, db.rebind(fmt.Sprintf(
+		`SELECT count(*) > 0 FROM %s.sqlite_master WHERE name = 'sqlite_sequence'`, sqliteDialect{}.QuoteIdentifier(schema))))
+	if err != nil || !exists {
+		return nil, err
+	}
+	var sequences []sequenceValue
+	err = db.DB.SelectContext(ctx, &sequences, db.rebind(fmt.Sprintf(`
+		SELECT s.name AS name, s.name AS owner,
+			coalesce((SELECT name FROM pragma_table_info(s.name, ?) WHERE pk = 1), '') AS "column", s.seq AS last_value
+		FROM %s.sqlite_sequence s
+		WHERE ? = '' OR s.name = ?
+		ORDER BY s.name`, sqliteDialect{}.QuoteIdentifier(schema))), schema, name, name)
+	return sequences, err
+}
+
+// Tables lists the tables of an attached database, leaving out SQLite's own.
+func (sqliteDialect) views(ctx context.Context, db *DB, schema string) ([]string, error) {
+	if schema == "" {
+		schema = "main"
+	}
+	var names []string
+	err := db.DB.SelectContext(ctx, &names, fmt.Sprintf(`
+		SELECT name FROM %s.sqlite_master WHERE type = 'view' ORDER BY name`, sqliteDialect{}.QuoteIdentifier(schema)))
+	return names, err
+}
+
+// viewDefinition reads the view's CREATE VIEW statement as written.
+func (d sqliteDialect) viewDefinition(ctx context.Context, db *DB, tableName string) (string, string, error) {
+	schema, name := sqliteSchema(tableName)
+	return scanViewDefinition(db.DB.QueryRowContext(ctx, db.rebind(fmt.Sprintf(`
+		SELECT 'view', sql FROM %s.sqlite_master WHERE type = 'view' AND name = ?`, d.QuoteIdentifier(schema))), name))
+}
+
+func (sqliteDialect) Tables(ctx context.Context, db *DB, schema string) ([]string, error) {
+	if schema == "" {
+		schema = "main"
+	}
+	var names []string
+	err := db.DB.SelectContext(ctx, &names, fmt.Sprintf(`
+		SELECT name FROM %s.sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite\_%%' ESCAPE '\'
+		ORDER BY name`, sqliteDialect{}.QuoteIdentifier(schema)))
+	return names, err
+}
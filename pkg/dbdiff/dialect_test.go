@@ -0,0 +1,153 @@
+package dbdiff
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseTableRef(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		want TableRef
+	}{
+		{"orders", TableRef{Name: "orders"}},
+		{"dbo.orders", TableRef{Schema: "dbo", Name: "orders"}},
+		{`"my.schema".orders`, TableRef{Schema: "my.schema", Name: "orders"}},
+		{`sales."order.items"`, TableRef{Schema: "sales", Name: "order.items"}},
+		{`"order.items"`, TableRef{Name: "order.items"}},
+		{`"say ""hi""".greetings`, TableRef{Schema: `say "hi"`, Name: "greetings"}},
+		// only the first unquoted dot separates the schema
+		{"db.sales.orders", TableRef{Schema: "db", Name: "sales.orders"}},
+		{`"unterminated.orders`, TableRef{Name: `"unterminated.orders`}},
+		{"", TableRef{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ParseTableRef(test.name); got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestQualifyTable(t *testing.T) {
+	for _, test := range []struct {
+		dialect Dialect
+		ref     TableRef
+		want    string
+	}{
+		{sqliteDialect{}, TableRef{Name: "orders"}, "orders"},
+		{sqliteDialect{}, TableRef{Schema: "sales", Name: "orders"}, "sales.orders"},
+		{sqliteDialect{}, TableRef{Schema: "my.schema", Name: "orders"}, `"my.schema".orders`},
+		{sqliteDialect{}, TableRef{Schema: `say "hi"`, Name: "order.items"}, `"say ""hi"""."order.items"`},
+		{mysqlDialect{}, TableRef{Schema: "sales", Name: "Orders"}, "sales.Orders"},
+		// a table created with a quoted mixed-case name keeps its case
+		{postgresDialect{}, TableRef{Schema: "public", Name: "Orders"}, `public."Orders"`},
+		{postgresDialect{}, TableRef{Schema: "public", Name: "orders"}, "public.orders"},
+	} {
+		name := qualifyTable(test.dialect, test.ref.Schema, test.ref.Name)
+		if name != test.want {
+			t.Errorf("%+v qualified as %s, want %s", test.ref, name, test.want)
+		}
+		if got := resolveTableRef(test.dialect, name); got != test.ref {
+			t.Errorf("%+v qualified as %s, which reads back as %+v", test.ref, name, got)
+		}
+	}
+}
+
+func TestResolveTableRef(t *testing.T) {
+	for _, test := range []struct {
+		dialect Dialect
+		name    string
+		want    TableRef
+	}{
+		// PostgreSQL folds unquoted names, as the table list's defaults are
+		{postgresDialect{}, "imx_table_A", TableRef{Name: "imx_table_a"}},
+		{postgresDialect{}, `"imx_table_A"`, TableRef{Name: "imx_table_A"}},
+		{postgresDialect{}, "Sales.Orders", TableRef{Schema: "sales", Name: "orders"}},
+		{postgresDialect{}, `Sales."Orders"`, TableRef{Schema: "sales", Name: "Orders"}},
+		{postgresDialect{}, `"My.Schema".Orders`, TableRef{Schema: "My.Schema", Name: "orders"}},
+		{sqliteDialect{}, "imx_table_A", TableRef{Name: "imx_table_A"}},
+		{sqlserverDialect{}, "dbo.Orders", TableRef{Schema: "dbo", Name: "Orders"}},
+	} {
+		if got := resolveTableRef(test.dialect, test.name); got != test.want {
+			t.Errorf("%s resolves %s to %+v, want %+v", test.dialect.Name(), test.name, got, test.want)
+		}
+	}
+}
+
+func TestQuoteTable(t *testing.T) {
+	for _, test := range []struct {
+		dialect Dialect
+		name    string
+		want    string
+	}{
+		{postgresDialect{}, "orders", `"orders"`},
+		{postgresDialect{}, "sales.orders", `"sales"."orders"`},
+		{postgresDialect{}, "imx_table_A", `"imx_table_a"`},
+		{postgresDialect{}, `"imx_table_A"`, `"imx_table_A"`},
+		{postgresDialect{}, "Sales.Orders", `"sales"."orders"`},
+		{sqliteDialect{}, "imx_table_A", `"imx_table_A"`},
+		{sqliteDialect{}, `"my.schema".orders`, `"my.schema"."orders"`},
+		{mysqlDialect{}, "sales.orders", "`sales`.`orders`"},
+		{sqlserverDialect{}, "dbo.orders", "[dbo].[orders]"},
+		{clickhouseDialect{}, "analytics.orders", "`analytics`.`orders`"},
+		// Snowflake folds lower case names to upper case like unquoted ones
+		{snowflakeDialect{}, "sales.orders", `"SALES"."ORDERS"`},
+		{snowflakeDialect{}, "sales.Orders", `"SALES"."Orders"`},
+		{bigqueryDialect{}, "sales.orders", "`sales`.`orders`"},
+	} {
+		if got := quoteTable(test.dialect, test.name); got != test.want {
+			t.Errorf("%s quotes %s as %s, want %s", test.dialect.Name(), test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsSystemSchema(t *testing.T) {
+	for _, test := range []struct {
+		dialect Dialect
+		schema  string
+		want    bool
+	}{
+		{postgresDialect{}, "pg_catalog", true},
+		{postgresDialect{}, "PG_CATALOG", true},
+		{postgresDialect{}, "pg_temp_3", true},
+		{postgresDialect{}, "pg_toast_temp_12", true},
+		{postgresDialect{}, "pg_temp_", false},
+		{postgresDialect{}, "public", false},
+		{postgresDialect{}, "sys", false},
+		{mysqlDialect{}, "performance_schema", true},
+		{sqlserverDialect{}, "sys", true},
+		{sqliteDialect{}, "temp", true},
+		{clickhouseDialect{}, "system", true},
+		{postgresDialect{}, "", false},
+	} {
+		if got := isSystemSchema(test.dialect, test.schema); got != test.want {
+			t.Errorf("%s schema %q is a system one: %t, want %t", test.dialect.Name(), test.schema, got, test.want)
+		}
+	}
+}
+
+func TestCompareSystemTable(t *testing.T) {
+	comparer := openFixtures(t, Options{Mode: ModeCount})
+	_, err := comparer.CompareTable(context.Background(), TableConfig{Name: "temp.orders"})
+	if err == nil || !strings.Contains(err.Error(), "table temp.orders is in the system schema temp") {
+		t.Errorf("error %v, want the system schema refused", err)
+	}
+}
+
+func TestCountQueryMixedCase(t *testing.T) {
+	for _, test := range []struct {
+		dialect Dialect
+		name    string
+		want    string
+	}{
+		{postgresDialect{}, "imx_table_A", `SELECT COUNT(*) FROM "imx_table_a"`},
+		{postgresDialect{}, `public."imx_table_A"`, `SELECT COUNT(*) FROM "public"."imx_table_A"`},
+		{mysqlDialect{}, "imx_table_A", "SELECT COUNT(*) FROM `imx_table_A`"},
+	} {
+		if got := test.dialect.CountQuery(test.name, ""); got != test.want {
+			t.Errorf("%s counts %s with %s, want %s", test.dialect.Name(), test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+)
+
+// DiscoverTables lists every base table in the given schemas of the source
+// database, and with Options.Views every view, qualified with their schema. Tables that are also in the
+// configuration keep their settings. The engine's own schemas, which hold its
+// catalogs, TOAST data and temporary tables, are skipped.
+func (c *Comparer) DiscoverTables(ctx context.Context, schemas []string, config Config) ([]TableConfig, error) {
+	db := c.Source()
+	var discovered []TableConfig
+	for _, schema := range schemas {
+		if isSystemSchema(db.Dialect, schema) {
+			c.log.Warnw("Skipping a system schema", "schema", schema, "database", db.ServiceName)
+			continue
+		}
+		names, err := db.Dialect.Tables(ctx, db, schema)
+		if err != nil {
+			return nil, db.wrap(fmt.Errorf("listing tables of %s: %w", schema, err))
+		}
+		if dialect, ok := db.Dialect.(viewDialect); ok && c.Options.Views {
+			views, err := dialect.views(ctx, db, schema)
+			if err != nil {
+				return nil, db.wrap(fmt.Errorf("listing views of %s: %w", schema, err))
+			}
+			names = append(names, views...)
+		}
+		for _, name := range names {
+			table := config.Table(qualifyTable(db.Dialect, schema, name))
+			table.Dest = config.destName(table)
+			discovered = append(discovered, table)
+		}
+		c.log.Infow("Discovered tables", "schema", schema, "tables", len(names))
+	}
+	return discovered, nil
+}
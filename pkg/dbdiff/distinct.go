@@ -0,0 +1,145 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DistinctCount is the number of distinct values of a column, or of several
+// columns taken together, on both databases in ModeDistinct.
+type DistinctCount struct {
+	Columns      []string
+	Source, Dest int
+	// Approximate is set when either count is an estimate
+	Approximate bool
+}
+
+func (d DistinctCount) String() string {
+	return strings.Join(d.Columns, ", ")
+}
+
+// approxDistinctDialect is implemented by dialects with an aggregate
+// estimating distinct values, usually with HyperLogLog, which scans the
+// table without sorting or hashing every value into memory.
+type approxDistinctDialect interface {
+	// approxCountDistinct estimates the distinct values of the quoted
+	// columns taken together, or returns false when the engine can't for
+	// that many columns.
+	approxCountDistinct(columns []string) (string, bool)
+}
+
+// compareDistinct counts the table's rows and the distinct values of its
+// configured columns on both databases, one query each. The distinct counts
+// catch duplicates inserted on one database, which deletes on it hide from
+// the row count. Tables configuring no columns count their key's. With
+// Options.Estimate, the distinct values are estimated where the engine has an
+// aggregate for it, unless the table is Exact, while the rows are still
+// counted exactly.
+func (c *Comparer) compareDistinct(ctx context.Context, table *TableResult, config TableConfig) error {
+	source, dest := &c.databases.source, &c.databases.dest
+	sets := make([][]string, len(config.Distinct))
+	for i, columns := range config.Distinct {
+		for _, column := range strings.Split(columns, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				sets[i] = append(sets[i], column)
+			}
+		}
+		if len(sets[i]) == 0 {
+			return fmt.Errorf("table %s: distinct %q names no column", config.Name, columns)
+		}
+	}
+	if len(sets) == 0 {
+		spec, err := loadTableSpec(ctx, source, config, c.Options)
+		if err != nil {
+			return err
+		}
+		key := make([]string, len(spec.Key))
+		for i, column := range spec.Key {
+			key[i] = column.Name
+		}
+		sets = [][]string{key}
+	}
+
+	approximate := c.Options.Estimate && !config.Exact
+	var sourceCounts, destCounts []int
+	var sourceApproximate, destApproximate []bool
+	err := bothSides(func() error {
+		return c.Options.Retry.do(ctx, source, func() (err error) {
+			table.SourceRowCount, sourceCounts, sourceApproximate, err = countDistinct(ctx, source, config, sets, approximate)
+			return err
+		})
+	}, func() error {
+		return c.Options.Retry.do(ctx, dest, func() (err error) {
+			table.DestRowCount, destCounts, destApproximate, err = countDistinct(ctx, dest, config.onDest(), sets, approximate)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for i, columns := range sets {
+		table.DistinctCounts = append(table.DistinctCounts, DistinctCount{Columns: columns, Source: sourceCounts[i], Dest: destCounts[i],
+			Approximate: sourceApproximate[i] || destApproximate[i]})
+	}
+	return nil
+}
+
+// countDistinct counts the rows and the distinct values of every set of
+// columns, leaving out the rows with a NULL in any of the set's columns, as
+// COUNT(DISTINCT) does. Sets of several columns are counted exactly in a
+// subquery, where the engine can't count them together, and so is every set
+// without approximate. The sets whose counts are estimates are flagged.
+func countDistinct(ctx context.Context, db *DB, table TableConfig, sets [][]string, approximate bool) (int, []int, []bool, error) {
+	d := db.Dialect
+	from := table.from(d)
+	selects := []string{"COUNT(*)"}
+	approximated := make([]bool, len(sets))
+	for s, set := range sets {
+		quoted := make([]string, len(set))
+		notNull := make([]string, len(set))
+		for i, column := range set {
+			quoted[i] = d.QuoteIdentifier(column)
+			notNull[i] = quoted[i] + " IS NOT NULL"
+		}
+		if estimating, ok := d.(approxDistinctDialect); ok && approximate {
+			if expression, ok := estimating.approxCountDistinct(quoted); ok {
+				selects = append(selects, expression)
+				approximated[s] = true
+				continue
+			}
+		}
+		if len(set) == 1 {
+			selects = append(selects, "COUNT(DISTINCT "+quoted[0]+")")
+			continue
+		}
+		if table.Where != "" {
+			notNull = append([]string{"(" + table.Where + ")"}, notNull...)
+		}
+		selects = append(selects, fmt.Sprintf("(SELECT COUNT(*) FROM (SELECT DISTINCT %s FROM %s WHERE %s) d)",
+			strings.Join(quoted, ", "), from, strings.Join(notNull, " AND ")))
+	}
+	counts := make([]int, len(selects))
+	pointers := make([]interface{}, len(selects))
+	for i := range counts {
+		pointers[i] = &counts[i]
+	}
+	if err := db.scanRow(ctx, "SELECT "+strings.Join(selects, ", ")+" FROM "+from+whereClause(table.Where), pointers...); err != nil {
+		return 0, nil, nil, db.wrap(err)
+	}
+	return counts[0], counts[1:], approximated, nil
+}
+
+// DistinctDrift adds up how far the distinct counts of every set of columns
+// are apart.
+func (t TableResult) DistinctDrift() int {
+	drift := 0
+	for _, count := range t.DistinctCounts {
+		if count.Source > count.Dest {
+			drift += count.Source - count.Dest
+		} else {
+			drift += count.Dest - count.Source
+		}
+	}
+	return drift
+}
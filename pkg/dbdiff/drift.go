@@ -0,0 +1,103 @@
+package dbdiff
+
+// Drift is how far the table differs in the mode, and out of how many rows,
+// columns, privileges, sequences or aggregates. A count comparison's drift is
+// signed, the source's rows minus the destination's; thresholds compare its
+// magnitude.
+func (t TableResult) Drift(mode string) (diff, total int) {
+	total = t.SourceRowCount
+	if t.DestRowCount > total {
+		total = t.DestRowCount
+	}
+	switch mode {
+	case ModeCount:
+		diff = t.SourceRowCount - t.DestRowCount
+	case ModeRows:
+		diff = t.OnlyInSource + t.OnlyInDest + t.Mismatched
+	case ModeChecksum:
+		// without Localize, every row of a differing chunk counts
+		if len(t.DifferingRanges) > 0 {
+			diff = t.OnlyInSource + t.OnlyInDest + t.Mismatched
+			break
+		}
+		for _, chunk := range t.MismatchedChunks {
+			if chunk.SourceRows > chunk.DestRows {
+				diff += chunk.SourceRows
+			} else {
+				diff += chunk.DestRows
+			}
+		}
+	case ModeSample:
+		diff, _, _ = t.SampleEstimate()
+	case ModeMembership:
+		onlyInSource, onlyInDest := t.MembershipEstimate()
+		diff = onlyInSource + onlyInDest
+	case ModeDistinct:
+		diff = t.DistinctDrift()
+	case ModeFreshness:
+		// the skew in seconds, out of nothing
+		diff, total = t.freshnessDrift(), 0
+	case ModeAggregates:
+		for _, aggregate := range t.Aggregates {
+			if !aggregate.Equal {
+				diff++
+			}
+		}
+		total = len(t.Aggregates)
+	case ModeGroups:
+		for _, bucket := range t.DifferingBuckets {
+			if bucket.SourceCount > bucket.DestCount {
+				diff += bucket.SourceCount - bucket.DestCount
+			} else {
+				diff += bucket.DestCount - bucket.SourceCount
+			}
+		}
+	case ModeKeys:
+		// gaps both databases share, such as deleted rows, cancel out
+		diff = t.SourceKeys.DuplicateRows + t.DestKeys.DuplicateRows
+		if missing := t.SourceKeys.MissingKeys - t.DestKeys.MissingKeys; missing > 0 {
+			diff += int(missing)
+		} else {
+			diff -= int(missing)
+		}
+	case ModeSchema:
+		diff = len(t.SchemaDifferences)
+		total = t.SourceColumns
+		if t.DestColumns > total {
+			total = t.DestColumns
+		}
+	case ModeGrants:
+		diff = len(t.SchemaDifferences)
+		total = t.SourceGrants
+		if t.DestGrants > total {
+			total = t.DestGrants
+		}
+	case ModeSequences:
+		for _, sequence := range t.Sequences {
+			if sequence.Drifts() {
+				diff++
+			}
+		}
+		total = len(t.Sequences)
+	default:
+		if IsStrategy(mode) {
+			diff = t.OnlyInSource + t.OnlyInDest + t.Mismatched
+		}
+	}
+	return diff, total
+}
+
+// DriftPct is the drift's magnitude as a percentage of the total. Any drift
+// of an empty total counts as 100%.
+func DriftPct(diff, total int) float64 {
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff == 0 {
+		return 0
+	}
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(diff) / float64(total)
+}
@@ -0,0 +1,89 @@
+package dbdiff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTableNotFound is returned when a table has no columns on a database.
+var ErrTableNotFound = errors.New("table not found")
+
+// DatabaseError is an error from one of the two databases.
+type DatabaseError struct {
+	// Database is the name of the database, as given to Open.
+	Database string
+	Err      error
+}
+
+func (e *DatabaseError) Error() string {
+	return e.Database + ": " + e.Err.Error()
+}
+
+func (e *DatabaseError) Unwrap() error {
+	return e.Err
+}
+
+func (db *DB) wrap(err error) error {
+	return &DatabaseError{db.ServiceName, err}
+}
+
+// Statuses of a table comparison, as reported by TableResult.Status. The
+// failing statuses are followed by the database they happened on, as in
+// "missing on inventory".
+const (
+	StatusOK               = "ok"
+	StatusMissing          = "missing"
+	StatusPermissionDenied = "permission denied"
+	StatusTimeout          = "timeout"
+	StatusFailed           = "failed"
+)
+
+// errorPatterns recognize the failures worth telling apart in the messages
+// of each engine's driver, which rarely agree on error codes.
+var errorPatterns = []struct {
+	status   string
+	patterns []string
+}{
+	{StatusTimeout, []string{"statement timeout", "timeout expired", "timed out", "timeout exceeded"}},
+	{StatusPermissionDenied, []string{"permission denied", "permission was denied", "command denied", "access denied", "insufficient privileges", "not authorized"}},
+	{StatusMissing, []string{"does not exist", "doesn't exist", "no such table", "invalid object name", "unknown table", "not found: table"}},
+}
+
+// TimedOut reports whether the table's comparison gave up on its timeout,
+// or the database did on a statement timeout.
+func (t TableResult) TimedOut() bool {
+	return strings.HasPrefix(t.Status(), StatusTimeout)
+}
+
+// Status classifies why the table's comparison failed, or is StatusOK when it
+// didn't.
+func (t TableResult) Status() string {
+	if t.Err == nil {
+		return StatusOK
+	}
+	status := StatusFailed
+	message := strings.ToLower(t.Err.Error())
+	switch {
+	case errors.Is(t.Err, context.DeadlineExceeded):
+		status = StatusTimeout
+	case errors.Is(t.Err, ErrTableNotFound):
+		status = StatusMissing
+	default:
+	patterns:
+		for _, candidate := range errorPatterns {
+			for _, pattern := range candidate.patterns {
+				if strings.Contains(message, pattern) {
+					status = candidate.status
+					break patterns
+				}
+			}
+		}
+	}
+	var dbErr *DatabaseError
+	if errors.As(t.Err, &dbErr) {
+		status = fmt.Sprintf("%s on %s", status, dbErr.Database)
+	}
+	return status
+}
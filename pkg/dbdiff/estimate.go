@@ -0,0 +1,34 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// estimatingDialect is implemented by dialects whose catalogs keep a row
+// count, read instead of COUNT(*) with Options.Estimate. Depending on the
+// engine, the count is as of the last ANALYZE, statistics update or merge.
+type estimatingDialect interface {
+	estimateCount(ctx context.Context, db *DB, tableName string) (int, error)
+}
+
+// canEstimate reports whether a table's count may be estimated. Filtered
+// and flagged tables, those with their own count and those read as of a
+// time are counted exactly.
+func (c *Comparer) canEstimate(db *DB, config TableConfig) bool {
+	_, ok := db.Dialect.(estimatingDialect)
+	return ok && c.Options.Estimate && !config.Exact && config.Where == "" && config.Count == "" && config.CountQuery == "" && config.asOf.IsZero()
+}
+
+// scanEstimate reads an estimate, which is missing when the table is.
+func scanEstimate(row *sql.Row) (int, error) {
+	var count sql.NullInt64
+	if err := row.Scan(&count); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if !count.Valid {
+		return 0, ErrTableNotFound
+	}
+	return int(count.Int64), nil
+}
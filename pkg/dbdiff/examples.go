@@ -0,0 +1,149 @@
+package dbdiff
+
+import (
+	"context"
+	"strings"
+)
+
+// RowExample is a row found on one database only, shown as evidence for a
+// count or checksum mismatch.
+type RowExample struct {
+	// Kind is MissingInDest or MissingInSource.
+	Kind string
+	Key  string
+	// Row is every column of the row, as name=value pairs.
+	Row string
+}
+
+// findExamples fetches up to Options.Examples rows present on one database
+// only, for tables whose exact counts or checksums differ. The keys of both
+// tables are merged in key order, within the mismatched key ranges for
+// checksums, until enough are found. Failing to find them is only logged, as
+// the comparison itself succeeded.
+func (c *Comparer) findExamples(ctx context.Context, table *TableResult, config TableConfig) {
+	if c.Options.Examples <= 0 {
+		return
+	}
+	var ranges []KeyRange
+	switch c.Options.Mode {
+	case ModeCount:
+		if table.SourceRowCount != table.DestRowCount && !table.Approximate {
+			ranges = []KeyRange{{}}
+		}
+	case ModeChecksum:
+		chunks := table.DifferingRanges
+		if len(chunks) == 0 {
+			chunks = table.MismatchedChunks
+		}
+		for _, chunk := range chunks {
+			ranges = append(ranges, chunk.Range)
+		}
+	}
+	if len(ranges) == 0 {
+		return
+	}
+	if err := c.fetchExamples(ctx, table, config, ranges); err != nil {
+		c.log.Warnw("Couldn't fetch example rows", "table", table.Name, "source", table.Source, "dest", table.Dest, "error", err)
+	}
+}
+
+func (c *Comparer) fetchExamples(ctx context.Context, table *TableResult, config TableConfig, ranges []KeyRange) error {
+	source, dest := &c.databases.source, &c.databases.dest
+	spec, err := loadTableSpec(ctx, source, config, c.Options)
+	if err != nil {
+		return err
+	}
+	// walk the keys alone, fetching the rows once they're found
+	keysOnly := spec
+	keysOnly.Columns = nil
+	var sourceKeys, destKeys [][]interface{}
+	for _, keyRange := range ranges {
+		limit := c.Options.Examples - len(sourceKeys) - len(destKeys)
+		if limit <= 0 {
+			break
+		}
+		onlySource, onlyDest, err := keysOnOneSide(ctx, c.databases, keysOnly, keyRange, c.Options.BatchSize, limit)
+		if err != nil {
+			return err
+		}
+		sourceKeys, destKeys = append(sourceKeys, onlySource...), append(destKeys, onlyDest...)
+	}
+
+	for _, side := range []struct {
+		db   *DB
+		spec tableSpec
+		keys [][]interface{}
+		kind string
+	}{{source, spec, sourceKeys, MissingInDest}, {dest, spec.onDest(), destKeys, MissingInSource}} {
+		if len(side.keys) == 0 {
+			continue
+		}
+		rows, err := rowsByKey(ctx, side.db, side.spec, side.keys)
+		if err != nil {
+			return err
+		}
+		for _, key := range side.keys {
+			formatted := formatKey(spec.Key, key)
+			// deleted since its key was read
+			row, ok := rows[formatted]
+			if !ok {
+				continue
+			}
+			table.Examples = append(table.Examples, RowExample{Kind: side.kind, Key: spec.displayKey(key), Row: formatRow(spec, row)})
+		}
+	}
+	return nil
+}
+
+// keysOnOneSide merges the keys of a key range of both tables, returning up
+// to limit keys found on either database only.
+func keysOnOneSide(ctx context.Context, databases *Databases, spec tableSpec, keyRange KeyRange, batchSize, limit int) (onlySource, onlyDest [][]interface{}, err error) {
+	source := newRowCursor(&databases.source, spec, keyRange, batchSize)
+	dest := newRowCursor(&databases.dest, spec.onDest(), keyRange, batchSize)
+	sourceKey, err := source.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	destKey, err := dest.Next(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for (sourceKey != nil || destKey != nil) && len(onlySource)+len(onlyDest) < limit {
+		var cmp int
+		switch {
+		case sourceKey == nil:
+			cmp = 1
+		case destKey == nil:
+			cmp = -1
+		default:
+			cmp = compareKeys(spec.Key, sourceKey, destKey)
+		}
+		if cmp < 0 {
+			onlySource = append(onlySource, sourceKey)
+		}
+		if cmp > 0 {
+			onlyDest = append(onlyDest, destKey)
+		}
+		if cmp <= 0 {
+			if sourceKey, err = source.Next(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+		if cmp >= 0 {
+			if destKey, err = dest.Next(ctx); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return onlySource, onlyDest, nil
+}
+
+// formatRow renders a row as selected by selectList, the key columns
+// followed by every column, as name=value pairs of its columns, masked.
+func formatRow(spec tableSpec, row []interface{}) string {
+	parts := make([]string, len(spec.Columns))
+	for i, column := range spec.Columns {
+		parts[i] = column.Name + "=" + spec.formatMasked(column.Name, row[len(spec.Key)+i])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,204 @@
+package dbdiff
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgconn"
+)
+
+// fdwLink reaches the destination's tables from the source through
+// postgres_fdw, so that a rows comparison runs as a single query on the
+// source. The foreign server, unless Options.FDWServer names one already
+// set up, and the schemas holding the foreign tables are created the first
+// time a table is compared and dropped when the comparer is closed.
+type fdwLink struct {
+	// server is the foreign server, created when it's ours
+	server  string
+	created bool
+	// prefix names the schemas the foreign tables are imported into
+	prefix string
+
+	mu    sync.Mutex
+	ready bool
+	// destSchema is the destination's current schema, which unqualified
+	// tables are in
+	destSchema string
+	// schemas are the local schemas by destination schema, and tables the
+	// foreign tables by destination table
+	schemas map[string]string
+	tables  map[TableRef]string
+}
+
+func newFDWLink(server string) *fdwLink {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("databasediff_%d_%s", os.Getpid(), hex.EncodeToString(suffix))
+	link := &fdwLink{server: server, prefix: name, schemas: map[string]string{}, tables: map[TableRef]string{}}
+	if server == "" {
+		link.server, link.created = name, true
+	}
+	return link
+}
+
+// foreignTable imports the destination's table as a foreign table on the
+// source, once, and returns its name there.
+func (l *fdwLink) foreignTable(ctx context.Context, databases *Databases, destName string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	source, dest := &databases.source, &databases.dest
+	if !l.ready {
+		if err := l.setUp(ctx, source, dest); err != nil {
+			return "", source.wrap(fmt.Errorf("setting up postgres_fdw: %w", err))
+		}
+		l.ready = true
+	}
+	ref := resolveTableRef(dest.Dialect, destName)
+	if ref.Schema == "" {
+		ref.Schema = l.destSchema
+	}
+	if table, ok := l.tables[ref]; ok {
+		return table, nil
+	}
+	d := source.Dialect
+	schema, ok := l.schemas[ref.Schema]
+	if !ok {
+		schema = l.prefix + "_" + strconv.Itoa(len(l.schemas))
+		if _, err := source.DB.ExecContext(ctx, "CREATE SCHEMA "+d.QuoteIdentifier(schema)); err != nil {
+			return "", source.wrap(fmt.Errorf("setting up postgres_fdw: %w", err))
+		}
+		l.schemas[ref.Schema] = schema
+	}
+	_, err := source.DB.ExecContext(ctx, fmt.Sprintf("IMPORT FOREIGN SCHEMA %s LIMIT TO (%s) FROM SERVER %s INTO %s",
+		d.QuoteIdentifier(ref.Schema), d.QuoteIdentifier(ref.Name), d.QuoteIdentifier(l.server), d.QuoteIdentifier(schema)))
+	if err != nil {
+		return "", source.wrap(fmt.Errorf("importing %s through postgres_fdw: %w", destName, err))
+	}
+	table := d.QuoteIdentifier(schema) + "." + d.QuoteIdentifier(ref.Name)
+	l.tables[ref] = table
+	return table, nil
+}
+
+// setUp creates the foreign server with a user mapping for the source's
+// user, logging in as the destination's, unless the server was given. The
+// destination is reached at the host and port of its connection string, as
+// the source sees them.
+func (l *fdwLink) setUp(ctx context.Context, source, dest *DB) error {
+	if err := dest.DB.GetContext(ctx, &l.destSchema, "SELECT current_schema()"); err != nil {
+		return err
+	}
+	if !l.created {
+		return nil
+	}
+	if dest.conn == "" {
+		return errors.New("creating the foreign server needs the destination's connection string, which databases opened outside Open lack; set Options.FDWServer")
+	}
+	dsn, err := dest.Dialect.DSN(dest.conn)
+	if err != nil {
+		return err
+	}
+	config, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return err
+	}
+	d := source.Dialect
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS postgres_fdw",
+		fmt.Sprintf("CREATE SERVER %s FOREIGN DATA WRAPPER postgres_fdw OPTIONS (host %s, port %s, dbname %s)", d.QuoteIdentifier(l.server),
+			quoteString(config.Host), quoteString(strconv.Itoa(int(config.Port))), quoteString(config.Database)),
+		fmt.Sprintf("CREATE USER MAPPING FOR CURRENT_USER SERVER %s OPTIONS (user %s, password %s)", d.QuoteIdentifier(l.server),
+			quoteString(config.User), quoteString(config.Password)),
+	}
+	for i, statement := range statements {
+		if _, err := source.DB.ExecContext(ctx, statement); err != nil {
+			// the server is ours, but won't be dropped on closing
+			if i > 1 {
+				source.DB.ExecContext(ctx, "DROP SERVER IF EXISTS "+d.QuoteIdentifier(l.server)+" CASCADE")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// close drops the schemas imported into, and the foreign server when it's
+// ours, along with its user mapping.
+func (l *fdwLink) close(source *DB) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.ready {
+		return nil
+	}
+	d := source.Dialect
+	var statements []string
+	for _, schema := range l.schemas {
+		statements = append(statements, "DROP SCHEMA IF EXISTS "+d.QuoteIdentifier(schema)+" CASCADE")
+	}
+	if l.created {
+		statements = append(statements, "DROP SERVER IF EXISTS "+d.QuoteIdentifier(l.server)+" CASCADE")
+	}
+	var err error
+	for _, statement := range statements {
+		if _, dropErr := source.DB.Exec(statement); dropErr != nil && err == nil {
+			err = source.wrap(fmt.Errorf("cleaning up postgres_fdw: %w", dropErr))
+		}
+	}
+	return err
+}
+
+// compareRowsOverFDW full joins the table with its foreign table on the
+// source by key and counts the rows on each side, those on one side only and
+// those whose columns differ, compared as text. Only the counts leave the
+// source, so the differing rows aren't listed. Tables with large objects are
+// walked like any other instead.
+func compareRowsOverFDW(ctx context.Context, databases *Databases, link *fdwLink, table *TableResult, config TableConfig, options Options) error {
+	source := &databases.source
+	spec, err := loadTableSpec(ctx, source, config, options)
+	if err != nil {
+		return err
+	}
+	if spec.hasLargeObjects() {
+		// the foreign table's oids are of the destination's objects
+		return compareRows(ctx, databases, table, config, options)
+	}
+	foreign, err := link.foreignTable(ctx, databases, spec.DestName)
+	if err != nil {
+		return err
+	}
+	d := source.Dialect
+	joined := make([]string, len(spec.Key))
+	for i, key := range spec.Key {
+		name := d.QuoteIdentifier(key.Name)
+		joined[i] = "s." + name + " = d." + name
+	}
+	sourceKey, destKey := "s."+d.QuoteIdentifier(spec.Key[0].Name), "d."+d.QuoteIdentifier(spec.Key[0].Name)
+	differ := make([]string, len(spec.Columns))
+	for i, column := range spec.Columns {
+		name := d.QuoteIdentifier(column.Name)
+		differ[i] = fmt.Sprintf("s.%s::text IS DISTINCT FROM d.%s::text", name, name)
+	}
+	mismatched := "0"
+	if len(differ) > 0 {
+		mismatched = fmt.Sprintf("count(*) FILTER (WHERE %s IS NOT NULL AND %s IS NOT NULL AND (%s))", sourceKey, destKey, strings.Join(differ, " OR "))
+	}
+	query := fmt.Sprintf(`
+		SELECT count(%[1]s), count(%[2]s), count(*) FILTER (WHERE %[2]s IS NULL), count(*) FILTER (WHERE %[1]s IS NULL), %[3]s
+		FROM (SELECT * FROM %[4]s%[6]s) s
+		FULL JOIN (SELECT * FROM %[5]s%[7]s) d ON %[8]s`,
+		sourceKey, destKey, mismatched, spec.from(d), foreign, whereClause(spec.Filter), whereClause(spec.DestFilter), strings.Join(joined, " AND "))
+	return options.Retry.do(ctx, source, func() error {
+		err := source.DB.QueryRowContext(ctx, query).Scan(&table.SourceRowCount, &table.DestRowCount, &table.OnlyInSource, &table.OnlyInDest, &table.Mismatched)
+		if err != nil {
+			return source.wrap(err)
+		}
+		source.addScanned(table.SourceRowCount + table.DestRowCount)
+		return nil
+	})
+}
@@ -0,0 +1,41 @@
+package dbdiff
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNewFDWLink(t *testing.T) {
+	ours := newFDWLink("")
+	if !ours.created || ours.server != ours.prefix || !strings.HasPrefix(ours.server, "databasediff_") {
+		t.Errorf("link without a server is %+v, want one creating its own", ours)
+	}
+	if other := newFDWLink(""); other.prefix == ours.prefix {
+		t.Errorf("two links share the prefix %s", ours.prefix)
+	}
+	given := newFDWLink("replica")
+	if given.created || given.server != "replica" || given.prefix == "replica" {
+		t.Errorf("link with a server is %+v, want one using it", given)
+	}
+	// nothing was set up, so closing drops nothing
+	if err := given.close(&DB{}); err != nil {
+		t.Errorf("closing a link never set up: %v", err)
+	}
+}
+
+func TestCompareRowsFDWOfSQLite(t *testing.T) {
+	// postgres_fdw needs PostgreSQL on both sides, so the rows are walked
+	comparer := openFixtures(t, Options{Mode: ModeRows, FDW: true})
+	if comparer.fdw != nil {
+		t.Fatal("comparer of SQLite databases links them through postgres_fdw")
+	}
+	result, err := comparer.CompareTable(context.Background(), TableConfig{Name: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{MissingInDest: "id=3,id=4", MissingInSource: "id=11", ValuesDiffer: "id=5,id=7"}
+	if got := differingKeys(result); !equalKeys(got, want) {
+		t.Errorf("differences are %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// DefaultFreshnessColumn is the column compared in ModeFreshness when
+// neither the table nor Options name one.
+const DefaultFreshnessColumn = "updated_at"
+
+// timestampLayouts are the text forms of timestamps drivers without a native
+// type return, such as SQLite's, tried in order.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// compareFreshness reads the latest value of the table's freshness column on
+// both databases, telling a replica that's merely behind from one missing
+// rows.
+func (c *Comparer) compareFreshness(ctx context.Context, table *TableResult, config TableConfig) error {
+	column := config.FreshnessColumn
+	if column == "" {
+		column = c.Options.FreshnessColumn
+	}
+	if column == "" {
+		column = DefaultFreshnessColumn
+	}
+	source, dest := &c.databases.source, &c.databases.dest
+	return bothSides(func() error {
+		return c.Options.Retry.do(ctx, source, func() (err error) {
+			table.SourceLatest, err = latestValue(ctx, source, config, column)
+			return err
+		})
+	}, func() error {
+		return c.Options.Retry.do(ctx, dest, func() (err error) {
+			table.DestLatest, err = latestValue(ctx, dest, config.onDest(), column)
+			return err
+		})
+	})
+}
+
+// latestValue is the column's maximum, zero when no row has a value.
+func latestValue(ctx context.Context, db *DB, table TableConfig, column string) (time.Time, error) {
+	query := fmt.Sprintf("SELECT MAX(%s) FROM %s%s",
+		db.Dialect.QuoteIdentifier(column), table.from(db.Dialect), whereClause(table.Where))
+	var value interface{}
+	if err := db.scanRow(ctx, query, &value); err != nil {
+		return time.Time{}, db.wrap(err)
+	}
+	latest, err := parseTimestamp(value)
+	if err != nil {
+		return time.Time{}, db.wrap(fmt.Errorf("%s.%s: %w", table.Name, column, err))
+	}
+	return latest, nil
+}
+
+// parseTimestamp converts a scanned timestamp to a time. Integers are taken
+// as Unix seconds. Timestamps without a time zone are taken as UTC.
+func parseTimestamp(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return v, nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case []byte:
+		return parseTimestamp(string(v))
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC(), nil
+		}
+		return time.Time{}, fmt.Errorf("%q isn't a timestamp", v)
+	}
+	// Drivers such as ClickHouse's may return nullable values as pointers.
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return time.Time{}, nil
+		}
+		return parseTimestamp(v.Elem().Interface())
+	}
+	return time.Time{}, fmt.Errorf("%T isn't a timestamp", value)
+}
+
+// Skew is how far the destination's latest change trails the source's,
+// negative when the destination is ahead. It's false unless both databases
+// have a latest change.
+func (t TableResult) Skew() (time.Duration, bool) {
+	if t.SourceLatest.IsZero() || t.DestLatest.IsZero() {
+		return 0, false
+	}
+	return t.SourceLatest.Sub(t.DestLatest), true
+}
+
+// freshnessDrift is the skew in whole seconds. A table with values on one
+// side only drifts further than any threshold.
+func (t TableResult) freshnessDrift() int {
+	skew, ok := t.Skew()
+	if !ok {
+		if t.SourceLatest.IsZero() == t.DestLatest.IsZero() {
+			return 0
+		}
+		return math.MaxInt32
+	}
+	if skew < 0 {
+		skew = -skew
+	}
+	return int(skew / time.Second)
+}
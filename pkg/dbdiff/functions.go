@@ -0,0 +1,77 @@
+package dbdiff
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Functions is the pseudo-table the stored functions and procedures of the
+// compared tables' schemas are reported under in ModeSchema.
+const Functions = "(functions)"
+
+// functionDialect is implemented by dialects with stored functions.
+// functions lists those of a schema, or of the connection's current one when
+// it's empty, named by their signature where the engine overloads them.
+type functionDialect interface {
+	functions(ctx context.Context, db *DB, schema string) ([]schemaObject, error)
+}
+
+// compareFunctions diffs the stored functions and procedures of every
+// schema holding one of the tables, with their definitions' whitespace
+// collapsed. A schema mapped to another on the destination is compared
+// against it, with its name replaced in the destination's definitions.
+func compareFunctions(ctx context.Context, databases *Databases, table *TableResult, tables []TableConfig) error {
+	source, dest := &databases.source, &databases.dest
+	sourceDialect, sourceOK := source.Dialect.(functionDialect)
+	destDialect, destOK := dest.Dialect.(functionDialect)
+	if !sourceOK || !destOK {
+		return nil
+	}
+	schemas := map[string]string{}
+	for _, config := range tables {
+		schemas[ParseTableRef(config.Name).Schema] = ParseTableRef(config.onDest().Name).Schema
+	}
+	sourceSchemas := make([]string, 0, len(schemas))
+	for schema := range schemas {
+		sourceSchemas = append(sourceSchemas, schema)
+	}
+	sort.Strings(sourceSchemas)
+
+	var sourceFunctions, destFunctions []schemaObject
+	for _, schema := range sourceSchemas {
+		destSchema := schemas[schema]
+		var sourceObjects, destObjects []schemaObject
+		err := bothSides(func() (err error) {
+			if sourceObjects, err = sourceDialect.functions(ctx, source, schema); err != nil {
+				return source.wrap(err)
+			}
+			return nil
+		}, func() (err error) {
+			if destObjects, err = destDialect.functions(ctx, dest, destSchema); err != nil {
+				return dest.wrap(err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, objects := range [][]schemaObject{sourceObjects, destObjects} {
+			for i := range objects {
+				objects[i].Definition = normalizeDefinition(objects[i].Definition)
+				if schema != "" {
+					objects[i].Name = schema + "." + objects[i].Name
+				}
+			}
+		}
+		if destSchema != schema && destSchema != "" {
+			for i := range destObjects {
+				destObjects[i].Definition = strings.ReplaceAll(destObjects[i].Definition, destSchema+".", schema+".")
+			}
+		}
+		sourceFunctions, destFunctions = append(sourceFunctions, sourceObjects...), append(destFunctions, destObjects...)
+	}
+	table.SourceColumns, table.DestColumns = len(sourceFunctions), len(destFunctions)
+	diffSchemaObjects(table, sourceFunctions, destFunctions)
+	return nil
+}
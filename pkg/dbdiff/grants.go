@@ -0,0 +1,97 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// grantDialect is implemented by dialects that can list privileges. grants
+// returns the table's owner, empty on engines without owners, and a row per
+// privilege granted on the table or one of its columns.
+type grantDialect interface {
+	grants(ctx context.Context, db *DB, tableName string) (owner string, grants []tableGrant, err error)
+}
+
+// tableGrant is a privilege granted on a table, or on one of its columns
+// when Column is set.
+type tableGrant struct {
+	Grantee   string `db:"grantee"`
+	Column    string `db:"column_name"`
+	Privilege string `db:"privilege"`
+}
+
+// compareGrants diffs the owner of the table and the privileges each
+// grantee holds on it and its columns, recording them as schema
+// differences.
+func compareGrants(ctx context.Context, databases *Databases, table *TableResult, config TableConfig) error {
+	var sourceOwner, destOwner string
+	var source, dest map[string]string
+	err := bothSides(func() (err error) {
+		sourceOwner, source, err = getGrants(ctx, &databases.source, config.Name)
+		return err
+	}, func() (err error) {
+		destOwner, dest, err = getGrants(ctx, &databases.dest, config.onDest().Name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	table.SourceGrants, table.DestGrants = len(source), len(dest)
+
+	if sourceOwner != destOwner {
+		table.addSchemaDifference(ParseTableRef(config.Name).Name, "owner", sourceOwner, destOwner)
+	}
+	objects := make([]string, 0, len(source)+len(dest))
+	for object := range source {
+		objects = append(objects, object)
+	}
+	for object := range dest {
+		if _, ok := source[object]; !ok {
+			objects = append(objects, object)
+		}
+	}
+	sort.Strings(objects)
+	for _, object := range objects {
+		s, ok := source[object]
+		if !ok {
+			s = absent
+		}
+		d, ok := dest[object]
+		if !ok {
+			d = absent
+		}
+		if s != d {
+			table.addSchemaDifference(object, "privileges", s, d)
+		}
+	}
+	return nil
+}
+
+// getGrants returns the table's owner and the privileges of each grantee,
+// keyed by grantee, or grantee and column, as a sorted list.
+func getGrants(ctx context.Context, db *DB, tableName string) (string, map[string]string, error) {
+	dialect, ok := db.Dialect.(grantDialect)
+	if !ok {
+		return "", nil, db.wrap(fmt.Errorf("%s has no privileges to compare", db.Dialect.Name()))
+	}
+	owner, grants, err := dialect.grants(ctx, db, tableName)
+	if err != nil {
+		return "", nil, db.wrap(err)
+	}
+	privileges := map[string][]string{}
+	for _, grant := range grants {
+		object := grant.Grantee
+		if grant.Column != "" {
+			object += " on " + grant.Column
+		}
+		privileges[object] = append(privileges[object], grant.Privilege)
+	}
+	byObject := make(map[string]string, len(privileges))
+	for object, list := range privileges {
+		sort.Strings(list)
+		byObject[object] = strings.Join(list, ", ")
+	}
+	return owner, byObject, nil
+}
@@ -0,0 +1,161 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// maxKeyIssues is how many gaps and duplicate keys a key scan lists on each
+// database. Beyond it they're only counted.
+const maxKeyIssues = 100
+
+// KeyScan is what ModeKeys found scanning the key space of a table on one
+// database.
+type KeyScan struct {
+	// Gaps are the runs of keys missing between the lowest and the highest,
+	// in order. Only tables keyed by a single integer column are scanned for
+	// them.
+	Gaps []KeyGap
+	// MissingKeys counts every key in the gaps, including those not listed.
+	MissingKeys int64
+	// Duplicates are the keys held by more than one row, in key order.
+	Duplicates []DuplicateKey
+	// DuplicateRows counts the rows beyond the first of every duplicate key,
+	// including those not listed.
+	DuplicateRows int
+}
+
+// KeyGap is a run of missing keys, First through Last.
+type KeyGap struct {
+	First, Last int64
+}
+
+// DuplicateKey is a key held by Rows rows.
+type DuplicateKey struct {
+	Key  string
+	Rows int
+}
+
+// compareKeySpace scans the key space of the table on each database
+// independently for gaps and duplicate keys, which point to replication bugs
+// even when the counts happen to match.
+func (c *Comparer) compareKeySpace(ctx context.Context, table *TableResult, config TableConfig) error {
+	spec, err := loadTableSpec(ctx, &c.databases.source, config, c.Options)
+	if err != nil {
+		return err
+	}
+	source, dest := &c.databases.source, &c.databases.dest
+	return bothSides(func() error {
+		return c.Options.Retry.do(ctx, source, func() (err error) {
+			table.SourceRowCount, table.SourceKeys, err = scanKeys(ctx, source, spec)
+			return err
+		})
+	}, func() error {
+		return c.Options.Retry.do(ctx, dest, func() (err error) {
+			table.DestRowCount, table.DestKeys, err = scanKeys(ctx, dest, spec.onDest())
+			return err
+		})
+	})
+}
+
+func scanKeys(ctx context.Context, db *DB, spec tableSpec) (int, KeyScan, error) {
+	var scan KeyScan
+	var err error
+	if scan.Duplicates, scan.DuplicateRows, err = duplicateKeys(ctx, db, spec); err != nil {
+		return 0, scan, err
+	}
+	var count int
+	if len(spec.Key) != 1 || spec.Key[0].Kind != keyNumeric {
+		if err := db.scanRow(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s%s", spec.from(db.Dialect), whereClause(spec.Filter)), &count); err != nil {
+			return 0, scan, db.wrap(err)
+		}
+		db.addScanned(count)
+		return count, scan, nil
+	}
+
+	// count the keys missing from the range between the lowest and the
+	// highest before looking for the gaps they're in
+	var lowest, highest interface{}
+	key := db.Dialect.QuoteIdentifier(spec.Key[0].Name)
+	err = db.scanRow(ctx, fmt.Sprintf("SELECT COUNT(*), MIN(%s), MAX(%s) FROM %s%s", key, key, spec.from(db.Dialect), whereClause(spec.Filter)),
+		&count, &lowest, &highest)
+	if err != nil {
+		return 0, scan, db.wrap(err)
+	}
+	db.addScanned(count)
+	low, lowErr := strconv.ParseInt(formatValue(lowest), 10, 64)
+	high, highErr := strconv.ParseInt(formatValue(highest), 10, 64)
+	// keys that aren't integers have no gaps
+	if count == 0 || lowErr != nil || highErr != nil {
+		return count, scan, nil
+	}
+	scan.MissingKeys = high - low + 1 - int64(count-scan.DuplicateRows)
+	if scan.MissingKeys > 0 {
+		if scan.Gaps, err = keyGaps(ctx, db, spec); err != nil {
+			return 0, scan, err
+		}
+	}
+	return count, scan, nil
+}
+
+// duplicateKeys lists the first maxKeyIssues keys held by several rows and
+// counts the extra rows of all of them.
+func duplicateKeys(ctx context.Context, db *DB, spec tableSpec) ([]DuplicateKey, int, error) {
+	rows, err := db.DB.QueryContext(ctx, fmt.Sprintf("SELECT %[1]s, COUNT(*) FROM %[2]s%[3]s GROUP BY %[1]s HAVING COUNT(*) > 1 ORDER BY %[1]s",
+		spec.keyList(db.Dialect), spec.from(db.Dialect), whereClause(spec.Filter)))
+	if err != nil {
+		return nil, 0, db.wrap(err)
+	}
+	defer rows.Close()
+	var duplicates []DuplicateKey
+	extra := 0
+	for rows.Next() {
+		key := make([]interface{}, len(spec.Key))
+		var count int
+		pointers := make([]interface{}, len(key)+1)
+		for i := range key {
+			pointers[i] = &key[i]
+		}
+		pointers[len(key)] = &count
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, 0, db.wrap(err)
+		}
+		extra += count - 1
+		if len(duplicates) < maxKeyIssues {
+			duplicates = append(duplicates, DuplicateKey{spec.displayKey(key), count})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, db.wrap(err)
+	}
+	return duplicates, extra, nil
+}
+
+// keyGaps lists the first maxKeyIssues gaps between consecutive keys of a
+// single integer key.
+func keyGaps(ctx context.Context, db *DB, spec tableSpec) ([]KeyGap, error) {
+	key := db.Dialect.QuoteIdentifier(spec.Key[0].Name)
+	rows, err := db.DB.QueryContext(ctx, fmt.Sprintf(`
+		SELECT previous, %[1]s FROM (
+			SELECT %[1]s, LAG(%[1]s) OVER (ORDER BY %[1]s) AS previous FROM %[2]s%[3]s
+		) ordered
+		WHERE %[1]s - previous > 1
+		ORDER BY %[1]s`, key, spec.from(db.Dialect), whereClause(spec.Filter)))
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	defer rows.Close()
+	var gaps []KeyGap
+	for len(gaps) < maxKeyIssues && rows.Next() {
+		var previous, next int64
+		if err := rows.Scan(&previous, &next); err != nil {
+			return nil, db.wrap(err)
+		}
+		gaps = append(gaps, KeyGap{previous + 1, next - 1})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, db.wrap(err)
+	}
+	return gaps, nil
+}
@@ -0,0 +1,165 @@
+package dbdiff
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaskHash replaces a value with a prefix of its HMAC-SHA256 under
+	// Options.MaskKey, which still tells whether two values are the same
+	// without the value being recoverable by hashing guesses.
+	MaskHash = "hash"
+	// MaskRedact replaces a value altogether.
+	MaskRedact = "redact"
+	// MaskPartial keeps the last characters of a value and hides the rest,
+	// as receipts do with card numbers.
+	MaskPartial = "partial"
+)
+
+// partialVisible is how many characters MaskPartial keeps. Values no longer
+// than that are hidden whole.
+const partialVisible = 4
+
+// Masking maps columns, matched case-insensitively, to the rule their values
+// are masked with wherever they're shown: the differing rows and columns,
+// example rows, duplicate keys and sync statements. Values are compared
+// unmasked, and NULLs are left as they are.
+type Masking map[string]string
+
+// ParseMasking reads rules written as column=rule pairs separated by
+// commas, such as email=hash,ssn=partial.
+func ParseMasking(rules string) (Masking, error) {
+	masking := Masking{}
+	for _, pair := range strings.Split(rules, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("masking rule %q isn't column=rule", pair)
+		}
+		masking[parts[0]] = parts[1]
+	}
+	return masking, masking.Validate()
+}
+
+// Validate checks that every rule is MaskHash, MaskRedact or MaskPartial.
+func (m Masking) Validate() error {
+	columns := make([]string, 0, len(m))
+	for column := range m {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		switch m[column] {
+		case MaskHash, MaskRedact, MaskPartial:
+		default:
+			return fmt.Errorf("unknown masking rule %q for column %s, expected hash, redact or partial", m[column], column)
+		}
+	}
+	return nil
+}
+
+// merge returns the rules with a table's own, which take precedence.
+func (m Masking) merge(table Masking) Masking {
+	if len(table) == 0 {
+		return m
+	}
+	merged := Masking{}
+	for _, rules := range []Masking{m, table} {
+		for column, rule := range rules {
+			for existing := range merged {
+				if strings.EqualFold(existing, column) {
+					delete(merged, existing)
+				}
+			}
+			merged[column] = rule
+		}
+	}
+	return merged
+}
+
+func (m Masking) rule(column string) string {
+	if rule, ok := m[column]; ok {
+		return rule
+	}
+	for name, rule := range m {
+		if strings.EqualFold(name, column) {
+			return rule
+		}
+	}
+	return ""
+}
+
+// maskKeySize is the size of the HMAC keys picked for a run.
+const maskKeySize = 32
+
+// withMaskKey returns the options with a random MaskKey when they have none.
+func (o Options) withMaskKey() Options {
+	if len(o.MaskKey) == 0 {
+		o.MaskKey = make([]byte, maskKeySize)
+		rand.Read(o.MaskKey)
+	}
+	return o
+}
+
+// value masks a scanned value of the column, hashing under the key, and
+// returns it as it is when the column has no rule.
+func (m Masking) value(key []byte, column string, value interface{}) interface{} {
+	rule := m.rule(column)
+	if rule == "" || value == nil {
+		return value
+	}
+	text := formatValue(value)
+	switch rule {
+	case MaskHash:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(text))
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+	case MaskPartial:
+		runes := []rune(text)
+		hidden := len(runes) - partialVisible
+		if hidden <= 0 {
+			return strings.Repeat("*", len(runes))
+		}
+		return strings.Repeat("*", hidden) + string(runes[hidden:])
+	}
+	return "[redacted]"
+}
+
+// maskValue masks a scanned value of the column by the table's rules.
+func (t tableSpec) maskValue(column string, value interface{}) interface{} {
+	return t.Mask.value(t.MaskKey, column, value)
+}
+
+// formatMasked renders a scanned value of the column for display, masked.
+func (t tableSpec) formatMasked(column string, value interface{}) string {
+	return formatValue(t.maskValue(column, value))
+}
+
+// displayKey renders a row's key for display, like formatKey but with the
+// key columns masked.
+func (t tableSpec) displayKey(row []interface{}) string {
+	if len(t.Mask) == 0 {
+		return formatKey(t.Key, row)
+	}
+	parts := make([]string, len(t.Key))
+	for i, key := range t.Key {
+		parts[i] = key.Name + "=" + t.formatMasked(key.Name, row[i])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// displayRange renders a key range for display, like KeyRange.String but
+// with the key columns masked.
+func (t tableSpec) displayRange(r KeyRange) string {
+	return r.format(func(i int, value interface{}) string {
+		return t.formatMasked(t.Key[i].Name, value)
+	})
+}
@@ -0,0 +1,150 @@
+package dbdiff
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseMasking(t *testing.T) {
+	for _, test := range []struct {
+		rules string
+		want  Masking
+		err   string
+	}{
+		{"", Masking{}, ""},
+		{"email=hash, ssn=partial,", Masking{"email": MaskHash, "ssn": MaskPartial}, ""},
+		{"email", nil, `masking rule "email" isn't column=rule`},
+		{"=hash", nil, `masking rule "=hash" isn't column=rule`},
+		{"email=scramble", nil, `unknown masking rule "scramble" for column email`},
+	} {
+		t.Run(test.rules, func(t *testing.T) {
+			masking, err := ParseMasking(test.rules)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(masking) != len(test.want) {
+				t.Fatalf("rules are %v, want %v", masking, test.want)
+			}
+			for column, rule := range test.want {
+				if masking[column] != rule {
+					t.Errorf("rule of %s is %q, want %q", column, masking[column], rule)
+				}
+			}
+		})
+	}
+}
+
+func TestMaskingValue(t *testing.T) {
+	masking := Masking{"Email": MaskHash, "ssn": MaskPartial, "name": MaskRedact}
+	key := []byte("run key")
+	for _, test := range []struct {
+		name   string
+		column string
+		value  interface{}
+		want   interface{}
+	}{
+		{"no rule", "id", int64(7), int64(7)},
+		{"null", "ssn", nil, nil},
+		{"partial", "ssn", "123-45-6789", "*******6789"},
+		{"partial of bytes", "SSN", []byte("123-45-6789"), "*******6789"},
+		{"partial of a short value", "ssn", "123", "***"},
+		{"partial of runes", "ssn", "äöüßéè", "**üßéè"},
+		{"redact", "name", "Ada", "[redacted]"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := masking.value(key, test.column, test.value); got != test.want {
+				t.Errorf("masked %v to %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+
+	// hashes tell equal values apart from different ones without showing them
+	hashed := masking.value(key, "email", "ada@example.com")
+	if text, ok := hashed.(string); !ok || !strings.HasPrefix(text, "hmac:") || len(text) != len("hmac:")+16 || strings.Contains(text, "ada") {
+		t.Errorf("hashed to %v", hashed)
+	}
+	if again := masking.value(key, "EMAIL", []byte("ada@example.com")); again != hashed {
+		t.Errorf("hashed the same value to %v and %v", hashed, again)
+	}
+	if other := masking.value(key, "email", "bob@example.com"); other == hashed {
+		t.Errorf("hashed different values to %v", other)
+	}
+	// without the key, hashing a guess doesn't match
+	if other := masking.value([]byte("another key"), "email", "ada@example.com"); other == hashed {
+		t.Errorf("hashed under another key to %v", other)
+	}
+}
+
+func TestMaskingMerge(t *testing.T) {
+	merged := Masking{"email": MaskHash, "ssn": MaskPartial}.merge(Masking{"EMAIL": MaskRedact})
+	if len(merged) != 2 || merged.rule("email") != MaskRedact || merged.rule("ssn") != MaskPartial {
+		t.Errorf("merged rules are %v", merged)
+	}
+}
+
+func TestCompareRowsMasked(t *testing.T) {
+	options := Options{Mode: ModeRows, SyncSQL: true, Mask: Masking{"total": MaskHash, "synced_at": MaskRedact}}
+	comparer := openFixtures(t, options)
+	// the table's own rule takes precedence
+	result, err := comparer.CompareTable(context.Background(), TableConfig{Name: "orders", Mask: Masking{"TOTAL": MaskPartial}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := map[string]ColumnDifference{}
+	for _, difference := range result.Differences {
+		for _, column := range difference.Columns {
+			columns[difference.Key] = column
+		}
+	}
+	want := map[string]ColumnDifference{
+		"id=5": {"total", "**", "***"},
+		"id=7": {"synced_at", "[redacted]", "[redacted]"},
+	}
+	for key, column := range want {
+		if columns[key] != column {
+			t.Errorf("%s differs in %+v, want %+v", key, columns[key], column)
+		}
+	}
+	for _, statement := range result.SyncStatements {
+		if strings.Contains(statement, "2024-") || strings.Contains(statement, " 50 ") {
+			t.Errorf("statement %s shows a masked value", statement)
+		}
+	}
+}
+
+func TestMaskKey(t *testing.T) {
+	if first, second := New(DB{}, DB{}, Options{}), New(DB{}, DB{}, Options{}); len(first.Options.MaskKey) != maskKeySize ||
+		string(first.Options.MaskKey) == string(second.Options.MaskKey) {
+		t.Errorf("comparers picked the keys %x and %x, want random ones", first.Options.MaskKey, second.Options.MaskKey)
+	}
+	if comparer := New(DB{}, DB{}, Options{MaskKey: []byte("configured")}); string(comparer.Options.MaskKey) != "configured" {
+		t.Errorf("comparer replaced the configured key with %x", comparer.Options.MaskKey)
+	}
+	multi := newMultiComparer([]DB{{}, {}, {}}, [][2]int{{0, 1}, {0, 2}}, Options{})
+	if first, second := multi.comparers[0].Options.MaskKey, multi.comparers[1].Options.MaskKey; len(first) == 0 || string(first) != string(second) {
+		t.Errorf("pairs picked the keys %x and %x, want the same", first, second)
+	}
+}
+
+func TestCompareChecksumsMaskedRanges(t *testing.T) {
+	comparer := openFixtures(t, Options{Mode: ModeChecksum, Checksum: ChecksumClient, ChunkSize: 4, Mask: Masking{"id": MaskRedact}})
+	result, err := comparer.CompareTable(context.Background(), TableConfig{Name: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.MismatchedChunks) == 0 {
+		t.Fatal("no chunks mismatched")
+	}
+	for _, chunk := range result.MismatchedChunks {
+		if chunk.Bounds == chunk.Range.String() || strings.ContainsAny(chunk.Bounds, "0123456789") {
+			t.Errorf("range %s is shown as %s, unmasked", chunk.Range, chunk.Bounds)
+		}
+	}
+}
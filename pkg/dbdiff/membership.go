@@ -0,0 +1,269 @@
+package dbdiff
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+const (
+	// membershipBitsPerKey sizes a chunk's filters by the rows of its
+	// larger side. Ten bits a key keep the filters far from full, where the
+	// estimates lose their precision.
+	membershipBitsPerKey = 10
+	// membershipHashes is how many bits each key sets. Fewer hashes fill
+	// the filters more slowly, which suits estimating cardinalities better
+	// than testing membership.
+	membershipHashes = 3
+	// minMembershipBits keeps the filters of small chunks from saturating.
+	minMembershipBits = 1024
+)
+
+// MembershipChunk is a key range whose Bloom filters differ between the
+// databases, with the keys estimated to be missing from each.
+type MembershipChunk struct {
+	Range                    KeyRange
+	SourceRows, DestRows     int
+	OnlyInSource, OnlyInDest int
+	// Bounds is the Range as shown, with masked key columns masked.
+	Bounds string
+}
+
+// membershipDialect is implemented by dialects that can hash the keys of a
+// table on the server, so a Bloom filter of them is built without the keys
+// being transferred. Like checksums, the hashes are only comparable between
+// databases of the same dialect.
+type membershipDialect interface {
+	// keyHashes are two expressions hashing the key of a row to
+	// non-negative integers below 2^32, from which the filter's bits are
+	// derived.
+	keyHashes(spec tableSpec) (string, string)
+}
+
+// compareMembership builds a Bloom filter of the primary keys of every
+// chunk on each database, chunked like checksums, and compares them. The
+// bits count how many distinct keys went into each filter and into their
+// union, so the keys on one database only are estimated without the rows,
+// or with Options.Checksum set to ChecksumClient even the keys, being
+// compared one by one. With ChecksumServer, the keys are hashed on the
+// server when both databases are of the same dialect and it can hash them.
+func compareMembership(ctx context.Context, databases *Databases, table *TableResult, config TableConfig, options Options) error {
+	spec, err := loadTableSpec(ctx, &databases.source, config, options)
+	if err != nil {
+		return err
+	}
+	spec.Columns = nil
+
+	ranges := []KeyRange{{}}
+	if size := chunkSize(config, options); size > 0 {
+		err := options.Retry.do(ctx, &databases.source, func() (err error) {
+			ranges, err = chunkRanges(ctx, &databases.source, spec, size)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, serverSide := databases.source.Dialect.(membershipDialect)
+	serverSide = serverSide && options.Checksum == ChecksumServer && databases.source.Dialect.Name() == databases.dest.Dialect.Name()
+	chunks := make([]MembershipChunk, len(ranges))
+	err = forEachRange(ctx, len(ranges), parallelism(config, options), func(ctx context.Context, i int) (err error) {
+		chunks[i], err = membershipChunk(ctx, databases, spec, ranges[i], serverSide, options)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		table.SourceRowCount += chunk.SourceRows
+		table.DestRowCount += chunk.DestRows
+		table.Chunks++
+		if chunk.OnlyInSource > 0 || chunk.OnlyInDest > 0 {
+			table.DifferingFilters = append(table.DifferingFilters, chunk)
+		}
+	}
+	return nil
+}
+
+// membershipChunk counts the chunk's rows on both databases, sizing the
+// filters both then build alike.
+func membershipChunk(ctx context.Context, databases *Databases, spec tableSpec, keyRange KeyRange, serverSide bool, options Options) (MembershipChunk, error) {
+	chunk := MembershipChunk{Range: keyRange, Bounds: spec.displayRange(keyRange)}
+	count := func(db *DB, spec tableSpec, rows *int) func() error {
+		return func() error {
+			return options.Retry.do(ctx, db, func() error {
+				predicate, args := spec.rangePredicate(db.Dialect, keyRange)
+				query := "SELECT COUNT(*) FROM " + spec.from(db.Dialect) + whereClause(predicate)
+				if err := db.DB.QueryRowContext(ctx, db.rebind(query), args...).Scan(rows); err != nil {
+					return db.wrap(err)
+				}
+				db.addScanned(*rows)
+				return nil
+			})
+		}
+	}
+	source, dest := &databases.source, &databases.dest
+	if err := bothSides(count(source, spec, &chunk.SourceRows), count(dest, spec.onDest(), &chunk.DestRows)); err != nil {
+		return chunk, err
+	}
+	if chunk.SourceRows == 0 && chunk.DestRows == 0 {
+		return chunk, nil
+	}
+
+	size := chunk.SourceRows
+	if chunk.DestRows > size {
+		size = chunk.DestRows
+	}
+	size *= membershipBitsPerKey
+	if size < minMembershipBits {
+		size = minMembershipBits
+	}
+	build := func(ctx context.Context, db *DB, spec tableSpec) (bloomFilter, error) {
+		if serverSide {
+			return bloomOnServer(ctx, db, spec, keyRange, size)
+		}
+		return bloomOnClient(ctx, db, spec, keyRange, size, options.BatchSize)
+	}
+	var sourceFilter, destFilter bloomFilter
+	err := bothSides(func() error {
+		return options.Retry.do(ctx, source, func() (err error) {
+			sourceFilter, err = build(ctx, source, spec)
+			return err
+		})
+	}, func() error {
+		return options.Retry.do(ctx, dest, func() (err error) {
+			destFilter, err = build(ctx, dest, spec.onDest())
+			return err
+		})
+	})
+	if err != nil {
+		return chunk, err
+	}
+	chunk.OnlyInSource, chunk.OnlyInDest = sourceFilter.missing(destFilter)
+	return chunk, nil
+}
+
+// bloomFilter is a Bloom filter of a chunk's keys, of size bits.
+type bloomFilter struct {
+	words []uint64
+	size  int
+}
+
+func newBloomFilter(size int) bloomFilter {
+	return bloomFilter{words: make([]uint64, (size+63)/64), size: size}
+}
+
+// add sets the key's bits, derived from its two hashes by double hashing.
+func (f bloomFilter) add(h1, h2 uint64) {
+	for i := uint64(0); i < membershipHashes; i++ {
+		f.set(int((h1 + i*h2) % uint64(f.size)))
+	}
+}
+
+func (f bloomFilter) set(bit int) {
+	f.words[bit/64] |= 1 << (bit % 64)
+}
+
+// cardinality estimates the distinct keys in a filter with set of its bits
+// set.
+func (f bloomFilter) cardinality(set int) float64 {
+	if set >= f.size {
+		set = f.size - 1
+	}
+	m := float64(f.size)
+	return -m / membershipHashes * math.Log(1-float64(set)/m)
+}
+
+// missing estimates the keys in f that aren't in other, and the other way
+// round, from the keys in the union of both. A bit set in one filter only
+// proves that a key is missing from the other, so neither estimate is
+// rounded down to zero then.
+func (f bloomFilter) missing(other bloomFilter) (onlyInF, onlyInOther int) {
+	var ownBits, otherBits, unionBits int
+	var ownOnly, otherOnly bool
+	for i, word := range f.words {
+		ownBits += bits.OnesCount64(word)
+		otherBits += bits.OnesCount64(other.words[i])
+		unionBits += bits.OnesCount64(word | other.words[i])
+		ownOnly = ownOnly || word&^other.words[i] != 0
+		otherOnly = otherOnly || other.words[i]&^word != 0
+	}
+	union := f.cardinality(unionBits)
+	estimate := func(present int, proven bool) int {
+		if !proven {
+			return 0
+		}
+		if n := round(union - f.cardinality(present)); n > 1 {
+			return n
+		}
+		return 1
+	}
+	return estimate(otherBits, ownOnly), estimate(ownBits, otherOnly)
+}
+
+// bloomOnClient streams the chunk's keys and hashes their canonical text
+// locally, which is independent of how each server renders them.
+func bloomOnClient(ctx context.Context, db *DB, spec tableSpec, keyRange KeyRange, size, batchSize int) (bloomFilter, error) {
+	filter := newBloomFilter(size)
+	cursor := newRowCursor(db, spec, keyRange, batchSize)
+	// the filter's retries wait for the throttle
+	cursor.throttled = false
+	for {
+		row, err := cursor.Next(ctx)
+		if err != nil {
+			return filter, err
+		}
+		if row == nil {
+			return filter, nil
+		}
+		hash := md5.New()
+		for _, value := range row[:len(spec.Key)] {
+			hash.Write([]byte(formatValue(value)))
+			hash.Write([]byte{0})
+		}
+		sum := hash.Sum(nil)
+		filter.add(uint64(binary.BigEndian.Uint32(sum)), uint64(binary.BigEndian.Uint32(sum[4:])))
+	}
+}
+
+// bloomOnServer has the database hash the chunk's keys and return the
+// distinct bits they set.
+func bloomOnServer(ctx context.Context, db *DB, spec tableSpec, keyRange KeyRange, size int) (bloomFilter, error) {
+	filter := newBloomFilter(size)
+	h1, h2 := db.Dialect.(membershipDialect).keyHashes(spec)
+	seeds := make([]string, membershipHashes)
+	for i := range seeds {
+		seeds[i] = fmt.Sprintf("SELECT %d AS i", i)
+	}
+	predicate, args := spec.rangePredicate(db.Dialect, keyRange)
+	query := fmt.Sprintf("SELECT DISTINCT MOD(h.h1 + s.i * h.h2, %d) FROM (SELECT %s AS h1, %s AS h2 FROM %s%s) h CROSS JOIN (%s) s",
+		size, h1, h2, spec.from(db.Dialect), whereClause(predicate), strings.Join(seeds, " UNION ALL "))
+	rows, err := db.DB.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return filter, db.wrap(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bit int
+		if err := rows.Scan(&bit); err != nil {
+			return filter, err
+		}
+		filter.set(bit)
+	}
+	return filter, rows.Err()
+}
+
+// MembershipEstimate adds up the keys estimated to be on one database only
+// in a membership comparison.
+func (t TableResult) MembershipEstimate() (onlyInSource, onlyInDest int) {
+	for _, chunk := range t.DifferingFilters {
+		onlyInSource += chunk.OnlyInSource
+		onlyInDest += chunk.OnlyInDest
+	}
+	return onlyInSource, onlyInDest
+}
@@ -0,0 +1,86 @@
+package dbdiff
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"strconv"
+	"testing"
+)
+
+func TestCompareMembership(t *testing.T) {
+	for _, test := range []struct {
+		name                     string
+		options                  Options
+		table                    TableConfig
+		chunks, differing        int
+		onlyInSource, onlyInDest int
+	}{
+		{"whole table", Options{}, TableConfig{Name: "orders"}, 1, 1, 2, 1},
+		{"chunks", Options{ChunkSize: 4}, TableConfig{Name: "orders"}, 3, 2, 2, 1},
+		{"where", Options{ChunkSize: 4}, TableConfig{Name: "orders", Where: "id >= 5"}, 2, 1, 0, 1},
+		// values aren't compared, only keys
+		{"changed rows only", Options{}, TableConfig{Name: "orders", Where: "id >= 5 AND id <= 10"}, 1, 0, 0, 0},
+		{"key", Options{}, TableConfig{Name: "events", Key: []string{"code"}}, 1, 0, 0, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.options.Mode, test.options.Checksum = ModeMembership, ChecksumClient
+			comparer := openFixtures(t, test.options)
+			result, err := comparer.CompareTable(context.Background(), test.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Chunks != test.chunks || len(result.DifferingFilters) != test.differing {
+				t.Errorf("%d of %d filters differ, want %d of %d", len(result.DifferingFilters), result.Chunks, test.differing, test.chunks)
+			}
+			// filters of so few keys are exact
+			onlyInSource, onlyInDest := result.MembershipEstimate()
+			if onlyInSource != test.onlyInSource || onlyInDest != test.onlyInDest {
+				t.Errorf("estimated %d and %d keys on one side only, want %d and %d", onlyInSource, onlyInDest, test.onlyInSource, test.onlyInDest)
+			}
+			if diff, _ := result.Drift(ModeMembership); diff != test.onlyInSource+test.onlyInDest {
+				t.Errorf("drift is %d, want %d", diff, test.onlyInSource+test.onlyInDest)
+			}
+		})
+	}
+}
+
+// filterOf builds a filter of the integer keys from, up to but not
+// including, to, hashed as bloomOnClient hashes them.
+func filterOf(size, from, to int) bloomFilter {
+	filter := newBloomFilter(size)
+	for key := from; key < to; key++ {
+		sum := md5.Sum([]byte(strconv.Itoa(key) + "\x00"))
+		filter.add(uint64(binary.BigEndian.Uint32(sum[:])), uint64(binary.BigEndian.Uint32(sum[4:])))
+	}
+	return filter
+}
+
+func TestBloomFilterMissing(t *testing.T) {
+	size := 10000 * membershipBitsPerKey
+	for _, test := range []struct {
+		name                     string
+		source, dest             bloomFilter
+		onlyInSource, onlyInDest int
+	}{
+		{"same keys", filterOf(size, 0, 10000), filterOf(size, 0, 10000), 0, 0},
+		{"missing on the destination", filterOf(size, 0, 10000), filterOf(size, 500, 10000), 500, 0},
+		{"missing on either", filterOf(size, 0, 9800), filterOf(size, 300, 10000), 300, 200},
+		{"empty destination", filterOf(size, 0, 1000), newBloomFilter(size), 1000, 0},
+		{"both empty", newBloomFilter(size), newBloomFilter(size), 0, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			onlyInSource, onlyInDest := test.source.missing(test.dest)
+			// the estimates are within a few percent
+			near := func(got, want int) bool {
+				return got >= want-want/20-1 && got <= want+want/20+1
+			}
+			if !near(onlyInSource, test.onlyInSource) || !near(onlyInDest, test.onlyInDest) {
+				t.Errorf("estimated %d and %d keys on one side only, want about %d and %d", onlyInSource, onlyInDest, test.onlyInSource, test.onlyInDest)
+			}
+			if (onlyInSource == 0) != (test.onlyInSource == 0) || (onlyInDest == 0) != (test.onlyInDest == 0) {
+				t.Errorf("estimated %d and %d keys on one side only, want none exactly when there are none", onlyInSource, onlyInDest)
+			}
+		})
+	}
+}
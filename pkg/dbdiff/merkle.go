@@ -0,0 +1,62 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+)
+
+// localizeChunk bisects a mismatched key range, re-checksumming each half on
+// both databases and descending only into halves that still differ. Once a
+// range holds at most leafSize rows on either side it is recorded and its rows
+// are compared directly to find the individual keys that differ.
+func localizeChunk(ctx context.Context, databases *Databases, spec tableSpec, chunk ChunkChecksum, options Options, table *TableResult) error {
+	// split on whichever side has more rows, so both halves are non-empty there
+	splitOn, splitSpec, rows := &databases.source, spec, chunk.SourceRows
+	if chunk.DestRows > rows {
+		splitOn, splitSpec, rows = &databases.dest, spec.onDest(), chunk.DestRows
+	}
+
+	if rows <= options.LeafSize {
+		table.DifferingRanges = append(table.DifferingRanges, chunk)
+		_, _, err := diffRange(ctx, databases, spec, chunk.Range, options.BatchSize, table, nil)
+		return err
+	}
+
+	middle, err := nthKey(ctx, splitOn, splitSpec, chunk.Range, rows/2)
+	if err != nil {
+		return err
+	}
+	for _, half := range []KeyRange{{chunk.Range.Lower, middle}, {middle, chunk.Range.Upper}} {
+		halfChunk, err := checksumChunk(ctx, databases, spec, half, options)
+		if err != nil {
+			return err
+		}
+		if halfChunk.matches() {
+			continue
+		}
+		if err := localizeChunk(ctx, databases, spec, halfChunk, options, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nthKey returns the key of the row at the given offset within a key range.
+func nthKey(ctx context.Context, db *DB, spec tableSpec, keyRange KeyRange, offset int) ([]interface{}, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s", spec.keyList(db.Dialect), spec.from(db.Dialect))
+	predicate, args := spec.rangePredicate(db.Dialect, keyRange)
+	if predicate != "" {
+		query += " WHERE " + predicate
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s", spec.keyTuple(db.Dialect), db.Dialect.Paginate(1, offset))
+
+	key := make([]interface{}, len(spec.Key))
+	pointers := make([]interface{}, len(key))
+	for i := range key {
+		pointers[i] = &key[i]
+	}
+	if err := db.DB.QueryRowContext(ctx, db.rebind(query), args...).Scan(pointers...); err != nil {
+		return nil, db.wrap(err)
+	}
+	return key, nil
+}
@@ -0,0 +1,344 @@
+package dbdiff
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MultiComparer compares more than two databases: a source against several
+// destinations, such as the regional replicas of a primary, or every pair of
+// a group of databases, such as the members of an active-active setup. It has
+// a Comparer for each pair compared.
+type MultiComparer struct {
+	// databases are all the databases, the first being the source that
+	// table configurations name tables on
+	databases []DB
+	comparers []*Comparer
+	// pairs are the indexes in databases each comparer compares
+	pairs   [][2]int
+	scanned *int64
+	tunnels []*sshTunnel
+}
+
+// MultiResult is a table compared between every pair.
+type MultiResult struct {
+	Name string
+	// Results are the comparisons of each pair, in the order of Comparers.
+	Results []TableResult
+}
+
+// OpenMulti connects to the source and every destination, and compares each
+// destination against the source. The connection settings of Options, such
+// as SourceTLS and DestConns, are taken from the endpoints instead.
+func OpenMulti(source Endpoint, dests []Endpoint, options Options) (*MultiComparer, error) {
+	databases, tunnels, err := openEndpoints(append([]Endpoint{source}, dests...), options)
+	if err != nil {
+		return nil, err
+	}
+	multi := NewMulti(databases[0], databases[1:], options)
+	multi.tunnels = tunnels
+	return multi, nil
+}
+
+// OpenPairwise connects to the databases and compares every pair of them,
+// each pair in the order the databases are given.
+func OpenPairwise(endpoints []Endpoint, options Options) (*MultiComparer, error) {
+	databases, tunnels, err := openEndpoints(endpoints, options)
+	if err != nil {
+		return nil, err
+	}
+	multi := NewPairwise(databases, options)
+	multi.tunnels = tunnels
+	return multi, nil
+}
+
+func openEndpoints(endpoints []Endpoint, options Options) ([]DB, []*sshTunnel, error) {
+	if len(endpoints) < 2 {
+		return nil, nil, errors.New("at least two databases are needed to compare")
+	}
+	var databases []DB
+	var tunnels []*sshTunnel
+	for _, endpoint := range endpoints {
+		db, tunnel, err := openEndpoint(endpoint, options)
+		if err != nil {
+			for _, db := range databases {
+				db.close()
+			}
+			for _, tunnel := range tunnels {
+				tunnel.Close()
+			}
+			return nil, nil, err
+		}
+		databases = append(databases, db)
+		if tunnel != nil {
+			tunnels = append(tunnels, tunnel)
+		}
+	}
+	return databases, tunnels, nil
+}
+
+// NewMulti returns a MultiComparer over already open databases, comparing
+// each destination against the source.
+func NewMulti(source DB, dests []DB, options Options) *MultiComparer {
+	pairs := make([][2]int, len(dests))
+	for i := range dests {
+		pairs[i] = [2]int{0, i + 1}
+	}
+	return newMultiComparer(append([]DB{source}, dests...), pairs, options)
+}
+
+// NewPairwise returns a MultiComparer over already open databases, comparing
+// every pair of them.
+func NewPairwise(databases []DB, options Options) *MultiComparer {
+	var pairs [][2]int
+	for i := range databases {
+		for j := i + 1; j < len(databases); j++ {
+			pairs = append(pairs, [2]int{i, j})
+		}
+	}
+	return newMultiComparer(databases, pairs, options)
+}
+
+func newMultiComparer(databases []DB, pairs [][2]int, options Options) *MultiComparer {
+	// the pairs hash masked values alike
+	options = options.withMaskKey()
+	scanned := new(int64)
+	log := options.sugar()
+	multi := &MultiComparer{pairs: pairs, scanned: scanned}
+	for _, db := range databases {
+		// the pairs' copies share the snapshot
+		db.log, db.scanned, db.snapshot = log.With("database", db.ServiceName), scanned, &snapshot{}
+		db.tracer = options.tracer()
+		multi.databases = append(multi.databases, db)
+	}
+	for _, pair := range pairs {
+		comparer := New(multi.databases[pair[0]], multi.databases[pair[1]], options)
+		comparer.scanned = scanned
+		comparer.databases.source.scanned, comparer.databases.dest.scanned = scanned, scanned
+		multi.comparers = append(multi.comparers, comparer)
+	}
+	return multi
+}
+
+// Comparers returns the comparer of each pair, in order, to set options or
+// check schemas on. Their Source and Dest are the pair's databases.
+func (m *MultiComparer) Comparers() []*Comparer {
+	return m.comparers
+}
+
+// Databases returns the names of all the databases, the source first.
+func (m *MultiComparer) Databases() []string {
+	names := make([]string, len(m.databases))
+	for i, db := range m.databases {
+		names[i] = db.ServiceName
+	}
+	return names
+}
+
+// RowsScanned is how many rows have been read from all the databases so far.
+func (m *MultiComparer) RowsScanned() int64 {
+	return atomic.LoadInt64(m.scanned)
+}
+
+// TakeSnapshots takes a snapshot on every database, like
+// Comparer.TakeSnapshots.
+func (m *MultiComparer) TakeSnapshots(ctx context.Context) error {
+	errs := make(chan error, len(m.databases))
+	for i := range m.databases {
+		go func(db *DB) { errs <- db.takeSnapshot(ctx) }(&m.databases[i])
+	}
+	var err error
+	for range m.databases {
+		if dbErr := <-errs; err == nil {
+			err = dbErr
+		}
+	}
+	return err
+}
+
+// ReleaseSnapshots ends the snapshot on every database, like
+// Comparer.ReleaseSnapshots.
+func (m *MultiComparer) ReleaseSnapshots() {
+	for i := range m.databases {
+		m.databases[i].releaseSnapshot()
+	}
+}
+
+// Close closes every database, and the snapshots and SSH tunnels on them.
+func (m *MultiComparer) Close() error {
+	var err error
+	m.ReleaseSnapshots()
+	for _, comparer := range m.comparers {
+		if fdwErr := comparer.closeFDW(); err == nil {
+			err = fdwErr
+		}
+	}
+	for _, db := range m.databases {
+		if dbErr := db.close(); err == nil {
+			err = dbErr
+		}
+	}
+	for _, tunnel := range m.tunnels {
+		if tunnelErr := tunnel.Close(); err == nil {
+			err = tunnelErr
+		}
+	}
+	return err
+}
+
+// CompareTable compares one table between every pair at once. In ModeCount
+// each database is only counted once, for all the pairs it's in.
+func (m *MultiComparer) CompareTable(ctx context.Context, config TableConfig) MultiResult {
+	result := MultiResult{Name: config.Name, Results: make([]TableResult, len(m.comparers))}
+	if m.comparers[0].Options.Mode == ModeCount {
+		m.compareCounts(ctx, config, result.Results)
+		return result
+	}
+	var wg sync.WaitGroup
+	for i, comparer := range m.comparers {
+		wg.Add(1)
+		go func(i int, comparer *Comparer) {
+			defer wg.Done()
+			// failures are kept in the result
+			result.Results[i], _ = comparer.CompareTable(ctx, config)
+		}(i, comparer)
+	}
+	wg.Wait()
+	return result
+}
+
+// CompareTables compares the tables on a pool of workers, like
+// Comparer.CompareTables.
+func (m *MultiComparer) CompareTables(ctx context.Context, tables []TableConfig, workers int) <-chan MultiResult {
+	results := make(chan MultiResult, len(tables))
+	go func() {
+		forEachTable(tables, workers, func(config TableConfig) {
+			results <- m.CompareTable(ctx, config)
+		})
+		close(results)
+	}()
+	return results
+}
+
+// compareCounts counts the table on every database concurrently. A pair
+// fails when counting failed on either of its databases.
+func (m *MultiComparer) compareCounts(ctx context.Context, config TableConfig, results []TableResult) {
+	// the options, and so how to count, are the same for every pair
+	first := m.comparers[0]
+	start := time.Now()
+	// one span for the table, since it's counted once on each database
+	ctx, span := first.startTable(ctx, config)
+	defer func() {
+		var err error
+		for i := range results {
+			if err = results[i].Err; err != nil {
+				break
+			}
+		}
+		endSpan(span, err)
+	}()
+	ctx, cancel := first.withTableTimeout(ctx, config)
+	defer cancel()
+	// the source may be read as of a time, the destinations as they are
+	onSource, err := first.readAsOf(config)
+	if err != nil {
+		for i, comparer := range m.comparers {
+			results[i] = comparer.newResult(config)
+			comparer.finish(&results[i], start, err)
+		}
+		return
+	}
+	// onSource in place of config on the source
+	asRead := func(i int) TableConfig {
+		if i == 0 {
+			return onSource
+		}
+		return config
+	}
+
+	// the pairs unchanged since their last comparison keep its result, and
+	// only the databases of the others are counted
+	activities := make([]string, len(m.databases))
+	skipped := make([]*TableResult, len(m.comparers))
+	counted := make([]bool, len(m.databases))
+	if first.canSkip(config) {
+		var wg sync.WaitGroup
+		for i := range m.databases {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				table := config
+				if i > 0 {
+					table = config.onDest()
+				}
+				activities[i] = first.tableActivity(ctx, &m.databases[i], table.Name)
+			}(i)
+		}
+		wg.Wait()
+	}
+	for i, comparer := range m.comparers {
+		source, dest := m.pairs[i][0], m.pairs[i][1]
+		if first.canSkip(config) {
+			table := comparer.newResult(config)
+			table.SourceActivity, table.DestActivity = activities[source], activities[dest]
+			skipped[i] = comparer.unchanged(table, config, start)
+		}
+		if skipped[i] == nil {
+			counted[source], counted[dest] = true, true
+		}
+	}
+
+	counts := make([]int, len(m.databases))
+	partitions := make([]map[string]int, len(m.databases))
+	errs := make([]error, len(m.databases))
+	var wg sync.WaitGroup
+	for i := range m.databases {
+		if !counted[i] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			db, table := &m.databases[i], onSource
+			if i > 0 {
+				table = config.onDest()
+			}
+			if errs[i] = db.checkSystemTable(table.Name); errs[i] != nil {
+				return
+			}
+			errs[i] = first.Options.Retry.do(ctx, db, func() (err error) {
+				counts[i], partitions[i], err = first.countRows(ctx, db, table)
+				return err
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, comparer := range m.comparers {
+		if skipped[i] != nil {
+			results[i] = *skipped[i]
+			continue
+		}
+		source, dest := m.pairs[i][0], m.pairs[i][1]
+		table := comparer.newResult(config)
+		table.SourceActivity, table.DestActivity = activities[source], activities[dest]
+		table.SourceRowCount, table.DestRowCount = counts[source], counts[dest]
+		table.Partitions = partitionCounts(partitions[source], partitions[dest])
+		table.Approximate = first.canEstimate(&m.databases[source], asRead(source)) || first.canEstimate(&m.databases[dest], asRead(dest))
+		err := errs[source]
+		if err == nil {
+			err = errs[dest]
+		}
+		if err == nil {
+			err = comparer.readRefreshes(ctx, &table, config)
+		}
+		if err == nil {
+			comparer.findExamples(ctx, &table, asRead(source))
+		}
+		comparer.finish(&table, start, err)
+		results[i] = table
+	}
+}
@@ -0,0 +1,217 @@
+package dbdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization are the rules column values are normalized by before row
+// comparisons and client-side checksums compare them, so that differences in
+// how engines store the same data don't show up as mismatches. Keys are
+// compared as they are.
+type Normalization struct {
+	// SourceTimeZone and DestTimeZone are the zones the timestamps of each
+	// database's columns without a time zone are in, as described by the
+	// source's schema. They're compared as the instants they stand for, so
+	// a naive local timestamp matches the same moment stored in UTC. Nil
+	// leaves them as the driver read them.
+	SourceTimeZone, DestTimeZone *time.Location
+	// FloatEpsilon is how far numbers may differ and still match. Client-side
+	// checksums round them to a multiple of it instead, so numbers close to
+	// a rounding boundary may still differ there.
+	FloatEpsilon float64
+	// TrimTrailingSpace ignores whitespace at the end of text, such as the
+	// padding of CHAR columns.
+	TrimTrailingSpace bool
+	// IgnoreCase compares text case-insensitively.
+	IgnoreCase bool
+	// SortJSONKeys compares text holding JSON objects regardless of the
+	// order and spacing of their keys.
+	SortJSONKeys bool
+	// UnicodeForm is the Unicode normalization form text is compared in,
+	// NFC, NFD, NFKC or NFKD, so that a character stored precomposed on one
+	// database matches it stored decomposed on the other.
+	UnicodeForm string
+	// Collation is the BCP 47 language tag, such as de or en-u-ks-level2,
+	// whose collation text is compared under: values it sorts as equal
+	// match whatever their bytes. The tag's ks key sets the strength, such
+	// as level2 to ignore case too, or level1 accents as well.
+	Collation string
+}
+
+// unicodeForms are the forms UnicodeForm may name.
+var unicodeForms = map[string]norm.Form{"NFC": norm.NFC, "NFD": norm.NFD, "NFKC": norm.NFKC, "NFKD": norm.NFKD}
+
+// set reports whether any rule is.
+func (n Normalization) set() bool {
+	return n != Normalization{}
+}
+
+// Validate checks UnicodeForm and Collation.
+func (n Normalization) Validate() error {
+	if _, ok := unicodeForms[n.UnicodeForm]; n.UnicodeForm != "" && !ok {
+		return fmt.Errorf("unknown Unicode normalization form %q, expected NFC, NFD, NFKC or NFKD", n.UnicodeForm)
+	}
+	if n.Collation != "" {
+		if _, err := language.Parse(n.Collation); err != nil {
+			return fmt.Errorf("collation %q: %w", n.Collation, err)
+		}
+	}
+	return nil
+}
+
+// rowsEqual compares two rows as selected by selectList column by column,
+// after normalizing them. Their keys have already been found equal.
+func (t tableSpec) rowsEqual(sourceRow, destRow []interface{}) bool {
+	for i := range t.Columns {
+		if !t.columnEqual(i, sourceRow[len(t.Key)+i], destRow[len(t.Key)+i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// columnEqual compares the values of the i-th column read from the source
+// and the destination.
+func (t tableSpec) columnEqual(i int, source, dest interface{}) bool {
+	n := t.Normalize
+	if !n.set() {
+		return formatValue(source) == formatValue(dest)
+	}
+	x, y := n.format(source, t.Columns[i].DataType, false), n.format(dest, t.Columns[i].DataType, true)
+	if x == y {
+		return true
+	}
+	if n.FloatEpsilon > 0 {
+		a, aErr := strconv.ParseFloat(x, 64)
+		b, bErr := strconv.ParseFloat(y, 64)
+		return aErr == nil && bErr == nil && math.Abs(a-b) <= n.FloatEpsilon
+	}
+	return false
+}
+
+// hashValue renders the i-th value of a row as selected by selectList for a
+// client-side checksum, normalized unless it's part of the key.
+func (t tableSpec) hashValue(i int, value interface{}) string {
+	if i < len(t.Key) || !t.Normalize.set() {
+		return formatValue(value)
+	}
+	column := t.Columns[i-len(t.Key)]
+	formatted := t.Normalize.format(value, column.DataType, t.Dest)
+	if t.Normalize.FloatEpsilon > 0 {
+		if f, err := strconv.ParseFloat(formatted, 64); err == nil {
+			rounded := math.Round(f/t.Normalize.FloatEpsilon) * t.Normalize.FloatEpsilon
+			return strconv.FormatFloat(rounded, 'g', -1, 64)
+		}
+	}
+	return formatted
+}
+
+// format renders a value of a column of the given type, read from the
+// destination when dest is set, with the rules applied except FloatEpsilon,
+// which needs both values.
+func (n Normalization) format(value interface{}, dataType string, dest bool) string {
+	zone := n.SourceTimeZone
+	if dest {
+		zone = n.DestTimeZone
+	}
+	if t, ok := value.(time.Time); ok && zone != nil && withoutTimeZone(dataType) {
+		value = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone)
+	}
+	formatted := formatValue(value)
+	switch value.(type) {
+	case string, []byte:
+	default:
+		return formatted
+	}
+	if n.SortJSONKeys {
+		formatted = sortJSONKeys(formatted)
+	}
+	if n.TrimTrailingSpace {
+		formatted = strings.TrimRightFunc(formatted, unicode.IsSpace)
+	}
+	if n.IgnoreCase {
+		formatted = strings.ToLower(formatted)
+	}
+	if form, ok := unicodeForms[n.UnicodeForm]; ok {
+		formatted = form.String(formatted)
+	}
+	if n.Collation != "" {
+		formatted = collationKey(n.Collation, formatted)
+	}
+	return formatted
+}
+
+// collators pools the collators of every tag, which can't be shared between
+// goroutines, along with the buffer each writes its keys to.
+var collators sync.Map
+
+type pooledCollator struct {
+	collator *collate.Collator
+	buffer   collate.Buffer
+}
+
+// collationKey renders text as its key under the tag's collation, which is
+// equal for the texts the collation sorts as equal, and so both compares and
+// hashes them.
+func collationKey(tag, text string) string {
+	pool, _ := collators.LoadOrStore(tag, &sync.Pool{New: func() interface{} {
+		return &pooledCollator{collator: collate.New(language.Make(tag))}
+	}})
+	c := pool.(*sync.Pool).Get().(*pooledCollator)
+	defer pool.(*sync.Pool).Put(c)
+	key := string(c.collator.KeyFromString(&c.buffer, text))
+	c.buffer.Reset()
+	return key
+}
+
+// withoutTimeZone reports whether columns of the type hold timestamps
+// without a time zone.
+func withoutTimeZone(dataType string) bool {
+	dataType = strings.ToLower(dataType)
+	if strings.Contains(dataType, "without time zone") {
+		return true
+	}
+	if i := strings.Index(dataType, "("); i >= 0 {
+		dataType = dataType[:i]
+	}
+	switch dataType {
+	case "timestamp", "datetime", "datetime2", "smalldatetime", "timestamp_ntz":
+		return true
+	}
+	return false
+}
+
+// sortJSONKeys re-encodes text holding a JSON object or array with its keys
+// sorted and without spacing, leaving other text as it is.
+func sortJSONKeys(text string) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return text
+	}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	// keep numbers exactly as written
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil || decoder.More() {
+		return text
+	}
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(decoded); err != nil {
+		return text
+	}
+	return strings.TrimSuffix(encoded.String(), "\n")
+}
@@ -0,0 +1,72 @@
+package dbdiff
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestColumnEqual(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	naive := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name         string
+		normalize    Normalization
+		dataType     string
+		source, dest interface{}
+		want         bool
+	}{
+		{"no rules", Normalization{}, "text", "abc", "abc", true},
+		{"no rules on trailing space", Normalization{}, "text", "abc", "abc  ", false},
+		{"trailing space", Normalization{TrimTrailingSpace: true}, "character", []byte("abc"), "abc  ", true},
+		{"leading space", Normalization{TrimTrailingSpace: true}, "text", "abc", " abc", false},
+		{"case", Normalization{IgnoreCase: true}, "text", "ABC", "abc", true},
+		{"json keys", Normalization{SortJSONKeys: true}, "jsonb", `{"b": 1, "a": [2, {"d": 3, "c": 4}]}`, `{"a":[2,{"c":4,"d":3}],"b":1}`, true},
+		{"json numbers as written", Normalization{SortJSONKeys: true}, "json", `{"a": 1.0}`, `{"a": 1}`, false},
+		{"not json", Normalization{SortJSONKeys: true}, "text", `{not json`, `{not json`, true},
+		{"within epsilon", Normalization{FloatEpsilon: 0.01}, "double precision", 1.0, 1.005, true},
+		{"past epsilon", Normalization{FloatEpsilon: 0.01}, "double precision", 1.0, 1.02, false},
+		{"epsilon on text", Normalization{FloatEpsilon: 0.01}, "text", "1.0", "1.005", true},
+		{"time zone", Normalization{SourceTimeZone: berlin, DestTimeZone: time.UTC}, "timestamp without time zone",
+			naive, naive.Add(-time.Hour), true},
+		{"time zone of a zoned column", Normalization{SourceTimeZone: berlin, DestTimeZone: time.UTC}, "timestamp with time zone",
+			naive, naive.Add(-time.Hour), false},
+		{"null", Normalization{IgnoreCase: true}, "text", nil, nil, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			spec := tableSpec{Columns: []tableColumn{{Name: "value", DataType: test.dataType}}, Normalize: test.normalize}
+			if got := spec.columnEqual(0, test.source, test.dest); got != test.want {
+				t.Errorf("%v and %v equal is %t, want %t", test.source, test.dest, got, test.want)
+			}
+		})
+	}
+}
+
+func TestWithoutTimeZone(t *testing.T) {
+	for dataType, want := range map[string]bool{
+		"timestamp without time zone": true,
+		"timestamp with time zone":    false,
+		"DATETIME2(7)":                true,
+		"datetimeoffset":              false,
+		"TIMESTAMP_NTZ":               true,
+		"TIMESTAMP_TZ":                false,
+		"date":                        false,
+	} {
+		if got := withoutTimeZone(dataType); got != want {
+			t.Errorf("%s is without a time zone: %t, want %t", dataType, got, want)
+		}
+	}
+}
+
+func TestCompareRowsNormalized(t *testing.T) {
+	// the total of 5 differs by less than the epsilon
+	comparer := openFixtures(t, Options{Mode: ModeRows, Normalize: Normalization{FloatEpsilon: 1000}})
+	result, err := comparer.CompareTable(context.Background(), TableConfig{Name: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{MissingInDest: "id=3,id=4", MissingInSource: "id=11", ValuesDiffer: "id=7"}
+	if got := differingKeys(result); !equalKeys(got, want) {
+		t.Errorf("differences are %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// parallelism is how many of the table's key ranges are compared at once,
+// the table's own setting taking precedence over Options.Parallelism.
+func parallelism(config TableConfig, options Options) int {
+	if config.Parallelism > 0 {
+		return config.Parallelism
+	}
+	return options.Parallelism
+}
+
+// chunkSize is the number of rows, or keys, per key range the table is
+// split into, its own setting taking precedence over Options.ChunkSize.
+func chunkSize(config TableConfig, options Options) int {
+	if config.ChunkSize > 0 {
+		return config.ChunkSize
+	}
+	return options.ChunkSize
+}
+
+// canCountInRanges reports whether the table may be counted a key range at a
+// time: it's counted with COUNT(*) rather than estimated or with its own
+// count, which needn't add up across ranges.
+func (c *Comparer) canCountInRanges(db *DB, config TableConfig) bool {
+	return parallelism(config, c.Options) > 1 && !c.canEstimate(db, config) && config.Count == "" && config.CountQuery == ""
+}
+
+// countInRanges counts the table's rows a key range at a time, several at
+// once, and adds the counts up. Only a single integer key can be split
+// without reading the keys; other tables are counted as a whole.
+func (c *Comparer) countInRanges(ctx context.Context, db *DB, config TableConfig) (int, error) {
+	spec, err := loadTableSpec(ctx, db, config, c.Options)
+	if err != nil {
+		return 0, err
+	}
+	ranges, err := integerRanges(ctx, db, spec, parallelism(config, c.Options), chunkSize(config, c.Options))
+	if err != nil {
+		return 0, err
+	}
+	if ranges == nil {
+		c.log.Debugw("Counting the table as a whole, its key isn't a single integer", "table", config.Name, "database", db.ServiceName)
+		count := -1
+		if err := db.scanRow(ctx, countQuery(db.Dialect, config), &count); err != nil {
+			return count, db.wrap(err)
+		}
+		return count, nil
+	}
+
+	counts := make([]int, len(ranges))
+	err = forEachRange(ctx, len(ranges), parallelism(config, c.Options), func(ctx context.Context, i int) error {
+		predicate := integerRangePredicate(db.Dialect, spec, ranges[i])
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", spec.from(db.Dialect), predicate)
+		if err := db.scanRow(ctx, query, &counts[i]); err != nil {
+			return db.wrap(fmt.Errorf("range %s: %w", ranges[i], err))
+		}
+		return nil
+	})
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total, err
+}
+
+// integerRanges splits a table with a single integer key into ranges of
+// size keys each, or into parts ranges of equal width without a size,
+// between its lowest and highest keys. The first and last ranges are left
+// open, so that rows outside one database's span on the other are still
+// covered. It returns nil for other keys.
+func integerRanges(ctx context.Context, db *DB, spec tableSpec, parts, size int) ([]KeyRange, error) {
+	if len(spec.Key) != 1 || spec.Key[0].Kind != keyNumeric {
+		return nil, nil
+	}
+	key := db.Dialect.QuoteIdentifier(spec.Key[0].Name)
+	var lowest, highest interface{}
+	err := db.scanRow(ctx, fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s%s", key, key, spec.from(db.Dialect), whereClause(spec.Filter)),
+		&lowest, &highest)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	if lowest == nil {
+		return []KeyRange{{}}, nil
+	}
+	low, lowErr := strconv.ParseInt(formatValue(lowest), 10, 64)
+	high, highErr := strconv.ParseInt(formatValue(highest), 10, 64)
+	// decimal and floating point keys aren't split
+	if lowErr != nil || highErr != nil {
+		return nil, nil
+	}
+	width := int64(size)
+	if width <= 0 {
+		width = (high-low)/int64(parts) + 1
+	}
+	ranges := []KeyRange{{}}
+	// a boundary below the lowest key overflowed past the highest
+	for boundary := low + width; boundary <= high && boundary > low; boundary += width {
+		ranges[len(ranges)-1].Upper = []interface{}{boundary}
+		ranges = append(ranges, KeyRange{Lower: []interface{}{boundary}})
+	}
+	return ranges, nil
+}
+
+// integerRangePredicate restricts a query to a range of integerRanges and
+// the table's filter, with the bounds written as literals for scanRow,
+// which takes no arguments.
+func integerRangePredicate(d Dialect, spec tableSpec, r KeyRange) string {
+	key := d.QuoteIdentifier(spec.Key[0].Name)
+	predicate := "1 = 1"
+	if spec.Filter != "" {
+		predicate = "(" + spec.Filter + ")"
+	}
+	if r.Lower != nil {
+		predicate += fmt.Sprintf(" AND %s >= %d", key, r.Lower[0])
+	}
+	if r.Upper != nil {
+		predicate += fmt.Sprintf(" AND %s < %d", key, r.Upper[0])
+	}
+	return predicate
+}
+
+// forEachRange calls compare for the ranges 0 to n-1, workers at a time,
+// returning the first error. The ranges not yet started are cancelled then.
+func forEachRange(ctx context.Context, n, workers int, compare func(ctx context.Context, i int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var first error
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := compare(ctx, i); err != nil {
+					once.Do(func() {
+						first = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if first == nil {
+		first = ctx.Err()
+	}
+	return first
+}
@@ -0,0 +1,208 @@
+package dbdiff
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+// parquetBatchSize is how many rows are read from a Parquet file at a time,
+// so that only they and the pages they're in are held in memory.
+const parquetBatchSize = 1024
+
+// parquetColumn is a column of a flat Parquet file's schema.
+type parquetColumn struct {
+	name string
+	kind parquet.Kind
+	// logical is the column's annotation, which older files' converted
+	// types are read as too
+	logical format.LogicalType
+}
+
+// loadParquet loads a Parquet file as the table, the key columns becoming
+// its primary key.
+func loadParquet(db *sqlx.DB, path, name string, key []string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	table, err := readParquet(file)
+	if err != nil {
+		return err
+	}
+	return table.load(db, name, key)
+}
+
+// readParquet reads a Parquet file's schema, its rows being read as the
+// table is loaded, a batch at a time. Only flat schemas are supported, of
+// columns without nesting or repetition, in any of the encodings and with
+// snappy, gzip, Brotli, zstd or LZ4 raw compression.
+func readParquet(file *os.File) (*fileTable, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	f, err := parquet.OpenFile(file, info.Size(), parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return nil, err
+	}
+	var columns []parquetColumn
+	table := &fileTable{}
+	for _, column := range f.Root().Columns() {
+		if !column.Leaf() || column.Repeated() {
+			return nil, fmt.Errorf("column %s is nested or repeated, only flat files are supported", column.Name())
+		}
+		c := parquetColumn{name: column.Name(), kind: column.Type().Kind()}
+		if logical := column.Type().LogicalType(); logical != nil {
+			c.logical = *logical
+		}
+		columns = append(columns, c)
+		table.columns = append(table.columns, fileColumn{name: c.name, kind: c.sqliteKind()})
+	}
+	table.stream = func(insert func(row []interface{}) error) error {
+		buffer := make([]parquet.Row, parquetBatchSize)
+		for _, group := range f.RowGroups() {
+			if err := readRowGroup(group, columns, buffer, insert); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return table, nil
+}
+
+// readRowGroup passes the row group's rows to insert, with nil for nulls.
+func readRowGroup(group parquet.RowGroup, columns []parquetColumn, buffer []parquet.Row, insert func(row []interface{}) error) error {
+	rows := group.Rows()
+	defer rows.Close()
+	for {
+		n, err := rows.ReadRows(buffer)
+		for _, row := range buffer[:n] {
+			values := make([]interface{}, len(columns))
+			for _, value := range row {
+				if i := value.Column(); i < len(columns) && !value.IsNull() {
+					values[i] = columns[i].convert(value)
+				}
+			}
+			if err := insert(values); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sqliteKind is the SQLite type the column is declared with, which
+// go-sqlite3 reads booleans and times back by. Decimals are kept as text so
+// that their scale survives.
+func (c parquetColumn) sqliteKind() string {
+	switch l := c.logical; {
+	case l.Date != nil:
+		return "DATE"
+	case l.Timestamp != nil, c.kind == parquet.Int96:
+		return "TIMESTAMP"
+	case l.Decimal != nil, l.Time != nil, l.UTF8 != nil, l.Enum != nil, l.Json != nil, l.UUID != nil:
+		return "TEXT"
+	}
+	switch c.kind {
+	case parquet.Boolean:
+		return "BOOLEAN"
+	case parquet.Int32, parquet.Int64:
+		return "INTEGER"
+	case parquet.Float, parquet.Double:
+		return "REAL"
+	}
+	return "BLOB"
+}
+
+// convert turns a value into what the column's annotation says it holds.
+func (c parquetColumn) convert(value parquet.Value) interface{} {
+	l := c.logical
+	switch c.kind {
+	case parquet.Boolean:
+		return value.Boolean()
+	case parquet.Int32, parquet.Int64:
+		v := value.Int64()
+		if c.kind == parquet.Int32 {
+			v = int64(value.Int32())
+		}
+		switch {
+		case l.Date != nil:
+			return time.Unix(v*86400, 0).UTC()
+		case l.Timestamp != nil:
+			return time.Unix(0, v*int64(parquetUnit(l.Timestamp.Unit))).UTC()
+		case l.Time != nil:
+			return time.Unix(0, v*int64(parquetUnit(l.Time.Unit))).UTC().Format("15:04:05.999999999")
+		case l.Decimal != nil:
+			return formatDecimal(big.NewInt(v), int64(l.Decimal.Scale))
+		case l.Integer != nil && !l.Integer.IsSigned && l.Integer.BitWidth <= 32:
+			return int64(uint32(v))
+		}
+		return v
+	case parquet.Int96:
+		// nanoseconds into the day, then the Julian day
+		v := value.Int96()
+		nanos := int64(v[1])<<32 | int64(v[0])
+		return time.Unix((int64(v[2])-2440588)*86400, nanos).UTC()
+	case parquet.Float:
+		return float64(value.Float())
+	case parquet.Double:
+		return value.Double()
+	}
+	// the bytes are only valid until the next batch is read
+	v := value.ByteArray()
+	switch {
+	case l.Decimal != nil:
+		// big-endian two's complement
+		unscaled := new(big.Int).SetBytes(v)
+		if len(v) > 0 && v[0]&0x80 != 0 {
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(v))*8))
+		}
+		return formatDecimal(unscaled, int64(l.Decimal.Scale))
+	case l.UUID != nil && len(v) == 16:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", v[:4], v[4:6], v[6:8], v[8:10], v[10:])
+	case c.sqliteKind() == "TEXT":
+		return string(v)
+	}
+	return append([]byte(nil), v...)
+}
+
+// parquetUnit is what a TIMESTAMP or TIME column counts in.
+func parquetUnit(unit format.TimeUnit) time.Duration {
+	switch {
+	case unit.Micros != nil:
+		return time.Microsecond
+	case unit.Nanos != nil:
+		return time.Nanosecond
+	}
+	return time.Millisecond
+}
+
+func formatDecimal(unscaled *big.Int, scale int64) string {
+	digits := new(big.Int).Abs(unscaled).String()
+	if scale <= 0 {
+		return unscaled.String()
+	}
+	if pad := int(scale) + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	point := len(digits) - int(scale)
+	formatted := digits[:point] + "." + digits[point:]
+	if unscaled.Sign() < 0 {
+		return "-" + formatted
+	}
+	return formatted
+}
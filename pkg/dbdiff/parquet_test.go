@@ -0,0 +1,287 @@
+package dbdiff
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+)
+
+// testOrder is an order as a Parquet file holds it, each column in another
+// encoding or with another codec: an id in the delta binary packed
+// encoding, an optional note in the delta length byte array one, a
+// dictionary encoded status, a customer in the delta byte array encoding, a
+// date, an optional decimal amount, a weight split into byte streams and a
+// boolean. A zero amount is written as a null.
+type testOrder struct {
+	ID        int64   `parquet:"id,delta"`
+	Note      *string `parquet:"note,optional,snappy"`
+	Status    string  `parquet:"status,dict,gzip"`
+	Customer  string  `parquet:"customer,delta,zstd"`
+	OrderedOn int32   `parquet:"ordered_on,date"`
+	Amount    int32   `parquet:"amount,optional,decimal(2:9)"`
+	Weight    float64 `parquet:"weight,split"`
+	Paid      bool    `parquet:"paid"`
+}
+
+// eventSchema has the columns annotated as times and UUIDs, and bytes,
+// which are in the order of their names.
+var eventSchema = parquet.NewSchema("event", parquet.Group{
+	"id":        parquet.Int(64),
+	"at":        parquet.Timestamp(parquet.Microsecond),
+	"logged_at": parquet.Leaf(parquet.Int96Type),
+	"ref":       parquet.UUID(),
+	"raw":       parquet.Leaf(parquet.ByteArrayType),
+})
+
+// writeTestParquet writes the rows to a Parquet file named orders.parquet.
+func writeTestParquet[T any](t *testing.T, rows []T, options ...parquet.WriterOption) string {
+	t.Helper()
+	return writeTestFile(t, func(file io.Writer) error {
+		w := parquet.NewGenericWriter[T](file, options...)
+		if _, err := w.Write(rows); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// writeTestParquetRows writes rows of the schema's required columns to a
+// Parquet file.
+func writeTestParquetRows(t *testing.T, schema *parquet.Schema, rows [][]interface{}, options ...parquet.WriterOption) string {
+	t.Helper()
+	return writeTestFile(t, func(file io.Writer) error {
+		w := parquet.NewWriter(file, append(options, schema)...)
+		for _, values := range rows {
+			row := make(parquet.Row, len(values))
+			for i, value := range values {
+				row[i] = parquet.ValueOf(value).Level(0, 0, i)
+			}
+			if _, err := w.WriteRows([]parquet.Row{row}); err != nil {
+				return err
+			}
+		}
+		return w.Close()
+	})
+}
+
+func writeTestFile(t *testing.T, write func(io.Writer) error) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "orders.parquet")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := write(file); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readTestParquet reads a Parquet file's columns and every row.
+func readTestParquet(t *testing.T, path string) ([]fileColumn, [][]interface{}) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	table, err := readParquet(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]interface{}
+	if err := table.stream(func(row []interface{}) error {
+		rows = append(rows, row)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return table.columns, rows
+}
+
+func stringPointer(s string) *string { return &s }
+
+// testOrders are three orders, the second with a null note and the third
+// with a null amount.
+var testOrders = []testOrder{
+	{1, stringPointer("first"), "shipped", "acme", 19723, 12345, 1.5, true},
+	{2, nil, "open", "acme corp", 19724, -5, 0.25, false},
+	{3, stringPointer("third"), "shipped", "bolt", 0, 0, -2, true},
+}
+
+func TestReadParquet(t *testing.T) {
+	wantColumns := []fileColumn{
+		{"id", "INTEGER"}, {"note", "TEXT"}, {"status", "TEXT"}, {"customer", "TEXT"},
+		{"ordered_on", "DATE"}, {"amount", "TEXT"}, {"weight", "REAL"}, {"paid", "BOOLEAN"},
+	}
+	wantRows := [][]interface{}{
+		{int64(1), "first", "shipped", "acme", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "123.45", 1.5, true},
+		{int64(2), nil, "open", "acme corp", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), "-0.05", 0.25, false},
+		{int64(3), "third", "shipped", "bolt", time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), nil, -2.0, true},
+	}
+	columns, rows := readTestParquet(t, writeTestParquet(t, testOrders))
+	if !reflect.DeepEqual(columns, wantColumns) {
+		t.Errorf("columns are %v, want %v", columns, wantColumns)
+	}
+	if !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("rows are %v, want %v", rows, wantRows)
+	}
+}
+
+// TestReadParquetTypes reads the events in both versions of data pages,
+// which parquet-go only writes readably for required columns.
+func TestReadParquetTypes(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 678000, time.UTC)
+	ref := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+	// nanoseconds into the day, then the Julian day
+	nanos := uint64(3*time.Hour + 4*time.Minute + 5*time.Second)
+	loggedAt := deprecated.Int96{uint32(nanos), uint32(nanos >> 32), 2440588 + 19724}
+	wantColumns := []fileColumn{{"at", "TIMESTAMP"}, {"id", "INTEGER"}, {"logged_at", "TIMESTAMP"}, {"raw", "BLOB"}, {"ref", "TEXT"}}
+	wantRows := [][]interface{}{{at, int64(1), at.Truncate(time.Second), []byte{0xff, 0x00}, "12345678-9abc-def0-1234-56789abcdef0"}}
+	for _, version := range []int{1, 2} {
+		path := writeTestParquetRows(t, eventSchema, [][]interface{}{{at.UnixMicro(), int64(1), loggedAt, []byte{0xff, 0x00}, ref}},
+			parquet.DataPageVersion(version))
+		columns, rows := readTestParquet(t, path)
+		if !reflect.DeepEqual(columns, wantColumns) {
+			t.Errorf("version %d pages: columns are %v, want %v", version, columns, wantColumns)
+		}
+		if !reflect.DeepEqual(rows, wantRows) {
+			t.Errorf("version %d pages: rows are %v, want %v", version, rows, wantRows)
+		}
+	}
+}
+
+// TestReadParquetBatches reads row groups of more rows than a batch.
+func TestReadParquetBatches(t *testing.T) {
+	orders := make([]testOrder, 2*parquetBatchSize+500)
+	for i := range orders {
+		orders[i] = testOrder{ID: int64(i + 1), Status: []string{"open", "shipped"}[i%2], Customer: "acme"}
+	}
+	_, rows := readTestParquet(t, writeTestParquet(t, orders, parquet.MaxRowsPerRowGroup(1000), parquet.PageBufferSize(4096)))
+	if len(rows) != len(orders) {
+		t.Fatalf("read %d rows, want %d", len(rows), len(orders))
+	}
+	for i, row := range rows {
+		if row[0] != int64(i+1) || row[2] != orders[i].Status {
+			t.Fatalf("row %d is %v, want order %d", i, row, i+1)
+		}
+	}
+}
+
+func TestReadParquetErrors(t *testing.T) {
+	type address struct {
+		City string `parquet:"city"`
+	}
+	for _, test := range []struct {
+		name string
+		path func(t *testing.T) string
+		err  string
+	}{
+		{"nested column", func(t *testing.T) string {
+			return writeTestParquet(t, []struct {
+				ID      int64   `parquet:"id"`
+				Address address `parquet:"address"`
+			}{{1, address{"Berlin"}}})
+		}, "column address is nested or repeated"},
+		{"repeated column", func(t *testing.T) string {
+			return writeTestParquet(t, []struct {
+				ID   int64    `parquet:"id"`
+				Tags []string `parquet:"tags"`
+			}{{1, []string{"new"}}})
+		}, "column tags is nested or repeated"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := os.Open(test.path(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			_, err = readParquet(file)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestReadParquetNotParquet(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"empty":     "",
+		"csv":       "id,name\n1,a\n",
+		"truncated": "PAR1\xff\xff\x00\x00PAR1",
+	} {
+		path := filepath.Join(dir, name+".parquet")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readParquet(file); err == nil {
+			t.Errorf("%s read as a Parquet file", name)
+		}
+		file.Close()
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	for _, test := range []struct {
+		unscaled int64
+		scale    int64
+		want     string
+	}{
+		{12345, 2, "123.45"},
+		{-5, 2, "-0.05"},
+		{5, 0, "5"},
+		{0, 3, "0.000"},
+		{-12300, 2, "-123.00"},
+	} {
+		if got := formatDecimal(big.NewInt(test.unscaled), test.scale); got != test.want {
+			t.Errorf("%d with scale %d formats as %s, want %s", test.unscaled, test.scale, got, test.want)
+		}
+	}
+}
+
+// TestCompareParquet compares a Parquet file against a CSV file of the same
+// orders but for a changed status.
+func TestCompareParquet(t *testing.T) {
+	parquet := writeTestParquet(t, testOrders)
+	csv := filepath.Join(t.TempDir(), "orders.csv")
+	data := "id,note,status,customer,ordered_on,amount,weight,paid\n" +
+		"1,first,shipped,acme,2024-01-01,123.45,1.5,true\n" +
+		"2,,open,acme corp,2024-01-02,-0.05,0.25,false\n" +
+		"3,third,open,bolt,1970-01-01,,-2,true\n"
+	if err := os.WriteFile(csv, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	comparer, err := Open("parquet", "parquet://"+parquet+"?key=id", "csv", "csv://"+csv+"?key=id", Options{Mode: ModeRows, BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer comparer.Close()
+	result, err := comparer.CompareTable(context.Background(), TableConfig{Name: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SourceRowCount != 3 || result.DestRowCount != 3 {
+		t.Errorf("read %d and %d rows, want 3 of each", result.SourceRowCount, result.DestRowCount)
+	}
+	if len(result.Differences) != 1 || result.Differences[0].Key != "id=3" {
+		t.Fatalf("differences are %+v, want only id=3's", result.Differences)
+	}
+	if columns := result.Differences[0].Columns; len(columns) != 1 || columns[0].Column != "status" {
+		t.Errorf("id=3 differs in %+v, want only its status", columns)
+	}
+}
@@ -0,0 +1,86 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// partitionDialect is implemented by dialects whose tables can be
+// declaratively partitioned. partitions returns the table's leaf partitions
+// in order, or none when it isn't partitioned.
+type partitionDialect interface {
+	partitions(ctx context.Context, db *DB, tableName string) ([]partition, error)
+}
+
+// partition is a leaf partition of a table and the FROM clause reading only
+// its rows.
+type partition struct {
+	Name, From string
+}
+
+// PartitionCount is a partition's row count on both databases, matched by
+// name. A partition missing on one database counts zero rows there.
+type PartitionCount struct {
+	Name                   string
+	SourceCount, DestCount int
+}
+
+// canCountPartitions reports whether a table's count may be broken down by
+// partition. Estimated tables, those with their own count and those read
+// through the engine's temporal query aren't.
+func (c *Comparer) canCountPartitions(db *DB, config TableConfig) bool {
+	_, ok := db.Dialect.(partitionDialect)
+	return ok && c.Options.Partitions && !c.canEstimate(db, config) && config.Count == "" && config.CountQuery == "" &&
+		config.temporalAt().IsZero()
+}
+
+// countRows counts the table's rows as getRowCount does, or partition by
+// partition with Options.Partitions, returning the partitions' counts too.
+// They're nil when the table isn't partitioned.
+func (c *Comparer) countRows(ctx context.Context, db *DB, config TableConfig) (int, map[string]int, error) {
+	if !c.canCountPartitions(db, config) {
+		count, err := c.getRowCount(ctx, db, config)
+		return count, nil, err
+	}
+	partitions, err := db.Dialect.(partitionDialect).partitions(ctx, db, config.Name)
+	if err != nil {
+		return 0, nil, db.wrap(err)
+	}
+	if len(partitions) == 0 {
+		count, err := c.getRowCount(ctx, db, config)
+		return count, nil, err
+	}
+	total, counts := 0, make(map[string]int, len(partitions))
+	for _, partition := range partitions {
+		count := 0
+		if err := db.scanRow(ctx, "SELECT COUNT(*) FROM "+partition.From+whereClause(config.Where), &count); err != nil {
+			return 0, nil, db.wrap(fmt.Errorf("partition %s: %w", partition.Name, err))
+		}
+		counts[partition.Name] += count
+		total += count
+	}
+	return total, counts, nil
+}
+
+// partitionCounts pairs up the partitions of both databases by name, in
+// order. Only tables partitioned on both are broken down, as there's nothing
+// to match the partitions of one with otherwise.
+func partitionCounts(source, dest map[string]int) []PartitionCount {
+	if source == nil || dest == nil {
+		return nil
+	}
+	var counts []PartitionCount
+	for name, count := range source {
+		counts = append(counts, PartitionCount{name, count, dest[name]})
+	}
+	for name, count := range dest {
+		if _, ok := source[name]; !ok {
+			counts = append(counts, PartitionCount{name, 0, count})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return compareKeyValues(keyNumeric, counts[i].Name, counts[j].Name) < 0
+	})
+	return counts
+}
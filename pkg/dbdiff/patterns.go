@@ -0,0 +1,96 @@
+package dbdiff
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// tablePattern matches table names against a glob such as imx_*, or against
+// a regular expression when written between slashes, as in /^imx_\d+$/.
+type tablePattern struct {
+	glob   string
+	regexp *regexp.Regexp
+}
+
+func parseTablePattern(pattern string) (tablePattern, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return tablePattern{}, err
+		}
+		return tablePattern{regexp: re}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return tablePattern{}, fmt.Errorf("%s: %w", pattern, err)
+	}
+	return tablePattern{glob: pattern}, nil
+}
+
+func (p tablePattern) matches(name string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(name)
+	}
+	matched, _ := path.Match(p.glob, name)
+	return matched
+}
+
+func (p tablePattern) String() string {
+	if p.regexp != nil {
+		return "/" + p.regexp.String() + "/"
+	}
+	return p.glob
+}
+
+// TablePatterns is a flag.Value collecting table patterns from repeated or
+// comma separated flags.
+type TablePatterns []tablePattern
+
+func (p *TablePatterns) String() string {
+	patterns := make([]string, len(*p))
+	for i, pattern := range *p {
+		patterns[i] = pattern.String()
+	}
+	return strings.Join(patterns, ",")
+}
+
+func (p *TablePatterns) Set(value string) error {
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		parsed, err := parseTablePattern(pattern)
+		if err != nil {
+			return err
+		}
+		*p = append(*p, parsed)
+	}
+	return nil
+}
+
+// Matches reports whether the name matches any of the patterns.
+func (p TablePatterns) Matches(name string) bool {
+	for _, pattern := range p {
+		if pattern.matches(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectTables keeps the tables matching any include pattern, or all of them
+// when there are none, and drops those matching an exclude pattern.
+func SelectTables(tables []TableConfig, include, exclude TablePatterns) []TableConfig {
+	var selected []TableConfig
+	for _, table := range tables {
+		if len(include) > 0 && !include.Matches(table.Name) {
+			continue
+		}
+		if exclude.Matches(table.Name) {
+			continue
+		}
+		selected = append(selected, table)
+	}
+	return selected
+}
@@ -0,0 +1,89 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Pool tunes the connections kept open to a database. The zero Pool keeps
+// database/sql's defaults.
+type Pool struct {
+	// MaxIdleConns keeps at most this many connections open while they're
+	// idle, zero keeping database/sql's two.
+	MaxIdleConns int
+	// ConnMaxLifetime closes connections once they're this old, and
+	// ConnMaxIdleTime once they've been idle this long, zero keeping them
+	// however long.
+	ConnMaxLifetime, ConnMaxIdleTime time.Duration
+	// Keepalive pings the idle connections this often, so that a proxy or
+	// NAT gateway doesn't drop them as idle, and those dropped anyway are
+	// found and closed before a query picks them. Zero doesn't ping.
+	Keepalive time.Duration
+}
+
+func (p Pool) apply(db *sqlx.DB) {
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// keepalive pings a database's idle connections until it's stopped, when
+// the database is closed.
+type keepalive struct {
+	stop chan struct{}
+	once sync.Once
+}
+
+func startKeepalive(db *sqlx.DB, interval time.Duration, log *zap.SugaredLogger) *keepalive {
+	k := &keepalive{stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-k.stop:
+				return
+			case <-ticker.C:
+				pingIdle(db.DB, interval, log)
+			}
+		}
+	}()
+	return k
+}
+
+func (k *keepalive) close() {
+	if k != nil {
+		k.once.Do(func() { close(k.stop) })
+	}
+}
+
+// pingIdle pings each of the connections idle now, holding them all so
+// that the same one isn't pinged twice. A dead connection fails the ping
+// and is closed by database/sql rather than put back.
+func pingIdle(db *sql.DB, timeout time.Duration, log *zap.SugaredLogger) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var conns []*sql.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for i := db.Stats().Idle; i > 0; i-- {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return
+		}
+		conns = append(conns, conn)
+		if err := conn.PingContext(ctx); err != nil {
+			log.Debugw("Closed a dead idle connection", "error", err)
+		}
+	}
+}
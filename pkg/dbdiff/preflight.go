@@ -0,0 +1,122 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DatabaseCheck is how a database fared in MultiComparer.Preflight.
+type DatabaseCheck struct {
+	Name, Engine string
+	// Latency is how long connecting and pinging took.
+	Latency time.Duration
+	// Encrypted reports whether the connection is over TLS, and is nil when
+	// the engine doesn't tell.
+	Encrypted *bool
+	// Err is why the database couldn't be reached, such as rejected
+	// credentials or a failed TLS handshake.
+	Err error
+}
+
+// TableCheck is how a table fared on one of the databases in
+// MultiComparer.Preflight.
+type TableCheck struct {
+	// Table is the table's configured name, and Name its name on the
+	// Database.
+	Table, Database, Name string
+	// EstimatedRows is the catalog's row count, or -1 when the engine keeps
+	// none.
+	EstimatedRows int
+	// Err is why the table can't be compared there, such as it missing or
+	// not being readable.
+	Err error
+}
+
+// encryptionDialect is implemented by dialects that tell whether a
+// connection is encrypted.
+type encryptionDialect interface {
+	encrypted(ctx context.Context, db *DB) (bool, error)
+}
+
+// Preflight checks that a comparison of the tables can run, without reading
+// their rows: that every database can be connected to, whether the
+// connections are encrypted, and that each table exists and can be read on
+// every database, along with its estimated size. With Options.AsOf, the
+// source's is the table it's read as of the time from, such as its history
+// table. Databases that can't be reached have their tables skipped. The
+// tables are checked on up to workers at once.
+func (m *MultiComparer) Preflight(ctx context.Context, tables []TableConfig, workers int) ([]DatabaseCheck, []TableCheck) {
+	databases := make([]DatabaseCheck, len(m.databases))
+	for i := range m.databases {
+		databases[i] = checkDatabase(ctx, &m.databases[i])
+	}
+
+	var mu sync.Mutex
+	var checks []TableCheck
+	forEachTable(tables, workers, func(config TableConfig) {
+		for i := range m.databases {
+			if databases[i].Err != nil {
+				continue
+			}
+			db := &m.databases[i]
+			table, err := m.comparers[0].readAsOf(config)
+			if i > 0 {
+				table, err = config.onDest(), nil
+			}
+			check := TableCheck{Database: db.ServiceName, Name: table.Name, EstimatedRows: -1, Err: err}
+			if err == nil {
+				check = checkTable(ctx, db, table.Name)
+			}
+			check.Table = config.Name
+			mu.Lock()
+			checks = append(checks, check)
+			mu.Unlock()
+		}
+	})
+	return databases, checks
+}
+
+func checkDatabase(ctx context.Context, db *DB) DatabaseCheck {
+	check := DatabaseCheck{Name: db.ServiceName, Engine: db.Dialect.Name()}
+	start := time.Now()
+	if err := db.DB.PingContext(ctx); err != nil {
+		check.Err = db.wrap(err)
+		return check
+	}
+	check.Latency = time.Since(start)
+	if dialect, ok := db.Dialect.(encryptionDialect); ok {
+		encrypted, err := dialect.encrypted(ctx, db)
+		if err != nil {
+			db.log.Warnw("Couldn't tell whether the connection is encrypted", "error", err)
+		} else {
+			check.Encrypted = &encrypted
+		}
+	}
+	return check
+}
+
+// checkTable selects none of the table's rows, which still needs the table
+// to exist and be readable.
+func checkTable(ctx context.Context, db *DB, name string) TableCheck {
+	check := TableCheck{Database: db.ServiceName, Name: name, EstimatedRows: -1}
+	if check.Err = db.checkSystemTable(name); check.Err != nil {
+		return check
+	}
+	rows, err := db.DB.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", quoteTable(db.Dialect, name)))
+	if err != nil {
+		check.Err = db.wrap(err)
+		return check
+	}
+	rows.Close()
+	if dialect, ok := db.Dialect.(estimatingDialect); ok {
+		count, err := dialect.estimateCount(ctx, db, name)
+		if err != nil {
+			db.log.Warnw("Couldn't estimate the table's size", "table", name, "error", err)
+		} else {
+			check.EstimatedRows = count
+		}
+	}
+	return check
+}
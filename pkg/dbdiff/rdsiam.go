@@ -0,0 +1,100 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/lib/pq"
+)
+
+// rdsIAM signs Amazon RDS IAM auth tokens for a database endpoint.
+type rdsIAM struct {
+	endpoint, region, user string
+	credentials            aws.CredentialsProvider
+}
+
+// newRDSIAM reads the endpoint and user to sign tokens for from a postgres://
+// URL, before it's pointed at any tunnel. The region is taken from the RDS
+// host name, or the AWS configuration for other names, such as a CNAME.
+// Credentials come from the AWS SDK's default chain: the environment, shared
+// config files or the instance's role.
+func newRDSIAM(conn string) (*rdsIAM, error) {
+	if _, ok := DialectFor(conn).(postgresDialect); !ok {
+		return nil, errors.New("RDS IAM authentication is only supported on PostgreSQL")
+	}
+	u, err := url.Parse(conn)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") || u.Hostname() == "" {
+		return nil, errors.New("RDS IAM authentication needs a postgres:// connection URL with a host")
+	}
+	if u.User.Username() == "" {
+		return nil, errors.New("RDS IAM authentication needs a user in the connection URL")
+	}
+	port := u.Port()
+	if port == "" {
+		port = postgresDialect{}.defaultPort()
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("AWS config: %w", err)
+	}
+	region := cfg.Region
+	// e.g. mydb.abcdefghijkl.eu-west-1.rds.amazonaws.com
+	if labels := strings.Split(u.Hostname(), "."); len(labels) >= 5 && labels[len(labels)-3] == "rds" {
+		region = labels[len(labels)-4]
+	}
+	if region == "" {
+		return nil, errors.New("no AWS region for RDS IAM authentication, set AWS_REGION")
+	}
+	return &rdsIAM{
+		endpoint:    net.JoinHostPort(u.Hostname(), port),
+		region:      region,
+		user:        u.User.Username(),
+		credentials: cfg.Credentials,
+	}, nil
+}
+
+// iamConnector connects with a new token every time, as each is only good
+// for 15 minutes while connections are opened throughout a long run.
+type iamConnector struct {
+	dsn string
+	iam *rdsIAM
+	pgx bool
+}
+
+func (c iamConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	token, err := auth.BuildAuthToken(ctx, c.iam.endpoint, c.iam.region, c.iam.user, c.iam.credentials)
+	if err != nil {
+		return nil, fmt.Errorf("RDS IAM token: %w", err)
+	}
+	dsn, err := setPostgresParams(c.dsn, map[string]string{"password": token})
+	if err != nil {
+		return nil, err
+	}
+	var connector driver.Connector
+	if c.pgx {
+		connector, err = stdlib.GetDefaultDriver().(driver.DriverContext).OpenConnector(dsn)
+	} else {
+		connector, err = pq.NewConnector(dsn)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c iamConnector) Driver() driver.Driver {
+	if c.pgx {
+		return stdlib.GetDefaultDriver()
+	}
+	return &pq.Driver{}
+}
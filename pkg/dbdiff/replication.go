@@ -0,0 +1,231 @@
+package dbdiff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// replicaPollInterval is how often a replica's replay position is checked
+// while waiting for it.
+const replicaPollInterval = 500 * time.Millisecond
+
+// ErrNotReplica is returned when waiting for a database that isn't
+// replaying another's changes.
+var ErrNotReplica = errors.New("not a streaming replica")
+
+// replicationDialect is implemented by dialects whose replicas report how
+// far they have replayed the primary's log.
+type replicationDialect interface {
+	// logPosition is the current position in the database's log, or the
+	// position replayed so far on a replica.
+	logPosition(ctx context.Context, db *DB) (string, error)
+	// replayedPast reports whether the replica has replayed the log up to
+	// the position, returning ErrNotReplica when it isn't a replica.
+	replayedPast(ctx context.Context, db *DB, position string) (bool, error)
+}
+
+// WaitForReplica records the source's current log position and waits for
+// the destination, a streaming replica of it, to replay past it, so that
+// changes committed on the source before the comparison started show up on
+// both. It gives up when ctx is done.
+func (c *Comparer) WaitForReplica(ctx context.Context) error {
+	return waitForReplay(ctx, &c.databases.source, []*DB{&c.databases.dest})
+}
+
+// WaitForReplicas waits for every destination to replay past the source's
+// current log position, like Comparer.WaitForReplica.
+func (m *MultiComparer) WaitForReplicas(ctx context.Context) error {
+	replicas := make([]*DB, len(m.databases)-1)
+	for i := range replicas {
+		replicas[i] = &m.databases[i+1]
+	}
+	return waitForReplay(ctx, &m.databases[0], replicas)
+}
+
+func waitForReplay(ctx context.Context, source *DB, replicas []*DB) error {
+	dialect, ok := source.Dialect.(replicationDialect)
+	if !ok {
+		return fmt.Errorf("%s: waiting for replicas isn't supported on %s", source.ServiceName, source.Dialect.Name())
+	}
+	position, err := dialect.logPosition(ctx, source)
+	if err != nil {
+		return source.wrap(err)
+	}
+	errs := make(chan error, len(replicas))
+	for _, replica := range replicas {
+		go func(replica *DB) { errs <- waitForReplica(ctx, replica, position) }(replica)
+	}
+	for range replicas {
+		if replicaErr := <-errs; err == nil {
+			err = replicaErr
+		}
+	}
+	return err
+}
+
+func waitForReplica(ctx context.Context, replica *DB, position string) error {
+	dialect, ok := replica.Dialect.(replicationDialect)
+	if !ok {
+		return fmt.Errorf("%s: waiting for replicas isn't supported on %s", replica.ServiceName, replica.Dialect.Name())
+	}
+	start := time.Now()
+	ticker := time.NewTicker(replicaPollInterval)
+	defer ticker.Stop()
+	for {
+		replayed, err := dialect.replayedPast(ctx, replica, position)
+		if err != nil {
+			return replica.wrap(err)
+		}
+		if replayed {
+			replica.log.Infow("Replica caught up", "position", position, "waited", time.Since(start).Round(time.Millisecond))
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return replica.wrap(fmt.Errorf("still behind %s after %s: %w", position, time.Since(start).Round(time.Second), ctx.Err()))
+		case <-ticker.C:
+		}
+	}
+}
+
+// How a destination replicates from the source, in ReplicationStatus.Kind.
+const (
+	ReplicationStreaming = "streaming"
+	ReplicationLogical   = "logical"
+)
+
+// ReplicationStatus is how far a destination replicating from the source is
+// behind it, telling drift explained by the lag from data that's lost.
+type ReplicationStatus struct {
+	Source, Dest string
+	// Kind is ReplicationStreaming for a standby of the source, and
+	// ReplicationLogical for a subscription to it.
+	Kind string
+	// Slot is the replication slot on the source the destination
+	// replicates through, if any.
+	Slot string
+	// Active reports whether the destination is connected to the source
+	// and receiving its changes.
+	Active bool
+	// LagBytes is how much of the source's log the destination has yet to
+	// replay, or the slot to confirm, or -1 when unknown.
+	LagBytes int64
+	// ReplayDelay is how far behind in time the destination's replay is,
+	// or -1 when unknown.
+	ReplayDelay time.Duration
+	// Err is why the status couldn't be read.
+	Err error
+}
+
+// Behind reports whether the destination may be missing changes of the
+// source: it has some to replay, or isn't receiving them.
+func (s ReplicationStatus) Behind() bool {
+	return s.Err == nil && (s.LagBytes > 0 || s.ReplayDelay > 0 || !s.Active)
+}
+
+// upstream is how a database replicates from another, as its dialect sees
+// it.
+type upstream struct {
+	kind, slot string
+	// position is the log position replayed so far, delay how long ago
+	// the last transaction replayed committed, -1 when unknown, and active
+	// whether changes are being received
+	position string
+	delay    time.Duration
+	active   bool
+}
+
+// replicationSlot is a replication slot's state on the database it's on.
+type replicationSlot struct {
+	active bool
+	// lag is how far the slot's consumer is behind the database's log,
+	// in bytes, and delay how far its replay is behind in time, -1 when
+	// unknown
+	lag   int64
+	delay time.Duration
+}
+
+// replicationStatusDialect is implemented by dialects that tell how one
+// database replicates from another.
+type replicationStatusDialect interface {
+	// upstreams lists how the database replicates from others, as a
+	// standby or through its subscriptions.
+	upstreams(ctx context.Context, db *DB) ([]upstream, error)
+	// slot reads the replication slot on the database, nil when it has
+	// none by that name.
+	slot(ctx context.Context, db *DB, name string) (*replicationSlot, error)
+	// logBehind is how many bytes the position is behind the database's
+	// log.
+	logBehind(ctx context.Context, db *DB, position string) (int64, error)
+}
+
+// Replication reads how far the destination is behind the source, when it
+// replicates from it: as a standby, taken for the source's whether or not
+// it streams through a slot, or through a subscription to one of the
+// source's slots. It returns nothing when the destination doesn't
+// replicate from the source, or the engines can't tell, and logs a warning
+// for every link behind, since the tables' drift may be its lag.
+func (c *Comparer) Replication(ctx context.Context) []ReplicationStatus {
+	source, dest := &c.databases.source, &c.databases.dest
+	sourceDialect, ok := source.Dialect.(replicationStatusDialect)
+	if !ok {
+		return nil
+	}
+	destDialect, ok := dest.Dialect.(replicationStatusDialect)
+	if !ok {
+		return nil
+	}
+	failed := func(err error) []ReplicationStatus {
+		c.log.Warnw("Couldn't read the replication status", "source", source.ServiceName, "dest", dest.ServiceName, "error", err)
+		return []ReplicationStatus{{Source: source.ServiceName, Dest: dest.ServiceName, LagBytes: -1, ReplayDelay: -1, Err: err}}
+	}
+	upstreams, err := destDialect.upstreams(ctx, dest)
+	if err != nil {
+		return failed(dest.wrap(err))
+	}
+	var statuses []ReplicationStatus
+	for _, link := range upstreams {
+		status := ReplicationStatus{
+			Source: source.ServiceName, Dest: dest.ServiceName, Kind: link.kind, Active: link.active,
+			LagBytes: -1, ReplayDelay: link.delay,
+		}
+		var slot *replicationSlot
+		if link.slot != "" {
+			if slot, err = sourceDialect.slot(ctx, source, link.slot); err != nil {
+				return failed(source.wrap(err))
+			}
+		}
+		switch {
+		case slot != nil:
+			status.Slot, status.Active, status.LagBytes = link.slot, slot.active, slot.lag
+			if slot.delay >= 0 {
+				status.ReplayDelay = slot.delay
+			}
+		case link.kind == ReplicationLogical:
+			// a subscription to another database
+			continue
+		case link.position != "":
+			if status.LagBytes, err = sourceDialect.logBehind(ctx, source, link.position); err != nil {
+				return failed(source.wrap(err))
+			}
+		}
+		if status.Behind() {
+			c.log.Warnw("The destination is behind the source, which may explain drift", "source", source.ServiceName, "dest", dest.ServiceName,
+				"replication", status.Kind, "slot", status.Slot, "active", status.Active, "lag_bytes", status.LagBytes, "replay_delay", status.ReplayDelay)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Replication reads how far every destination is behind its source, like
+// Comparer.Replication.
+func (m *MultiComparer) Replication(ctx context.Context) []ReplicationStatus {
+	var statuses []ReplicationStatus
+	for _, pair := range m.comparers {
+		statuses = append(statuses, pair.Replication(ctx)...)
+	}
+	return statuses
+}
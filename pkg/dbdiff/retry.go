@@ -0,0 +1,91 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Retry is how queries are retried after transient failures, such as a
+// dropped connection or a failover, before the table's comparison fails.
+// Queries acquire their connection from the pool, so a failure to connect is
+// retried along with them.
+type Retry struct {
+	// Retries is how many times a query is retried. Zero disables retries.
+	Retries int
+	// Backoff is the delay before the first retry, doubled for each one
+	// after it.
+	Backoff time.Duration
+	// Jitter randomizes each delay by up to this fraction of it, so
+	// comparisons failing together don't retry in lockstep.
+	Jitter float64
+}
+
+// transientErrors are messages of failures that may well succeed on retry.
+var transientErrors = []string{
+	"connection reset", "connection refused", "broken pipe", "bad connection",
+	"server closed", "terminating connection", "the database system is starting up",
+	"the database system is shutting down", "too many connections", "deadlock",
+	"try restarting transaction", "service unavailable", "backend error",
+}
+
+func transient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, pattern := range transientErrors {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// do runs the query until it succeeds, fails for good, or runs out of
+// retries, every attempt waiting for the database's throttle.
+func (r Retry) do(ctx context.Context, db *DB, query func() error) (err error) {
+	_, span := db.startQuery(ctx, "query "+db.ServiceName)
+	defer func() { endSpan(span, err) }()
+	delay := r.Backoff
+	for attempt := 0; ; attempt++ {
+		release, err := db.acquire(ctx)
+		if err != nil {
+			return db.wrap(err)
+		}
+		err = query()
+		release()
+		if err == nil || attempt >= r.Retries || !transient(err) {
+			span.SetAttributes(attribute.Int("databasediff.attempts", attempt+1))
+			return err
+		}
+
+		wait := delay
+		if r.Jitter > 0 {
+			wait += time.Duration(r.Jitter * (2*rand.Float64() - 1) * float64(delay))
+		}
+		db.log.Warnw("Retrying query", "in", wait, "attempt", attempt+1, "retries", r.Retries, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,705 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RowDifference is a single row that is missing on one side or whose column
+// values differ between the two databases.
+type RowDifference struct {
+	Kind string
+	Key  string
+	// Columns are the columns whose values differ, for ValuesDiffer.
+	Columns []ColumnDifference
+}
+
+// ColumnDifference is a column of a row whose value differs, with the value
+// on each database.
+type ColumnDifference struct {
+	Column       string
+	Source, Dest string
+}
+
+const (
+	MissingInDest   = "missing_in_dest"
+	MissingInSource = "missing_in_source"
+	ValuesDiffer    = "values_differ"
+)
+
+type keyKind int
+
+const (
+	keyOther keyKind = iota
+	keyNumeric
+	keyText
+)
+
+type keyColumn struct {
+	Name     string
+	Kind     keyKind
+	DataType string
+}
+
+type tableColumn struct {
+	Name     string
+	DataType string
+	// LargeObject is set on columns holding PostgreSQL large objects
+	LargeObject bool
+}
+
+// compareRows walks both tables ordered by primary key and merges the two
+// streams, recording rows that exist on only one side or differ in value.
+func compareRows(ctx context.Context, databases *Databases, table *TableResult, config TableConfig, options Options) error {
+	spec, err := loadTableSpec(ctx, &databases.source, config, options)
+	if err != nil {
+		return err
+	}
+	if options.Checkpoints == nil {
+		table.SourceRowCount, table.DestRowCount, err = diffRange(ctx, databases, spec, KeyRange{}, options.BatchSize, table, nil)
+		return err
+	}
+
+	var keyRange KeyRange
+	var sourceBefore, destBefore int
+	// a checkpoint of another key, which was since changed, doesn't apply
+	if checkpoint := options.Checkpoints.Checkpoint(table.Source, table.Dest, table.Name); checkpoint != nil && len(checkpoint.Next) == len(spec.Key) {
+		table.restore(*checkpoint)
+		keyRange.Lower, sourceBefore, destBefore = checkpoint.Next, checkpoint.SourceRows, checkpoint.DestRows
+		options.sugar().Infow("Resuming the rows comparison", "table", table.Name, "source", table.Source, "dest", table.Dest,
+			"from", spec.displayRange(keyRange), "source_rows", sourceBefore, "dest_rows", destBefore)
+	}
+	sourceRows, destRows, err := diffRange(ctx, databases, spec, keyRange, options.BatchSize, table, func(next []interface{}, sourceRows, destRows int) {
+		options.Checkpoints.SaveCheckpoint(table.Source, table.Dest, table.Name, table.checkpoint(next, sourceBefore+sourceRows, destBefore+destRows))
+	})
+	table.SourceRowCount, table.DestRowCount = sourceBefore+sourceRows, destBefore+destRows
+	return err
+}
+
+// diffRange merges a key range of both tables and records its differences on
+// the table, returning the number of rows scanned on each side. Checkpoint,
+// unless nil, is called after every batch with the key the range would
+// continue from.
+func diffRange(ctx context.Context, databases *Databases, spec tableSpec, keyRange KeyRange, batchSize int, table *TableResult,
+	checkpoint func(next []interface{}, sourceRows, destRows int)) (int, int, error) {
+	source := newRowCursor(&databases.source, spec, keyRange, batchSize)
+	dest := newRowCursor(&databases.dest, spec.onDest(), keyRange, batchSize)
+
+	sourceRow, err := source.Next(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	destRow, err := dest.Next(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	record := func(kind string, sourceRow, destRow []interface{}) {
+		keyed := sourceRow
+		if keyed == nil {
+			keyed = destRow
+		}
+		// past half the memory, differences are only counted, the rest
+		// being the batches'
+		if spec.Memory > 0 && table.kept >= spec.Memory/2 {
+			table.DroppedDifferences++
+			return
+		}
+		var columns []ColumnDifference
+		if kind == ValuesDiffer {
+			columns = spec.differingColumns(sourceRow, destRow)
+		}
+		table.addDifference(kind, spec.displayKey(keyed), columns)
+		if spec.Sync {
+			table.SyncStatements = append(table.SyncStatements, spec.syncStatement(databases.dest.Dialect, kind, sourceRow, destRow))
+			table.kept += int64(len(table.SyncStatements[len(table.SyncStatements)-1]))
+		}
+	}
+
+	checkpointed := 0
+	for sourceRow != nil || destRow != nil {
+		if scanned := source.scanned + dest.scanned; checkpoint != nil && scanned-checkpointed >= batchSize {
+			// every key before the lowest of the rows yet to be merged is
+			// done with on both sides
+			next := sourceRow
+			if next == nil || destRow != nil && compareKeys(spec.Key, destRow, sourceRow) < 0 {
+				next = destRow
+			}
+			// the rows yet to be merged don't count as scanned
+			sourceScanned, destScanned := source.scanned, dest.scanned
+			if sourceRow != nil {
+				sourceScanned--
+			}
+			if destRow != nil {
+				destScanned--
+			}
+			checkpoint(append([]interface{}(nil), next[:len(spec.Key)]...), sourceScanned, destScanned)
+			checkpointed = scanned
+		}
+
+		var cmp int
+		switch {
+		case sourceRow == nil:
+			cmp = 1
+		case destRow == nil:
+			cmp = -1
+		default:
+			cmp = compareKeys(spec.Key, sourceRow, destRow)
+		}
+
+		switch {
+		case cmp < 0:
+			record(MissingInDest, sourceRow, nil)
+			table.OnlyInSource++
+			if sourceRow, err = source.Next(ctx); err != nil {
+				return 0, 0, err
+			}
+		case cmp > 0:
+			record(MissingInSource, nil, destRow)
+			table.OnlyInDest++
+			if destRow, err = dest.Next(ctx); err != nil {
+				return 0, 0, err
+			}
+		default:
+			if !spec.rowsEqual(sourceRow, destRow) {
+				record(ValuesDiffer, sourceRow, destRow)
+				table.Mismatched++
+			}
+			if sourceRow, err = source.Next(ctx); err != nil {
+				return 0, 0, err
+			}
+			if destRow, err = dest.Next(ctx); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	return source.scanned, dest.scanned, nil
+}
+
+func (t *TableResult) addDifference(kind, key string, columns []ColumnDifference) {
+	difference := RowDifference{Kind: kind, Key: key, Columns: columns}
+	t.Differences = append(t.Differences, difference)
+	t.kept += difference.size()
+}
+
+// size is roughly the bytes the difference takes in memory.
+func (d RowDifference) size() int64 {
+	size := int64(64 + len(d.Kind) + len(d.Key))
+	for _, column := range d.Columns {
+		size += int64(48 + len(column.Column) + len(column.Source) + len(column.Dest))
+	}
+	return size
+}
+
+// differingColumns compares two rows as selected by selectList, the key
+// columns followed by every column, column by column.
+func (t tableSpec) differingColumns(sourceRow, destRow []interface{}) []ColumnDifference {
+	var columns []ColumnDifference
+	for i, column := range t.Columns {
+		source, dest := sourceRow[len(t.Key)+i], destRow[len(t.Key)+i]
+		if !t.columnEqual(i, source, dest) {
+			columns = append(columns, ColumnDifference{column.Name, t.formatMasked(column.Name, source), t.formatMasked(column.Name, dest)})
+		}
+	}
+	return columns
+}
+
+// tableSpec is the column layout and primary key of a table, read from the
+// source database and used to build queries against both sides.
+type tableSpec struct {
+	Name    string
+	Columns []tableColumn
+	Key     []keyColumn
+	// Filter is the configured WHERE condition, if any, and DestFilter
+	// the one on the destination, which differs when the source is read as
+	// of a time.
+	Filter, DestFilter string
+	// AsOf is when the source is read as of through the engine's temporal
+	// query, zero reading it now.
+	AsOf time.Time
+	// DestName is the table's name on the destination.
+	DestName string
+	// Dest is set on the spec for querying the destination.
+	Dest bool
+	// Sync records the statement repairing each differing row in
+	// TableResult.SyncStatements.
+	Sync bool
+	// Normalize are the rules values are compared by.
+	Normalize Normalization
+	// Memory is the bytes a rows comparison of the table may hold, with
+	// Options.MemoryLimit, zero leaving it unbounded.
+	Memory int64
+	// Mask are the rules the table's values are shown by, hashing under
+	// MaskKey.
+	Mask    Masking
+	MaskKey []byte
+	// HashBinaryOver is the size past which binary values are read as
+	// their hash, with Options.HashBinaryOver.
+	HashBinaryOver int64
+}
+
+// onDest returns the spec for querying the destination.
+func (t tableSpec) onDest() tableSpec {
+	t.Name, t.Filter, t.AsOf = t.DestName, t.DestFilter, time.Time{}
+	t.Dest = true
+	return t
+}
+
+func loadTableSpec(ctx context.Context, db *DB, config TableConfig, options Options) (tableSpec, error) {
+	tableName := config.Name
+	if !config.asOf.IsZero() && config.History != nil && config.History.Table != "" && len(config.Key) == 0 {
+		return tableSpec{}, fmt.Errorf("table %s: reading it from history table %s needs its key", config.onDest().Name, tableName)
+	}
+	columns, err := getColumns(ctx, db, tableName)
+	if err != nil {
+		return tableSpec{}, err
+	}
+	key, err := getPrimaryKey(ctx, db, tableName, columns, config.Key)
+	if err != nil {
+		return tableSpec{}, err
+	}
+	if columns, err = excludeColumns(columns, config.ExcludeColumns); err != nil {
+		return tableSpec{}, db.wrap(fmt.Errorf("table %s: %w", tableName, err))
+	}
+	if len(config.LargeObjects) > 0 && options.SyncSQL {
+		return tableSpec{}, fmt.Errorf("table %s: large objects can't be repaired by sync statements", tableName)
+	}
+	// inserted rows would lack the excluded columns, left to their defaults
+	if len(config.ExcludeColumns) > 0 && options.SyncSQL {
+		return tableSpec{}, fmt.Errorf("table %s: tables with excluded columns can't be repaired by sync statements", tableName)
+	}
+	if err := markLargeObjects(db, columns, config.LargeObjects); err != nil {
+		return tableSpec{}, db.wrap(fmt.Errorf("table %s: %w", tableName, err))
+	}
+	dest := config.onDest()
+	return tableSpec{Name: tableName, Columns: columns, Key: key, Filter: config.Where, DestFilter: dest.Where, AsOf: config.temporalAt(), DestName: dest.Name,
+		Sync: options.SyncSQL, Normalize: options.Normalize, Memory: options.MemoryLimit, Mask: options.Mask.merge(config.Mask), MaskKey: options.MaskKey,
+		HashBinaryOver: options.HashBinaryOver}, nil
+}
+
+// excludeColumns drops the excluded columns, matched case-insensitively. Key
+// columns are still compared as part of the key.
+func excludeColumns(columns []tableColumn, excluded []string) ([]tableColumn, error) {
+	if len(excluded) == 0 {
+		return columns, nil
+	}
+	var kept []tableColumn
+	found := make([]bool, len(excluded))
+	for _, column := range columns {
+		keep := true
+		for i, name := range excluded {
+			if strings.EqualFold(column.Name, name) {
+				keep, found[i] = false, true
+			}
+		}
+		if keep {
+			kept = append(kept, column)
+		}
+	}
+	for i, name := range excluded {
+		if !found[i] {
+			return nil, fmt.Errorf("no column %s to exclude", name)
+		}
+	}
+	return kept, nil
+}
+
+func getColumns(ctx context.Context, db *DB, tableName string) ([]tableColumn, error) {
+	definitions, err := db.Dialect.Columns(ctx, db, tableName)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	if len(definitions) == 0 {
+		return nil, db.wrap(fmt.Errorf("%w: %s", ErrTableNotFound, tableName))
+	}
+	columns := make([]tableColumn, len(definitions))
+	for i, definition := range definitions {
+		columns[i] = tableColumn{Name: definition.Name, DataType: definition.DataType}
+	}
+	return columns, nil
+}
+
+// getPrimaryKey returns the table's primary key, or the configured key
+// columns in its place, matched case-insensitively.
+func getPrimaryKey(ctx context.Context, db *DB, tableName string, columns []tableColumn, configured []string) ([]keyColumn, error) {
+	if len(configured) > 0 {
+		keyColumns := make([]keyColumn, len(configured))
+		for i, name := range configured {
+			found := false
+			for _, column := range columns {
+				if strings.EqualFold(column.Name, name) {
+					keyColumns[i] = keyColumn{Name: column.Name, Kind: keyKindOf(column.DataType), DataType: column.DataType}
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, db.wrap(fmt.Errorf("table %s has no key column %s", tableName, name))
+			}
+		}
+		return keyColumns, nil
+	}
+
+	names, err := db.Dialect.PrimaryKey(ctx, db, tableName)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	if len(names) == 0 {
+		return nil, db.wrap(fmt.Errorf("table %s has no primary key, configure its key columns", tableName))
+	}
+
+	dataTypes := make(map[string]string, len(columns))
+	for _, column := range columns {
+		dataTypes[column.Name] = column.DataType
+	}
+	keyColumns := make([]keyColumn, len(names))
+	for i, name := range names {
+		keyColumns[i] = keyColumn{Name: name, Kind: keyKindOf(dataTypes[name]), DataType: dataTypes[name]}
+	}
+	return keyColumns, nil
+}
+
+func keyKindOf(dataType string) keyKind {
+	switch strings.ToLower(dataType) {
+	case "smallint", "integer", "bigint", "numeric", "decimal", "real", "double precision",
+		"tinyint", "mediumint", "int", "float", "double", "money", "smallmoney",
+		"int8", "int16", "int32", "int64", "uint8", "uint16", "uint32", "uint64", "float32", "float64",
+		"number", "bignumeric", "binary_float", "binary_double":
+		return keyNumeric
+	case "text", "character varying", "character", "name",
+		"varchar", "char", "tinytext", "mediumtext", "longtext", "nvarchar", "nchar", "ntext",
+		"string", "fixedstring", "varchar2", "nvarchar2":
+		return keyText
+	}
+	return keyOther
+}
+
+func (t tableSpec) from(d Dialect) string {
+	return tableAt(d, t.Name, t.AsOf)
+}
+
+func (t tableSpec) keyList(d Dialect) string {
+	names := make([]string, len(t.Key))
+	for i, key := range t.Key {
+		names[i] = d.QuoteIdentifier(key.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// selectList selects the key columns first, followed by every column, so
+// rows can be ordered and keyed by their leading values. Large values may be
+// selected as their hash, see columnExpression.
+func (t tableSpec) selectList(d Dialect) string {
+	selected := []string{t.keyList(d)}
+	for _, column := range t.Columns {
+		selected = append(selected, t.columnExpression(d, column))
+	}
+	return strings.Join(selected, ", ")
+}
+
+// orderedKey is the key columns ordered byte-wise so the client-side merge
+// agrees with the database regardless of either side's collation.
+func (t tableSpec) orderedKey(d Dialect) []string {
+	ordered := make([]string, len(t.Key))
+	for i, key := range t.Key {
+		ordered[i] = d.OrderKey(d.QuoteIdentifier(key.Name), key.Kind)
+	}
+	return ordered
+}
+
+func (t tableSpec) keyTuple(d Dialect) string {
+	return strings.Join(t.orderedKey(d), ", ")
+}
+
+// keyPredicate compares the key against the given values using ? placeholders.
+func (t tableSpec) keyPredicate(d Dialect, op string, values []interface{}) (string, []interface{}) {
+	return d.KeyPredicate(t.orderedKey(d), op, values)
+}
+
+// rangePredicate restricts a query to the key range and the table's filter
+// using ? placeholders. It returns an empty predicate for an unbounded range
+// of an unfiltered table.
+func (t tableSpec) rangePredicate(d Dialect, r KeyRange) (string, []interface{}) {
+	var predicates []string
+	var args []interface{}
+	if t.Filter != "" {
+		predicates = append(predicates, "("+t.Filter+")")
+	}
+	if r.Lower != nil {
+		predicate, lowerArgs := t.keyPredicate(d, ">=", r.Lower)
+		predicates = append(predicates, predicate)
+		args = append(args, lowerArgs...)
+	}
+	if r.Upper != nil {
+		predicate, upperArgs := t.keyPredicate(d, "<", r.Upper)
+		predicates = append(predicates, predicate)
+		args = append(args, upperArgs...)
+	}
+	return strings.Join(predicates, " AND "), args
+}
+
+// KeyRange is a half-open range of primary key values: Lower is inclusive,
+// Upper exclusive, and a nil bound is unbounded.
+type KeyRange struct {
+	Lower, Upper []interface{}
+}
+
+// String renders the range with its bounds as they are, masked or not; the
+// chunks of a result carry them masked in their Bounds.
+func (r KeyRange) String() string {
+	return r.format(func(_ int, value interface{}) string { return formatValue(value) })
+}
+
+// format renders the range with each bound's values formatted by their
+// position in the key.
+func (r KeyRange) format(formatKey func(i int, value interface{}) string) string {
+	bound := func(values []interface{}, unbounded string) string {
+		if values == nil {
+			return unbounded
+		}
+		formatted := make([]string, len(values))
+		for i, value := range values {
+			formatted[i] = formatKey(i, value)
+		}
+		return "(" + strings.Join(formatted, ", ") + ")"
+	}
+	return "[" + bound(r.Lower, "-inf") + ", " + bound(r.Upper, "+inf") + ")"
+}
+
+// rowCursor streams a key range of a table in primary key order, one
+// keyset-paginated batch at a time.
+type rowCursor struct {
+	db        *DB
+	spec      tableSpec
+	keyRange  KeyRange
+	batchSize int
+	batch     [][]interface{}
+	pos       int
+	lastKey   []interface{}
+	done      bool
+	scanned   int
+	// limit is the rows fetched in the next batch, at most batchSize, and
+	// fewer when that many would take more than a quarter of spec.Memory
+	limit int
+	// throttled has every batch wait for the database's throttle, unless
+	// the query reading the cursor already does
+	throttled bool
+}
+
+// probeRows is the first batch fetched with a memory limit, before the rows'
+// size is known.
+const probeRows = 100
+
+func newRowCursor(db *DB, spec tableSpec, keyRange KeyRange, batchSize int) *rowCursor {
+	limit := batchSize
+	if spec.Memory > 0 && limit > probeRows {
+		limit = probeRows
+	}
+	return &rowCursor{db: db, spec: spec, keyRange: keyRange, batchSize: batchSize, limit: limit, throttled: true}
+}
+
+// Next returns the next row, or nil once the range is exhausted.
+func (c *rowCursor) Next(ctx context.Context) ([]interface{}, error) {
+	if c.pos == len(c.batch) {
+		if c.done {
+			return nil, nil
+		}
+		if err := c.fetch(ctx); err != nil {
+			return nil, err
+		}
+		if len(c.batch) == 0 {
+			return nil, nil
+		}
+	}
+	row := c.batch[c.pos]
+	c.pos++
+	c.scanned++
+	return row, nil
+}
+
+func (c *rowCursor) fetch(ctx context.Context) (err error) {
+	if c.throttled {
+		release, err := c.db.acquire(ctx)
+		if err != nil {
+			return c.db.wrap(err)
+		}
+		defer release()
+	}
+	ctx, span := c.db.startQuery(ctx, "fetch rows "+c.db.ServiceName)
+	defer func() {
+		span.SetAttributes(attribute.Int("databasediff.rows", len(c.batch)))
+		endSpan(span, err)
+	}()
+	dialect := c.db.Dialect
+	predicate, args := c.spec.rangePredicate(dialect, c.keyRange)
+	predicates := []string{}
+	if predicate != "" {
+		predicates = append(predicates, predicate)
+	}
+	if c.lastKey != nil {
+		predicate, keyArgs := c.spec.keyPredicate(dialect, ">", c.lastKey)
+		predicates = append(predicates, predicate)
+		args = append(args, keyArgs...)
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", c.spec.selectList(dialect), c.spec.from(dialect))
+	if len(predicates) > 0 {
+		query += " WHERE " + strings.Join(predicates, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s", c.spec.keyTuple(dialect), dialect.Paginate(c.limit, 0))
+
+	rows, err := c.db.DB.QueryContext(ctx, c.db.rebind(query), args...)
+	if err != nil {
+		return c.db.wrap(err)
+	}
+	defer rows.Close()
+
+	c.batch = c.batch[:0]
+	c.pos = 0
+	for rows.Next() {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		c.batch = append(c.batch, values)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	c.db.addScanned(len(c.batch))
+	if len(c.batch) < c.limit {
+		c.done = true
+	}
+	if len(c.batch) > 0 {
+		c.lastKey = c.batch[len(c.batch)-1][:len(c.spec.Key)]
+		c.resize()
+	}
+	return nil
+}
+
+// resize sizes the next batch after the rows of this one, so that the two
+// cursors of a comparison hold at most half of spec.Memory between them.
+func (c *rowCursor) resize() {
+	if c.spec.Memory <= 0 {
+		return
+	}
+	var size int64
+	for _, row := range c.batch {
+		size += rowSize(row)
+	}
+	limit := c.spec.Memory / 4 / (size/int64(len(c.batch)) + 1)
+	switch {
+	case limit < 1:
+		c.limit = 1
+	case limit > int64(c.batchSize):
+		c.limit = c.batchSize
+	default:
+		c.limit = int(limit)
+	}
+}
+
+// rowSize is roughly the bytes a scanned row takes in memory.
+func rowSize(row []interface{}) int64 {
+	size := int64(24 + 16*len(row))
+	for _, value := range row {
+		switch v := value.(type) {
+		case []byte:
+			size += int64(len(v))
+		case string:
+			size += int64(len(v))
+		case time.Time:
+			size += 24
+		case nil:
+		default:
+			size += 8
+		}
+	}
+	return size
+}
+
+// compareKeys orders two rows by their leading key columns.
+func compareKeys(keyColumns []keyColumn, a, b []interface{}) int {
+	for i, key := range keyColumns {
+		if cmp := compareKeyValues(key.Kind, a[i], b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func compareKeyValues(kind keyKind, a, b interface{}) int {
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			switch {
+			case x.Before(y):
+				return -1
+			case x.After(y):
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if kind == keyNumeric {
+		x, xok := new(big.Rat).SetString(formatValue(a))
+		y, yok := new(big.Rat).SetString(formatValue(b))
+		if xok && yok {
+			return x.Cmp(y)
+		}
+	}
+	return strings.Compare(formatValue(a), formatValue(b))
+}
+
+func formatKey(keyColumns []keyColumn, row []interface{}) string {
+	parts := make([]string, len(keyColumns))
+	for i, key := range keyColumns {
+		parts[i] = key.Name + "=" + formatValue(row[i])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatValue renders a scanned column value in a canonical form so values
+// read from either database compare equal when they hold the same data.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	// Drivers such as ClickHouse's may return nullable values as pointers.
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "NULL"
+		}
+		return formatValue(v.Elem().Interface())
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,229 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// sampleZ is the normal quantile of the 95% confidence intervals around
+// sampled estimates.
+const sampleZ = 1.96
+
+// maxSampleParams caps the key values bound to one query fetching sampled
+// rows, below SQL Server's limit of 2100 parameters.
+const maxSampleParams = 2000
+
+// compareSample picks random primary keys on both databases and compares the
+// rows behind them. Keys sampled on the source find rows missing on the
+// destination or differing in value, and keys sampled on the destination find
+// rows missing on the source. The table's counts scale the sample up to an
+// estimate, see TableResult.SampleEstimate.
+func (c *Comparer) compareSample(ctx context.Context, table *TableResult, config TableConfig) error {
+	source, dest := &c.databases.source, &c.databases.dest
+	spec, err := loadTableSpec(ctx, source, config, c.Options)
+	if err != nil {
+		return err
+	}
+	if err := c.compareCounts(ctx, table, config); err != nil {
+		return err
+	}
+
+	var sourceKeys, destKeys [][]interface{}
+	err = bothSides(func() error {
+		return c.Options.Retry.do(ctx, source, func() (err error) {
+			sourceKeys, err = sampleKeys(ctx, source, spec, c.Options.SampleSize)
+			return err
+		})
+	}, func() error {
+		return c.Options.Retry.do(ctx, dest, func() (err error) {
+			destKeys, err = sampleKeys(ctx, dest, spec.onDest(), c.Options.SampleSize)
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
+	table.SampledSource, table.SampledDest = len(sourceKeys), len(destKeys)
+
+	batchSize := c.Options.BatchSize
+	if batchSize*len(spec.Key) > maxSampleParams {
+		batchSize = maxSampleParams / len(spec.Key)
+	}
+	for _, keys := range batches(sourceKeys, batchSize) {
+		var sourceRows, destRows map[string][]interface{}
+		err := bothSides(func() (err error) {
+			sourceRows, err = rowsByKey(ctx, source, spec, keys)
+			return err
+		}, func() (err error) {
+			destRows, err = rowsByKey(ctx, dest, spec.onDest(), keys)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			formatted := formatKey(spec.Key, key)
+			sourceRow, ok := sourceRows[formatted]
+			if !ok {
+				// deleted since it was sampled
+				table.SampledSource--
+				continue
+			}
+			destRow, ok := destRows[formatted]
+			switch {
+			case !ok:
+				table.addDifference(MissingInDest, spec.displayKey(key), nil)
+				table.OnlyInSource++
+			case !spec.rowsEqual(sourceRow, destRow):
+				table.addDifference(ValuesDiffer, spec.displayKey(key), spec.differingColumns(sourceRow, destRow))
+				table.Mismatched++
+			}
+		}
+	}
+
+	for _, keys := range batches(destKeys, batchSize) {
+		sourceRows, err := rowsByKey(ctx, source, spec, keys)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			formatted := formatKey(spec.Key, key)
+			if _, ok := sourceRows[formatted]; !ok {
+				table.addDifference(MissingInSource, spec.displayKey(key), nil)
+				table.OnlyInDest++
+			}
+		}
+	}
+	return nil
+}
+
+// sampleKeys returns up to n keys of the table's rows, picked at random.
+func sampleKeys(ctx context.Context, db *DB, spec tableSpec, n int) ([][]interface{}, error) {
+	predicate, args := spec.rangePredicate(db.Dialect, KeyRange{})
+	query := fmt.Sprintf("SELECT %s FROM %s", spec.keyList(db.Dialect), spec.from(db.Dialect))
+	if predicate != "" {
+		query += " WHERE " + predicate
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s", db.Dialect.RandomOrder(), db.Dialect.Paginate(n, 0))
+
+	rows, err := db.DB.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	defer rows.Close()
+
+	var keys [][]interface{}
+	for rows.Next() {
+		key := make([]interface{}, len(spec.Key))
+		pointers := make([]interface{}, len(key))
+		for i := range key {
+			pointers[i] = &key[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// rowsByKey fetches the rows with the given keys, indexed by their formatted
+// key. Keys without a row are left out.
+func rowsByKey(ctx context.Context, db *DB, spec tableSpec, keys [][]interface{}) (map[string][]interface{}, error) {
+	dialect := db.Dialect
+	var matches []string
+	var args []interface{}
+	for _, key := range keys {
+		columns := make([]string, len(spec.Key))
+		for i, column := range spec.Key {
+			columns[i] = dialect.QuoteIdentifier(column.Name) + " = ?"
+		}
+		matches = append(matches, "("+strings.Join(columns, " AND ")+")")
+		args = append(args, key...)
+	}
+	predicate := "(" + strings.Join(matches, " OR ") + ")"
+	if spec.Filter != "" {
+		predicate = "(" + spec.Filter + ") AND " + predicate
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s %s", spec.selectList(dialect), spec.from(dialect),
+		predicate, spec.keyTuple(dialect), dialect.Paginate(len(keys), 0))
+
+	rows, err := db.DB.QueryContext(ctx, db.rebind(query), args...)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	defer rows.Close()
+
+	found := make(map[string][]interface{}, len(keys))
+	for rows.Next() {
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		found[formatKey(spec.Key, values)] = values
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	db.addScanned(len(found))
+	return found, nil
+}
+
+// batches splits keys into slices of at most size keys.
+func batches(keys [][]interface{}, size int) [][][]interface{} {
+	var split [][][]interface{}
+	for len(keys) > size {
+		split = append(split, keys[:size])
+		keys = keys[size:]
+	}
+	if len(keys) > 0 {
+		split = append(split, keys)
+	}
+	return split
+}
+
+// SampleEstimate scales the differences found in a sampled comparison up to
+// the whole table: the estimated number of differing rows and its 95%
+// confidence interval. Rows missing on the destination or differing in value
+// are estimated from the source's sample and count, rows missing on the
+// source from the destination's.
+func (t TableResult) SampleEstimate() (diff, low, high int) {
+	sourceDiff, sourceLow, sourceHigh := estimateProportion(t.OnlyInSource+t.Mismatched, t.SampledSource, t.SourceRowCount)
+	destDiff, destLow, destHigh := estimateProportion(t.OnlyInDest, t.SampledDest, t.DestRowCount)
+	return round(sourceDiff + destDiff), round(sourceLow + destLow), round(sourceHigh + destHigh)
+}
+
+// estimateProportion scales the hits among n sampled rows up to the
+// population, with the Wilson score interval, which unlike the normal
+// approximation stays meaningful when nothing was found. A sample of the
+// whole population is exact.
+func estimateProportion(hits, n, population int) (estimate, low, high float64) {
+	if n == 0 {
+		return 0, 0, 0
+	}
+	p := float64(hits) / float64(n)
+	estimate = p * float64(population)
+	if n >= population {
+		return estimate, estimate, estimate
+	}
+	z2 := sampleZ * sampleZ / float64(n)
+	center := (p + z2/2) / (1 + z2)
+	margin := sampleZ / (1 + z2) * math.Sqrt(p*(1-p)/float64(n)+z2/(4*float64(n)))
+	low = math.Max(0, center-margin) * float64(population)
+	high = math.Min(1, center+margin) * float64(population)
+	return estimate, low, high
+}
+
+func round(x float64) int {
+	return int(math.Round(x))
+}
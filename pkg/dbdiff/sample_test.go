@@ -0,0 +1,77 @@
+package dbdiff
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCompareSample(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		size            int
+		table           TableConfig
+		sampled         int
+		want            map[string]string
+		diff, low, high int
+	}{
+		// a sample of every row finds every difference, exactly
+		{"whole table", 20, TableConfig{Name: "orders"}, 10,
+			map[string]string{MissingInDest: "id=3,id=4", MissingInSource: "id=11", ValuesDiffer: "id=5,id=7"}, 5, 5, 5},
+		{"where", 20, TableConfig{Name: "orders", Where: "id >= 5"}, 6,
+			map[string]string{MissingInSource: "id=11", ValuesDiffer: "id=5,id=7"}, 3, 3, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			comparer := openFixtures(t, Options{Mode: ModeSample, SampleSize: test.size})
+			result, err := comparer.CompareTable(context.Background(), test.table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.SampledSource != test.sampled {
+				t.Errorf("sampled %d source rows, want %d", result.SampledSource, test.sampled)
+			}
+			if got := differingKeys(result); !equalKeys(got, test.want) {
+				t.Errorf("differences are %v, want %v", got, test.want)
+			}
+			if diff, low, high := result.SampleEstimate(); diff != test.diff || low != test.low || high != test.high {
+				t.Errorf("estimated %d (%d to %d), want %d (%d to %d)", diff, low, high, test.diff, test.low, test.high)
+			}
+		})
+	}
+}
+
+func TestCompareSampleOfFewRows(t *testing.T) {
+	comparer := openFixtures(t, Options{Mode: ModeSample, SampleSize: 3})
+	result, err := comparer.CompareTable(context.Background(), TableConfig{Name: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SampledSource != 3 || result.SampledDest != 3 {
+		t.Errorf("sampled %d and %d rows, want 3 of each", result.SampledSource, result.SampledDest)
+	}
+	if len(result.Differences) > 6 {
+		t.Errorf("found %d differences in 6 sampled rows", len(result.Differences))
+	}
+	if diff, low, high := result.SampleEstimate(); low > diff || diff > high || high > 19 {
+		t.Errorf("estimated %d (%d to %d) of 19 rows", diff, low, high)
+	}
+}
+
+func TestEstimateProportion(t *testing.T) {
+	for _, test := range []struct {
+		name                string
+		hits, n, population int
+		estimate, low, high int
+	}{
+		{"nothing sampled", 0, 0, 1000, 0, 0, 0},
+		{"whole population", 3, 10, 10, 3, 3, 3},
+		{"nothing found", 0, 100, 1000, 0, 0, 37},
+		{"tenth", 10, 100, 1000, 100, 55, 174},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			estimate, low, high := estimateProportion(test.hits, test.n, test.population)
+			if round(estimate) != test.estimate || round(low) != test.low || round(high) != test.high {
+				t.Errorf("estimated %.1f (%.1f to %.1f), want %d (%d to %d)", estimate, low, high, test.estimate, test.low, test.high)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ColumnDefinition is a column as described by information_schema.columns,
+// or the engine's equivalent.
+type ColumnDefinition struct {
+	Name      string         `db:"column_name"`
+	Position  int            `db:"ordinal_position"`
+	DataType  string         `db:"data_type"`
+	Length    sql.NullInt64  `db:"character_maximum_length"`
+	Precision sql.NullInt64  `db:"numeric_precision"`
+	Scale     sql.NullInt64  `db:"numeric_scale"`
+	Nullable  string         `db:"is_nullable"`
+	Default   sql.NullString `db:"column_default"`
+}
+
+// fullType renders the data type with its length or precision, e.g.
+// character varying(255) or numeric(10,2).
+func (c ColumnDefinition) fullType() string {
+	switch {
+	case c.Length.Valid:
+		return fmt.Sprintf("%s(%d)", c.DataType, c.Length.Int64)
+	case c.DataType == "numeric" && c.Precision.Valid && c.Scale.Valid:
+		return fmt.Sprintf("%s(%d,%d)", c.DataType, c.Precision.Int64, c.Scale.Int64)
+	}
+	return c.DataType
+}
+
+// declaredType splits a declared type such as varchar(255) or numeric(10,2)
+// into its name and modifiers.
+var declaredType = regexp.MustCompile(`^\s*([^(]*?)\s*(?:\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\))?\s*$`)
+
+// splitDeclaredType moves the modifiers of a declared type into the length,
+// or the precision and scale, for engines whose catalogs only report the
+// type as declared.
+func (c *ColumnDefinition) splitDeclaredType() {
+	parts := declaredType.FindStringSubmatch(c.DataType)
+	if parts == nil {
+		return
+	}
+	c.DataType = parts[1]
+	first, _ := strconv.ParseInt(parts[2], 10, 64)
+	switch {
+	case parts[3] != "":
+		scale, _ := strconv.ParseInt(parts[3], 10, 64)
+		c.Precision = sql.NullInt64{Int64: first, Valid: true}
+		c.Scale = sql.NullInt64{Int64: scale, Valid: true}
+	case parts[2] != "":
+		c.Length = sql.NullInt64{Int64: first, Valid: true}
+	}
+}
+
+func (c ColumnDefinition) defaultValue() string {
+	if !c.Default.Valid {
+		return "(none)"
+	}
+	return c.Default.String
+}
+
+// SchemaDifference is one attribute of a column, index or constraint that
+// differs between the databases, or an object that only exists on one of them.
+type SchemaDifference struct {
+	Object       string
+	Attribute    string
+	Source, Dest string
+}
+
+const absent = "(absent)"
+
+func getColumnDefinitions(ctx context.Context, db *DB, tableName string) ([]ColumnDefinition, error) {
+	columns, err := db.Dialect.Columns(ctx, db, tableName)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	return columns, nil
+}
+
+// compareSchema diffs the column definitions, indexes and constraints of a
+// table on both databases, and the definitions of views.
+func compareSchema(ctx context.Context, databases *Databases, table *TableResult, config TableConfig) error {
+	var source, dest []ColumnDefinition
+	err := bothSides(func() (err error) {
+		source, err = getColumnDefinitions(ctx, &databases.source, config.Name)
+		return err
+	}, func() (err error) {
+		dest, err = getColumnDefinitions(ctx, &databases.dest, config.onDest().Name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	table.SourceColumns, table.DestColumns = len(source), len(dest)
+
+	destByName := make(map[string]ColumnDefinition, len(dest))
+	for _, column := range dest {
+		destByName[column.Name] = column
+	}
+	for _, s := range source {
+		d, ok := destByName[s.Name]
+		if !ok {
+			table.addSchemaDifference(s.Name, "column", s.fullType(), absent)
+			continue
+		}
+		delete(destByName, s.Name)
+
+		if s.fullType() != d.fullType() {
+			table.addSchemaDifference(s.Name, "type", s.fullType(), d.fullType())
+		}
+		if s.Nullable != d.Nullable {
+			table.addSchemaDifference(s.Name, "nullable", s.Nullable, d.Nullable)
+		}
+		if s.defaultValue() != d.defaultValue() {
+			table.addSchemaDifference(s.Name, "default", s.defaultValue(), d.defaultValue())
+		}
+		if s.Position != d.Position {
+			table.addSchemaDifference(s.Name, "position", strconv.Itoa(s.Position), strconv.Itoa(d.Position))
+		}
+	}
+	// whatever is left only exists on the destination
+	for _, d := range dest {
+		if _, ok := destByName[d.Name]; ok {
+			table.addSchemaDifference(d.Name, "column", absent, d.fullType())
+		}
+	}
+	if err := compareViewDefinitions(ctx, databases, table, config); err != nil {
+		return err
+	}
+	return compareSchemaObjects(ctx, databases, table, config)
+}
+
+func (t *TableResult) addSchemaDifference(object, attribute, source, dest string) {
+	t.SchemaDifferences = append(t.SchemaDifferences, SchemaDifference{object, attribute, source, dest})
+}
+
+// CheckSchemas compares the schema of every table ahead of a data comparison
+// and prints any drift, since data diffs are misleading when the columns
+// don't line up. Tables whose schema can't be read are skipped, leaving the
+// data comparison to report them.
+func (c *Comparer) CheckSchemas(ctx context.Context, tables []TableConfig) {
+	databases := c.databases
+	// "dest" is taken by the differences' values
+	log := c.log.With("database", databases.dest.ServiceName)
+	drifted := 0
+	for _, config := range tables {
+		tableName := config.Name
+		table := TableResult{Name: tableName}
+		tableCtx, cancel := c.withTableTimeout(ctx, config)
+		err := compareSchema(tableCtx, databases, &table, config)
+		cancel()
+		if err != nil {
+			log.Warnw("Couldn't check the schema", "table", tableName, "error", err)
+			continue
+		}
+		for _, difference := range table.SchemaDifferences {
+			log.Warnw("Schema drift", "table", tableName, "object", difference.Object, "attribute", difference.Attribute,
+				"source", difference.Source, "dest", difference.Dest)
+		}
+		if len(table.SchemaDifferences) > 0 {
+			drifted++
+		}
+	}
+	if drifted > 0 {
+		log.Warnw("Schema drift found", "drifted", drifted, "tables", len(tables))
+	}
+}
@@ -0,0 +1,112 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+)
+
+// UnownedSequences is the pseudo-table that sequences not owned by any of the
+// compared tables are reported under.
+const UnownedSequences = "(other sequences)"
+
+// SequenceDiff is the last value of a sequence on both databases. A value is
+// invalid when the sequence doesn't exist or has never been used.
+type SequenceDiff struct {
+	Name         string
+	Source, Dest sql.NullInt64
+}
+
+func (s SequenceDiff) Gap() string {
+	if !s.Source.Valid || !s.Dest.Valid {
+		return "n/a"
+	}
+	return strconv.FormatInt(s.Source.Int64-s.Dest.Int64, 10)
+}
+
+func (s SequenceDiff) Drifts() bool {
+	return s.Source != s.Dest
+}
+
+// sequenceValue is a sequence with the table and column owning it, if any.
+type sequenceValue struct {
+	Name      string        `db:"name"`
+	Owner     string        `db:"owner"`
+	Column    string        `db:"column"`
+	LastValue sql.NullInt64 `db:"last_value"`
+}
+
+// matchKey identifies a sequence across databases. Owned sequences are
+// matched by the column they feed, since engines name them differently.
+func (s sequenceValue) matchKey() string {
+	if s.Owner != "" {
+		return s.Owner + "." + s.Column
+	}
+	return s.Name
+}
+
+func getSequences(ctx context.Context, db *DB, owner string) ([]sequenceValue, error) {
+	sequences, err := db.Dialect.Sequences(ctx, db, owner)
+	if err != nil {
+		return nil, db.wrap(err)
+	}
+	return sequences, nil
+}
+
+// compareSequences compares the sequences owned by a table, or for the
+// UnownedSequences pseudo-table every sequence not owned by a compared table.
+func compareSequences(ctx context.Context, databases *Databases, table *TableResult, config TableConfig, tables []TableConfig) error {
+	owner, destOwner := config.Name, config.onDest().Name
+	if owner == UnownedSequences {
+		owner, destOwner = "", ""
+	}
+	var source, dest []sequenceValue
+	err := bothSides(func() (err error) {
+		source, err = getSequences(ctx, &databases.source, owner)
+		return err
+	}, func() (err error) {
+		dest, err = getSequences(ctx, &databases.dest, destOwner)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// match sequences of a renamed table by the source's name
+	for i := range dest {
+		if destOwner != "" && dest[i].Owner == ParseTableRef(destOwner).Name {
+			dest[i].Owner = ParseTableRef(owner).Name
+		}
+	}
+
+	compared := make(map[string]bool, 2*len(tables))
+	for _, table := range tables {
+		compared[ParseTableRef(table.Name).Name] = true
+		compared[ParseTableRef(table.onDest().Name).Name] = true
+	}
+	include := func(sequence sequenceValue) bool {
+		return owner != "" || !compared[sequence.Owner]
+	}
+
+	destByKey := make(map[string]sequenceValue, len(dest))
+	for _, sequence := range dest {
+		destByKey[sequence.matchKey()] = sequence
+	}
+	for _, s := range source {
+		if !include(s) {
+			continue
+		}
+		d, ok := destByKey[s.matchKey()]
+		delete(destByKey, s.matchKey())
+		diff := SequenceDiff{Name: s.Name, Source: s.LastValue}
+		if ok {
+			diff.Dest = d.LastValue
+		}
+		table.Sequences = append(table.Sequences, diff)
+	}
+	for _, d := range dest {
+		if _, ok := destByKey[d.matchKey()]; ok && include(d) {
+			table.Sequences = append(table.Sequences, SequenceDiff{Name: d.Name, Dest: d.LastValue})
+		}
+	}
+	return nil
+}
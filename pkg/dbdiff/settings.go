@@ -0,0 +1,69 @@
+package dbdiff
+
+import (
+	"context"
+)
+
+// Settings is the pseudo-table the installed extensions and database
+// settings, such as the encoding, collation and time zone, are reported
+// under in ModeSchema.
+const Settings = "(settings)"
+
+// settingsDialect is implemented by dialects that can list extensions and
+// settings, as objects of kind "extension" holding the installed version,
+// or "setting" holding the value.
+type settingsDialect interface {
+	settings(ctx context.Context, db *DB) ([]schemaObject, error)
+}
+
+// compareSettings diffs the extensions and settings of both databases,
+// which explain data that looks different without the rows differing, such
+// as timestamps rendered in another time zone or text sorted by another
+// collation.
+func compareSettings(ctx context.Context, databases *Databases, table *TableResult) error {
+	source, dest := &databases.source, &databases.dest
+	sourceDialect, sourceOK := source.Dialect.(settingsDialect)
+	destDialect, destOK := dest.Dialect.(settingsDialect)
+	if !sourceOK || !destOK {
+		return nil
+	}
+	var sourceSettings, destSettings []schemaObject
+	err := bothSides(func() (err error) {
+		if sourceSettings, err = sourceDialect.settings(ctx, source); err != nil {
+			return source.wrap(err)
+		}
+		return nil
+	}, func() (err error) {
+		if destSettings, err = destDialect.settings(ctx, dest); err != nil {
+			return dest.wrap(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	table.SourceColumns, table.DestColumns = len(sourceSettings), len(destSettings)
+
+	// unlike indexes, settings aren't renamed
+	destByName := make(map[string]schemaObject, len(destSettings))
+	for _, setting := range destSettings {
+		destByName[setting.Kind+" "+setting.Name] = setting
+	}
+	for _, s := range sourceSettings {
+		d, ok := destByName[s.Kind+" "+s.Name]
+		if !ok {
+			table.addSchemaDifference(s.Name, s.Kind, s.Definition, absent)
+			continue
+		}
+		delete(destByName, s.Kind+" "+s.Name)
+		if s.Definition != d.Definition {
+			table.addSchemaDifference(s.Name, s.Kind, s.Definition, d.Definition)
+		}
+	}
+	for _, d := range destSettings {
+		if _, ok := destByName[d.Kind+" "+d.Name]; ok {
+			table.addSchemaDifference(d.Name, d.Kind, absent, d.Definition)
+		}
+	}
+	return nil
+}
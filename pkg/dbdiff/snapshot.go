@@ -0,0 +1,140 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+)
+
+// snapshotDialect is implemented by dialects that can hold a transaction
+// seeing the database as of a single moment.
+type snapshotDialect interface {
+	// beginSnapshot starts the transaction on the connection and pins its
+	// snapshot, which some engines otherwise take at its first read.
+	beginSnapshot(ctx context.Context, conn *sql.Conn) error
+}
+
+// snapshotExporter is implemented by snapshot dialects that can share the
+// snapshot with transactions on other connections, so counts needn't wait
+// for one another on the connection holding it.
+type snapshotExporter interface {
+	exportSnapshot(ctx context.Context, conn *sql.Conn) (string, error)
+	// importSnapshot has a transaction begun with repeatable read see the
+	// exported snapshot.
+	importSnapshot(ctx context.Context, tx *sql.Tx, id string) error
+}
+
+// snapshot is the transaction a database's counts are read in, shared by
+// the copies of the DB.
+type snapshot struct {
+	mu sync.Mutex
+	// conn holds the transaction open, nil when there is none. Without an
+	// exported id, counts run on it one at a time, holding mu.
+	conn *sql.Conn
+	id   string
+}
+
+// TakeSnapshots starts a transaction on both databases that the row counts
+// of the following comparisons are read in, so all the counts on a database
+// are as of the same moment. Taking them again moves them on to the present,
+// and ReleaseSnapshots or Close releases them.
+func (c *Comparer) TakeSnapshots(ctx context.Context) error {
+	return bothSides(func() error {
+		return c.databases.source.takeSnapshot(ctx)
+	}, func() error {
+		return c.databases.dest.takeSnapshot(ctx)
+	})
+}
+
+// ReleaseSnapshots ends the transactions TakeSnapshots started, so they
+// don't hold back the databases' vacuum and purge between runs. Comparisons
+// after it read the databases as they are.
+func (c *Comparer) ReleaseSnapshots() {
+	c.databases.source.releaseSnapshot()
+	c.databases.dest.releaseSnapshot()
+}
+
+// takeSnapshot replaces the database's snapshot with a new one.
+func (db *DB) takeSnapshot(ctx context.Context) error {
+	dialect, ok := db.Dialect.(snapshotDialect)
+	if !ok {
+		return fmt.Errorf("%s: %s doesn't support consistent snapshots", db.ServiceName, db.Dialect.Name())
+	}
+	s := db.snapshot
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.release()
+
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return db.wrap(err)
+	}
+	s.conn = conn
+	if err := dialect.beginSnapshot(ctx, conn); err != nil {
+		s.release()
+		return db.wrap(err)
+	}
+	// sharing the snapshot takes a second connection
+	if exporter, ok := db.Dialect.(snapshotExporter); ok && db.DB.Stats().MaxOpenConnections != 1 {
+		if s.id, err = exporter.exportSnapshot(ctx, conn); err != nil {
+			s.release()
+			return db.wrap(err)
+		}
+	}
+	db.log.Debugw("Took snapshot", "exported", s.id)
+	return nil
+}
+
+// release ends the snapshot's transaction, if any. The caller holds mu.
+func (s *snapshot) release() {
+	if s.conn == nil {
+		return
+	}
+	if _, err := s.conn.ExecContext(context.Background(), "ROLLBACK"); err != nil {
+		// don't hand a connection in an unknown state back to the pool
+		s.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	s.conn.Close()
+	s.conn, s.id = nil, ""
+}
+
+// releaseSnapshot ends the database's snapshot, if any.
+func (db *DB) releaseSnapshot() {
+	if db.snapshot != nil {
+		db.snapshot.mu.Lock()
+		db.snapshot.release()
+		db.snapshot.mu.Unlock()
+	}
+}
+
+// scanRow runs a query returning a single row, in the database's snapshot
+// when it has one.
+func (db *DB) scanRow(ctx context.Context, query string, dest ...interface{}) error {
+	s := db.snapshot
+	if s == nil {
+		return db.DB.QueryRowContext(ctx, query).Scan(dest...)
+	}
+	s.mu.Lock()
+	if s.conn == nil {
+		s.mu.Unlock()
+		return db.DB.QueryRowContext(ctx, query).Scan(dest...)
+	}
+	if s.id == "" {
+		defer s.mu.Unlock()
+		return s.conn.QueryRowContext(ctx, query).Scan(dest...)
+	}
+	id := s.id
+	s.mu.Unlock()
+
+	tx, err := db.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := db.Dialect.(snapshotExporter).importSnapshot(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.QueryRowContext(ctx, query).Scan(dest...)
+}
@@ -0,0 +1,37 @@
+package dbdiff
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReleaseSnapshots(t *testing.T) {
+	comparer := openFixtures(t, Options{Mode: ModeCount})
+	ctx := context.Background()
+	for round := 1; round <= 2; round++ {
+		if err := comparer.TakeSnapshots(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if comparer.Source().snapshot.conn == nil || comparer.Dest().snapshot.conn == nil {
+			t.Fatalf("round %d took no snapshots", round)
+		}
+		result, err := comparer.CompareTable(ctx, TableConfig{Name: "orders"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.SourceRowCount != 10 || result.DestRowCount != 9 {
+			t.Errorf("round %d counted %d and %d rows", round, result.SourceRowCount, result.DestRowCount)
+		}
+		comparer.ReleaseSnapshots()
+		if comparer.Source().snapshot.conn != nil || comparer.Dest().snapshot.conn != nil {
+			t.Fatalf("round %d left the snapshots open", round)
+		}
+		// nothing holds the databases between rounds
+		if _, err := comparer.Dest().DB.Exec(`INSERT INTO orders VALUES (?, 'c', 0, NULL)`, 100+round); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := comparer.Dest().DB.Exec(`DELETE FROM orders WHERE id = ?`, 100+round); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
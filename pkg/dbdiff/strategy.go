@@ -0,0 +1,76 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Strategy is a comparison mode of one's own, such as reconciling an
+// event-sourced table by replaying its events, run by the comparer like the
+// built-in modes, on the same tables and workers, with the same timeouts,
+// thresholds, reports and alerts. It reports what it finds like ModeRows
+// does, in the result's OnlyInSource, OnlyInDest and Mismatched counts and
+// the Differences behind them, which the table's drift is measured by, along
+// with the row counts. Strategies are compared concurrently, so Compare must
+// be safe for concurrent use.
+type Strategy interface {
+	// Compare compares the table on both databases, the config's Name
+	// being the table on the source and its onDest the one on the
+	// destination, and fills in the result.
+	Compare(ctx context.Context, source, dest *DB, table *TableResult, config TableConfig) error
+}
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]Strategy{}
+)
+
+// builtinModes are the modes strategies can't take the name of.
+var builtinModes = map[string]bool{
+	ModeCount: true, ModeRows: true, ModeChecksum: true, ModeSchema: true, ModeSequences: true, ModeSample: true, ModeFreshness: true,
+	ModeAggregates: true, ModeGroups: true, ModeKeys: true, ModeGrants: true, ModeMembership: true, ModeDistinct: true,
+}
+
+// RegisterStrategy makes the strategy available as the mode, usually from
+// the init function of the package implementing it, like a database/sql
+// driver. It panics when the mode is empty, built in or already registered,
+// or the strategy is nil.
+func RegisterStrategy(mode string, strategy Strategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if strategy == nil {
+		panic("dbdiff: RegisterStrategy strategy is nil")
+	}
+	if mode == "" || builtinModes[mode] {
+		panic(fmt.Sprintf("dbdiff: RegisterStrategy can't register the mode %q", mode))
+	}
+	if _, dup := strategies[mode]; dup {
+		panic("dbdiff: RegisterStrategy called twice for mode " + mode)
+	}
+	strategies[mode] = strategy
+}
+
+// Strategies returns the modes of the registered strategies, sorted.
+func Strategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	modes := make([]string, 0, len(strategies))
+	for mode := range strategies {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// IsStrategy reports whether the mode is a registered strategy's.
+func IsStrategy(mode string) bool {
+	return strategyFor(mode) != nil
+}
+
+func strategyFor(mode string) Strategy {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	return strategies[mode]
+}
@@ -0,0 +1,237 @@
+package dbdiff
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// literalDialect is implemented by dialects whose literals differ from
+// standard SQL's, such as those escaping strings with backslashes. literal
+// returns false for values written the standard way.
+type literalDialect interface {
+	literal(value interface{}) (string, bool)
+}
+
+// binaryLiteralDialect is implemented by dialects writing binary values
+// other than as standard SQL's X'...'.
+type binaryLiteralDialect interface {
+	binaryLiteral(b []byte) string
+}
+
+// syncStatement returns the statement that repairs a differing row on the
+// destination: inserting the source's row missing there, deleting the row
+// missing on the source, or updating the columns whose values differ. Rows
+// hold the key columns followed by every column, as selected by selectList.
+// Values of masked columns are written masked, so the statements are only
+// good for review then.
+func (t tableSpec) syncStatement(d Dialect, kind string, sourceRow, destRow []interface{}) string {
+	keyed := len(t.Key)
+	switch kind {
+	case MissingInDest:
+		columns := make([]string, len(t.Columns))
+		values := make([]string, len(t.Columns))
+		for i, column := range t.Columns {
+			columns[i] = d.QuoteIdentifier(column.Name)
+			values[i] = columnLiteral(d, column.DataType, t.maskValue(column.Name, sourceRow[keyed+i]))
+		}
+		return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s);",
+			quoteTable(d, t.DestName), strings.Join(columns, ", "), strings.Join(values, ", "))
+	case MissingInSource:
+		return fmt.Sprintf("DELETE FROM %s WHERE %s;", quoteTable(d, t.DestName), t.keyCondition(d, destRow))
+	}
+	var assignments []string
+	for i, column := range t.Columns {
+		if !t.columnEqual(i, sourceRow[keyed+i], destRow[keyed+i]) {
+			assignments = append(assignments, d.QuoteIdentifier(column.Name)+" = "+columnLiteral(d, column.DataType, t.maskValue(column.Name, sourceRow[keyed+i])))
+		}
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s;", quoteTable(d, t.DestName), strings.Join(assignments, ", "), t.keyCondition(d, sourceRow))
+}
+
+// keyCondition matches the row's primary key.
+func (t tableSpec) keyCondition(d Dialect, row []interface{}) string {
+	conditions := make([]string, len(t.Key))
+	for i, key := range t.Key {
+		conditions[i] = d.QuoteIdentifier(key.Name) + " = " + columnLiteral(d, key.DataType, t.maskValue(key.Name, row[i]))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// columnLiteral renders a scanned value of a column of the type as an SQL
+// literal. Drivers scan text and binary values alike as bytes, so bytes are
+// written as binary by the column's type; only without one does their being
+// valid UTF-8 decide, as it does for sqlLiteral.
+func columnLiteral(d Dialect, dataType string, value interface{}) string {
+	b, ok := value.([]byte)
+	if !ok || dataType == "" {
+		return sqlLiteral(d, value)
+	}
+	if !isBinaryType(dataType) {
+		return sqlLiteral(d, string(b))
+	}
+	if dialect, ok := d.(binaryLiteralDialect); ok {
+		return dialect.binaryLiteral(b)
+	}
+	return "X'" + hex.EncodeToString(b) + "'"
+}
+
+// sqlLiteral renders a scanned value as an SQL literal. Timestamps are
+// written in UTC without a time zone, which every engine reads.
+func sqlLiteral(d Dialect, value interface{}) string {
+	if dialect, ok := d.(literalDialect); ok {
+		if literal, ok := dialect.literal(value); ok {
+			return literal
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return quoteString(v)
+	case []byte:
+		if utf8.Valid(v) {
+			return quoteString(string(v))
+		}
+		return "X'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		return "'" + v.UTC().Format("2006-01-02 15:04:05.999999") + "'"
+	}
+	// Drivers such as ClickHouse's may return nullable values as pointers.
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "NULL"
+		}
+		return sqlLiteral(d, v.Elem().Interface())
+	}
+	if v := reflect.ValueOf(value); v.Kind() >= reflect.Int && v.Kind() <= reflect.Float64 {
+		return fmt.Sprint(value)
+	}
+	return quoteString(fmt.Sprint(value))
+}
+
+// quoteString quotes a string literal the standard way, doubling quotes.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// backslashLiteral writes text values for engines that treat backslashes in
+// string literals as escapes.
+func backslashLiteral(value interface{}) (string, bool) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		if !utf8.Valid(v) {
+			return "", false
+		}
+		s = string(v)
+	default:
+		return "", false
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'", true
+}
+
+// ApplyOptions control how ApplySync repairs the destination.
+type ApplyOptions struct {
+	// BatchSize is the number of statements run in each transaction.
+	BatchSize int
+	// MaxRows is the most rows, each repaired by one statement, ApplySync
+	// changes. It applies none when the tables need more.
+	MaxRows int
+	// DryRun logs the statements instead of running them.
+	DryRun bool
+}
+
+// ApplyError is why ApplySync stopped at a table's batch.
+type ApplyError struct {
+	Table string
+	Err   error
+}
+
+func (e *ApplyError) Error() string { return e.Table + ": " + e.Err.Error() }
+
+func (e *ApplyError) Unwrap() error { return e.Err }
+
+// ApplySync runs the tables' SyncStatements on the destination, BatchSize
+// per transaction, and returns how many it applied. A statement that doesn't
+// change exactly one row rolls its batch back and stops with an ApplyError.
+func (c *Comparer) ApplySync(ctx context.Context, tables []TableResult, options ApplyOptions) (int, error) {
+	dest := &c.databases.dest
+	total := 0
+	for _, table := range tables {
+		if table.Err == nil {
+			total += len(table.SyncStatements)
+		}
+	}
+	if options.MaxRows > 0 && total > options.MaxRows {
+		return 0, fmt.Errorf("%d rows to repair on %s exceed the limit of %d, applying none", total, dest.ServiceName, options.MaxRows)
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = total
+	}
+
+	applied := 0
+	for _, table := range tables {
+		if table.Err != nil {
+			continue
+		}
+		for start := 0; start < len(table.SyncStatements); start += batchSize {
+			end := start + batchSize
+			if end > len(table.SyncStatements) {
+				end = len(table.SyncStatements)
+			}
+			batch := table.SyncStatements[start:end]
+			if options.DryRun {
+				for _, statement := range batch {
+					c.log.Infow("Dry run, not applying", "table", table.Name, "dest", dest.ServiceName, "statement", statement)
+				}
+				continue
+			}
+			if err := applyBatch(ctx, dest, batch); err != nil {
+				return applied, &ApplyError{table.Name, err}
+			}
+			applied += len(batch)
+			c.log.Infow("Applied repairs", "table", table.Name, "dest", dest.ServiceName, "statements", len(batch), "applied", applied, "total", total)
+		}
+	}
+	return applied, nil
+}
+
+func applyBatch(ctx context.Context, db *DB, statements []string) error {
+	tx, err := db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return db.wrap(err)
+	}
+	defer tx.Rollback()
+	for _, statement := range statements {
+		result, err := tx.ExecContext(ctx, statement)
+		if err != nil {
+			return db.wrap(fmt.Errorf("%s: %w", statement, err))
+		}
+		// engines such as BigQuery don't report it
+		if affected, err := result.RowsAffected(); err == nil && affected != 1 {
+			return db.wrap(fmt.Errorf("%s changed %d rows instead of one", statement, affected))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return db.wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package dbdiff
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLLiteral(t *testing.T) {
+	var nilInt *int64
+	seven := int64(7)
+	at := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.FixedZone("CET", 3600))
+	for _, test := range []struct {
+		name    string
+		dialect Dialect
+		value   interface{}
+		want    string
+	}{
+		{"null", sqliteDialect{}, nil, "NULL"},
+		{"integer", sqliteDialect{}, int64(-42), "-42"},
+		{"float", sqliteDialect{}, 2.5, "2.5"},
+		{"boolean", postgresDialect{}, true, "TRUE"},
+		{"string", sqliteDialect{}, "it's", "'it''s'"},
+		{"text bytes", sqliteDialect{}, []byte("it's"), "'it''s'"},
+		{"binary", sqliteDialect{}, []byte{0xff, 0x00}, "X'ff00'"},
+		{"time in UTC", sqliteDialect{}, at, "'2024-01-02 02:04:05.6'"},
+		{"nil pointer", clickhouseDialect{}, nilInt, "NULL"},
+		{"pointer", clickhouseDialect{}, &seven, "7"},
+		{"postgres bytea", postgresDialect{}, []byte{0xff, 0x00}, `'\xff00'::bytea`},
+		{"postgres backslash", postgresDialect{}, `C:\temp`, `'C:\temp'`},
+		{"mysql backslash", mysqlDialect{}, `it's C:\temp`, `'it\'s C:\\temp'`},
+		{"mysql binary", mysqlDialect{}, []byte{0xff, 0x00}, "X'ff00'"},
+		{"clickhouse backslash", clickhouseDialect{}, `C:\temp`, `'C:\\temp'`},
+		{"snowflake backslash", snowflakeDialect{}, `it's`, `'it\'s'`},
+		{"bigquery backslash", bigqueryDialect{}, `it's`, `'it\'s'`},
+		{"sqlserver string", sqlserverDialect{}, "it's", "N'it''s'"},
+		{"sqlserver boolean", sqlserverDialect{}, false, "0"},
+		{"sqlserver binary", sqlserverDialect{}, []byte{0xff, 0x00}, "0xff00"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sqlLiteral(test.dialect, test.value); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestColumnLiteral(t *testing.T) {
+	text := []byte("abc")
+	for _, test := range []struct {
+		name     string
+		dialect  Dialect
+		dataType string
+		value    interface{}
+		want     string
+	}{
+		// bytes that happen to be text are still binary in a binary column
+		{"postgres bytea", postgresDialect{}, "bytea", text, `'\x616263'::bytea`},
+		{"postgres text", postgresDialect{}, "text", text, "'abc'"},
+		{"postgres untyped", postgresDialect{}, "", []byte{0xff}, `'\xff'::bytea`},
+		{"mysql varbinary", mysqlDialect{}, "varbinary(16)", text, "X'616263'"},
+		{"mysql text", mysqlDialect{}, "varchar", text, "'abc'"},
+		{"sqlite blob", sqliteDialect{}, "BLOB", text, "X'616263'"},
+		{"sqlserver varbinary", sqlserverDialect{}, "varbinary", text, "0x616263"},
+		{"sqlserver nvarchar", sqlserverDialect{}, "nvarchar", text, "N'abc'"},
+		{"oracle blob", oracleDialect{}, "BLOB", text, "HEXTORAW('616263')"},
+		{"bigquery bytes", bigqueryDialect{}, "BYTES", text, "FROM_HEX('616263')"},
+		{"masked binary", postgresDialect{}, "bytea", "hmac:0011", "'hmac:0011'"},
+		{"not bytes", postgresDialect{}, "bytea", nil, "NULL"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := columnLiteral(test.dialect, test.dataType, test.value); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSyncStatements(t *testing.T) {
+	want := []string{
+		`DELETE FROM "orders" WHERE "id" = 11;`,
+		`INSERT INTO "orders" ("id", "customer", "total", "synced_at") VALUES (3, 'c3', 30, '2024-01-01');`,
+		`INSERT INTO "orders" ("id", "customer", "total", "synced_at") VALUES (4, 'c4', 40, '2024-01-01');`,
+		`UPDATE "orders" SET "synced_at" = '2024-01-01' WHERE "id" = 7;`,
+		`UPDATE "orders" SET "total" = 50 WHERE "id" = 5;`,
+	}
+	for _, test := range []struct {
+		name    string
+		options Options
+	}{
+		{"rows", Options{Mode: ModeRows, SyncSQL: true}},
+		{"localized checksum", Options{Mode: ModeChecksum, Checksum: ChecksumServer, ChunkSize: 4, Localize: true, LeafSize: 1, SyncSQL: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			comparer := openFixtures(t, test.options)
+			result, err := comparer.CompareTable(context.Background(), TableConfig{Name: "orders"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := append([]string(nil), result.SyncStatements...)
+			sort.Strings(got)
+			if len(got) != len(want) {
+				t.Fatalf("statements are %q, want %q", got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("statement %d is %s, want %s", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSyncStatementsExcludedColumns(t *testing.T) {
+	comparer := openFixtures(t, Options{Mode: ModeRows, SyncSQL: true})
+	_, err := comparer.CompareTable(context.Background(), TableConfig{Name: "orders", ExcludeColumns: []string{"synced_at"}})
+	if err == nil || !strings.Contains(err.Error(), "tables with excluded columns can't be repaired by sync statements") {
+		t.Errorf("error %v, want the sync statements refused", err)
+	}
+}
+
+func TestApplySync(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		options   ApplyOptions
+		applied   int
+		err       string
+		remaining int
+	}{
+		{"in batches", ApplyOptions{BatchSize: 2}, 5, "", 0},
+		{"in one batch", ApplyOptions{}, 5, "", 0},
+		{"dry run", ApplyOptions{BatchSize: 2, DryRun: true}, 0, "", 5},
+		{"past the limit", ApplyOptions{BatchSize: 2, MaxRows: 4}, 0, "exceed the limit of 4", 5},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			comparer := openFixtures(t, Options{Mode: ModeRows, SyncSQL: true})
+			ctx := context.Background()
+			result, err := comparer.CompareTable(ctx, TableConfig{Name: "orders"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			applied, err := comparer.ApplySync(ctx, []TableResult{result}, test.options)
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("error %v, want one containing %q", err, test.err)
+			}
+			if applied != test.applied {
+				t.Errorf("applied %d statements, want %d", applied, test.applied)
+			}
+			if result, err = comparer.CompareTable(ctx, TableConfig{Name: "orders"}); err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Differences) != test.remaining {
+				t.Errorf("%d differences remain, want %d", len(result.Differences), test.remaining)
+			}
+		})
+	}
+}
+
+func TestApplySyncStale(t *testing.T) {
+	comparer := openFixtures(t, Options{Mode: ModeRows, SyncSQL: true})
+	ctx := context.Background()
+	result, err := comparer.CompareTable(ctx, TableConfig{Name: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the row to delete is gone by the time the repairs run
+	if _, err := comparer.Dest().DB.Exec(`DELETE FROM orders WHERE id = 11`); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := comparer.ApplySync(ctx, []TableResult{result}, ApplyOptions{BatchSize: 100})
+	if err == nil || !strings.Contains(err.Error(), "changed 0 rows instead of one") {
+		t.Fatalf("applied stale statements, error %v", err)
+	}
+	if applied != 0 {
+		t.Errorf("applied %d statements, want the batch rolled back", applied)
+	}
+	if result, err = comparer.CompareTable(ctx, TableConfig{Name: "orders"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Differences) != 4 {
+		t.Errorf("%d differences remain, want the 4 still unrepaired", len(result.Differences))
+	}
+}
@@ -0,0 +1,260 @@
+package dbdiff
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultThrottleCheck is how often a throttled database's lag and load are
+// checked, without Throttle.CheckEvery.
+const defaultThrottleCheck = 10 * time.Second
+
+// Throttle limits the load comparisons put on a database, such as a
+// production primary. It applies to the queries reading the tables' data:
+// counts, checksums, batches of rows and the like, along with checks, rather
+// than the lookups of their columns and keys. The zero Throttle doesn't
+// limit anything.
+type Throttle struct {
+	// QueriesPerSecond caps how fast the queries start, zero leaving them
+	// uncapped.
+	QueriesPerSecond float64
+	// HeavyQueries caps how many of them run at once, zero leaving them
+	// uncapped.
+	HeavyQueries int
+	// Window is the time of day the queries may run in, their tables'
+	// comparisons waiting for it otherwise.
+	Window Window
+	// MaxLag pauses the queries while the database lags behind its
+	// primary, or its replicas behind it, by more than this. Zero doesn't
+	// check.
+	MaxLag time.Duration
+	// MaxActive pauses the queries while more than this many queries are
+	// running on the database, ours included. Zero doesn't check.
+	MaxActive int
+	// CheckEvery is how often the lag and load are checked, every 10
+	// seconds when zero.
+	CheckEvery time.Duration
+}
+
+func (t Throttle) set() bool {
+	return t != Throttle{}
+}
+
+// Window is a daily span of local time, such as 22:00-06:00, which may
+// wrap around midnight. The zero Window is the whole day.
+type Window struct {
+	// Start and End are the time since midnight it starts and ends at.
+	Start, End time.Duration
+}
+
+// ParseWindow parses a window written as HH:MM-HH:MM.
+func ParseWindow(s string) (Window, error) {
+	bounds := strings.SplitN(s, "-", 2)
+	if len(bounds) != 2 {
+		return Window{}, fmt.Errorf("window %q isn't written as HH:MM-HH:MM", s)
+	}
+	var w Window
+	for i, bound := range []*time.Duration{&w.Start, &w.End} {
+		at, err := time.Parse("15:04", strings.TrimSpace(bounds[i]))
+		if err != nil {
+			return Window{}, fmt.Errorf("window %q isn't written as HH:MM-HH:MM", s)
+		}
+		*bound = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	}
+	if w.Start == w.End {
+		return Window{}, fmt.Errorf("window %q is empty", s)
+	}
+	return w, nil
+}
+
+func (w Window) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return clock(w.Start) + "-" + clock(w.End)
+}
+
+// until is how long it is from t until the window opens, zero while it's
+// open.
+func (w Window) until(t time.Time) time.Duration {
+	if w == (Window{}) {
+		return 0
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	now := t.Sub(midnight)
+	open := now >= w.Start && now < w.End
+	if w.Start > w.End {
+		open = now >= w.Start || now < w.End
+	}
+	if open {
+		return 0
+	}
+	if now < w.Start {
+		return w.Start - now
+	}
+	return 24*time.Hour - now + w.Start
+}
+
+// loadDialect is implemented by dialects that report how far a database
+// lags and how busy it is, for Throttle.MaxLag and Throttle.MaxActive.
+type loadDialect interface {
+	// replicationLag is how far the database, a replica, lags behind its
+	// primary, or how far its slowest replica lags behind it, zero
+	// without either.
+	replicationLag(ctx context.Context, db *DB) (time.Duration, error)
+	// activeQueries is how many queries are running on the database.
+	activeQueries(ctx context.Context, db *DB) (int, error)
+}
+
+// throttle enforces a database's Throttle, shared by every comparison on
+// it.
+type throttle struct {
+	limits Throttle
+	heavy  chan struct{}
+
+	mu sync.Mutex
+	// next is when the next query may start
+	next time.Time
+	// checked is when the lag and load were last checked, and paused why
+	// the queries wait, if they do
+	checked time.Time
+	paused  string
+}
+
+func newThrottle(limits Throttle) *throttle {
+	if !limits.set() {
+		return nil
+	}
+	if limits.CheckEvery <= 0 {
+		limits.CheckEvery = defaultThrottleCheck
+	}
+	t := &throttle{limits: limits}
+	if limits.HeavyQueries > 0 {
+		t.heavy = make(chan struct{}, limits.HeavyQueries)
+	}
+	return t
+}
+
+// acquire waits until a query may run on the database and returns the
+// function that ends it. It only fails when ctx is done.
+func (db *DB) acquire(ctx context.Context) (func(), error) {
+	t := db.throttle
+	if t == nil {
+		return func() {}, nil
+	}
+	if err := t.waitForWindow(ctx, db); err != nil {
+		return nil, err
+	}
+	if err := t.waitForLoad(ctx, db); err != nil {
+		return nil, err
+	}
+	if err := t.waitForRate(ctx); err != nil {
+		return nil, err
+	}
+	if t.heavy == nil {
+		return func() {}, nil
+	}
+	select {
+	case t.heavy <- struct{}{}:
+		return func() { <-t.heavy }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *throttle) waitForWindow(ctx context.Context, db *DB) error {
+	wait := t.limits.Window.until(time.Now())
+	if wait == 0 {
+		return nil
+	}
+	db.log.Infow("Waiting for the database's window", "window", t.limits.Window, "in", wait.Round(time.Second))
+	return sleep(ctx, wait)
+}
+
+// waitForLoad waits while the lag or load is over its bound, checking them
+// again every CheckEvery. A check that fails lets the queries run.
+func (t *throttle) waitForLoad(ctx context.Context, db *DB) error {
+	dialect, ok := db.Dialect.(loadDialect)
+	if !ok || (t.limits.MaxLag <= 0 && t.limits.MaxActive <= 0) {
+		return nil
+	}
+	for {
+		t.mu.Lock()
+		if time.Since(t.checked) >= t.limits.CheckEvery {
+			was := t.paused
+			t.paused = t.check(ctx, db, dialect)
+			t.checked = time.Now()
+			switch {
+			case t.paused != "" && was == "":
+				db.log.Warnw("Pausing the comparisons", "reason", t.paused, "recheck", t.limits.CheckEvery)
+			case t.paused == "" && was != "":
+				db.log.Infow("Resuming the comparisons")
+			}
+		}
+		paused := t.paused
+		t.mu.Unlock()
+		if paused == "" {
+			return nil
+		}
+		if err := sleep(ctx, t.limits.CheckEvery); err != nil {
+			return err
+		}
+	}
+}
+
+// check returns why the queries should pause, if they should.
+func (t *throttle) check(ctx context.Context, db *DB, dialect loadDialect) string {
+	ctx, cancel := context.WithTimeout(ctx, t.limits.CheckEvery)
+	defer cancel()
+	if t.limits.MaxLag > 0 {
+		lag, err := dialect.replicationLag(ctx, db)
+		if err != nil {
+			db.log.Warnw("Couldn't check the replication lag", "error", err)
+		} else if lag > t.limits.MaxLag {
+			return fmt.Sprintf("replication lag of %s over %s", lag.Round(time.Second), t.limits.MaxLag)
+		}
+	}
+	if t.limits.MaxActive > 0 {
+		active, err := dialect.activeQueries(ctx, db)
+		if err != nil {
+			db.log.Warnw("Couldn't check the active queries", "error", err)
+		} else if active > t.limits.MaxActive {
+			return fmt.Sprintf("%d active queries, over %d", active, t.limits.MaxActive)
+		}
+	}
+	return ""
+}
+
+// waitForRate spaces the queries' starts 1/QueriesPerSecond apart.
+func (t *throttle) waitForRate(ctx context.Context) error {
+	if t.limits.QueriesPerSecond <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	now := time.Now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	t.next = start.Add(time.Duration(float64(time.Second) / t.limits.QueriesPerSecond))
+	t.mu.Unlock()
+	return sleep(ctx, time.Until(start))
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package dbdiff
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLS modes, named after libpq's sslmode values.
+const (
+	TLSDisable    = "disable"
+	TLSRequire    = "require"
+	TLSVerifyCA   = "verify-ca"
+	TLSVerifyFull = "verify-full"
+)
+
+// TLS configures how a connection is encrypted, overriding whatever its
+// connection string sets.
+type TLS struct {
+	// Mode is TLSDisable, TLSRequire (encrypted without verifying the
+	// server), TLSVerifyCA (the server's certificate is signed by a trusted
+	// CA) or TLSVerifyFull (it's also issued for the host connected to).
+	// Empty leaves the connection string's settings alone.
+	Mode string
+	// RootCert is a PEM file of the CAs trusted to sign the server's
+	// certificate, instead of the system's.
+	RootCert string
+	// Cert and Key are PEM files of the client certificate and its key,
+	// for servers requiring mutual TLS.
+	Cert, Key string
+}
+
+// tlsDialect is implemented by dialects that can apply TLS options to their
+// DSN.
+type tlsDialect interface {
+	withTLS(dsn string, options TLS) (string, error)
+}
+
+func (t TLS) check() error {
+	switch t.Mode {
+	case "":
+		if t != (TLS{}) {
+			return errors.New("TLS certificates require a TLS mode")
+		}
+	case TLSDisable, TLSRequire, TLSVerifyCA, TLSVerifyFull:
+	default:
+		return fmt.Errorf("unknown TLS mode %q, expected %s, %s, %s or %s", t.Mode, TLSDisable, TLSRequire, TLSVerifyCA, TLSVerifyFull)
+	}
+	if (t.Cert == "") != (t.Key == "") {
+		return errors.New("a TLS client certificate requires its key and the other way round")
+	}
+	return nil
+}
+
+// applyTLS sets up the DSN's TLS options.
+func applyTLS(dialect Dialect, dsn string, options TLS) (string, error) {
+	if options == (TLS{}) {
+		return dsn, nil
+	}
+	if err := options.check(); err != nil {
+		return "", fmt.Errorf("%s: %w", dialect.Name(), err)
+	}
+	tlsDialect, ok := dialect.(tlsDialect)
+	if !ok {
+		return "", fmt.Errorf("%s connections don't take TLS options", dialect.Name())
+	}
+	dsn, err := tlsDialect.withTLS(dsn, options)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", dialect.Name(), err)
+	}
+	return dsn, nil
+}
+
+// config builds the tls.Config for drivers that take one rather than the
+// certificates' paths. It's nil with TLSDisable.
+func (t TLS) config(serverName string) (*tls.Config, error) {
+	if t.Mode == TLSDisable {
+		return nil, nil
+	}
+	config := &tls.Config{ServerName: serverName}
+	if t.RootCert != "" {
+		pem, err := os.ReadFile(t.RootCert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", t.RootCert)
+		}
+	}
+	if t.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch t.Mode {
+	case TLSRequire:
+		config.InsecureSkipVerify = true
+	case TLSVerifyCA:
+		// verify the chain ourselves, without the host name
+		config.InsecureSkipVerify = true
+		roots := config.RootCAs
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for i, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs[i] = cert
+			}
+			if len(certs) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			intermediates := x509.NewCertPool()
+			for _, cert := range certs[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+			return err
+		}
+	}
+	return config, nil
+}
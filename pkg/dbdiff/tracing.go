@@ -0,0 +1,60 @@
+package dbdiff
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer the spans come from.
+const instrumentationName = "databasediff/pkg/dbdiff"
+
+func (o Options) tracer() trace.Tracer {
+	if o.TracerProvider == nil {
+		return trace.NewNoopTracerProvider().Tracer(instrumentationName)
+	}
+	return o.TracerProvider.Tracer(instrumentationName)
+}
+
+// startTable starts the span of a table's comparison, which the queries on
+// each database are children of.
+func (c *Comparer) startTable(ctx context.Context, config TableConfig, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append([]attribute.KeyValue{attribute.String("databasediff.table", config.Name), attribute.String("databasediff.mode", c.Options.Mode)}, attrs...)
+	return c.Options.tracer().Start(ctx, "compare "+config.Name, trace.WithAttributes(attrs...))
+}
+
+// endTable ends the table's span with its counts, or its error.
+func endTable(span trace.Span, table *TableResult) {
+	span.SetAttributes(
+		attribute.Int("databasediff.source_rows", table.SourceRowCount),
+		attribute.Int("databasediff.dest_rows", table.DestRowCount),
+		attribute.String("databasediff.status", table.Status()),
+	)
+	endSpan(span, table.Err)
+}
+
+// startQuery starts the span of a query on the database.
+func (db *DB) startQuery(ctx context.Context, name string) (context.Context, trace.Span) {
+	tracer := db.tracer
+	if tracer == nil {
+		tracer = Options{}.tracer()
+	}
+	var system string
+	if db.Dialect != nil {
+		system = db.Dialect.Name()
+	}
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", system),
+		attribute.String("databasediff.database", db.ServiceName),
+	))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,185 @@
+package dbdiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHTunnel reaches a database through an SSH jump host, forwarding its
+// connections from a local port.
+type SSHTunnel struct {
+	// Host is the jump host as host or host:port. Empty connects to the
+	// database directly.
+	Host string
+	User string
+	// KeyFile is a private key to authenticate with, decrypted with
+	// Passphrase if it's encrypted. The keys of the SSH agent listening on
+	// SSH_AUTH_SOCK are also tried.
+	KeyFile, Passphrase string
+	// KnownHosts is the file the jump host's key is checked against,
+	// ~/.ssh/known_hosts when empty.
+	KnownHosts string
+}
+
+// tunnelDialect is implemented by dialects connecting to a host:port in
+// their connection string, which can be forwarded.
+type tunnelDialect interface {
+	defaultPort() string
+}
+
+// sshTunnel forwards connections accepted on a local port to the target
+// through the SSH client.
+type sshTunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	target   string
+	log      *zap.SugaredLogger
+	wg       sync.WaitGroup
+}
+
+// openTunnel connects to the jump host and points the connection string at
+// the tunnel's local end instead of the database.
+func openTunnel(conn string, config SSHTunnel, log *zap.SugaredLogger) (string, *sshTunnel, error) {
+	dialect := DialectFor(conn)
+	tunnels, ok := dialect.(tunnelDialect)
+	if !ok {
+		return "", nil, fmt.Errorf("%s connections can't be tunneled", dialect.Name())
+	}
+	u, err := url.Parse(conn)
+	if err != nil || u.Host == "" {
+		return "", nil, fmt.Errorf("%s: SSH tunnels need a connection URL with a host", dialect.Name())
+	}
+	target := u.Host
+	if u.Port() == "" {
+		target = net.JoinHostPort(u.Hostname(), tunnels.defaultPort())
+	}
+
+	clientConfig, err := config.clientConfig()
+	if err != nil {
+		return "", nil, fmt.Errorf("ssh %s: %w", config.Host, err)
+	}
+	host := config.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	client, err := ssh.Dial("tcp", host, clientConfig)
+	if err != nil {
+		return "", nil, fmt.Errorf("ssh %s: %w", config.Host, err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return "", nil, err
+	}
+	tunnel := &sshTunnel{client: client, listener: listener, target: target, log: log}
+	go tunnel.serve()
+	log.Debugw("Opened SSH tunnel", "jump_host", config.Host, "target", target, "local", listener.Addr().String())
+
+	u.Host = listener.Addr().String()
+	return u.String(), tunnel, nil
+}
+
+func (c SSHTunnel) clientConfig() (*ssh.ClientConfig, error) {
+	knownHosts := c.KnownHosts
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	var signers []ssh.Signer
+	if c.KeyFile != "" {
+		key, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var signer ssh.Signer
+		if c.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(c.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.KeyFile, err)
+		}
+		signers = append(signers, signer)
+	}
+	var auth []ssh.AuthMethod
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		agentConn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, fmt.Errorf("SSH agent: %w", err)
+		}
+		// the agent connection lives as long as the process
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers))
+	} else if len(signers) == 0 {
+		return nil, errors.New("no SSH key file given and no SSH agent running")
+	}
+	return &ssh.ClientConfig{User: c.User, Auth: auth, HostKeyCallback: hostKeys}, nil
+}
+
+func (t *sshTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			// closed
+			return
+		}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.forward(local)
+		}()
+	}
+}
+
+// forward copies between a local connection and a new one to the target,
+// until either side closes.
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+	remote, err := t.client.Dial("tcp", t.target)
+	if err != nil {
+		t.log.Warnw("Couldn't forward over the SSH tunnel", "target", t.target, "error", err)
+		return
+	}
+	defer remote.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// Close stops accepting connections and disconnects from the jump host,
+// which ends the forwarded connections.
+func (t *sshTunnel) Close() error {
+	t.listener.Close()
+	err := t.client.Close()
+	t.wg.Wait()
+	return err
+}
@@ -0,0 +1,128 @@
+package dbdiff
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	KindView             = "view"
+	KindMaterializedView = "materialized view"
+)
+
+// viewDialect is implemented by dialects that can compare views.
+type viewDialect interface {
+	// views lists the views and materialized views of a schema, or of the
+	// connection's current one when it's empty.
+	views(ctx context.Context, db *DB, schema string) ([]string, error)
+	// viewDefinition returns KindView or KindMaterializedView and the
+	// query defining the view, or an empty kind for tables.
+	viewDefinition(ctx context.Context, db *DB, tableName string) (kind, definition string, err error)
+}
+
+// refreshDialect is implemented by dialects that record when materialized
+// views were last refreshed. lastRefresh returns the zero time for tables,
+// views and materialized views never refreshed.
+type refreshDialect interface {
+	lastRefresh(ctx context.Context, db *DB, tableName string) (time.Time, error)
+}
+
+// scanViewDefinition reads a view's kind and definition, which a table
+// has no row for.
+func scanViewDefinition(row *sql.Row) (kind, definition string, err error) {
+	var text sql.NullString
+	if err := row.Scan(&kind, &text); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	return kind, text.String, nil
+}
+
+// compareViewDefinitions diffs the queries defining a view on both
+// databases, reporting a view compared against a table as a difference in
+// kind. Definitions are compared with their whitespace collapsed.
+func compareViewDefinitions(ctx context.Context, databases *Databases, table *TableResult, config TableConfig) error {
+	_, sourceOK := databases.source.Dialect.(viewDialect)
+	_, destOK := databases.dest.Dialect.(viewDialect)
+	if !sourceOK || !destOK {
+		return nil
+	}
+	var sourceKind, sourceDefinition, destKind, destDefinition string
+	err := bothSides(func() (err error) {
+		sourceKind, sourceDefinition, err = getViewDefinition(ctx, &databases.source, config.Name)
+		return err
+	}, func() (err error) {
+		destKind, destDefinition, err = getViewDefinition(ctx, &databases.dest, config.onDest().Name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if sourceKind == "" && destKind == "" {
+		return nil
+	}
+	name := ParseTableRef(config.Name).Name
+	if sourceKind != destKind {
+		table.addSchemaDifference(name, "kind", kindOrTable(sourceKind), kindOrTable(destKind))
+		return nil
+	}
+	if normalizeDefinition(sourceDefinition) != normalizeDefinition(destDefinition) {
+		table.addSchemaDifference(name, sourceKind+" definition", sourceDefinition, destDefinition)
+	}
+	return nil
+}
+
+func getViewDefinition(ctx context.Context, db *DB, tableName string) (kind, definition string, err error) {
+	kind, definition, err = db.Dialect.(viewDialect).viewDefinition(ctx, db, tableName)
+	if err != nil {
+		return "", "", db.wrap(err)
+	}
+	return kind, definition, nil
+}
+
+func kindOrTable(kind string) string {
+	if kind == "" {
+		return "table"
+	}
+	return kind
+}
+
+// normalizeDefinition collapses runs of whitespace and drops a trailing
+// semicolon, which engines keep or add as the view was written.
+func normalizeDefinition(definition string) string {
+	return strings.TrimSuffix(strings.Join(strings.Fields(definition), " "), ";")
+}
+
+// readRefreshes records when a materialized view was last refreshed on both
+// databases, with Options.Views, for engines that keep track.
+func (c *Comparer) readRefreshes(ctx context.Context, table *TableResult, config TableConfig) error {
+	if !c.Options.Views {
+		return nil
+	}
+	source, dest := &c.databases.source, &c.databases.dest
+	return bothSides(func() (err error) {
+		table.SourceRefreshed, err = lastRefresh(ctx, source, config.Name)
+		return err
+	}, func() (err error) {
+		table.DestRefreshed, err = lastRefresh(ctx, dest, config.onDest().Name)
+		return err
+	})
+}
+
+func lastRefresh(ctx context.Context, db *DB, tableName string) (time.Time, error) {
+	dialect, ok := db.Dialect.(refreshDialect)
+	if !ok {
+		return time.Time{}, nil
+	}
+	refreshed, err := dialect.lastRefresh(ctx, db, tableName)
+	if err != nil {
+		return time.Time{}, db.wrap(fmt.Errorf("reading the last refresh of %s: %w", tableName, err))
+	}
+	return refreshed, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"plugin"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// loadPlugins opens the Go plugins, whose init functions register their
+// strategies with dbdiff.RegisterStrategy. Plugins have to be built with the
+// same Go version and dependencies as the binary, which the plugin package
+// only supports on Linux, macOS and FreeBSD.
+func loadPlugins(paths []string) error {
+	for _, path := range paths {
+		before := len(dbdiff.Strategies())
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("loading the plugin %s: %w", path, err)
+		}
+		logger.Infow("Loaded the plugin", "plugin", path, "strategies", len(dbdiff.Strategies())-before)
+	}
+	return nil
+}
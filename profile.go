@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// profileSetting matches the keys of a profile's settings, which become the
+// names of environment variables.
+var profileSetting = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// applyProfiles sets the environment variables of the source and the
+// destination from the profiles picked, overriding those set otherwise:
+// --source-profile's source, or else --profile's, and --dest-profile's
+// destination, or else --profile's. Settings a profile leaves out still come
+// from the environment.
+func applyProfiles(profiles map[string]dbdiff.Profile, profile, sourceProfile, destProfile string) error {
+	if sourceProfile == "" {
+		sourceProfile = profile
+	}
+	if destProfile == "" {
+		destProfile = profile
+	}
+	for _, side := range []struct {
+		profile, prefix, name string
+		settings              func(dbdiff.Profile) map[string]string
+	}{
+		{sourceProfile, "SRC", "source", func(p dbdiff.Profile) map[string]string { return p.Source }},
+		{destProfile, "DEST", "dest", func(p dbdiff.Profile) map[string]string { return p.Dest }},
+	} {
+		if side.profile == "" {
+			continue
+		}
+		picked, ok := profiles[side.profile]
+		if !ok {
+			names := make([]string, 0, len(profiles))
+			for name := range profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown profile %q (available: %s)", side.profile, strings.Join(names, ", "))
+		}
+		settings := side.settings(picked)
+		if settings == nil {
+			return fmt.Errorf("profile %s has no %s", side.profile, side.name)
+		}
+		for key, value := range settings {
+			if !profileSetting.MatchString(key) {
+				return fmt.Errorf("profile %s: %s setting %q isn't a variable name", side.profile, side.name, key)
+			}
+			name := side.prefix + "_" + strings.ToUpper(key)
+			// the destinations' names aren't prefixed
+			if side.prefix == "DEST" && strings.EqualFold(key, "dests") {
+				name = "DESTS"
+			}
+			os.Setenv(name, value)
+		}
+	}
+	return nil
+}
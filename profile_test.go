@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"databasediff/pkg/dbdiff"
+)
+
+func TestApplyProfiles(t *testing.T) {
+	profiles := map[string]dbdiff.Profile{
+		"staging": {
+			Source: map[string]string{"conn": "postgres://staging-primary", "sslmode": "require"},
+			Dest:   map[string]string{"conn": "postgres://staging-replica", "dests": "eu,us"},
+		},
+		"prod":    {Source: map[string]string{"conn": "postgres://prod-primary"}, Dest: map[string]string{"conn": "postgres://prod-replica"}},
+		"archive": {Dest: map[string]string{"conn": "postgres://archive"}},
+		"bad":     {Source: map[string]string{"conn string": "x"}},
+	}
+	for _, test := range []struct {
+		name                                string
+		profile, sourceProfile, destProfile string
+		want                                map[string]string
+		err                                 string
+	}{
+		{"one profile", "staging", "", "", map[string]string{
+			"SRC_CONN": "postgres://staging-primary", "SRC_SSLMODE": "require", "DEST_CONN": "postgres://staging-replica", "DESTS": "eu,us",
+		}, ""},
+		{"source from another", "staging", "prod", "", map[string]string{
+			"SRC_CONN": "postgres://prod-primary", "SRC_SSLMODE": "from the environment", "DEST_CONN": "postgres://staging-replica",
+		}, ""},
+		{"dest only", "", "", "archive", map[string]string{"SRC_CONN": "from the environment", "DEST_CONN": "postgres://archive"}, ""},
+		{"unknown", "qa", "", "", nil, `unknown profile "qa" (available: archive, bad, prod, staging)`},
+		{"side missing", "", "archive", "", nil, "profile archive has no source"},
+		{"bad setting", "", "bad", "", nil, `profile bad: source setting "conn string" isn't a variable name`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"SRC_CONN", "SRC_SSLMODE", "DEST_CONN", "DESTS"} {
+				t.Setenv(name, "from the environment")
+			}
+			err := applyProfiles(profiles, test.profile, test.sourceProfile, test.destProfile)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range test.want {
+				if got := os.Getenv(name); got != value {
+					t.Errorf("%s is %q, want %q", name, got, value)
+				}
+			}
+		})
+	}
+}
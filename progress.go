@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// terminal shares stderr between the logs and a progress line updated in
+// place: the line is cleared before anything else is written to the terminal
+// and redrawn once that ends a line.
+type terminal struct {
+	mu   sync.Mutex
+	line string
+	// shown is whether the line is drawn, and midLine whether the last
+	// write left the cursor in the middle of a line of its own
+	shown, midLine bool
+}
+
+// isTerminal reports whether the file is a terminal rather than a pipe or
+// file, where a line updated in place would only be noise.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// isPipe reports whether f is a pipe, such as stdin with another command's
+// output piped in.
+func isPipe(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+func (t *terminal) Write(p []byte) (int, error) {
+	return t.around(os.Stderr).Write(p)
+}
+
+func (t *terminal) Sync() error {
+	return nil
+}
+
+// around returns a writer to the file that keeps the progress line below
+// whatever it writes.
+func (t *terminal) around(f *os.File) io.Writer {
+	return terminalWriter{t, f}
+}
+
+type terminalWriter struct {
+	t *terminal
+	f *os.File
+}
+
+func (w terminalWriter) Write(p []byte) (int, error) {
+	w.t.mu.Lock()
+	defer w.t.mu.Unlock()
+	if w.t.shown {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+		w.t.shown = false
+	}
+	n, err := w.f.Write(p)
+	if len(p) > 0 {
+		w.t.midLine = p[len(p)-1] != '\n'
+	}
+	w.t.draw()
+	return n, err
+}
+
+func (t *terminal) setLine(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.line = line
+	t.draw()
+}
+
+// draw shows the line unless there's a partial line to finish first.
+func (t *terminal) draw() {
+	if t.midLine || (t.line == "" && !t.shown) {
+		return
+	}
+	fmt.Fprint(os.Stderr, "\r"+t.line+"\x1b[K")
+	t.shown = t.line != ""
+}
+
+// progress redraws how many tables a round has compared, the rows scanned
+// and the time left. A nil progress shows nothing.
+type progress struct {
+	term     *terminal
+	comparer *dbdiff.MultiComparer
+	total    int
+	done     int32
+	start    time.Time
+	scanned  int64
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// startProgress shows the progress of comparing total tables, unless the
+// terminal is nil because progress is off.
+func (t *terminal) startProgress(comparer *dbdiff.MultiComparer, total int) *progress {
+	if t == nil {
+		return nil
+	}
+	p := &progress{
+		term: t, comparer: comparer, total: total, start: time.Now(), scanned: comparer.RowsScanned(),
+		stop: make(chan struct{}), stopped: make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *progress) run() {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		p.term.setLine(p.String())
+		select {
+		case <-p.stop:
+			close(p.stopped)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *progress) tableDone() {
+	if p != nil {
+		atomic.AddInt32(&p.done, 1)
+		p.term.setLine(p.String())
+	}
+}
+
+// finish stops updating the progress and clears it.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	p.term.setLine("")
+}
+
+func (p *progress) String() string {
+	done := int(atomic.LoadInt32(&p.done))
+	elapsed := time.Since(p.start)
+	line := fmt.Sprintf("%d/%d tables, %d rows scanned, %s elapsed", done, p.total,
+		p.comparer.RowsScanned()-p.scanned, elapsed.Round(time.Second))
+	if done > 0 && done < p.total {
+		remaining := elapsed / time.Duration(done) * time.Duration(p.total-done)
+		line += fmt.Sprintf(", ETA %s", remaining.Round(time.Second))
+	}
+	return line
+}
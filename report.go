@@ -0,0 +1,1318 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// ReportWriter renders table diffs in a particular output format. Writers
+// receive the replication status of the destinations before the run, the
+// header once, every table diff as it arrives, the results of the configured
+// checks, and Close when the run is complete so formats that need the whole
+// result set can render it.
+type ReportWriter interface {
+	WriteReplication(statuses []dbdiff.ReplicationStatus) error
+	WriteHeader() error
+	WriteTableResult(tableDiff dbdiff.TableResult) error
+	WriteCheckResults(checks []dbdiff.CheckResult) error
+	Close() error
+}
+
+// reportColumn describes a single column of the report, shared by every
+// writer so all formats stay in sync.
+type reportColumn struct {
+	Header  string
+	Numeric bool
+	Value   func(dbdiff.TableResult) string
+	// Drift, when set, returns the result whose drift the column shows, if
+	// any, which the text report colors by its severity.
+	Drift func(dbdiff.TableResult) (dbdiff.TableResult, bool)
+}
+
+// ownDrift is the Drift of a column showing the table's own drift.
+func ownDrift(t dbdiff.TableResult) (dbdiff.TableResult, bool) {
+	return t, true
+}
+
+// reportSection is a details table listing individual differences, rendered
+// after the summary.
+type reportSection struct {
+	Title   string
+	Headers []string
+	Rows    func(dbdiff.TableResult) [][]string
+}
+
+// reportLayout is the shape of a report: one summary row per table, followed
+// by optional details sections.
+type reportLayout struct {
+	Columns  []reportColumn
+	Sections []reportSection
+	// Run describes the comparison, for the formats that summarize it.
+	Run reportRun
+	// Severity grades the drift of the Drift columns, nil leaving them
+	// uncolored.
+	Severity func(dbdiff.TableResult) severity
+	// OnlyDrift leaves the tables that match out of the summary and the
+	// details, though not out of the run's totals.
+	OnlyDrift bool
+}
+
+// reportOptions are how the report shows the tables, rather than what it
+// shows of them.
+type reportOptions struct {
+	bySchema  bool
+	onlyDrift bool
+	severity  func(dbdiff.TableResult) severity
+}
+
+func (o reportOptions) apply(layout reportLayout) reportLayout {
+	if o.bySchema {
+		layout = groupBySchema(layout)
+	}
+	layout.Severity, layout.OnlyDrift = o.severity, o.onlyDrift
+	return layout
+}
+
+// lists reports whether the report lists the table: unless only drifting
+// tables are, those that failed too.
+func (l reportLayout) lists(tableDiff dbdiff.TableResult) bool {
+	return !l.OnlyDrift || tableDiff.Err != nil || l.Run.Drift == nil || l.Run.Drift(tableDiff) != 0
+}
+
+// reportRun is what was compared and how a table's drift is measured.
+type reportRun struct {
+	Mode      string
+	Databases []string
+	Drift     func(dbdiff.TableResult) int
+	// Results are the results of every pair a table's row stands for, when
+	// it isn't its own result
+	Results func(dbdiff.TableResult) []dbdiff.TableResult
+}
+
+func (l reportLayout) headers() []string {
+	headers := make([]string, len(l.Columns))
+	for i, column := range l.Columns {
+		headers[i] = column.Header
+	}
+	return headers
+}
+
+func (l reportLayout) values(tableDiff dbdiff.TableResult) []string {
+	values := make([]string, len(l.Columns))
+	for i, column := range l.Columns {
+		values[i] = column.Value(tableDiff)
+	}
+	return values
+}
+
+// collectedSection is a details section with the rows gathered so far.
+type collectedSection struct {
+	Title   string
+	Headers []string
+	Rows    [][]string
+}
+
+// reportDetails accumulates detail rows until the summary has been written,
+// and the totals of the run's summary.
+type reportDetails struct {
+	sections    []collectedSection
+	replication collectedSection
+	totals      reportTotals
+}
+
+func newReportDetails() reportDetails {
+	return reportDetails{totals: newReportTotals()}
+}
+
+// collect gathers the table's detail rows and totals and reports whether it
+// belongs in the summary, which tables that couldn't be compared don't:
+// they're only listed with their error. Neither are those the layout
+// doesn't list.
+func (d *reportDetails) collect(layout reportLayout, tableDiff dbdiff.TableResult) bool {
+	d.totals.add(layout, tableDiff)
+	if !layout.lists(tableDiff) {
+		return false
+	}
+	if d.sections == nil {
+		d.sections = make([]collectedSection, len(layout.Sections))
+		for i, section := range layout.Sections {
+			d.sections[i] = collectedSection{Title: section.Title, Headers: section.Headers}
+		}
+	}
+	for i, section := range layout.Sections {
+		d.sections[i].Rows = append(d.sections[i].Rows, section.Rows(tableDiff)...)
+	}
+	return tableDiff.Err == nil
+}
+
+// nonEmpty returns the sections that have at least one row, followed by the
+// replication status and the run's summary.
+func (d *reportDetails) nonEmpty() []collectedSection {
+	var sections []collectedSection
+	for _, section := range append(d.sections, d.replication) {
+		if len(section.Rows) > 0 {
+			sections = append(sections, section)
+		}
+	}
+	return append(sections, d.totals.section())
+}
+
+// WriteReplication adds a section listing how far behind each destination
+// replicating from its source is, after the checks'.
+func (d *reportDetails) WriteReplication(statuses []dbdiff.ReplicationStatus) error {
+	d.replication = collectedSection{Title: "Replication", Headers: []string{"Databases", "Replication", "Slot", "Connected", "Lag", "Replay delay", "Status"}}
+	for _, status := range statuses {
+		databases := status.Source + "/" + status.Dest
+		if status.Err != nil {
+			d.replication.Rows = append(d.replication.Rows, []string{databases, "-", "-", "-", "-", "-", status.Err.Error()})
+			continue
+		}
+		slot, connected, lag, delay, result := status.Slot, "no", "n/a", "n/a", "ok"
+		if slot == "" {
+			slot = "-"
+		}
+		if status.Active {
+			connected = "yes"
+		}
+		if status.LagBytes >= 0 {
+			lag = byteSize(status.LagBytes)
+		}
+		if status.ReplayDelay >= 0 {
+			delay = status.ReplayDelay.Round(time.Millisecond).String()
+		}
+		if status.Behind() {
+			result = "behind"
+		}
+		d.replication.Rows = append(d.replication.Rows, []string{databases, status.Kind, slot, connected, lag, delay, result})
+	}
+	return nil
+}
+
+// byteSize renders a number of bytes in the largest unit it holds one of.
+func byteSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// WriteCheckResults adds sections listing every check and the rows of those
+// that differ, after the tables' sections.
+func (d *reportDetails) WriteCheckResults(checks []dbdiff.CheckResult) error {
+	summary := collectedSection{Title: "Checks", Headers: []string{"Check", "Databases", "Result", "Detail"}}
+	differences := collectedSection{Title: "Check differences", Headers: []string{"Check", "Databases", "Row", "Difference"}}
+	for _, check := range checks {
+		databases := check.Source + "/" + check.Dest
+		result, detail := "ok", ""
+		switch source, dest, scalar := check.Scalar(); {
+		case check.Err != nil:
+			result, detail = "error", check.Err.Error()
+		case !check.Passed() && scalar:
+			result, detail = "differs", fmt.Sprintf("%s on %s, %s on %s", source, check.Source, dest, check.Dest)
+		case !check.Passed():
+			result, detail = "differs", fmt.Sprintf("%d only on %s, %d only on %s", len(check.OnlyInSource), check.Source, len(check.OnlyInDest), check.Dest)
+			for _, row := range check.OnlyInSource {
+				differences.Rows = append(differences.Rows, []string{check.Name, databases, strings.Join(row, ", "), "only on " + check.Source})
+			}
+			for _, row := range check.OnlyInDest {
+				differences.Rows = append(differences.Rows, []string{check.Name, databases, strings.Join(row, ", "), "only on " + check.Dest})
+			}
+		case scalar:
+			detail = source
+		}
+		summary.Rows = append(summary.Rows, []string{check.Name, databases, result, detail})
+	}
+	d.sections = append(d.sections, summary, differences)
+	return nil
+}
+
+var reportWriters = map[string]func(w io.Writer, layout reportLayout) ReportWriter{
+	"text":     newTextReportWriter,
+	"csv":      newCSVReportWriter,
+	"markdown": newMarkdownReportWriter,
+	"html":     newHTMLReportWriter,
+	"jsonl":    newJSONLReportWriter,
+}
+
+func reportFormats() []string {
+	formats := make([]string, 0, len(reportWriters))
+	for format := range reportWriters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func checkReportFormat(format string) error {
+	if _, ok := reportWriters[format]; !ok {
+		return fmt.Errorf("unknown report format %q (available: %s)", format, strings.Join(reportFormats(), ", "))
+	}
+	return nil
+}
+
+func newReportWriter(format string, w io.Writer, mode, sourceDB, destDB string, options reportOptions) (ReportWriter, error) {
+	if err := checkReportFormat(format); err != nil {
+		return nil, err
+	}
+	return reportWriters[format](w, options.apply(modeLayout(mode, sourceDB, destDB))), nil
+}
+
+// modeLayout is the report's layout for the mode, comparing sourceDB with
+// destDB.
+func modeLayout(mode, sourceDB, destDB string) reportLayout {
+	layout := reportLayout{Columns: countColumns(mode, sourceDB, destDB), Sections: []reportSection{partitionsSection(sourceDB, destDB), refreshesSection(sourceDB, destDB)}}
+	switch mode {
+	case dbdiff.ModeRows:
+		layout = rowsLayout(mode, sourceDB, destDB)
+	case dbdiff.ModeChecksum:
+		layout = checksumLayout(mode, sourceDB, destDB)
+	case dbdiff.ModeSchema:
+		layout = schemaLayout(sourceDB, destDB)
+	case dbdiff.ModeSequences:
+		layout = sequencesLayout(sourceDB, destDB)
+	case dbdiff.ModeSample:
+		layout = sampleLayout(mode, sourceDB, destDB)
+	case dbdiff.ModeFreshness:
+		layout = freshnessLayout(sourceDB, destDB)
+	case dbdiff.ModeAggregates:
+		layout = aggregatesLayout(sourceDB, destDB)
+	case dbdiff.ModeGroups:
+		layout = groupsLayout(mode, sourceDB, destDB)
+	case dbdiff.ModeKeys:
+		layout = keysLayout(mode, sourceDB, destDB)
+	case dbdiff.ModeGrants:
+		layout = grantsLayout(sourceDB, destDB)
+	case dbdiff.ModeMembership:
+		layout = membershipLayout(mode, sourceDB, destDB)
+	case dbdiff.ModeDistinct:
+		layout = distinctLayout(mode, sourceDB, destDB)
+	default:
+		// strategies report their findings like rows mode
+		if dbdiff.IsStrategy(mode) {
+			layout = rowsLayout(mode, sourceDB, destDB)
+		}
+	}
+	layout.Sections = append(layout.Sections, examplesSection(sourceDB, destDB), errorsSection)
+	layout.Run = reportRun{Mode: mode, Databases: []string{sourceDB, destDB}, Drift: func(t dbdiff.TableResult) int {
+		diff, _ := t.Drift(mode)
+		return diff
+	}}
+	return layout
+}
+
+// partitionsSection lists the partitions whose counts differ, pointing to
+// the part of a partitioned table that's off.
+func partitionsSection(sourceDB, destDB string) reportSection {
+	return reportSection{
+		Title:   "Differing partitions",
+		Headers: []string{"Table", "Partition", sourceDB, destDB, "Diff"},
+		Rows: func(t dbdiff.TableResult) [][]string {
+			var rows [][]string
+			for _, partition := range t.Partitions {
+				if partition.SourceCount != partition.DestCount {
+					rows = append(rows, []string{t.Name, partition.Name,
+						strconv.Itoa(partition.SourceCount), strconv.Itoa(partition.DestCount), strconv.Itoa(partition.SourceCount - partition.DestCount)})
+				}
+			}
+			return rows
+		},
+	}
+}
+
+// refreshesSection lists when the materialized views were last refreshed on
+// each database, exposing one that stopped refreshing.
+func refreshesSection(sourceDB, destDB string) reportSection {
+	refreshed := func(t time.Time) string {
+		if t.IsZero() {
+			return "n/a"
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return reportSection{
+		Title:   "Materialized view refreshes",
+		Headers: []string{"Table", sourceDB + " refreshed", destDB + " refreshed"},
+		Rows: func(t dbdiff.TableResult) [][]string {
+			if t.SourceRefreshed.IsZero() && t.DestRefreshed.IsZero() {
+				return nil
+			}
+			return [][]string{{t.Name, refreshed(t.SourceRefreshed), refreshed(t.DestRefreshed)}}
+		},
+	}
+}
+
+// examplesSection lists the rows found on one side only of tables whose
+// counts or checksums differ.
+func examplesSection(sourceDB, destDB string) reportSection {
+	sides := map[string]string{dbdiff.MissingInDest: "only in " + sourceDB, dbdiff.MissingInSource: "only in " + destDB}
+	return reportSection{
+		Title:   "Example rows",
+		Headers: []string{"Table", "Key", "Difference", "Row"},
+		Rows: func(t dbdiff.TableResult) [][]string {
+			var rows [][]string
+			for _, example := range t.Examples {
+				rows = append(rows, []string{t.Name, example.Key, sides[example.Kind], example.Row})
+			}
+			return rows
+		},
+	}
+}
+
+// errorsSection lists the tables that couldn't be compared.
+var errorsSection = reportSection{
+	Title:   "Errors",
+	Headers: []string{"Table", "Status", "Error"},
+	Rows: func(t dbdiff.TableResult) [][]string {
+		if t.Err == nil {
+			return nil
+		}
+		return [][]string{{t.Name, t.Status(), t.Err.Error()}}
+	},
+}
+
+// reportSorts are the orders --sort writes the tables in: the most drifted
+// first, after those that failed, by name, or the slowest first.
+var reportSorts = []string{"diff", "name", "duration"}
+
+// reportOrder is the order the report lists the tables in. Without a sort
+// or schemas, the tables are written as they're compared.
+type reportOrder struct {
+	mode     string
+	bySchema bool
+	sort     string
+}
+
+func (o reportOrder) streams() bool {
+	return !o.bySchema && o.sort == ""
+}
+
+// sortResults orders the tables by schema, when grouped by schema, and then
+// by the sort, each table by the worst of its results on every pair.
+func (o reportOrder) sortResults(results []dbdiff.MultiResult) {
+	type key struct {
+		ref      dbdiff.TableRef
+		failed   bool
+		diff     int
+		duration time.Duration
+	}
+	keys := make(map[string]key, len(results))
+	for _, result := range results {
+		k := key{ref: dbdiff.ParseTableRef(result.Name)}
+		for _, table := range result.Results {
+			diff, _ := table.Drift(o.mode)
+			if diff = abs(diff); diff > k.diff {
+				k.diff = diff
+			}
+			if table.Duration > k.duration {
+				k.duration = table.Duration
+			}
+			k.failed = k.failed || table.Err != nil
+		}
+		keys[result.Name] = k
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := keys[results[i].Name], keys[results[j].Name]
+		if o.bySchema && a.ref.Schema != b.ref.Schema {
+			return a.ref.Schema < b.ref.Schema
+		}
+		switch o.sort {
+		case "diff":
+			if a.failed != b.failed {
+				return a.failed
+			}
+			if a.diff != b.diff {
+				return a.diff > b.diff
+			}
+		case "duration":
+			if a.duration != b.duration {
+				return a.duration > b.duration
+			}
+		}
+		// ties are in name order
+		if o.bySchema {
+			return a.ref.Name < b.ref.Name
+		}
+		return results[i].Name < results[j].Name
+	})
+}
+
+// groupBySchema splits the summary's Table column into Schema and Table.
+func groupBySchema(layout reportLayout) reportLayout {
+	columns := []reportColumn{
+		{Header: "Schema", Value: func(t dbdiff.TableResult) string { return dbdiff.ParseTableRef(t.Name).Schema }},
+		{Header: "Table", Value: func(t dbdiff.TableResult) string { return dbdiff.ParseTableRef(t.Name).Name }},
+	}
+	layout.Columns = append(columns, layout.Columns[1:]...)
+	return layout
+}
+
+// countColumns are the tables' row counts and the drift the mode's
+// thresholds are checked against, which is the difference in row counts only
+// in count mode.
+func countColumns(mode, sourceDB, destDB string) []reportColumn {
+	return []reportColumn{
+		{Header: "Table", Value: func(t dbdiff.TableResult) string { return t.Name }},
+		{Header: sourceDB, Numeric: true, Value: func(t dbdiff.TableResult) string { return formatCount(t, t.SourceRowCount) }},
+		{Header: destDB, Numeric: true, Value: func(t dbdiff.TableResult) string { return formatCount(t, t.DestRowCount) }},
+		{Header: "Diff", Numeric: true, Drift: ownDrift, Value: func(t dbdiff.TableResult) string {
+			diff, _ := t.Drift(mode)
+			return formatCount(t, diff)
+		}},
+	}
+}
+
+// formatCount marks estimated counts with a leading ~.
+func formatCount(t dbdiff.TableResult, count int) string {
+	if t.Approximate {
+		return "~" + strconv.Itoa(count)
+	}
+	return strconv.Itoa(count)
+}
+
+func rowsLayout(mode, sourceDB, destDB string) reportLayout {
+	columns := append(countColumns(mode, sourceDB, destDB),
+		reportColumn{Header: "Only in " + sourceDB, Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.OnlyInSource) }},
+		reportColumn{Header: "Only in " + destDB, Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.OnlyInDest) }},
+		reportColumn{Header: "Mismatched", Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.Mismatched) }},
+	)
+	return reportLayout{
+		Columns:  columns,
+		Sections: []reportSection{rowDifferencesSection(sourceDB, destDB), differingColumnsSection, columnDifferencesSection(sourceDB, destDB)},
+	}
+}
+
+// sampleLayout shows what the sample found next to the differences it
+// extrapolates to.
+func sampleLayout(mode, sourceDB, destDB string) reportLayout {
+	columns := append(countColumns(mode, sourceDB, destDB),
+		reportColumn{Header: "Sampled", Numeric: true, Value: func(t dbdiff.TableResult) string {
+			return strconv.Itoa(t.SampledSource) + "/" + strconv.Itoa(t.SampledDest)
+		}},
+		reportColumn{Header: "Differing in sample", Numeric: true, Value: func(t dbdiff.TableResult) string {
+			return strconv.Itoa(t.OnlyInSource + t.OnlyInDest + t.Mismatched)
+		}},
+		reportColumn{Header: "Est. differing rows", Numeric: true, Value: func(t dbdiff.TableResult) string {
+			diff, low, high := t.SampleEstimate()
+			return fmt.Sprintf("~%d (%d-%d)", diff, low, high)
+		}},
+	)
+	return reportLayout{
+		Columns:  columns,
+		Sections: []reportSection{rowDifferencesSection(sourceDB, destDB), differingColumnsSection, columnDifferencesSection(sourceDB, destDB)},
+	}
+}
+
+// membershipLayout shows the keys the filters estimate are missing from
+// either database, and in which key ranges.
+func membershipLayout(mode, sourceDB, destDB string) reportLayout {
+	columns := append(countColumns(mode, sourceDB, destDB),
+		reportColumn{Header: "Est. only in " + sourceDB, Numeric: true, Drift: ownDrift, Value: func(t dbdiff.TableResult) string {
+			onlyInSource, _ := t.MembershipEstimate()
+			return "~" + strconv.Itoa(onlyInSource)
+		}},
+		reportColumn{Header: "Est. only in " + destDB, Numeric: true, Drift: ownDrift, Value: func(t dbdiff.TableResult) string {
+			_, onlyInDest := t.MembershipEstimate()
+			return "~" + strconv.Itoa(onlyInDest)
+		}},
+		reportColumn{Header: "Differing chunks", Numeric: true, Value: func(t dbdiff.TableResult) string {
+			return fmt.Sprintf("%d/%d", len(t.DifferingFilters), t.Chunks)
+		}},
+	)
+	return reportLayout{
+		Columns: columns,
+		Sections: []reportSection{{
+			Title:   "Differing key ranges",
+			Headers: []string{"Table", "Key range", sourceDB + " rows", destDB + " rows", "Est. only in " + sourceDB, "Est. only in " + destDB},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				var rows [][]string
+				for _, chunk := range t.DifferingFilters {
+					rows = append(rows, []string{t.Name, chunk.Bounds, strconv.Itoa(chunk.SourceRows), strconv.Itoa(chunk.DestRows),
+						"~" + strconv.Itoa(chunk.OnlyInSource), "~" + strconv.Itoa(chunk.OnlyInDest)})
+				}
+				return rows
+			},
+		}},
+	}
+}
+
+// distinctLayout adds up the distinct counts' drift next to the row counts,
+// listing the columns whose distinct counts differ after the summary.
+func distinctLayout(mode, sourceDB, destDB string) reportLayout {
+	distinct := func(count dbdiff.DistinctCount, n int) string {
+		if count.Approximate {
+			return "~" + strconv.Itoa(n)
+		}
+		return strconv.Itoa(n)
+	}
+	columns := append(countColumns(mode, sourceDB, destDB),
+		reportColumn{Header: "Distinct diff", Numeric: true, Drift: ownDrift, Value: func(t dbdiff.TableResult) string {
+			return strconv.Itoa(t.DistinctDrift())
+		}},
+	)
+	return reportLayout{
+		Columns: columns,
+		Sections: []reportSection{{
+			Title:   "Differing distinct counts",
+			Headers: []string{"Table", "Columns", sourceDB, destDB, "Diff"},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				var rows [][]string
+				for _, count := range t.DistinctCounts {
+					if count.Source != count.Dest {
+						rows = append(rows, []string{t.Name, count.String(), distinct(count, count.Source), distinct(count, count.Dest), distinct(count, count.Source-count.Dest)})
+					}
+				}
+				return rows
+			},
+		}},
+	}
+}
+
+// freshnessLayout shows the latest change on each database, and how far the
+// destination trails the source.
+func freshnessLayout(sourceDB, destDB string) reportLayout {
+	latest := func(t time.Time) string {
+		if t.IsZero() {
+			return "none"
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return reportLayout{Columns: []reportColumn{
+		{Header: "Table", Value: func(t dbdiff.TableResult) string { return t.Name }},
+		{Header: sourceDB + " latest", Value: func(t dbdiff.TableResult) string { return latest(t.SourceLatest) }},
+		{Header: destDB + " latest", Value: func(t dbdiff.TableResult) string { return latest(t.DestLatest) }},
+		{Header: "Skew", Numeric: true, Drift: ownDrift, Value: func(t dbdiff.TableResult) string {
+			if skew, ok := t.Skew(); ok {
+				return skew.String()
+			}
+			return ""
+		}},
+	}}
+}
+
+// aggregatesLayout counts the differing aggregates of every table, listing
+// them after the summary.
+func aggregatesLayout(sourceDB, destDB string) reportLayout {
+	return reportLayout{
+		Columns: []reportColumn{
+			{Header: "Table", Value: func(t dbdiff.TableResult) string { return t.Name }},
+			{Header: "Aggregates", Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(len(t.Aggregates)) }},
+			{Header: "Differing", Numeric: true, Drift: ownDrift, Value: func(t dbdiff.TableResult) string {
+				diff, _ := t.Drift(dbdiff.ModeAggregates)
+				return strconv.Itoa(diff)
+			}},
+		},
+		Sections: []reportSection{{
+			Title:   "Differing aggregates",
+			Headers: []string{"Table", "Aggregate", sourceDB, destDB},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				var rows [][]string
+				for _, aggregate := range t.Aggregates {
+					if !aggregate.Equal {
+						rows = append(rows, []string{t.Name, aggregate.Aggregate.String(), aggregate.Source, aggregate.Dest})
+					}
+				}
+				return rows
+			},
+		}},
+	}
+}
+
+// groupsLayout counts the groups whose counts differ next to the totals,
+// listing them after the summary.
+func groupsLayout(mode, sourceDB, destDB string) reportLayout {
+	columns := append(countColumns(mode, sourceDB, destDB),
+		reportColumn{Header: "Groups", Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.Buckets) }},
+		reportColumn{Header: "Differing", Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(len(t.DifferingBuckets)) }},
+	)
+	return reportLayout{
+		Columns: columns,
+		Sections: []reportSection{{
+			Title:   "Differing groups",
+			Headers: []string{"Table", "Group", sourceDB, destDB, "Diff"},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				var rows [][]string
+				for _, bucket := range t.DifferingBuckets {
+					rows = append(rows, []string{t.Name, bucket.Bucket,
+						strconv.Itoa(bucket.SourceCount), strconv.Itoa(bucket.DestCount), strconv.Itoa(bucket.SourceCount - bucket.DestCount)})
+				}
+				return rows
+			},
+		}},
+	}
+}
+
+// keysLayout counts the missing keys and duplicate rows of each database
+// next to the totals, listing the gaps and duplicate keys after the summary.
+func keysLayout(mode, sourceDB, destDB string) reportLayout {
+	columns := append(countColumns(mode, sourceDB, destDB),
+		reportColumn{Header: "Missing in " + sourceDB, Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.FormatInt(t.SourceKeys.MissingKeys, 10) }},
+		reportColumn{Header: "Missing in " + destDB, Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.FormatInt(t.DestKeys.MissingKeys, 10) }},
+		reportColumn{Header: "Duplicates in " + sourceDB, Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.SourceKeys.DuplicateRows) }},
+		reportColumn{Header: "Duplicates in " + destDB, Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.DestKeys.DuplicateRows) }},
+	)
+	databases := []string{sourceDB, destDB}
+	return reportLayout{
+		Columns: columns,
+		Sections: []reportSection{{
+			Title:   "Key gaps",
+			Headers: []string{"Table", "Database", "Missing keys", "Count"},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				var rows [][]string
+				for i, scan := range []dbdiff.KeyScan{t.SourceKeys, t.DestKeys} {
+					for _, gap := range scan.Gaps {
+						keys := strconv.FormatInt(gap.First, 10)
+						if gap.Last != gap.First {
+							keys += "-" + strconv.FormatInt(gap.Last, 10)
+						}
+						rows = append(rows, []string{t.Name, databases[i], keys, strconv.FormatInt(gap.Last-gap.First+1, 10)})
+					}
+				}
+				return rows
+			},
+		}, {
+			Title:   "Duplicate keys",
+			Headers: []string{"Table", "Database", "Key", "Rows"},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				var rows [][]string
+				for i, scan := range []dbdiff.KeyScan{t.SourceKeys, t.DestKeys} {
+					for _, duplicate := range scan.Duplicates {
+						rows = append(rows, []string{t.Name, databases[i], duplicate.Key, strconv.Itoa(duplicate.Rows)})
+					}
+				}
+				return rows
+			},
+		}},
+	}
+}
+
+func rowDifferencesSection(sourceDB, destDB string) reportSection {
+	kinds := map[string]string{
+		dbdiff.MissingInDest:   "only in " + sourceDB,
+		dbdiff.MissingInSource: "only in " + destDB,
+		dbdiff.ValuesDiffer:    "values differ",
+	}
+	return reportSection{
+		Title:   "Row differences",
+		Headers: []string{"Table", "Key", "Difference"},
+		Rows: func(t dbdiff.TableResult) [][]string {
+			rows := make([][]string, len(t.Differences))
+			for i, difference := range t.Differences {
+				rows[i] = []string{t.Name, difference.Key, kinds[difference.Kind]}
+			}
+			if t.DroppedDifferences > 0 {
+				rows = append(rows, []string{t.Name, "", fmt.Sprintf("%d more past the memory limit", t.DroppedDifferences)})
+			}
+			return rows
+		},
+	}
+}
+
+// differingColumnsSection counts the mismatched rows each column differs in,
+// telling drift confined to a column from rows differing throughout.
+var differingColumnsSection = reportSection{
+	Title:   "Differing columns",
+	Headers: []string{"Table", "Column", "Mismatched rows"},
+	Rows: func(t dbdiff.TableResult) [][]string {
+		counts := map[string]int{}
+		var columns []string
+		for _, difference := range t.Differences {
+			for _, column := range difference.Columns {
+				if counts[column.Column] == 0 {
+					columns = append(columns, column.Column)
+				}
+				counts[column.Column]++
+			}
+		}
+		sort.SliceStable(columns, func(i, j int) bool { return counts[columns[i]] > counts[columns[j]] })
+		rows := make([][]string, len(columns))
+		for i, column := range columns {
+			rows[i] = []string{t.Name, column, strconv.Itoa(counts[column])}
+		}
+		return rows
+	},
+}
+
+// columnDifferencesSection lists the values of every differing column of the
+// mismatched rows side by side.
+func columnDifferencesSection(sourceDB, destDB string) reportSection {
+	return reportSection{
+		Title:   "Column differences",
+		Headers: []string{"Table", "Key", "Column", sourceDB, destDB},
+		Rows: func(t dbdiff.TableResult) [][]string {
+			var rows [][]string
+			for _, difference := range t.Differences {
+				for _, column := range difference.Columns {
+					rows = append(rows, []string{t.Name, difference.Key, column.Column, column.Source, column.Dest})
+				}
+			}
+			return rows
+		},
+	}
+}
+
+func checksumLayout(mode, sourceDB, destDB string) reportLayout {
+	columns := append(countColumns(mode, sourceDB, destDB),
+		reportColumn{Header: "Checksum", Value: func(t dbdiff.TableResult) string {
+			if len(t.MismatchedChunks) > 0 {
+				return "MISMATCH"
+			}
+			return "match"
+		}},
+		reportColumn{Header: "Mismatched chunks", Numeric: true, Value: func(t dbdiff.TableResult) string {
+			return fmt.Sprintf("%d/%d", len(t.MismatchedChunks), t.Chunks)
+		}},
+	)
+	return reportLayout{
+		Columns: columns,
+		Sections: []reportSection{
+			chunksSection("Mismatched key ranges", sourceDB, destDB, func(t dbdiff.TableResult) []dbdiff.ChunkChecksum { return t.MismatchedChunks }),
+			chunksSection("Localized key ranges", sourceDB, destDB, func(t dbdiff.TableResult) []dbdiff.ChunkChecksum { return t.DifferingRanges }),
+			rowDifferencesSection(sourceDB, destDB),
+			differingColumnsSection,
+			columnDifferencesSection(sourceDB, destDB),
+		},
+	}
+}
+
+func chunksSection(title, sourceDB, destDB string, chunks func(dbdiff.TableResult) []dbdiff.ChunkChecksum) reportSection {
+	return reportSection{
+		Title:   title,
+		Headers: []string{"Table", "Key range", sourceDB + " rows", destDB + " rows"},
+		Rows: func(t dbdiff.TableResult) [][]string {
+			var rows [][]string
+			for _, chunk := range chunks(t) {
+				rows = append(rows, []string{t.Name, chunk.Bounds, strconv.Itoa(chunk.SourceRows), strconv.Itoa(chunk.DestRows)})
+			}
+			return rows
+		},
+	}
+}
+
+func schemaLayout(sourceDB, destDB string) reportLayout {
+	return reportLayout{
+		Columns: []reportColumn{
+			{Header: "Table", Value: func(t dbdiff.TableResult) string { return t.Name }},
+			{Header: sourceDB + " columns", Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.SourceColumns) }},
+			{Header: destDB + " columns", Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.DestColumns) }},
+			{Header: "Drift", Numeric: true, Drift: ownDrift, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(len(t.SchemaDifferences)) }},
+		},
+		Sections: []reportSection{{
+			Title:   "Schema drift",
+			Headers: []string{"Table", "Object", "Attribute", sourceDB, destDB},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				rows := make([][]string, len(t.SchemaDifferences))
+				for i, difference := range t.SchemaDifferences {
+					rows[i] = []string{t.Name, difference.Object, difference.Attribute, difference.Source, difference.Dest}
+				}
+				return rows
+			},
+		}},
+	}
+}
+
+// grantsLayout counts the grantees holding privileges on each database,
+// listing the owners and privileges that differ.
+func grantsLayout(sourceDB, destDB string) reportLayout {
+	return reportLayout{
+		Columns: []reportColumn{
+			{Header: "Table", Value: func(t dbdiff.TableResult) string { return t.Name }},
+			{Header: sourceDB + " grantees", Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.SourceGrants) }},
+			{Header: destDB + " grantees", Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(t.DestGrants) }},
+			{Header: "Drift", Numeric: true, Drift: ownDrift, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(len(t.SchemaDifferences)) }},
+		},
+		Sections: []reportSection{{
+			Title:   "Privilege differences",
+			Headers: []string{"Table", "Grantee", "Attribute", sourceDB, destDB},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				rows := make([][]string, len(t.SchemaDifferences))
+				for i, difference := range t.SchemaDifferences {
+					rows[i] = []string{t.Name, difference.Object, difference.Attribute, difference.Source, difference.Dest}
+				}
+				return rows
+			},
+		}},
+	}
+}
+
+func sequencesLayout(sourceDB, destDB string) reportLayout {
+	return reportLayout{
+		Columns: []reportColumn{
+			{Header: "Table", Value: func(t dbdiff.TableResult) string { return t.Name }},
+			{Header: "Sequences", Numeric: true, Value: func(t dbdiff.TableResult) string { return strconv.Itoa(len(t.Sequences)) }},
+			{Header: "Drifting", Numeric: true, Drift: ownDrift, Value: func(t dbdiff.TableResult) string {
+				drifting := 0
+				for _, sequence := range t.Sequences {
+					if sequence.Drifts() {
+						drifting++
+					}
+				}
+				return strconv.Itoa(drifting)
+			}},
+		},
+		Sections: []reportSection{{
+			Title:   "Sequences",
+			Headers: []string{"Table", "Sequence", sourceDB, destDB, "Gap"},
+			Rows: func(t dbdiff.TableResult) [][]string {
+				rows := make([][]string, len(t.Sequences))
+				for i, sequence := range t.Sequences {
+					rows[i] = []string{t.Name, sequence.Name, formatNullInt(sequence.Source), formatNullInt(sequence.Dest), sequence.Gap()}
+				}
+				return rows
+			},
+		}},
+	}
+}
+
+func formatNullInt(value sql.NullInt64) string {
+	if !value.Valid {
+		return "NULL"
+	}
+	return strconv.FormatInt(value.Int64, 10)
+}
+
+type textReportWriter struct {
+	w      *tabwriter.Writer
+	layout reportLayout
+	reportDetails
+}
+
+func newTextReportWriter(w io.Writer, layout reportLayout) ReportWriter {
+	return &textReportWriter{w: tabwriter.NewWriter(w, 1, 1, 1, ' ', 0), layout: layout, reportDetails: newReportDetails()}
+}
+
+// severity is how bad a table's drift is, shown in color on terminals.
+type severity int
+
+const (
+	severityNone severity = iota
+	// severityMatch is no drift at all, severityDrift drift within the
+	// threshold, or without one, and severityExceeded drift past it
+	severityMatch
+	severityDrift
+	severityExceeded
+)
+
+// severityColors are the escape codes of the severities, all as long, as
+// tabwriter counts them in the cells' widths, and resetColor ends them.
+var severityColors = map[severity]string{
+	severityNone:     "\x1b[39m",
+	severityMatch:    "\x1b[32m",
+	severityDrift:    "\x1b[33m",
+	severityExceeded: "\x1b[31m",
+}
+
+const resetColor = "\x1b[0m"
+
+func (r *textReportWriter) WriteHeader() error {
+	headers := r.layout.headers()
+	if r.layout.Severity != nil {
+		for i, column := range r.layout.Columns {
+			if column.Drift != nil {
+				headers[i] = severityColors[severityNone] + headers[i] + resetColor
+			}
+		}
+	}
+	_, err := fmt.Fprintf(r.w, "\n%s\n", strings.Join(headers, "\t"))
+	return err
+}
+
+func (r *textReportWriter) WriteTableResult(tableDiff dbdiff.TableResult) error {
+	if !r.collect(r.layout, tableDiff) {
+		return nil
+	}
+	values := r.layout.values(tableDiff)
+	if r.layout.Severity != nil {
+		for i, column := range r.layout.Columns {
+			if column.Drift == nil {
+				continue
+			}
+			grade := severityNone
+			if result, ok := column.Drift(tableDiff); ok {
+				grade = r.layout.Severity(result)
+			}
+			values[i] = severityColors[grade] + values[i] + resetColor
+		}
+	}
+	_, err := fmt.Fprintf(r.w, "%s\n", strings.Join(values, "\t"))
+	return err
+}
+
+func (r *textReportWriter) Close() error {
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	for _, section := range r.nonEmpty() {
+		if _, err := fmt.Fprintf(r.w, "\n%s\n\n%s\n", section.Title, strings.Join(section.Headers, "\t")); err != nil {
+			return err
+		}
+		for _, row := range section.Rows {
+			if _, err := fmt.Fprintf(r.w, "%s\n", strings.Join(row, "\t")); err != nil {
+				return err
+			}
+		}
+		if err := r.w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type csvReportWriter struct {
+	w      *csv.Writer
+	layout reportLayout
+	reportDetails
+}
+
+func newCSVReportWriter(w io.Writer, layout reportLayout) ReportWriter {
+	return &csvReportWriter{w: csv.NewWriter(w), layout: layout, reportDetails: newReportDetails()}
+}
+
+func (r *csvReportWriter) WriteHeader() error {
+	return r.w.Write(r.layout.headers())
+}
+
+func (r *csvReportWriter) WriteTableResult(tableDiff dbdiff.TableResult) error {
+	if !r.collect(r.layout, tableDiff) {
+		return nil
+	}
+	return r.w.Write(r.layout.values(tableDiff))
+}
+
+// Close appends each details section as another header and set of records,
+// separated from the previous one by an empty record.
+func (r *csvReportWriter) Close() error {
+	for _, section := range r.nonEmpty() {
+		if err := r.w.Write(nil); err != nil {
+			return err
+		}
+		if err := r.w.Write(section.Headers); err != nil {
+			return err
+		}
+		if err := r.w.WriteAll(section.Rows); err != nil {
+			return err
+		}
+	}
+	r.w.Flush()
+	return r.w.Error()
+}
+
+type markdownReportWriter struct {
+	w      io.Writer
+	layout reportLayout
+	reportDetails
+}
+
+func newMarkdownReportWriter(w io.Writer, layout reportLayout) ReportWriter {
+	return &markdownReportWriter{w: w, layout: layout, reportDetails: newReportDetails()}
+}
+
+func (r *markdownReportWriter) WriteHeader() error {
+	numeric := make([]bool, len(r.layout.Columns))
+	for i, column := range r.layout.Columns {
+		numeric[i] = column.Numeric
+	}
+	return writeMarkdownHeader(r.w, r.layout.headers(), numeric)
+}
+
+func (r *markdownReportWriter) WriteTableResult(tableDiff dbdiff.TableResult) error {
+	if !r.collect(r.layout, tableDiff) {
+		return nil
+	}
+	return writeMarkdownRow(r.w, r.layout.values(tableDiff))
+}
+
+func (r *markdownReportWriter) Close() error {
+	for _, section := range r.nonEmpty() {
+		if _, err := fmt.Fprintf(r.w, "\n### %s\n\n", escapeMarkdown(section.Title)); err != nil {
+			return err
+		}
+		if err := writeMarkdownHeader(r.w, section.Headers, make([]bool, len(section.Headers))); err != nil {
+			return err
+		}
+		for _, row := range section.Rows {
+			if err := writeMarkdownRow(r.w, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeMarkdownHeader(w io.Writer, headers []string, numeric []bool) error {
+	escaped := make([]string, len(headers))
+	separators := make([]string, len(headers))
+	for i, header := range headers {
+		escaped[i] = escapeMarkdown(header)
+		separators[i] = "---"
+		if numeric[i] {
+			separators[i] = "---:"
+		}
+	}
+	_, err := fmt.Fprintf(w, "| %s |\n| %s |\n", strings.Join(escaped, " | "), strings.Join(separators, " | "))
+	return err
+}
+
+func writeMarkdownRow(w io.Writer, values []string) error {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = escapeMarkdown(value)
+	}
+	_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(escaped, " | "))
+	return err
+}
+
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// htmlReportWriter buffers every row and renders a single self-contained page
+// on Close, since the document can't be streamed incrementally. The page opens
+// with summary cards and the run's details, and every table's row expands to
+// its own rows of the details sections, such as its differing rows.
+type htmlReportWriter struct {
+	w       io.Writer
+	layout  reportLayout
+	summary []htmlTableRow
+	cards   htmlCards
+	reportDetails
+}
+
+// htmlTableRow is a table's summary row and its share of the details.
+type htmlTableRow struct {
+	Values  []string
+	Drift   int
+	Details []collectedSection
+}
+
+// htmlCards are the totals shown above the table list.
+type htmlCards struct {
+	Tables, Drifting, Errors, Drift int
+}
+
+func newHTMLReportWriter(w io.Writer, layout reportLayout) ReportWriter {
+	return &htmlReportWriter{w: w, layout: layout, reportDetails: newReportDetails()}
+}
+
+func (r *htmlReportWriter) WriteHeader() error {
+	return nil
+}
+
+func (r *htmlReportWriter) WriteTableResult(tableDiff dbdiff.TableResult) error {
+	r.cards.Tables++
+	if tableDiff.Err != nil {
+		r.cards.Errors++
+	}
+	if !r.collect(r.layout, tableDiff) {
+		return nil
+	}
+	row := htmlTableRow{Values: r.layout.values(tableDiff)}
+	if r.layout.Run.Drift != nil {
+		row.Drift = r.layout.Run.Drift(tableDiff)
+	}
+	if row.Drift > 0 {
+		r.cards.Drifting++
+		r.cards.Drift += row.Drift
+	}
+	for _, section := range r.layout.Sections {
+		if rows := section.Rows(tableDiff); len(rows) > 0 {
+			row.Details = append(row.Details, collectedSection{Title: section.Title, Headers: section.Headers, Rows: rows})
+		}
+	}
+	r.summary = append(r.summary, row)
+	return nil
+}
+
+// htmlRun is the run's details, both shown and embedded as JSON for tools
+// reading the page.
+type htmlRun struct {
+	Mode      string    `json:"mode"`
+	Databases []string  `json:"databases"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	Duration  string    `json:"duration"`
+	Tables    int       `json:"tables"`
+	Drifting  int       `json:"drifting"`
+	Errors    int       `json:"errors"`
+}
+
+func (r *htmlReportWriter) Close() error {
+	finished := time.Now()
+	run := htmlRun{
+		Mode:      r.layout.Run.Mode,
+		Databases: r.layout.Run.Databases,
+		Started:   r.totals.started,
+		Finished:  finished,
+		Duration:  finished.Sub(r.totals.started).Round(time.Millisecond).String(),
+		Tables:    r.cards.Tables,
+		Drifting:  r.cards.Drifting,
+		Errors:    r.cards.Errors,
+	}
+	return htmlReportTemplate.Execute(r.w, struct {
+		Generated string
+		Run       htmlRun
+		Cards     htmlCards
+		Columns   []reportColumn
+		Rows      []htmlTableRow
+		Sections  []collectedSection
+	}{finished.Format(time.RFC3339), run, r.cards, r.layout.Columns, r.summary, r.nonEmpty()})
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>databasediff report</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; }
+th { background: #f3f3f3; }
+#report > thead th { cursor: pointer; user-select: none; }
+td.numeric { text-align: right; font-variant-numeric: tabular-nums; }
+.cards { display: flex; gap: 1em; margin: 1em 0; }
+.card { border: 1px solid #ccc; border-radius: 6px; padding: 0.8em 1.2em; min-width: 8em; }
+.card .value { font-size: 1.8em; font-weight: 600; }
+.card.bad .value { color: #b42318; }
+dl.run { display: grid; grid-template-columns: max-content auto; gap: 2px 1em; }
+dl.run dt { font-weight: 600; }
+dl.run dd { margin: 0; }
+.filters { margin: 1em 0; }
+tr.drift > td:first-child { border-left: 4px solid #b42318; }
+tr.expandable { cursor: pointer; }
+tr.expandable > td:first-child::before { content: "\25B8  "; }
+tr.expandable.open > td:first-child::before { content: "\25BE  "; }
+tr.details > td { background: #fafafa; padding: 0.5em 1.5em; }
+tr.details h3 { font-size: 1em; margin: 0.6em 0 0.3em; }
+</style>
+</head>
+<body>
+<h1>databasediff report</h1>
+<div class="cards">
+<div class="card"><div class="value">{{.Cards.Tables}}</div>tables</div>
+<div class="card{{if .Cards.Drifting}} bad{{end}}"><div class="value">{{.Cards.Drifting}}</div>drifting</div>
+<div class="card{{if .Cards.Errors}} bad{{end}}"><div class="value">{{.Cards.Errors}}</div>failed</div>
+<div class="card"><div class="value">{{.Cards.Drift}}</div>total drift</div>
+</div>
+<dl class="run">
+{{- with .Run}}
+{{- if .Mode}}
+<dt>Mode</dt><dd>{{.Mode}}</dd>
+{{- end}}
+{{- if .Databases}}
+<dt>Databases</dt><dd>{{range $i, $d := .Databases}}{{if $i}}, {{end}}{{$d}}{{end}}</dd>
+{{- end}}
+<dt>Started</dt><dd>{{.Started.Format "2006-01-02T15:04:05Z07:00"}}</dd>
+<dt>Duration</dt><dd>{{.Duration}}</dd>
+{{- end}}
+<dt>Generated</dt><dd>{{.Generated}}</dd>
+</dl>
+<script type="application/json" id="run">{{.Run}}</script>
+<div class="filters">
+<input id="filter" type="search" placeholder="Filter tables" oninput="filterTables()">
+<label><input id="drifting" type="checkbox" onchange="filterTables()"> Only drifting tables</label>
+</div>
+{{- $columns := .Columns}}
+<table id="report">
+<thead>
+<tr>{{range $i, $c := .Columns}}<th data-numeric="{{$c.Numeric}}" onclick="sortTable({{$i}})">{{$c.Header}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr class="summary{{if .Drift}} drift{{end}}{{if .Details}} expandable{{end}}" data-drift="{{.Drift}}"{{if .Details}} onclick="toggleDetails(this)"{{end}}>{{range $i, $v := .Values}}<td{{if (index $columns $i).Numeric}} class="numeric"{{end}}>{{$v}}</td>{{end}}</tr>
+{{- if .Details}}
+<tr class="details" hidden><td colspan="{{len $columns}}">
+{{- range .Details}}
+<h3>{{.Title}}</h3>
+<table>
+<thead>
+<tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+</td></tr>
+{{- end}}
+{{- end}}
+</tbody>
+</table>
+{{- range .Sections}}
+<h2>{{.Title}}</h2>
+<table>
+<thead>
+<tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+<script>
+var sortState = {};
+// each summary row with its details row, if it has one, kept together
+function tableRows() {
+  var body = document.getElementById("report").tBodies[0];
+  return Array.prototype.filter.call(body.rows, function (row) {
+    return row.classList.contains("summary");
+  }).map(function (row) {
+    var next = row.nextElementSibling;
+    return {summary: row, details: next && next.classList.contains("details") ? next : null};
+  });
+}
+function sortTable(col) {
+  var table = document.getElementById("report");
+  var numeric = table.tHead.rows[0].cells[col].dataset.numeric === "true";
+  var asc = sortState[col] = !sortState[col];
+  var rows = tableRows();
+  rows.sort(function (a, b) {
+    var x = a.summary.cells[col].textContent, y = b.summary.cells[col].textContent;
+    var cmp = numeric ? parseFloat(x.replace("~", "")) - parseFloat(y.replace("~", "")) : x.localeCompare(y);
+    return asc ? cmp : -cmp;
+  });
+  rows.forEach(function (row) {
+    table.tBodies[0].appendChild(row.summary);
+    if (row.details) {
+      table.tBodies[0].appendChild(row.details);
+    }
+  });
+}
+function filterTables() {
+  var text = document.getElementById("filter").value.toLowerCase();
+  var drifting = document.getElementById("drifting").checked;
+  tableRows().forEach(function (row) {
+    var shown = row.summary.textContent.toLowerCase().indexOf(text) >= 0 &&
+      (!drifting || row.summary.dataset.drift !== "0");
+    row.summary.hidden = !shown;
+    if (row.details) {
+      row.details.hidden = !shown || !row.summary.classList.contains("open");
+    }
+  });
+}
+function toggleDetails(row) {
+  var open = row.classList.toggle("open");
+  row.nextElementSibling.hidden = !open;
+}
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// stateInterval is how often the state is written at most while the run
+// goes on, rewriting it being as costly as the results it holds.
+const stateInterval = 5 * time.Second
+
+// runState is a run's progress, written to --state as it goes so that
+// --resume continues a crashed or interrupted run where it left off: the
+// results of the tables already compared, which aren't compared again, and
+// how far the rows comparisons under way got.
+type runState struct {
+	path string
+	mu   sync.Mutex
+	// saved is when the state was last written, and dirty whether it
+	// changed since
+	saved time.Time
+	dirty bool
+	done  map[resultKey]bool
+
+	Mode      string   `json:"mode"`
+	Databases []string `json:"databases"`
+	// Tables are the tables compared without an error, whose results stand
+	Tables      []dbdiff.TableResult       `json:"tables"`
+	Checkpoints map[string]stateCheckpoint `json:"checkpoints,omitempty"`
+}
+
+// stateCheckpoint is a rows comparison's checkpoint, with its next key
+// typed so that it's read back as it was scanned. Next being named as the
+// embedded one is, it's written in its place.
+type stateCheckpoint struct {
+	dbdiff.RowsCheckpoint
+	Next []stateValue `json:"Next"`
+}
+
+type stateValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// openState starts the run's state afresh, or reads it back with resume,
+// failing when it's of a run of another mode or databases.
+func openState(path string, resume bool, mode string, databases []string) (*runState, error) {
+	state := &runState{path: path, done: map[resultKey]bool{}, Mode: mode, Databases: databases, Checkpoints: map[string]stateCheckpoint{}}
+	if !resume {
+		return state, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Infow("No state to resume from, comparing every table", "state", path)
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("state: %w", err)
+	}
+	var saved runState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("state %s: %w", path, err)
+	}
+	if saved.Mode != mode || strings.Join(saved.Databases, ",") != strings.Join(databases, ",") {
+		return nil, fmt.Errorf("state %s is of a %s comparison of %s, not of a %s comparison of %s",
+			path, saved.Mode, strings.Join(saved.Databases, ", "), mode, strings.Join(databases, ", "))
+	}
+	state.Tables = saved.Tables
+	for _, table := range state.Tables {
+		state.done[keyOf(table)] = true
+	}
+	if saved.Checkpoints != nil {
+		state.Checkpoints = saved.Checkpoints
+	}
+	return state, nil
+}
+
+// resumed splits the tables into those still to compare and the results of
+// those already compared. A table that only some pairs compared is compared
+// again on every pair.
+func (s *runState) resumed(names []dbdiff.TableConfig, comparer *dbdiff.MultiComparer) ([]dbdiff.TableConfig, []dbdiff.MultiResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byKey := make(map[resultKey]dbdiff.TableResult, len(s.Tables))
+	for _, table := range s.Tables {
+		byKey[keyOf(table)] = table
+	}
+	var remaining []dbdiff.TableConfig
+	var restored []dbdiff.MultiResult
+	// the results kept are those of the tables still being compared
+	s.Tables, s.done = nil, map[resultKey]bool{}
+	for _, config := range names {
+		result := dbdiff.MultiResult{Name: config.Name}
+		for _, pair := range comparer.Comparers() {
+			table, ok := byKey[resultKey{config.Name, pair.Source().ServiceName, pair.Dest().ServiceName}]
+			if !ok {
+				break
+			}
+			result.Results = append(result.Results, table)
+		}
+		if len(result.Results) < len(comparer.Comparers()) {
+			remaining = append(remaining, config)
+			continue
+		}
+		restored = append(restored, result)
+		for _, table := range result.Results {
+			s.Tables = append(s.Tables, table)
+			s.done[keyOf(table)] = true
+		}
+	}
+	return remaining, restored
+}
+
+// track sends the restored results, then those of the stream, recording
+// each in the state as it comes.
+func (s *runState) track(restored []dbdiff.MultiResult, stream <-chan dbdiff.MultiResult) <-chan dbdiff.MultiResult {
+	results := make(chan dbdiff.MultiResult, len(restored)+cap(stream))
+	for _, result := range restored {
+		results <- result
+	}
+	go func() {
+		for result := range stream {
+			for _, table := range result.Results {
+				s.record(table)
+			}
+			results <- result
+		}
+		close(results)
+	}()
+	return results
+}
+
+// record keeps a table's result once it's compared without an error, and
+// drops its checkpoint.
+func (s *runState) record(table dbdiff.TableResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if table.Err != nil || s.done[keyOf(table)] {
+		return
+	}
+	s.done[keyOf(table)] = true
+	s.Tables = append(s.Tables, table)
+	delete(s.Checkpoints, tableKey(table.Source, table.Dest, table.Name))
+	s.changed()
+}
+
+func (s *runState) Checkpoint(source, dest, table string) *dbdiff.RowsCheckpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved, ok := s.Checkpoints[tableKey(source, dest, table)]
+	if !ok {
+		return nil
+	}
+	checkpoint := saved.RowsCheckpoint
+	for _, value := range saved.Next {
+		next, err := value.decode()
+		if err != nil {
+			logger.Errorw("Couldn't read the checkpoint, comparing the table from the start", "table", table, "error", err)
+			return nil
+		}
+		checkpoint.Next = append(checkpoint.Next, next)
+	}
+	return &checkpoint
+}
+
+func (s *runState) SaveCheckpoint(source, dest, table string, checkpoint dbdiff.RowsCheckpoint) {
+	saved := stateCheckpoint{RowsCheckpoint: checkpoint}
+	for _, value := range checkpoint.Next {
+		saved.Next = append(saved.Next, encodeStateValue(value))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Checkpoints[tableKey(source, dest, table)] = saved
+	s.changed()
+}
+
+func tableKey(source, dest, table string) string {
+	return source + "/" + dest + "/" + table
+}
+
+// changed writes the state unless it was written less than stateInterval
+// ago, leaving it to the next change or flush.
+func (s *runState) changed() {
+	s.dirty = true
+	if time.Since(s.saved) < stateInterval {
+		return
+	}
+	if err := s.write(); err != nil {
+		logger.Errorw("Couldn't save the state", "state", s.path, "error", err)
+	}
+}
+
+// flush writes the state if it changed since it was last written.
+func (s *runState) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	return s.write()
+}
+
+// write replaces the state file through a temporary file, so that a crash
+// while writing leaves the previous state.
+func (s *runState) write() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.saved, s.dirty = time.Now(), false
+	return nil
+}
+
+// finish removes the state once every table was compared, there being
+// nothing left to resume, and otherwise writes it for --resume to compare
+// the rest.
+func (s *runState) finish(tableDiffs []dbdiff.TableResult) error {
+	for _, table := range tableDiffs {
+		if table.Err != nil {
+			return s.flush()
+		}
+	}
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// encodeStateValue writes a key value with its type, which JSON alone
+// loses, e.g. telling integers from floats and bytes from text.
+func encodeStateValue(value interface{}) stateValue {
+	switch v := value.(type) {
+	case nil:
+		return stateValue{Type: "null"}
+	case int64:
+		return stateValue{Type: "int", Value: strconv.FormatInt(v, 10)}
+	case float64:
+		return stateValue{Type: "float", Value: strconv.FormatFloat(v, 'g', -1, 64)}
+	case []byte:
+		return stateValue{Type: "bytes", Value: base64.StdEncoding.EncodeToString(v)}
+	case time.Time:
+		return stateValue{Type: "time", Value: v.Format(time.RFC3339Nano)}
+	case string:
+		return stateValue{Type: "text", Value: v}
+	}
+	return stateValue{Type: "text", Value: fmt.Sprint(value)}
+}
+
+func (v stateValue) decode() (interface{}, error) {
+	switch v.Type {
+	case "null":
+		return nil, nil
+	case "int":
+		return strconv.ParseInt(v.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(v.Value, 64)
+	case "bytes":
+		return base64.StdEncoding.DecodeString(v.Value)
+	case "time":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	case "text":
+		return v.Value, nil
+	}
+	return nil, fmt.Errorf("unknown key type %q", v.Type)
+}
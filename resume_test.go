@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+func TestStateValueRoundTrip(t *testing.T) {
+	for _, value := range []interface{}{
+		nil,
+		int64(-42),
+		2.5,
+		[]byte{0xff, 0x00},
+		"c5",
+		time.Date(2024, 1, 2, 3, 4, 5, 600, time.FixedZone("CET", 3600)),
+	} {
+		decoded, err := encodeStateValue(value).decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, ok := value.(time.Time); ok {
+			if got, ok := decoded.(time.Time); !ok || !got.Equal(want) {
+				t.Errorf("%v read back as %v", value, decoded)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(decoded, value) {
+			t.Errorf("%#v read back as %#v", value, decoded)
+		}
+	}
+	if _, err := (stateValue{Type: "uuid"}).decode(); err == nil {
+		t.Error("decoded a value of an unknown type")
+	}
+}
+
+func TestStateResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := openState(path, true, dbdiff.ModeRows, []string{"source", "dest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := dbdiff.TableResult{Name: "users", Source: "source", Dest: "dest", Err: errors.New("timeout")}
+	state.record(dbdiff.TableResult{Name: "orders", Source: "source", Dest: "dest", SourceRowCount: 10, DestRowCount: 9})
+	state.record(failed)
+	state.SaveCheckpoint("source", "dest", "users", dbdiff.RowsCheckpoint{Next: []interface{}{int64(7), "b"}, SourceRows: 6, DestRows: 5})
+	if err := state.finish([]dbdiff.TableResult{failed}); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := openState(path, true, dbdiff.ModeRows, []string{"source", "dest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed.Tables) != 1 || resumed.Tables[0].Name != "orders" || resumed.Tables[0].DestRowCount != 9 {
+		t.Errorf("resumed tables are %+v, want orders", resumed.Tables)
+	}
+	checkpoint := resumed.Checkpoint("source", "dest", "users")
+	if checkpoint == nil || !reflect.DeepEqual(checkpoint.Next, []interface{}{int64(7), "b"}) || checkpoint.SourceRows != 6 {
+		t.Errorf("resumed checkpoint is %+v", checkpoint)
+	}
+	if checkpoint := resumed.Checkpoint("source", "replica", "users"); checkpoint != nil {
+		t.Errorf("resumed %+v for another destination", checkpoint)
+	}
+
+	// comparing the table drops its checkpoint, and finishing every table
+	// the state
+	resumed.record(dbdiff.TableResult{Name: "users", Source: "source", Dest: "dest"})
+	if checkpoint := resumed.Checkpoint("source", "dest", "users"); checkpoint != nil {
+		t.Errorf("kept checkpoint %+v of a compared table", checkpoint)
+	}
+	if err := resumed.finish(resumed.Tables); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("state of a finished run is left, error %v", err)
+	}
+}
+
+func TestStateResumeOtherRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := openState(path, false, dbdiff.ModeRows, []string{"source", "dest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.write(); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		mode      string
+		databases []string
+	}{
+		{dbdiff.ModeCount, []string{"source", "dest"}},
+		{dbdiff.ModeRows, []string{"source", "replica"}},
+	} {
+		if _, err := openState(path, true, test.mode, test.databases); err == nil || !strings.Contains(err.Error(), "not of a") {
+			t.Errorf("resumed a rows comparison of source, dest as a %s comparison of %v, error %v", test.mode, test.databases, err)
+		}
+	}
+	// without --resume the state is started afresh
+	if _, err := openState(path, false, dbdiff.ModeCount, []string{"source", "dest"}); err != nil {
+		t.Error(err)
+	}
+}
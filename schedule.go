@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed cron expression, each field a set of the values it
+// matches as bits.
+type schedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// a restricted day of the month and day of the week match either, as in
+	// cron, rather than both
+	anyDay, anyWeekday bool
+}
+
+// scheduleMacros are the cron shorthands.
+var scheduleMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseSchedule parses a cron expression of five fields, minute, hour, day of
+// the month, month and day of the week, each a *, a value, a range such as
+// 1-5 or a list of them, any of which may have a /step. Months and days of
+// the week may be named, and both 0 and 7 are Sunday. The macros such as
+// @daily are accepted too.
+func parseSchedule(expr string) (*schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := scheduleMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: want 5 fields, minute hour day month weekday, got %d", expr, len(fields))
+	}
+	s := &schedule{anyDay: strings.HasPrefix(fields[2], "*"), anyWeekday: strings.HasPrefix(fields[4], "*")}
+	var err error
+	for _, field := range []struct {
+		bits     *uint64
+		spec     string
+		min, max int
+		names    []string
+		nameBase int
+	}{
+		{&s.minutes, fields[0], 0, 59, nil, 0},
+		{&s.hours, fields[1], 0, 23, nil, 0},
+		{&s.days, fields[2], 1, 31, nil, 0},
+		{&s.months, fields[3], 1, 12, monthNames, 1},
+		{&s.weekdays, fields[4], 0, 7, weekdayNames, 0},
+	} {
+		if *field.bits, err = parseScheduleField(field.spec, field.min, field.max, field.names, field.nameBase); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", expr, err)
+		}
+	}
+	// 7 is Sunday too
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	if s.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never matches", expr)
+	}
+	return s, nil
+}
+
+func parseScheduleField(spec string, min, max int, names []string, nameBase int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(spec, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			step, part = n, part[:i]
+		}
+		low, high := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if low, err = scheduleValue(bounds[0], names, nameBase); err != nil {
+				return 0, err
+			}
+			if high, err = scheduleValue(bounds[1], names, nameBase); err != nil {
+				return 0, err
+			}
+		default:
+			value, err := scheduleValue(part, names, nameBase)
+			if err != nil {
+				return 0, err
+			}
+			low = value
+			// 5/15 runs from 5 on
+			if step == 1 {
+				high = value
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+func scheduleValue(value string, names []string, nameBase int) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(value, name) {
+			return i + nameBase, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", value)
+	}
+	return n, nil
+}
+
+// next returns the first time the schedule matches after t, to the minute,
+// in t's location.
+func (s *schedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// an impossible day such as February 30 never matches; give up after
+	// five years rather than loop forever
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *schedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
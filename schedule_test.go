@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// a Wednesday
+	from := time.Date(2024, 1, 10, 10, 30, 20, 0, time.UTC)
+	for _, test := range []struct {
+		expr string
+		want []string
+	}{
+		{"* * * * *", []string{"2024-01-10 10:31", "2024-01-10 10:32"}},
+		{"*/15 * * * *", []string{"2024-01-10 10:45", "2024-01-10 11:00", "2024-01-10 11:15"}},
+		{"5/20 * * * *", []string{"2024-01-10 10:45", "2024-01-10 11:05", "2024-01-10 11:25"}},
+		{"0,30 9-10 * * *", []string{"2024-01-11 09:00", "2024-01-11 09:30", "2024-01-11 10:00", "2024-01-11 10:30", "2024-01-12 09:00"}},
+		{"0 2 * * mon-fri", []string{"2024-01-11 02:00", "2024-01-12 02:00", "2024-01-15 02:00"}},
+		{"0 0 * * 7", []string{"2024-01-14 00:00", "2024-01-21 00:00"}},
+		{"0 0 * * SUN", []string{"2024-01-14 00:00", "2024-01-21 00:00"}},
+		{"0 12 1 jan,jul *", []string{"2024-07-01 12:00", "2025-01-01 12:00"}},
+		// a restricted day of the month and of the week match either
+		{"0 0 13 * fri", []string{"2024-01-12 00:00", "2024-01-13 00:00", "2024-01-19 00:00"}},
+		{"0 0 29 2 *", []string{"2024-02-29 00:00", "2028-02-29 00:00"}},
+		{"@daily", []string{"2024-01-11 00:00", "2024-01-12 00:00"}},
+		{"@HOURLY", []string{"2024-01-10 11:00", "2024-01-10 12:00"}},
+		{" @weekly ", []string{"2024-01-14 00:00"}},
+		{"@monthly", []string{"2024-02-01 00:00", "2024-03-01 00:00"}},
+		{"@yearly", []string{"2025-01-01 00:00"}},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			s, err := parseSchedule(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at := from
+			for _, want := range test.want {
+				at = s.next(at)
+				if got := at.Format("2006-01-02 15:04"); got != want {
+					t.Fatalf("next run is %s, want %s", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, test := range []struct {
+		expr, err string
+	}{
+		{"", "want 5 fields"},
+		{"* * * *", "want 5 fields"},
+		{"* * * * * *", "want 5 fields"},
+		{"@fortnightly", "want 5 fields"},
+		{"60 * * * *", `"60" is outside 0-59`},
+		{"* 24 * * *", `"24" is outside 0-23`},
+		{"* * 0 * *", `"0" is outside 1-31`},
+		{"* * * 13 *", `"13" is outside 1-12`},
+		{"* * * * 8", `"8" is outside 0-7`},
+		{"5-1 * * * *", `"5-1" is outside 0-59`},
+		{"*/0 * * * *", `bad step in "*/0"`},
+		{"*/x * * * *", `bad step in "*/x"`},
+		{"x * * * *", `bad value "x"`},
+		{"* * * smarch *", `bad value "smarch"`},
+		{"0 0 31 feb *", "never matches"},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			_, err := parseSchedule(test.expr)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestScheduleNextKeepsLocation(t *testing.T) {
+	location := time.FixedZone("UTC+2", 2*60*60)
+	s, err := parseSchedule("0 3 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := s.next(time.Date(2024, 1, 10, 3, 0, 0, 0, location))
+	if want := time.Date(2024, 1, 11, 3, 0, 0, 0, location); !next.Equal(want) || next.Location() != location {
+		t.Errorf("next run is %s, want %s", next, want)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// secretTimeout bounds fetching each secret.
+const secretTimeout = 30 * time.Second
+
+// secretEnv reads an environment variable, resolving it if it's a secret://
+// reference:
+//
+//	secret://aws/prod/databasediff#dsn           AWS Secrets Manager
+//	secret://vault/secret/data/databasediff#dsn  HashiCorp Vault
+//
+// The fragment picks a field of the secret. Without it, an AWS secret is
+// used whole, and a Vault secret has to have a single field.
+func secretEnv(name string) (string, error) {
+	value := os.Getenv(name)
+	if !strings.HasPrefix(value, "secret://") {
+		return value, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	resolved, err := resolveSecret(ctx, value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return resolved, nil
+}
+
+// mustSecretEnv is secretEnv exiting on failure.
+func mustSecretEnv(name string) string {
+	value, err := secretEnv(name)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	return value
+}
+
+func resolveSecret(ctx context.Context, reference string) (string, error) {
+	u, err := url.Parse(reference)
+	if err != nil {
+		return "", err
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	if path == "" {
+		return "", fmt.Errorf("secret reference %s names no secret", reference)
+	}
+	switch u.Host {
+	case "aws":
+		secret, err := awsSecret(ctx, path)
+		if err != nil {
+			return "", err
+		}
+		if u.Fragment == "" {
+			return secret, nil
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+			return "", fmt.Errorf("secret %s isn't a JSON object, so it has no field %q", path, u.Fragment)
+		}
+		return secretField(path, fields, u.Fragment)
+	case "vault":
+		fields, err := vaultSecret(ctx, path)
+		if err != nil {
+			return "", err
+		}
+		if u.Fragment == "" && len(fields) == 1 {
+			for field := range fields {
+				return secretField(path, fields, field)
+			}
+		}
+		if u.Fragment == "" {
+			return "", fmt.Errorf("secret %s has %d fields, pick one with #field", path, len(fields))
+		}
+		return secretField(path, fields, u.Fragment)
+	}
+	return "", fmt.Errorf("unknown secret store %q in %s, expected aws or vault", u.Host, reference)
+}
+
+func secretField(path string, fields map[string]interface{}, field string) (string, error) {
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %q", path, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	// e.g. the port of an RDS secret
+	return fmt.Sprint(value), nil
+}
+
+// awsSecret reads a secret's string from AWS Secrets Manager, by name or ARN,
+// with credentials and region from the AWS SDK's default chain.
+func awsSecret(ctx context.Context, id string) (string, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", fmt.Errorf("AWS config: %w", err)
+	}
+	output, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", err
+	}
+	if output.SecretString == nil {
+		return "", fmt.Errorf("secret %s is binary", id)
+	}
+	return *output.SecretString, nil
+}
+
+// vaultSecret reads a secret's fields from the Vault server at VAULT_ADDR,
+// authenticating with VAULT_TOKEN. Paths of KV version 2 engines include
+// data/, as in secret/data/databasediff.
+func vaultSecret(ctx context.Context, path string) (map[string]interface{}, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault: reading %s returned %s", path, resp.Status)
+	}
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	// KV version 2 nests the fields next to their metadata
+	if data, ok := body.Data["data"].(map[string]interface{}); ok {
+		if _, ok := body.Data["metadata"]; ok {
+			return data, nil
+		}
+	}
+	return body.Data, nil
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// maxServedRuns is how many runs the server keeps the results of, dropping
+// the oldest.
+const maxServedRuns = 50
+
+// comparison runs the configured comparison once, of only the named tables
+// unless there are none, passing every table's result to progress as it's
+// compared, and returns the results along with the tables over their
+// threshold.
+type comparison func(ctx context.Context, only []string, progress func(dbdiff.TableResult)) (tableDiffs []dbdiff.TableResult, checks []dbdiff.CheckResult, exceeded []dbdiff.TableResult, err error)
+
+// server is the serve subcommand's REST and gRPC APIs, running the
+// configured comparison on request, one at a time, and keeping the results
+// of the recent runs.
+type server struct {
+	compare comparison
+	mode    string
+	// tables are the names of the configured tables, which runs can be
+	// limited to
+	tables map[string]bool
+	// ctx outlives the requests that start runs
+	ctx context.Context
+	// token is the bearer token requests must carry, unless it's empty
+	token string
+
+	mu     sync.Mutex
+	runs   []*servedRun
+	nextID int
+}
+
+// servedRun is a run's state and results as the API returns them. Until
+// the run finishes, tables' over_threshold isn't known and stays false.
+type servedRun struct {
+	ID       int                 `json:"id"`
+	State    string              `json:"state"`
+	Mode     string              `json:"mode"`
+	Started  time.Time           `json:"started"`
+	Finished *time.Time          `json:"finished,omitempty"`
+	Tables   []notificationTable `json:"tables,omitempty"`
+	Checks   []servedCheck       `json:"checks,omitempty"`
+	Exceeded int                 `json:"exceeded"`
+	Failed   int                 `json:"failed"`
+	// Error is why the run couldn't start, such as the replica failing to
+	// report its position.
+	Error string `json:"error,omitempty"`
+
+	// changed is closed and replaced whenever the run progresses, waking
+	// the clients streaming it
+	changed chan struct{}
+}
+
+type servedCheck struct {
+	Name         string `json:"name"`
+	Source       string `json:"source"`
+	Dest         string `json:"dest"`
+	Passed       bool   `json:"passed"`
+	OnlyInSource int    `json:"only_in_source"`
+	OnlyInDest   int    `json:"only_in_dest"`
+	Error        string `json:"error,omitempty"`
+}
+
+const (
+	runRunning  = "running"
+	runFinished = "finished"
+	runFailed   = "failed"
+)
+
+// serve answers the REST API on the address, and the gRPC service defined
+// in pkg/api on grpcAddr if set, until the context is done:
+//
+//	POST /runs               start a comparison, unless one is running
+//	GET  /runs               every kept run, without its results
+//	GET  /runs/latest        the latest finished run
+//	GET  /runs/previous      the finished run before it
+//	GET  /runs/{id}          a run, finished or not
+//	GET  /runs/{id}/events   a run's table results as server-sent events
+//
+// With a token, both answer only requests carrying it as a bearer token.
+func serve(ctx context.Context, addr, grpcAddr, token, mode string, tables []dbdiff.TableConfig, compare comparison) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("serve: %w", err)
+	}
+	s := &server{compare: compare, mode: mode, tables: map[string]bool{}, ctx: ctx, token: token}
+	for _, table := range tables {
+		s.tables[table.Name] = true
+	}
+	if token == "" && !loopback(listener.Addr()) {
+		logger.Warnw("Serving the API without SERVE_TOKEN on an address other machines can reach", "address", listener.Addr().String())
+	}
+	if grpcAddr != "" {
+		if err := s.serveGRPC(ctx, grpcAddr); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	httpServer := &http.Server{Handler: s.handler()}
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+	logger.Infow("Serving the API", "url", fmt.Sprintf("http://%s/runs", listener.Addr()))
+	if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("serve: %w", err)
+	}
+	return nil
+}
+
+// handler routes the REST API, turning away requests without the token.
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/runs", s.handleRuns)
+	mux.HandleFunc("/runs/", s.handleRun)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, apiError{"missing or wrong bearer token"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// authorized tells whether an Authorization header carries the token.
+func (s *server) authorized(header string) bool {
+	if s.token == "" {
+		return true
+	}
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(header[len(prefix):]), []byte(s.token)) == 1
+}
+
+// loopback tells whether an address only accepts connections from this
+// machine.
+func loopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+func (s *server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		runs := make([]servedRun, len(s.runs))
+		for i, run := range s.runs {
+			runs[i] = *run
+			runs[i].Tables, runs[i].Checks = nil, nil
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, runs)
+	case http.MethodPost:
+		// the body is optional, naming the tables to compare
+		var request struct {
+			Tables []string `json:"tables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			writeJSON(w, http.StatusBadRequest, apiError{err.Error()})
+			return
+		}
+		if err := s.checkTables(request.Tables); err != nil {
+			writeJSON(w, http.StatusBadRequest, apiError{err.Error()})
+			return
+		}
+		run, ok := s.start(request.Tables)
+		if !ok {
+			writeJSON(w, http.StatusConflict, apiError{fmt.Sprintf("run %d is still running", run.ID)})
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/runs/%d", run.ID))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		writeJSON(w, http.StatusAccepted, run)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{"use GET or POST"})
+	}
+}
+
+func (s *server) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSON(w, http.StatusMethodNotAllowed, apiError{"use GET"})
+		return
+	}
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/runs/"), "/")
+	if len(path) > 2 || (len(path) == 2 && path[1] != "events") {
+		writeJSON(w, http.StatusNotFound, apiError{"no such endpoint"})
+		return
+	}
+	run := s.find(path[0])
+	if run == nil {
+		writeJSON(w, http.StatusNotFound, apiError{"no such run"})
+		return
+	}
+	if len(path) == 2 {
+		s.streamEvents(w, r, run)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, run)
+}
+
+// find returns the run with the ID, or the latest or previous finished run.
+func (s *server) find(id string) *servedRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch id {
+	case "latest", "previous":
+		skip := 0
+		if id == "previous" {
+			skip = 1
+		}
+		for i := len(s.runs) - 1; i >= 0; i-- {
+			if s.runs[i].State != runFinished {
+				continue
+			}
+			if skip == 0 {
+				return s.runs[i]
+			}
+			skip--
+		}
+		return nil
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil
+	}
+	for _, run := range s.runs {
+		if run.ID == n {
+			return run
+		}
+	}
+	return nil
+}
+
+// checkTables returns an error naming the first table that isn't
+// configured.
+func (s *server) checkTables(only []string) error {
+	for _, name := range only {
+		if !s.tables[name] {
+			return fmt.Errorf("%s isn't one of the configured tables", name)
+		}
+	}
+	return nil
+}
+
+// start begins a run of the tables in the background, or returns the one
+// running and false.
+func (s *server) start(only []string) (*servedRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.runs); n > 0 && s.runs[n-1].State == runRunning {
+		return s.runs[n-1], false
+	}
+	s.nextID++
+	run := &servedRun{ID: s.nextID, State: runRunning, Mode: s.mode, Started: time.Now(), Tables: []notificationTable{}, changed: make(chan struct{})}
+	s.runs = append(s.runs, run)
+	if len(s.runs) > maxServedRuns {
+		s.runs = s.runs[1:]
+	}
+	go s.execute(run, only)
+	return run, true
+}
+
+func (s *server) execute(run *servedRun, only []string) {
+	logger.Infow("Run started", "run", run.ID)
+	tableDiffs, checks, exceeded, err := s.compare(s.ctx, only, func(table dbdiff.TableResult) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		run.Tables = append(run.Tables, newNotificationTable(table, s.mode, false))
+		s.progressed(run)
+	})
+	if err != nil {
+		logger.Errorw("Run failed", "run", run.ID, "error", err)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		finished := time.Now()
+		run.Finished, run.State, run.Error = &finished, runFailed, err.Error()
+		s.progressed(run)
+		return
+	}
+
+	over := make(map[resultKey]bool, len(exceeded))
+	for _, table := range exceeded {
+		over[keyOf(table)] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.Tables = make([]notificationTable, 0, len(tableDiffs))
+	for _, table := range tableDiffs {
+		run.Tables = append(run.Tables, newNotificationTable(table, s.mode, over[keyOf(table)]))
+		if table.Err != nil {
+			run.Failed++
+		}
+	}
+	for _, check := range checks {
+		served := servedCheck{Name: check.Name, Source: check.Source, Dest: check.Dest, Passed: check.Passed(), OnlyInSource: len(check.OnlyInSource), OnlyInDest: len(check.OnlyInDest)}
+		if check.Err != nil {
+			served.Error = check.Err.Error()
+		}
+		run.Checks = append(run.Checks, served)
+	}
+	run.Exceeded = len(exceeded)
+	finished := time.Now()
+	run.Finished = &finished
+	run.State = runFinished
+	s.progressed(run)
+	logger.Infow("Run finished", "run", run.ID, "tables", len(tableDiffs), "exceeded", run.Exceeded, "failed", run.Failed)
+}
+
+// progressed wakes the clients streaming the run. s.mu must be held.
+func (s *server) progressed(run *servedRun) {
+	close(run.changed)
+	run.changed = make(chan struct{})
+}
+
+// follow passes the tables compared in the run so far to send, then those
+// compared since whenever there are more, until the run ends or the context
+// is done. It returns the ended run.
+func (s *server) follow(ctx context.Context, run *servedRun, send func([]notificationTable) error) (servedRun, error) {
+	sent := 0
+	for {
+		s.mu.Lock()
+		tables := run.Tables[sent:]
+		ended, changed := *run, run.changed
+		sent += len(tables)
+		s.mu.Unlock()
+
+		// the run's tables are only ever appended to, or replaced as a whole
+		if len(tables) > 0 {
+			if err := send(tables); err != nil {
+				return ended, err
+			}
+		}
+		if ended.State != runRunning {
+			return ended, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ended, ctx.Err()
+		}
+	}
+}
+
+// streamEvents sends a table event for every table compared so far and as
+// they are, followed by a finished or failed event with the whole run.
+func (s *server) streamEvents(w http.ResponseWriter, r *http.Request, run *servedRun) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, apiError{"streaming isn't supported"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	ended, err := s.follow(r.Context(), run, func(tables []notificationTable) error {
+		for _, table := range tables {
+			data, err := json.Marshal(table)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: table\ndata: %s\n\n", data); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(ended)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ended.State, data)
+	flusher.Flush()
+}
+
+// apiError is the body of a failed request.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Debugw("Couldn't write the response", "error", err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// gatedComparison is a comparison that reports its table and then waits for
+// release, so tests can act while a run is in progress.
+type gatedComparison struct {
+	release chan struct{}
+	err     error
+	// only are the tables of the latest run
+	only chan []string
+}
+
+func newGatedComparison(err error) *gatedComparison {
+	return &gatedComparison{release: make(chan struct{}), err: err, only: make(chan []string, 10)}
+}
+
+func (g *gatedComparison) compare(ctx context.Context, only []string, progress func(dbdiff.TableResult)) ([]dbdiff.TableResult, []dbdiff.CheckResult, []dbdiff.TableResult, error) {
+	g.only <- only
+	table := dbdiff.TableResult{Name: "orders", Source: "source", Dest: "dest", SourceRowCount: 10, DestRowCount: 9}
+	progress(table)
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		return nil, nil, nil, ctx.Err()
+	}
+	if g.err != nil {
+		return nil, nil, nil, g.err
+	}
+	return []dbdiff.TableResult{table}, nil, []dbdiff.TableResult{table}, nil
+}
+
+func newTestServer(ctx context.Context, compare comparison) *server {
+	return &server{compare: compare, mode: dbdiff.ModeCount, tables: map[string]bool{"orders": true, "users": true}, ctx: ctx}
+}
+
+func request(t *testing.T, s *server, method, path string) (int, servedRun) {
+	t.Helper()
+	return requestWithBody(t, s, method, path, "")
+}
+
+func requestWithBody(t *testing.T, s *server, method, path, body string) (int, servedRun) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if s.token != "" {
+		r.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	s.handler().ServeHTTP(recorder, r)
+	var run servedRun
+	if recorder.Code < 400 {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &run); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return recorder.Code, run
+}
+
+// waitFor polls the run until it leaves the running state.
+func waitFor(t *testing.T, s *server, id string) servedRun {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, run := request(t, s, http.MethodGet, "/runs/"+id); run.State != runRunning {
+			return run
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("run %s is still running", id)
+	return servedRun{}
+}
+
+func TestServeOneRunAtATime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gated := newGatedComparison(nil)
+	s := newTestServer(ctx, gated.compare)
+
+	if code, run := request(t, s, http.MethodPost, "/runs"); code != http.StatusAccepted || run.ID != 1 {
+		t.Fatalf("first run answered %d with %+v", code, run)
+	}
+	if code, _ := request(t, s, http.MethodPost, "/runs"); code != http.StatusConflict {
+		t.Errorf("second run while the first is running answered %d, want %d", code, http.StatusConflict)
+	}
+	if code, _ := request(t, s, http.MethodGet, "/runs/latest"); code != http.StatusNotFound {
+		t.Errorf("latest run before any finished answered %d, want %d", code, http.StatusNotFound)
+	}
+
+	close(gated.release)
+	run := waitFor(t, s, "1")
+	if run.State != runFinished || run.Exceeded != 1 || len(run.Tables) != 1 || !run.Tables[0].OverThreshold {
+		t.Errorf("finished run is %+v", run)
+	}
+	if code, run := request(t, s, http.MethodPost, "/runs"); code != http.StatusAccepted || run.ID != 2 {
+		t.Errorf("run after the first finished answered %d with %+v", code, run)
+	}
+	if code, run := request(t, s, http.MethodGet, "/runs/latest"); code != http.StatusOK || run.ID != 1 {
+		t.Errorf("latest run answered %d with %+v, want run 1", code, run)
+	}
+}
+
+func TestServeFailedRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gated := newGatedComparison(errors.New("replica unreachable"))
+	close(gated.release)
+	s := newTestServer(ctx, gated.compare)
+
+	request(t, s, http.MethodPost, "/runs")
+	if run := waitFor(t, s, "1"); run.State != runFailed || run.Error != "replica unreachable" {
+		t.Errorf("failed run is %+v", run)
+	}
+	// a failed run doesn't hold up the next one
+	if code, run := request(t, s, http.MethodPost, "/runs"); code != http.StatusAccepted || run.ID != 2 {
+		t.Errorf("run after a failed one answered %d with %+v", code, run)
+	}
+}
+
+func TestServeTables(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gated := newGatedComparison(nil)
+	close(gated.release)
+	s := newTestServer(ctx, gated.compare)
+
+	for _, body := range []string{`{"tables": ["audit"]}`, `{"tables": `} {
+		if code, _ := requestWithBody(t, s, http.MethodPost, "/runs", body); code != http.StatusBadRequest {
+			t.Errorf("POST %s answered %d, want %d", body, code, http.StatusBadRequest)
+		}
+	}
+	if code, _ := requestWithBody(t, s, http.MethodPost, "/runs", `{"tables": ["users"]}`); code != http.StatusAccepted {
+		t.Fatalf("run of users answered %d", code)
+	}
+	if only := <-gated.only; len(only) != 1 || only[0] != "users" {
+		t.Errorf("ran %v, want users", only)
+	}
+	waitFor(t, s, "1")
+	if code, _ := request(t, s, http.MethodPost, "/runs"); code != http.StatusAccepted {
+		t.Fatalf("run of every table answered %d", code)
+	}
+	if only := <-gated.only; len(only) != 0 {
+		t.Errorf("ran %v, want every table", only)
+	}
+}
+
+func TestServeNotFound(t *testing.T) {
+	s := newTestServer(context.Background(), nil)
+	for _, path := range []string{"/runs/7", "/runs/latest", "/runs/1/tables", "/runs/x"} {
+		if code, _ := request(t, s, http.MethodGet, path); code != http.StatusNotFound {
+			t.Errorf("GET %s answered %d, want %d", path, code, http.StatusNotFound)
+		}
+	}
+	if code, _ := request(t, s, http.MethodDelete, "/runs"); code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /runs answered %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestServeToken(t *testing.T) {
+	s := newTestServer(context.Background(), nil)
+	s.token = "s3cret"
+	for _, test := range []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusOK},
+		{"bearer s3cret", http.StatusOK},
+	} {
+		recorder := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/runs", nil)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+		s.handler().ServeHTTP(recorder, r)
+		if recorder.Code != test.want {
+			t.Errorf("GET /runs with Authorization %q answered %d, want %d", test.header, recorder.Code, test.want)
+		}
+	}
+}
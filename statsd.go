@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// maxStatsDPacket keeps datagrams within a typical network's MTU, as the
+// StatsD clients do.
+const maxStatsDPacket = 1432
+
+// statsd pushes every run's gauges and durations to a StatsD or DogStatsD
+// server over UDP, for those not scraping the Prometheus metrics. Metrics
+// carry DogStatsD tags, which the Datadog agent and Telegraf understand.
+type statsd struct {
+	conn   net.Conn
+	prefix string
+	// tags are added to every metric, such as env:prod
+	tags []string
+}
+
+func newStatsD(addr, prefix string, tags []string) (*statsd, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	return &statsd{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+// record sends the run's metrics: each table's row counts, drift and
+// comparison time tagged with the table, source and dest, then the run's
+// duration and how many tables exceeded their threshold or failed.
+func (s *statsd) record(tableDiffs []dbdiff.TableResult, mode string, exceeded []dbdiff.TableResult, took time.Duration) error {
+	var lines []string
+	failed := 0
+	for _, table := range tableDiffs {
+		if table.Err != nil {
+			failed++
+			continue
+		}
+		tags := s.tagged("table:"+table.Name, "source:"+table.Source, "dest:"+table.Dest)
+		// a gauge's leading minus decrements it, so the drift goes as its
+		// magnitude, and whether the destination holds more rows apart
+		diff, _ := table.Drift(mode)
+		destAhead := 0
+		if diff < 0 {
+			diff, destAhead = -diff, 1
+		}
+		lines = append(lines,
+			s.line("source_rows", table.SourceRowCount, "g", tags),
+			s.line("dest_rows", table.DestRowCount, "g", tags),
+			s.line("diff", diff, "g", tags),
+			s.line("dest_ahead", destAhead, "g", tags),
+			s.line("table_duration", table.Duration.Milliseconds(), "ms", tags),
+		)
+	}
+	tags := s.tagged("mode:" + mode)
+	lines = append(lines,
+		s.line("run_duration", took.Milliseconds(), "ms", tags),
+		s.line("tables_exceeded", len(exceeded), "g", tags),
+		s.line("tables_failed", failed, "g", tags),
+	)
+	return s.send(lines)
+}
+
+func (s *statsd) tagged(tags ...string) string {
+	all := append(append([]string{}, s.tags...), tags...)
+	for i, tag := range all {
+		all[i] = statsdTags.Replace(tag)
+	}
+	return strings.Join(all, ",")
+}
+
+// line formats a metric as name:value|type|#tags.
+func (s *statsd) line(name string, value interface{}, kind, tags string) string {
+	return fmt.Sprintf("%s%s:%v|%s|#%s", s.prefix, name, value, kind, tags)
+}
+
+// statsdTags drops the characters that delimit the parts of a line or its
+// tags from a tag, such as a table name with a comma in it.
+var statsdTags = strings.NewReplacer("|", "_", "\n", "_", "#", "_", ",", "_")
+
+// send writes the lines in as few datagrams as fit them. UDP doesn't tell
+// when nobody is listening, so only a local failure is returned.
+func (s *statsd) send(lines []string) error {
+	var packet strings.Builder
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := s.conn.Write([]byte(packet.String()))
+		packet.Reset()
+		return err
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxStatsDPacket {
+			if err := flush(); err != nil {
+				return fmt.Errorf("statsd: %w", err)
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("statsd: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+func TestStatsDRecord(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	pushed, err := newStatsD(listener.LocalAddr().String(), "databasediff.", []string{"env:test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := []dbdiff.TableResult{
+		{Name: "orders", Source: "src", Dest: "dest", SourceRowCount: 100, DestRowCount: 98},
+		{Name: "users", Source: "src", Dest: "dest", SourceRowCount: 98, DestRowCount: 100},
+	}
+	if err := pushed.record(tables, dbdiff.ModeCount, nil, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	packet := make([]byte, maxStatsDPacket)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := listener.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(packet[:n]), "\n")
+	for _, want := range []string{
+		"databasediff.diff:2|g|#env:test,table:orders,source:src,dest:dest",
+		"databasediff.dest_ahead:0|g|#env:test,table:orders,source:src,dest:dest",
+		// more rows on the destination isn't sent as a decrement
+		"databasediff.diff:2|g|#env:test,table:users,source:src,dest:dest",
+		"databasediff.dest_ahead:1|g|#env:test,table:users,source:src,dest:dest",
+		"databasediff.tables_failed:0|g|#env:test,mode:count",
+	} {
+		found := false
+		for _, line := range lines {
+			found = found || line == want
+		}
+		if !found {
+			t.Errorf("sent %q, want a line %s", lines, want)
+		}
+	}
+	for _, line := range lines {
+		if strings.Contains(line, ":-") {
+			t.Errorf("sent the decrement %s", line)
+		}
+	}
+}
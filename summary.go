@@ -0,0 +1,161 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// slowestTables is how many of the slowest tables the run's summary names.
+const slowestTables = 5
+
+// reportTotals add up the tables a report lists into the run's summary: how
+// many matched, drifted and failed, the rows counted on every database and
+// which tables took longest.
+type reportTotals struct {
+	started time.Time
+	// tables are the tables by name, each with the results of every pair
+	// of databases, as several destinations have a result each
+	tables map[string]*tableTotal
+	order  []string
+	// databases are the databases in the order they were first seen
+	databases []string
+	// rows are every database's row counts by table, each table counted
+	// once however many of the pairs it was compared in
+	rows map[string]map[string]int
+}
+
+type tableTotal struct {
+	drifting, failed bool
+	duration         time.Duration
+}
+
+func newReportTotals() reportTotals {
+	return reportTotals{started: time.Now(), tables: map[string]*tableTotal{}, rows: map[string]map[string]int{}}
+}
+
+// add counts a table's row of the report, standing for the results of
+// every pair with the layout's Results.
+func (r *reportTotals) add(layout reportLayout, tableDiff dbdiff.TableResult) {
+	total, ok := r.tables[tableDiff.Name]
+	if !ok {
+		total = &tableTotal{}
+		r.tables[tableDiff.Name] = total
+		r.order = append(r.order, tableDiff.Name)
+	}
+	results := []dbdiff.TableResult{tableDiff}
+	if layout.Run.Results != nil {
+		results = layout.Run.Results(tableDiff)
+	}
+	for _, result := range results {
+		if result.Duration > total.duration {
+			total.duration = result.Duration
+		}
+		if result.Err != nil {
+			total.failed = true
+			continue
+		}
+		if countsRows(layout.Run.Mode) {
+			r.count(result.Source, result.Name, result.SourceRowCount)
+			r.count(result.Dest, result.Name, result.DestRowCount)
+		}
+	}
+	if tableDiff.Err == nil && layout.Run.Drift != nil && layout.Run.Drift(tableDiff) != 0 {
+		total.drifting = true
+	}
+}
+
+func (r *reportTotals) count(database, table string, rows int) {
+	if _, ok := r.rows[database]; !ok {
+		r.rows[database] = map[string]int{}
+		r.databases = append(r.databases, database)
+	}
+	r.rows[database][table] = rows
+}
+
+// countsRows reports whether the mode counts the tables' rows, which the
+// summary then adds up.
+func countsRows(mode string) bool {
+	switch mode {
+	case dbdiff.ModeCount, dbdiff.ModeRows, dbdiff.ModeChecksum, dbdiff.ModeSample, dbdiff.ModeGroups, dbdiff.ModeKeys, dbdiff.ModeMembership, dbdiff.ModeDistinct:
+		return true
+	}
+	return dbdiff.IsStrategy(mode)
+}
+
+// runSummary is the totals as the formats write them.
+type runSummary struct {
+	Tables, Matching, Drifting, Failed int
+	// Rows are the rows counted on each database, in Databases' order
+	Databases []string
+	Rows      []int
+	Duration  time.Duration
+	Slowest   []slowTable
+}
+
+type slowTable struct {
+	Name     string
+	Duration time.Duration
+}
+
+func (r *reportTotals) summary() runSummary {
+	summary := runSummary{Tables: len(r.order), Databases: r.databases, Duration: time.Since(r.started)}
+	for _, name := range r.order {
+		switch total := r.tables[name]; {
+		case total.failed:
+			summary.Failed++
+		case total.drifting:
+			summary.Drifting++
+		default:
+			summary.Matching++
+		}
+		summary.Slowest = append(summary.Slowest, slowTable{name, r.tables[name].duration})
+	}
+	for _, database := range r.databases {
+		rows := 0
+		for _, count := range r.rows[database] {
+			rows += count
+		}
+		summary.Rows = append(summary.Rows, rows)
+	}
+	sort.SliceStable(summary.Slowest, func(i, j int) bool { return summary.Slowest[i].Duration > summary.Slowest[j].Duration })
+	if len(summary.Slowest) > slowestTables {
+		summary.Slowest = summary.Slowest[:slowestTables]
+	}
+	return summary
+}
+
+// section is the summary as the last of the details sections.
+func (r *reportTotals) section() collectedSection {
+	summary := r.summary()
+	section := collectedSection{Title: "Run summary", Headers: []string{"Statistic", "Value"}, Rows: [][]string{
+		{"Tables compared", strconv.Itoa(summary.Tables)},
+		{"Matching", strconv.Itoa(summary.Matching)},
+		{"Drifting", strconv.Itoa(summary.Drifting)},
+		{"Failed", strconv.Itoa(summary.Failed)},
+	}}
+	for i, database := range summary.Databases {
+		section.Rows = append(section.Rows, []string{"Rows on " + database, strconv.Itoa(summary.Rows[i])})
+	}
+	section.Rows = append(section.Rows, []string{"Duration", roundDuration(summary.Duration).String()})
+	var slowest []string
+	for _, table := range summary.Slowest {
+		slowest = append(slowest, table.Name+" ("+roundDuration(table.Duration).String()+")")
+	}
+	if len(slowest) > 0 {
+		section.Rows = append(section.Rows, []string{"Slowest tables", strings.Join(slowest, ", ")})
+	}
+	return section
+}
+
+// roundDuration rounds to the millisecond, but for durations shorter than
+// one, which would round to nothing.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// writeSyncSQL writes the statements that bring the destination in line
+// with the source to a file, grouped by table, to be reviewed before they're
+// applied. Tables that couldn't be compared are left out, as their
+// statements may be incomplete.
+func writeSyncSQL(path string, tableDiffs []dbdiff.TableResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	statements := 0
+	fmt.Fprintf(w, "-- Generated by databasediff at %s\n", time.Now().Format(time.RFC3339))
+	for _, table := range tableDiffs {
+		switch {
+		case table.Err != nil:
+			fmt.Fprintf(w, "\n-- %s on %s: skipped, the comparison failed: %v\n", table.Name, table.Dest, table.Err)
+		case len(table.SyncStatements) > 0:
+			fmt.Fprintf(w, "\n-- %s on %s: only in %s %d, only in %s %d, mismatched %d\n",
+				table.Name, table.Dest, table.Source, table.OnlyInSource, table.Dest, table.OnlyInDest, table.Mismatched)
+			for _, statement := range table.SyncStatements {
+				fmt.Fprintln(w, statement)
+			}
+			statements += len(table.SyncStatements)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	logger.Infow("Wrote the sync SQL", "file", path, "statements", statements)
+	return nil
+}
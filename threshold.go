@@ -0,0 +1,85 @@
+package main
+
+import "databasediff/pkg/dbdiff"
+
+// Exit statuses, distinct from the 1 of a fatal log and the 2 of a panic:
+// exitDrift when a table drifts past its threshold, and exitTableErrors when
+// a table couldn't be compared, which takes precedence.
+const (
+	exitDrift       = 3
+	exitTableErrors = 4
+)
+
+// threshold is how much drift a table tolerates, as an absolute number or a
+// percentage. Negative values are unset.
+type threshold struct {
+	MaxDiff    int
+	MaxDiffPct float64
+}
+
+func (t threshold) set() bool {
+	return t.MaxDiff >= 0 || t.MaxDiffPct >= 0
+}
+
+// forTable applies the table's overrides.
+func (t threshold) forTable(table dbdiff.TableConfig) threshold {
+	if table.MaxDiff != nil {
+		t.MaxDiff = *table.MaxDiff
+	}
+	if table.MaxDiffPct != nil {
+		t.MaxDiffPct = *table.MaxDiffPct
+	}
+	return t
+}
+
+// exceeded compares the drift's magnitude, a count's being signed.
+func (t threshold) exceeded(diff, total int) bool {
+	return (t.MaxDiff >= 0 && abs(diff) > t.MaxDiff) ||
+		(t.MaxDiffPct >= 0 && dbdiff.DriftPct(diff, total) > t.MaxDiffPct)
+}
+
+// exceedsThreshold reports whether the table's drift exceeds its threshold,
+// as checkThresholds measures it.
+func exceedsThreshold(table dbdiff.TableResult, mode string, defaults threshold, config dbdiff.Config, accepted *baseline) bool {
+	limit := defaults.forTable(config.Table(table.Name))
+	if !limit.set() && accepted != nil {
+		limit.MaxDiff = 0
+	}
+	if !limit.set() || table.Err != nil {
+		return false
+	}
+	diff, total := table.Drift(mode)
+	deviation, ignored := accepted.deviation(table, diff)
+	return !ignored && limit.exceeded(deviation, total)
+}
+
+// checkThresholds prints the tables whose drift exceeds their threshold and
+// returns their results. With a baseline, only the drift beyond what it
+// accepts counts, and any of it exceeds an unset threshold.
+func checkThresholds(tableDiffs []dbdiff.TableResult, mode string, defaults threshold, config dbdiff.Config, accepted *baseline) []dbdiff.TableResult {
+	var exceeded []dbdiff.TableResult
+	for _, table := range tableDiffs {
+		if exceedsThreshold(table, mode, defaults, config, accepted) {
+			diff, total := table.Drift(mode)
+			deviation, _ := accepted.deviation(table, diff)
+			if accepted != nil {
+				logger.Warnw("Drift deviates from the baseline", "table", table.Name, "source", table.Source, "dest", table.Dest, "diff", diff, "deviation", deviation, "total", total, "pct", dbdiff.DriftPct(deviation, total))
+			} else {
+				logger.Warnw("Drift exceeds the threshold", "table", table.Name, "source", table.Source, "dest", table.Dest, "diff", diff, "total", total, "pct", dbdiff.DriftPct(diff, total))
+			}
+			exceeded = append(exceeded, table)
+		}
+	}
+	if len(exceeded) > 0 {
+		logger.Warnw("Tables exceed the drift threshold", "exceeded", len(exceeded))
+	}
+	return exceeded
+}
+
+// abs is the magnitude of a drift, which is signed in count mode.
+func abs(diff int) int {
+	if diff < 0 {
+		return -diff
+	}
+	return diff
+}
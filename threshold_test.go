@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// unset is a threshold the command's defaults leave unset.
+var unset = threshold{MaxDiff: -1, MaxDiffPct: -1}
+
+func counted(name string, source, dest int) dbdiff.TableResult {
+	return dbdiff.TableResult{Name: name, Source: "src", Dest: "dest", SourceRowCount: source, DestRowCount: dest}
+}
+
+func TestThresholdExceeded(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		limit       threshold
+		diff, total int
+		want        bool
+	}{
+		{"unset", unset, 1000, 1000, false},
+		{"no drift", threshold{MaxDiff: 0, MaxDiffPct: -1}, 0, 100, false},
+		{"any drift", threshold{MaxDiff: 0, MaxDiffPct: -1}, 1, 100, true},
+		{"at the limit", threshold{MaxDiff: 5, MaxDiffPct: -1}, 5, 100, false},
+		{"past the limit", threshold{MaxDiff: 5, MaxDiffPct: -1}, 6, 100, true},
+		{"negative at the limit", threshold{MaxDiff: 5, MaxDiffPct: -1}, -5, 100, false},
+		{"negative past the limit", threshold{MaxDiff: 5, MaxDiffPct: -1}, -6, 100, true},
+		{"under the percentage", threshold{MaxDiff: -1, MaxDiffPct: 10}, 9, 100, false},
+		{"past the percentage", threshold{MaxDiff: -1, MaxDiffPct: 10}, -11, 100, true},
+		{"empty tables", threshold{MaxDiff: -1, MaxDiffPct: 0}, 0, 0, false},
+		{"either", threshold{MaxDiff: 100, MaxDiffPct: 1}, 2, 100, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.limit.exceeded(test.diff, test.total); got != test.want {
+				t.Errorf("%+v exceeded by %d of %d is %t, want %t", test.limit, test.diff, test.total, got, test.want)
+			}
+		})
+	}
+}
+
+func TestThresholdForTable(t *testing.T) {
+	maxDiff, maxDiffPct := 10, 2.5
+	for _, test := range []struct {
+		name  string
+		table dbdiff.TableConfig
+		want  threshold
+	}{
+		{"defaults", dbdiff.TableConfig{Name: "orders"}, threshold{MaxDiff: 0, MaxDiffPct: -1}},
+		{"max diff", dbdiff.TableConfig{Name: "orders", MaxDiff: &maxDiff}, threshold{MaxDiff: 10, MaxDiffPct: -1}},
+		{"both", dbdiff.TableConfig{Name: "orders", MaxDiff: &maxDiff, MaxDiffPct: &maxDiffPct}, threshold{MaxDiff: 10, MaxDiffPct: 2.5}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (threshold{MaxDiff: 0, MaxDiffPct: -1}).forTable(test.table); got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExceedsThreshold(t *testing.T) {
+	maxDiff := 10
+	config := dbdiff.Config{Tables: []dbdiff.TableConfig{{Name: "events", MaxDiff: &maxDiff}}}
+	accepted := &baseline{Tables: []baselineTable{
+		{Table: "orders", Diff: 5},
+		{Table: "orders", Dest: "replica", Diff: -2},
+		{Table: "audit", Ignore: true},
+	}}
+	failed := counted("orders", 100, 0)
+	failed.Err = errors.New("connection refused")
+	onReplica := counted("orders", 100, 102)
+	onReplica.Dest = "replica"
+	rows := dbdiff.TableResult{Name: "users", SourceRowCount: 10, DestRowCount: 10, Mismatched: 1}
+
+	for _, test := range []struct {
+		name     string
+		table    dbdiff.TableResult
+		mode     string
+		defaults threshold
+		accepted *baseline
+		want     bool
+	}{
+		{"unset", counted("orders", 100, 0), dbdiff.ModeCount, unset, nil, false},
+		{"no drift", counted("orders", 100, 100), dbdiff.ModeCount, threshold{0, -1}, nil, false},
+		{"missing rows", counted("orders", 100, 99), dbdiff.ModeCount, threshold{0, -1}, nil, true},
+		{"extra rows", counted("orders", 99, 100), dbdiff.ModeCount, threshold{0, -1}, nil, true},
+		{"table's own threshold", counted("events", 100, 90), dbdiff.ModeCount, threshold{0, -1}, nil, false},
+		{"past the table's own threshold", counted("events", 100, 89), dbdiff.ModeCount, threshold{0, -1}, nil, true},
+		{"failed", failed, dbdiff.ModeCount, threshold{0, -1}, nil, false},
+		{"rows mode", rows, dbdiff.ModeRows, threshold{0, -1}, nil, true},
+		{"rows mode under the percentage", rows, dbdiff.ModeRows, threshold{-1, 10}, nil, false},
+		{"baseline's drift", counted("orders", 100, 95), dbdiff.ModeCount, unset, accepted, false},
+		{"less than the baseline's drift", counted("orders", 100, 96), dbdiff.ModeCount, unset, accepted, true},
+		{"more than the baseline's drift", counted("orders", 100, 94), dbdiff.ModeCount, unset, accepted, true},
+		{"baseline's drift the other way", counted("orders", 95, 100), dbdiff.ModeCount, unset, accepted, true},
+		{"within the threshold of the baseline", counted("orders", 100, 93), dbdiff.ModeCount, threshold{2, -1}, accepted, false},
+		{"baseline's drift for the destination", onReplica, dbdiff.ModeCount, unset, accepted, false},
+		{"table not in the baseline", counted("users", 100, 99), dbdiff.ModeCount, unset, accepted, true},
+		{"ignored", counted("audit", 100, 0), dbdiff.ModeCount, threshold{0, 0}, accepted, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := exceedsThreshold(test.table, test.mode, test.defaults, config, test.accepted); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	tables := []dbdiff.TableResult{counted("orders", 100, 100), counted("users", 100, 98), counted("events", 3, 5)}
+	exceeded := checkThresholds(tables, dbdiff.ModeCount, threshold{MaxDiff: 1, MaxDiffPct: -1}, dbdiff.Config{}, nil)
+	if len(exceeded) != 2 || exceeded[0].Name != "users" || exceeded[1].Name != "events" {
+		t.Errorf("exceeded are %+v, want users and events", exceeded)
+	}
+	if exceeded := checkThresholds(tables, dbdiff.ModeCount, unset, dbdiff.Config{}, nil); len(exceeded) != 0 {
+		t.Errorf("unset thresholds exceeded by %+v", exceeded)
+	}
+}
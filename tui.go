@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// Orders the browser cycles through.
+const (
+	sortArrival = "arrival"
+	sortDiff    = "diff"
+	sortName    = "name"
+)
+
+// browser is the --tui results browser: a full screen list of the tables
+// updated as they're compared, which can be sorted and filtered, and where
+// choosing a table diffs its rows on the spot. It draws on the terminal until
+// quit, with the logs held back until then.
+type browser struct {
+	mode string
+	// rowDiff compares a table's rows, on the databases it was compared on
+	rowDiff func(ctx context.Context, table dbdiff.TableResult) (dbdiff.TableResult, error)
+	ctx     context.Context
+
+	mu       sync.Mutex
+	tables   []dbdiff.TableResult
+	expected int
+	finished bool
+	order    string
+	filter   string
+	// filtering is whether keys are typed into the filter
+	filtering bool
+	cursor    int
+	offset    int
+	// detail is the row diff shown instead of the list, once chosen
+	detail      []string
+	detailTitle string
+	detailOff   int
+	diffing     bool
+	quit        chan struct{}
+	state       *term.State
+	closed      bool
+}
+
+func newBrowser(ctx context.Context, mode string, expected int, rowDiff func(context.Context, dbdiff.TableResult) (dbdiff.TableResult, error)) *browser {
+	return &browser{ctx: ctx, mode: mode, expected: expected, rowDiff: rowDiff, order: sortArrival, quit: make(chan struct{})}
+}
+
+// start takes over the terminal, drawing the browser until it's quit or
+// closed.
+func (b *browser) start() error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("tui: %w", err)
+	}
+	b.state = state
+	// the alternate screen leaves the terminal as it was on quitting
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+
+	keys := make(chan string)
+	go readKeys(keys)
+	go func() {
+		// redraw now and then for resized terminals
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		b.draw()
+		for {
+			select {
+			case key := <-keys:
+				if !b.handle(key) {
+					close(b.quit)
+					return
+				}
+			case <-ticker.C:
+			}
+			b.draw()
+		}
+	}()
+	return nil
+}
+
+// close gives the terminal back as it was, quit or not, such as on a panic.
+func (b *browser) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || b.state == nil {
+		return
+	}
+	b.closed = true
+	fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[?1049l")
+	term.Restore(int(os.Stdin.Fd()), b.state)
+}
+
+// readKeys sends the keys read from stdin, with escape sequences for arrow
+// and paging keys kept together.
+func readKeys(keys chan<- string) {
+	buf := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		for input := string(buf[:n]); input != ""; {
+			key := input[:1]
+			if input[0] == 0x1b && len(input) > 2 && input[1] == '[' {
+				end := strings.IndexAny(input[2:], "ABCD~")
+				if end >= 0 {
+					key = input[:end+3]
+				}
+			}
+			keys <- key
+			input = input[len(key):]
+		}
+	}
+}
+
+// add shows a compared table.
+func (b *browser) add(table dbdiff.TableResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tables = append(b.tables, table)
+}
+
+// done marks the comparison finished.
+func (b *browser) done() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.finished = true
+}
+
+// handle applies a key, and returns false to quit.
+func (b *browser) handle(key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.filtering {
+		switch key {
+		case "\r", "\x1b":
+			b.filtering = false
+		case "\x7f", "\b":
+			if b.filter != "" {
+				b.filter = b.filter[:len(b.filter)-1]
+			}
+		default:
+			if len(key) == 1 && key[0] >= ' ' {
+				b.filter += key
+			}
+		}
+		b.cursor, b.offset = 0, 0
+		return true
+	}
+	if b.detail != nil || b.diffing {
+		switch key {
+		case "q", "\x03":
+			return false
+		case "\x1b", "\x7f", "\b", "h":
+			if !b.diffing {
+				b.detail = nil
+			}
+		case "j", "\x1b[B":
+			b.detailOff++
+		case "k", "\x1b[A":
+			b.detailOff--
+		case "\x1b[6~", " ":
+			b.detailOff += 10
+		case "\x1b[5~":
+			b.detailOff -= 10
+		}
+		if b.detailOff < 0 {
+			b.detailOff = 0
+		}
+		return true
+	}
+	visible := b.visible()
+	switch key {
+	case "q", "\x03":
+		return false
+	case "j", "\x1b[B":
+		b.cursor++
+	case "k", "\x1b[A":
+		b.cursor--
+	case "\x1b[6~", " ":
+		b.cursor += 10
+	case "\x1b[5~":
+		b.cursor -= 10
+	case "s":
+		switch b.order {
+		case sortArrival:
+			b.order = sortDiff
+		case sortDiff:
+			b.order = sortName
+		default:
+			b.order = sortArrival
+		}
+	case "/":
+		b.filtering, b.filter = true, ""
+	case "\r", "l":
+		if b.cursor < len(visible) {
+			b.diff(visible[b.cursor])
+		}
+	}
+	if b.cursor >= len(visible) {
+		b.cursor = len(visible) - 1
+	}
+	if b.cursor < 0 {
+		b.cursor = 0
+	}
+	return true
+}
+
+// diff compares the table's rows in the background and shows them. b.mu
+// must be held.
+func (b *browser) diff(table dbdiff.TableResult) {
+	b.diffing, b.detail, b.detailOff = true, nil, 0
+	b.detailTitle = fmt.Sprintf("Rows of %s between %s and %s", table.Name, table.Source, table.Dest)
+	go func() {
+		result, err := b.rowDiff(b.ctx, table)
+		lines := []string{}
+		switch {
+		case err != nil:
+			lines = append(lines, "Couldn't compare the rows: "+err.Error())
+		case result.Err != nil:
+			lines = append(lines, fmt.Sprintf("Couldn't compare the rows (%s): %v", result.Status(), result.Err))
+		default:
+			lines = rowDiffLines(result)
+		}
+		b.mu.Lock()
+		b.detail, b.diffing = lines, false
+		b.mu.Unlock()
+	}()
+}
+
+// rowDiffLines renders a rows mode result with the sections of its report.
+func rowDiffLines(result dbdiff.TableResult) []string {
+	lines := []string{fmt.Sprintf("%d rows only in %s, %d only in %s, %d mismatched, in %s",
+		result.OnlyInSource, result.Source, result.OnlyInDest, result.Dest, result.Mismatched, result.Duration.Round(time.Millisecond))}
+	for _, section := range rowsLayout(dbdiff.ModeRows, result.Source, result.Dest).Sections {
+		rows := section.Rows(result)
+		if len(rows) == 0 {
+			continue
+		}
+		var text bytes.Buffer
+		w := tabwriter.NewWriter(&text, 1, 1, 2, ' ', 0)
+		// the table is in the title already
+		fmt.Fprintln(w, strings.Join(section.Headers[1:], "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row[1:], "\t"))
+		}
+		w.Flush()
+		lines = append(lines, "", section.Title, "")
+		lines = append(lines, strings.Split(strings.TrimSuffix(text.String(), "\n"), "\n")...)
+	}
+	return lines
+}
+
+// visible returns the tables matching the filter, in order. b.mu must be
+// held.
+func (b *browser) visible() []dbdiff.TableResult {
+	var tables []dbdiff.TableResult
+	for _, table := range b.tables {
+		if b.filter == "" || strings.Contains(strings.ToLower(table.Name), strings.ToLower(b.filter)) {
+			tables = append(tables, table)
+		}
+	}
+	switch b.order {
+	case sortDiff:
+		sort.SliceStable(tables, func(i, j int) bool {
+			a, _ := tables[i].Drift(b.mode)
+			c, _ := tables[j].Drift(b.mode)
+			return abs(a) > abs(c)
+		})
+	case sortName:
+		sort.SliceStable(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	}
+	return tables
+}
+
+func (b *browser) draw() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height < 5 {
+		width, height = 80, 24
+	}
+	var screen []string
+	progress := fmt.Sprintf("%d/%d tables", len(b.tables), b.expected)
+	if b.finished {
+		progress = fmt.Sprintf("%d tables, done", len(b.tables))
+	}
+	screen = append(screen, fmt.Sprintf("\x1b[1mdatabasediff %s\x1b[0m  %s  sorted by %s", b.mode, progress, b.order))
+
+	if b.detail != nil || b.diffing {
+		screen = append(screen, "\x1b[1m"+b.detailTitle+"\x1b[0m", "")
+		lines := b.detail
+		if b.diffing {
+			lines = []string{"Comparing rows..."}
+		}
+		rows := height - len(screen) - 1
+		if b.detailOff > len(lines)-1 {
+			b.detailOff = len(lines) - 1
+		}
+		for i := b.detailOff; i < len(lines) && i-b.detailOff < rows; i++ {
+			screen = append(screen, lines[i])
+		}
+		b.render(screen, width, height, "esc back  j/k scroll  q quit")
+		return
+	}
+
+	visible := b.visible()
+	var header bytes.Buffer
+	w := tabwriter.NewWriter(&header, 1, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "  Table\tSource\tDest\tSource rows\tDest rows\tDrift\tStatus")
+	for i, table := range visible {
+		diff, total := table.Drift(b.mode)
+		marker := "  "
+		if i == b.cursor {
+			marker = "> "
+		}
+		drift := strconv.Itoa(diff)
+		if total > 0 {
+			drift += fmt.Sprintf(" (%.2f%%)", dbdiff.DriftPct(diff, total))
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\t%s\n", marker, table.Name, table.Source, table.Dest,
+			formatCount(table, table.SourceRowCount), formatCount(table, table.DestRowCount), drift, table.Status())
+	}
+	w.Flush()
+	lines := strings.Split(strings.TrimSuffix(header.String(), "\n"), "\n")
+	rows := height - len(screen) - 2
+	// keep the cursor on screen
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+rows {
+		b.offset = b.cursor - rows + 1
+	}
+	screen = append(screen, "\x1b[4m"+lines[0]+"\x1b[0m")
+	for i := b.offset; i < len(visible) && i-b.offset < rows; i++ {
+		line := lines[i+1]
+		if i == b.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		screen = append(screen, line)
+	}
+	help := "j/k move  enter diff rows  s sort  / filter  q quit"
+	if b.filtering || b.filter != "" {
+		help = "filter: " + b.filter
+		if b.filtering {
+			help += "_  (enter to apply)"
+		}
+	}
+	b.render(screen, width, height, help)
+}
+
+// render clears the screen and draws the lines, cut to its width, with the
+// status line at the bottom.
+func (b *browser) render(lines []string, width, height int, status string) {
+	var out strings.Builder
+	out.WriteString("\x1b[H\x1b[2J")
+	for _, line := range lines {
+		out.WriteString(truncateVisible(line, width))
+		out.WriteString("\r\n")
+	}
+	fmt.Fprintf(&out, "\x1b[%d;1H\x1b[2m%s\x1b[0m", height, truncateVisible(status, width))
+	os.Stdout.WriteString(out.String())
+}
+
+// truncateVisible cuts the line to the width in characters, not counting
+// escape sequences.
+func truncateVisible(line string, width int) string {
+	var out strings.Builder
+	visible := 0
+	escape := false
+	for _, r := range line {
+		switch {
+		case r == 0x1b:
+			escape = true
+		case escape:
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				escape = false
+			}
+		default:
+			if visible >= width {
+				continue
+			}
+			visible++
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// wait returns once the browser is quit.
+func (b *browser) wait() {
+	<-b.quit
+}
+
+// browserReportWriter passes every table to the browser on its way to the
+// report.
+type browserReportWriter struct {
+	ReportWriter
+	browser *browser
+}
+
+func (w browserReportWriter) WriteTableResult(tableDiff dbdiff.TableResult) error {
+	w.browser.add(tableDiff)
+	return w.ReportWriter.WriteTableResult(tableDiff)
+}
+
+// pairRowDiff returns a browser's rowDiff, comparing the table's rows on the
+// pair of databases it was compared on, whatever the run's mode.
+func pairRowDiff(comparer *dbdiff.MultiComparer, names []dbdiff.TableConfig) func(context.Context, dbdiff.TableResult) (dbdiff.TableResult, error) {
+	return func(ctx context.Context, table dbdiff.TableResult) (dbdiff.TableResult, error) {
+		config := dbdiff.TableConfig{Name: table.Name}
+		for _, name := range names {
+			if name.Name == table.Name {
+				config = name
+				break
+			}
+		}
+		for _, pair := range comparer.Comparers() {
+			if pair.Source().ServiceName == table.Source && pair.Dest().ServiceName == table.Dest {
+				// the drill-down neither keeps results and checkpoints nor
+				// links the databases through postgres_fdw, which its comparer
+				// isn't closed to remove
+				options := pair.Options
+				options.Mode = dbdiff.ModeRows
+				options.Unchanged, options.Checkpoints, options.FDW = nil, nil, false
+				return dbdiff.New(*pair.Source(), *pair.Dest(), options).CompareTable(ctx, config)
+			}
+		}
+		return dbdiff.TableResult{}, fmt.Errorf("no databases %s and %s", table.Source, table.Dest)
+	}
+}
+
+// heldWriter writes the logs to w, except while the browser is on the
+// terminal, when they're kept until it's released.
+type heldWriter struct {
+	w    io.Writer
+	mu   sync.Mutex
+	held bool
+	buf  bytes.Buffer
+}
+
+func (h *heldWriter) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.held {
+		return h.buf.Write(p)
+	}
+	return h.w.Write(p)
+}
+
+func (h *heldWriter) Sync() error { return nil }
+
+func (h *heldWriter) hold() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.held = true
+}
+
+// release writes the logs kept meanwhile.
+func (h *heldWriter) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.held = false
+	h.w.Write(h.buf.Bytes())
+	h.buf.Reset()
+}
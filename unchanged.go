@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// lastResults are the tables' last results, kept in --skip-unchanged with
+// their activity on both databases, so that the next run skips the tables
+// written to on neither since.
+type lastResults struct {
+	path string
+	mu   sync.Mutex
+
+	Mode   string                `json:"mode"`
+	Tables map[string]lastResult `json:"tables"`
+}
+
+// lastResult is a table's result along with the configuration it was
+// compared with, which has to be the same for the result to stand.
+type lastResult struct {
+	Config dbdiff.TableConfig `json:"config"`
+	Result dbdiff.TableResult `json:"result"`
+}
+
+// openLastResults reads the last results, starting afresh when there are
+// none yet or they're of another mode.
+func openLastResults(path, mode string) (*lastResults, error) {
+	last := &lastResults{path: path, Mode: mode, Tables: map[string]lastResult{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return last, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved lastResults
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if saved.Mode != mode {
+		logger.Infow("The last results are of another mode, comparing every table", "skip_unchanged", path, "mode", saved.Mode)
+		return last, nil
+	}
+	if saved.Tables != nil {
+		last.Tables = saved.Tables
+	}
+	return last, nil
+}
+
+func (l *lastResults) LastResult(source, dest string, config dbdiff.TableConfig) *dbdiff.TableResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last, ok := l.Tables[tableKey(source, dest, config.Name)]
+	if !ok {
+		return nil
+	}
+	// the configurations compare as they're written
+	saved, err := json.Marshal(last.Config)
+	if err != nil {
+		return nil
+	}
+	current, err := json.Marshal(config)
+	if err != nil || string(saved) != string(current) {
+		return nil
+	}
+	result := last.Result
+	return &result
+}
+
+// record keeps the results of the tables whose activity both databases
+// keep track of, dropping those of the others and of the tables that
+// failed, and writes them.
+func (l *lastResults) record(tableDiffs []dbdiff.TableResult, configs []dbdiff.TableConfig) error {
+	byName := make(map[string]dbdiff.TableConfig, len(configs))
+	for _, config := range configs {
+		byName[config.Name] = config
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, table := range tableDiffs {
+		key := tableKey(table.Source, table.Dest, table.Name)
+		config, ok := byName[table.Name]
+		if !ok || table.Err != nil || table.SourceActivity == "" || table.DestActivity == "" {
+			delete(l.Tables, key)
+			continue
+		}
+		// a skipped table's result is the one kept already
+		if !table.Unchanged {
+			l.Tables[key] = lastResult{Config: config, Result: table}
+		}
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// reportContentTypes are the uploaded reports' content types, by format.
+var reportContentTypes = map[string]string{
+	"text":     "text/plain; charset=utf-8",
+	"csv":      "text/csv; charset=utf-8",
+	"markdown": "text/markdown; charset=utf-8",
+	"html":     "text/html; charset=utf-8",
+	"jsonl":    "application/x-ndjson",
+}
+
+// reportExtensions are the uploaded reports' file extensions, by format.
+var reportExtensions = map[string]string{
+	"text":     "txt",
+	"csv":      "csv",
+	"markdown": "md",
+	"html":     "html",
+	"jsonl":    "jsonl",
+}
+
+// uploader writes every run's report to an S3 or GCS bucket, at a key
+// templated with the run's date and anything from the environment, such as
+//
+//	s3://audit/databasediff/{{env "ENVIRONMENT"}}/{{.Date}}/{{.Time}}.{{.Ext}}
+//
+// Credentials come from the SDKs' default chains: the AWS environment
+// variables, shared config or instance role for S3, and Application Default
+// Credentials for GCS.
+type uploader struct {
+	scheme string
+	bucket string
+	key    *template.Template
+}
+
+// uploadKey is what an upload's key is executed with.
+type uploadKey struct {
+	// Date is the run's day, as 2006-01-02, and Time its time of day, as
+	// 150405, both in UTC
+	Date, Time string
+	Mode       string
+	Source     string
+	Dest       string
+	Format     string
+	Ext        string
+}
+
+func newUploader(destination string) (*uploader, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, fmt.Errorf("upload: %w", err)
+	}
+	if u.Scheme != "s3" && u.Scheme != "gs" {
+		return nil, fmt.Errorf("upload: %q isn't an s3:// or gs:// URL", destination)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("upload: %q needs both a bucket and a key", destination)
+	}
+	// the URL is parsed for its bucket only, since the key's template may
+	// hold anything
+	key = strings.SplitN(strings.SplitN(destination, "://", 2)[1], "/", 2)[1]
+	tmpl, err := template.New("key").Funcs(template.FuncMap{"env": os.Getenv}).Option("missingkey=error").Parse(key)
+	if err != nil {
+		return nil, fmt.Errorf("upload: key: %w", err)
+	}
+	// a misspelled field fails now rather than after the first run
+	if err := tmpl.Execute(io.Discard, uploadKey{}); err != nil {
+		return nil, fmt.Errorf("upload: key: %w", err)
+	}
+	return &uploader{scheme: u.Scheme, bucket: u.Host, key: tmpl}, nil
+}
+
+// upload writes the report and returns its URL.
+func (u *uploader) upload(ctx context.Context, report []byte, format, mode, source, dest string, at time.Time) (string, error) {
+	at = at.UTC()
+	var key bytes.Buffer
+	if err := u.key.Execute(&key, uploadKey{
+		Date: at.Format("2006-01-02"), Time: at.Format("150405"),
+		Mode: mode, Source: source, Dest: dest, Format: format, Ext: reportExtensions[format],
+	}); err != nil {
+		return "", fmt.Errorf("upload: key: %w", err)
+	}
+	location := fmt.Sprintf("%s://%s/%s", u.scheme, u.bucket, key.String())
+	contentType := reportContentTypes[format]
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	if u.scheme == "s3" {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return "", fmt.Errorf("AWS config: %w", err)
+		}
+		if _, err := s3.NewFromConfig(cfg).PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(u.bucket), Key: aws.String(key.String()),
+			Body: bytes.NewReader(report), ContentType: aws.String(contentType),
+		}); err != nil {
+			return "", fmt.Errorf("upload to %s: %w", location, err)
+		}
+		return location, nil
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return "", fmt.Errorf("GCS client: %w", err)
+	}
+	defer client.Close()
+	w := client.Bucket(u.bucket).Object(key.String()).NewWriter(ctx)
+	w.ContentType = contentType
+	if _, err := w.Write(report); err != nil {
+		w.Close()
+		return "", fmt.Errorf("upload to %s: %w", location, err)
+	}
+	// the object is only written once closed
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("upload to %s: %w", location, err)
+	}
+	return location, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"databasediff/pkg/dbdiff"
+)
+
+// watchHistory keeps the last two drift measurements of every table across
+// watch rounds, enough to tell whether its drift is growing and whether that
+// growth is speeding up.
+type watchHistory map[resultKey][]int
+
+// record adds a round's results and prints each table's trend once there is
+// a previous round to compare with, as a warning when the drift grows, so
+// --quiet still shows it.
+func (h watchHistory) record(tableDiffs []dbdiff.TableResult, mode string) {
+	for _, table := range tableDiffs {
+		if table.Err != nil {
+			continue
+		}
+		diff, _ := table.Drift(mode)
+		key := keyOf(table)
+		// trends are of the magnitude, a count's drift being signed
+		previous := h[key]
+		h[key] = append(previous, abs(diff))
+		if len(h[key]) > 2 {
+			h[key] = h[key][1:]
+		}
+		if len(previous) == 0 {
+			continue
+		}
+
+		last := previous[len(previous)-1]
+		delta := abs(diff) - last
+		trend := "stable"
+		switch {
+		case delta > 0:
+			trend = fmt.Sprintf("growing by %d", delta)
+		case delta < 0:
+			trend = fmt.Sprintf("shrinking by %d", -delta)
+		}
+		if len(previous) >= 2 {
+			if change := delta - (last - previous[len(previous)-2]); change != 0 {
+				trend += fmt.Sprintf(" (%+d on the previous change)", change)
+			}
+		}
+		log := logger.Infow
+		if delta > 0 {
+			log = logger.Warnw
+		}
+		log("Drift trend", "table", table.Name, "source", table.Source, "dest", table.Dest, "diff", diff, "delta", delta, "trend", trend)
+	}
+}